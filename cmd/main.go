@@ -3,21 +3,27 @@ package main
 import (
 	"context"
 	"crypto/tls"
+	"fmt"
 	"github.com/gofiber/fiber/v3"
 	"github.com/gofiber/fiber/v3/middleware/recover"
 	"github.com/gofiber/fiber/v3/middleware/requestid"
 	"github.com/google/uuid"
-	"github.com/jmoiron/sqlx"
 	httpSwagger "github.com/swaggo/http-swagger"
 	"go.uber.org/zap"
 	"idm/inner/common"
 	"idm/inner/database"
+	"idm/inner/devtoken"
 	"idm/inner/employee"
 	"idm/inner/info"
+	"idm/inner/me"
+	"idm/inner/revocation"
 	"idm/inner/role"
+	"idm/inner/serviceaccount"
 	"idm/inner/validator"
 	"idm/inner/web"
+	"os"
 	"os/signal"
+	"strings"
 	"sync"
 	"syscall"
 	"time"
@@ -33,13 +39,46 @@ func main() {
 	cfg := common.GetConfig(".env")
 	logger := common.NewLogger(cfg)
 	defer func() { _ = logger.Sync() }()
-	db := database.ConnectDbWithCfg(cfg)
-	defer func() {
-		if err := db.Close(); err != nil {
-			logger.Panic("error closing db: %v", zap.Error(err))
+	if len(os.Args) > 1 {
+		if err := runCommand(cfg, os.Args[1:], logger); err != nil {
+			logger.Error("command failed", zap.Error(err))
+			_ = logger.Sync()
+			os.Exit(1)
 		}
-	}()
-	server := build(cfg, db, logger)
+		return
+	}
+	var repos repositories
+	if cfg.DbDriverName == database.MemoryDriver {
+		logger.Warn("data is stored in memory and will be lost on restart")
+		repos = newMemoryRepositories()
+	} else {
+		db, err := database.ConnectDbWithRetry(context.Background(), cfg, logger)
+		if err != nil {
+			logger.Panic("failed database connecting", zap.Error(err))
+		}
+		defer func() {
+			if err := db.Close(); err != nil {
+				logger.Panic("error closing db: %v", zap.Error(err))
+			}
+		}()
+		if cfg.DbAutoMigrate {
+			if err := database.Migrate(context.Background(), db, "up", logger); err != nil {
+				logger.Panic("failed auto migration", zap.Error(err))
+			}
+		}
+		replicas, err := database.ConnectReplicas(cfg)
+		if err != nil {
+			logger.Panic("failed replicas connecting", zap.Error(err))
+		}
+		router := database.NewRouter(db, replicas, logger)
+		defer func() { _ = router.Close() }()
+		healthCtx, stopHealthCheck := context.WithCancel(context.Background())
+		defer stopHealthCheck()
+		router.CheckHealth(healthCtx, cfg.DbReplicaCheckInterval)
+		router.StartHealthCheck(healthCtx, cfg.DbReplicaCheckInterval)
+		repos = newDbRepositories(cfg, router, logger)
+	}
+	server := build(cfg, repos, logger)
 	go func() {
 		// загружаем сертификаты
 		cer, err := tls.LoadX509KeyPair(cfg.SslSert, cfg.SslKey)
@@ -48,6 +87,15 @@ func main() {
 		}
 		// создаём конфигурацию TLS сервера
 		tlsConfig := &tls.Config{Certificates: []tls.Certificate{cer}}
+		if cfg.MtlsEnabled {
+			clientCAs, err := web.LoadCertPool(cfg.MtlsCaFile)
+			if err != nil {
+				logger.Panic("failed client CA loading", zap.Error(err))
+			}
+			// сертификат не обязателен: клиенты без него аутентифицируются токеном
+			tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+			tlsConfig.ClientCAs = clientCAs
+		}
 		// создаём слушателя https соединения
 		ln, err := tls.Listen("tcp", ":8080", tlsConfig)
 		if err != nil {
@@ -66,6 +114,24 @@ func main() {
 	logger.Info("Graceful shutdown complete.")
 }
 
+// runCommand выполняет подкоманду вместо запуска сервера: idm migrate up|down|status|redo
+func runCommand(cfg common.Config, args []string, logger *common.Logger) error {
+	if args[0] != "migrate" || len(args) != 2 {
+		return fmt.Errorf("usage: idm migrate %s", strings.Join(database.MigrateCommands, "|"))
+	}
+	if cfg.DbDriverName == database.MemoryDriver {
+		return fmt.Errorf("migrate: nothing to migrate with %s driver", database.MemoryDriver)
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	db, err := database.ConnectDbWithRetry(ctx, cfg, logger)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = db.Close() }()
+	return database.Migrate(ctx, db, args[1], logger)
+}
+
 func gracefulShutdown(server *web.Server, wg *sync.WaitGroup, logger *common.Logger) {
 	const shutdownTimeout = 5 * time.Second
 	defer wg.Done()
@@ -88,7 +154,47 @@ func gracefulShutdown(server *web.Server, wg *sync.WaitGroup, logger *common.Log
 
 const ridHeader = fiber.HeaderXRequestID
 
-func build(cfg common.Config, database *sqlx.DB, logger *common.Logger) *web.Server {
+// repositories хранилища сервисов: Postgres или память процесса при DB_DRIVER_NAME=memory
+type repositories struct {
+	// router nil, если приложение работает без базы
+	router         *database.Router
+	employee       employee.Repo
+	role           role.Repo
+	serviceAccount serviceaccount.Repo
+	revocation     revocation.Repo
+	// me nil в памяти: профиль собирается запросами сразу к нескольким таблицам
+	me me.Repo
+}
+
+func newDbRepositories(cfg common.Config, router *database.Router, logger *common.Logger) repositories {
+	db := router.Primary()
+	// чтение сотрудников и ролей вне транзакций записи уходит на реплики
+	txManager := database.NewRoutedTxManager(router, logger, cfg.DbTxMaxAttempts)
+	var revocationRepo revocation.Repo = revocation.NewRepository(db)
+	if cfg.RevocationStore == "memory" {
+		revocationRepo = revocation.NewMemoryRepository()
+	}
+	return repositories{
+		router:         router,
+		employee:       employee.NewRepository(db, txManager),
+		role:           role.NewRepository(db, txManager),
+		serviceAccount: serviceaccount.NewRepository(db),
+		revocation:     revocationRepo,
+		me:             me.NewRepository(db),
+	}
+}
+
+func newMemoryRepositories() repositories {
+	store := database.NewMemoryStore()
+	return repositories{
+		employee:       employee.NewMemoryRepository(store),
+		role:           role.NewMemoryRepository(store),
+		serviceAccount: serviceaccount.NewMemoryRepository(store),
+		revocation:     revocation.NewMemoryRepository(),
+	}
+}
+
+func build(cfg common.Config, repos repositories, logger *common.Logger) *web.Server {
 	server := web.NewServer()
 	server.App.Use(requestid.New())
 	server.App.Use(requestid.New(requestid.Config{
@@ -97,17 +203,51 @@ func build(cfg common.Config, database *sqlx.DB, logger *common.Logger) *web.Ser
 	}))
 	server.App.Use("/swagger/*", web.HTTPHandler(httpSwagger.WrapHandler))
 	server.App.Use(recover.New())
-	server.GroupApiV1.Use(web.AuthMiddleware(logger))
 	vld := validator.New()
-	employeeRepo := employee.NewRepository(database)
-	employeeService := employee.NewService(employeeRepo, vld)
+	serviceAccountService := serviceaccount.NewService(repos.serviceAccount, vld)
+	// срок действует и для запросов к базе из middleware аутентификации и отзыва
+	server.GroupApiV1.Use(web.TimeoutMiddleware(cfg.DbTimeout))
+	server.GroupApiV1.Use(web.ApiKeyMiddleware(serviceAccountService, logger))
+	if cfg.MtlsEnabled {
+		principals, err := web.LoadCertPrincipals(cfg.MtlsPrincipalsFile)
+		if err != nil {
+			logger.Panic("failed certificate principals loading", zap.Error(err))
+		}
+		server.GroupApiV1.Use(web.ClientCertMiddleware(principals, logger))
+	}
+	if cfg.DevTokenIssuerEnabled {
+		issuer, err := devtoken.NewIssuer(cfg)
+		if err != nil {
+			logger.Panic("failed dev token issuer creating", zap.Error(err))
+		}
+		devtoken.NewController(server, issuer, vld, logger).RegisterRoutes()
+		logger.Warn("dev token issuer is enabled, do not use it in production")
+		// JWKS может публиковать само приложение, поэтому ключи загружаются при первом запросе
+		server.GroupApiV1.Use(web.LazyAuthMiddleware(cfg, logger))
+	} else {
+		server.GroupApiV1.Use(web.AuthMiddleware(cfg, logger))
+	}
+	revocationService := revocation.NewService(repos.revocation, vld, cfg.RevocationTtl)
+	server.GroupApiV1.Use(web.RevocationMiddleware(revocationService, logger))
+	server.GroupApiV1.Use(web.TenantMiddleware(logger))
+	employeeService := employee.NewService(repos.employee, vld)
 	employeeController := employee.NewController(server, employeeService, logger)
 	employeeController.RegisterRoutes()
-	roleRepo := role.NewRepository(database)
-	roleService := role.NewService(roleRepo, vld)
+	roleService := role.NewService(repos.role, vld)
 	roleController := role.NewController(server, roleService, logger)
 	roleController.RegisterRoutes()
-	infoController := info.NewController(server, cfg, database, logger)
+	serviceAccountController := serviceaccount.NewController(server, serviceAccountService, logger)
+	serviceAccountController.RegisterRoutes()
+	if repos.me != nil {
+		meService := me.NewService(repos.me, cfg.IdentityAutoLink)
+		meController := me.NewController(server, meService, logger)
+		meController.RegisterRoutes()
+	} else {
+		logger.Warn("/me endpoints are not available without database")
+	}
+	revocationController := revocation.NewController(server, revocationService, logger)
+	revocationController.RegisterRoutes()
+	infoController := info.NewController(server, cfg, repos.router, logger)
 	infoController.RegisterRoutes()
 	return server
 }
@@ -6,18 +6,75 @@ import (
 	"github.com/go-playground/validator/v10"
 	"github.com/joho/godotenv"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type Config struct {
-	DbDriverName   string `validate:"required"`
-	Dsn            string `validate:"required"`
+	// DbDriverName postgres, sqlite (встроенная база в файле) или memory (данные в памяти процесса, без базы)
+	DbDriverName string `validate:"required"`
+	Dsn          string `validate:"required_unless=DbDriverName memory"`
+	// DbTimeout ограничивает время работы с базой в рамках одного HTTP запроса, по истечении - 504
+	DbTimeout time.Duration `validate:"gt=0"`
+	// DbTxMaxAttempts число попыток транзакции при конфликте сериализации (40001) или взаимной блокировке (40P01)
+	DbTxMaxAttempts int `validate:"gte=1"`
+	// DbMaxOpenConns, DbMaxIdleConns, DbConnMaxLifetime и DbConnMaxIdleTime настройки пула соединений основной базы и каждой реплики
+	DbMaxOpenConns    int           `validate:"gte=1"`
+	DbMaxIdleConns    int           `validate:"gte=0,ltefield=DbMaxOpenConns"`
+	DbConnMaxLifetime time.Duration `validate:"gte=0"`
+	DbConnMaxIdleTime time.Duration `validate:"gte=0"`
+	// DbConnectRetryTimeout сколько ждать базу при старте, повторяя подключение с нарастающей паузой; 0 - без повторов
+	DbConnectRetryTimeout time.Duration `validate:"gte=0"`
+	// DbReplicaDsns DSN реплик для чтения через запятую, если пусто - всё выполняется в основной базе
+	DbReplicaDsns []string `validate:"dive,required"`
+	// DbReplicaCheckInterval период проверки реплик, недоступная реплика исключается из чтения до восстановления
+	DbReplicaCheckInterval time.Duration `validate:"gt=0"`
+	// DbAutoMigrate применяет встроенные миграции при старте, экземпляры ждут друг друга на advisory lock
+	DbAutoMigrate  bool
 	AppName        string `validate:"required"`
 	AppVersion     string `validate:"required"`
 	LogLevel       string
 	LogDevelopMode bool
 	SslSert        string `validate:"required"`
 	SslKey         string `validate:"required"`
-	KeycloakJwkUrl string `validate:"required"`
+	// JwtSigningMode способ проверки подписи токенов: jwks, pem или hmac
+	JwtSigningMode string `validate:"oneof=jwks pem hmac"`
+	KeycloakJwkUrl string `validate:"required_if=JwtSigningMode jwks"`
+	// JwtKeyFile PEM файл с открытым (или закрытым) ключом для режима pem
+	JwtKeyFile string `validate:"required_if=JwtSigningMode pem"`
+	// JwtHmacSecret общий секрет для режима hmac
+	JwtHmacSecret string `validate:"required_if=JwtSigningMode hmac,omitempty,min=32"`
+	// JwtKeyId kid ключа, если задан - токены без этого kid отклоняются
+	JwtKeyId string
+	// KeycloakIssuer ожидаемое значение claim "iss"
+	KeycloakIssuer string `validate:"required"`
+	// KeycloakAudience ожидаемое значение claim "aud"
+	KeycloakAudience string `validate:"required"`
+	// KeycloakClientId ожидаемое значение claim "azp", если пусто - не проверяется
+	KeycloakClientId string
+	// KeycloakResourceClient клиент, роли которого читаются из resource_access, по умолчанию KeycloakAudience
+	KeycloakResourceClient string
+	// TrustedIssuersFile JSON файл с дополнительными доверенными издателями (realm), см. web.TrustedIssuer
+	TrustedIssuersFile string
+	// JwtLeeway допустимое расхождение часов при проверке exp, nbf и iat
+	JwtLeeway time.Duration `validate:"gte=0"`
+	// IntrospectionUrl endpoint интроспекции RFC 7662 для непрозрачных токенов, если пусто - интроспекция выключена
+	IntrospectionUrl          string `validate:"omitempty,url"`
+	IntrospectionClientId     string `validate:"required_with=IntrospectionUrl"`
+	IntrospectionClientSecret string
+	// MtlsEnabled запрашивает у клиентов сертификаты, проверенные сертификаты сопоставляются с MtlsPrincipalsFile
+	MtlsEnabled        bool
+	MtlsCaFile         string `validate:"required_if=MtlsEnabled true"`
+	MtlsPrincipalsFile string `validate:"required_if=MtlsEnabled true"`
+	// RevocationStore хранилище отозванных токенов: postgres (общее для всех экземпляров) или memory
+	RevocationStore string `validate:"oneof=postgres memory"`
+	// RevocationTtl срок хранения отзыва по sub и sid, должен быть не меньше срока жизни токенов
+	RevocationTtl time.Duration `validate:"gt=0"`
+	// IdentityAutoLink привязывает пользователя токена к сотруднику по логину или подтверждённому email
+	IdentityAutoLink bool
+	// DevTokenIssuerEnabled включает /api/internal/dev/token и /api/internal/dev/jwks, только для локальной разработки
+	DevTokenIssuerEnabled bool
 }
 
 func GetConfig(envFile string) Config {
@@ -28,15 +85,45 @@ func GetConfig(envFile string) Config {
 		}
 	}
 	var cfg = Config{
-		DbDriverName:   os.Getenv("DB_DRIVER_NAME"),
-		Dsn:            os.Getenv("DB_DSN"),
-		AppName:        os.Getenv("APP_NAME"),
-		AppVersion:     os.Getenv("APP_VERSION"),
-		LogLevel:       os.Getenv("LOG_LEVEL"),
-		LogDevelopMode: os.Getenv("LOG_DEVELOP_MODE") == "true",
-		SslSert:        os.Getenv("SSL_SERT"),
-		SslKey:         os.Getenv("SSL_KEY"),
-		KeycloakJwkUrl: os.Getenv("KEYCLOAK_JWK_URL"),
+		DbDriverName:              os.Getenv("DB_DRIVER_NAME"),
+		Dsn:                       os.Getenv("DB_DSN"),
+		DbTimeout:                 parseDuration("DB_TIMEOUT", getEnvOrDefault("DB_TIMEOUT", "5s")),
+		DbTxMaxAttempts:           parseInt("DB_TX_MAX_ATTEMPTS", getEnvOrDefault("DB_TX_MAX_ATTEMPTS", "3")),
+		DbMaxOpenConns:            parseInt("DB_MAX_OPEN_CONNS", getEnvOrDefault("DB_MAX_OPEN_CONNS", "20")),
+		DbMaxIdleConns:            parseInt("DB_MAX_IDLE_CONNS", getEnvOrDefault("DB_MAX_IDLE_CONNS", "5")),
+		DbConnMaxLifetime:         parseDuration("DB_CONN_MAX_LIFETIME", getEnvOrDefault("DB_CONN_MAX_LIFETIME", "1m")),
+		DbConnMaxIdleTime:         parseDuration("DB_CONN_MAX_IDLE_TIME", getEnvOrDefault("DB_CONN_MAX_IDLE_TIME", "10m")),
+		DbConnectRetryTimeout:     parseDuration("DB_CONNECT_RETRY_TIMEOUT", os.Getenv("DB_CONNECT_RETRY_TIMEOUT")),
+		DbReplicaDsns:             splitList(os.Getenv("DB_REPLICA_DSNS")),
+		DbReplicaCheckInterval:    parseDuration("DB_REPLICA_CHECK_INTERVAL", getEnvOrDefault("DB_REPLICA_CHECK_INTERVAL", "5s")),
+		DbAutoMigrate:             os.Getenv("DB_AUTO_MIGRATE") == "true",
+		AppName:                   os.Getenv("APP_NAME"),
+		AppVersion:                os.Getenv("APP_VERSION"),
+		LogLevel:                  os.Getenv("LOG_LEVEL"),
+		LogDevelopMode:            os.Getenv("LOG_DEVELOP_MODE") == "true",
+		SslSert:                   os.Getenv("SSL_SERT"),
+		SslKey:                    os.Getenv("SSL_KEY"),
+		JwtSigningMode:            getEnvOrDefault("JWT_SIGNING_MODE", "jwks"),
+		KeycloakJwkUrl:            os.Getenv("KEYCLOAK_JWK_URL"),
+		JwtKeyFile:                os.Getenv("JWT_KEY_FILE"),
+		JwtHmacSecret:             os.Getenv("JWT_HMAC_SECRET"),
+		JwtKeyId:                  os.Getenv("JWT_KEY_ID"),
+		KeycloakIssuer:            os.Getenv("KEYCLOAK_ISSUER"),
+		KeycloakAudience:          os.Getenv("KEYCLOAK_AUDIENCE"),
+		KeycloakClientId:          os.Getenv("KEYCLOAK_CLIENT_ID"),
+		KeycloakResourceClient:    getEnvOrDefault("KEYCLOAK_RESOURCE_CLIENT", os.Getenv("KEYCLOAK_AUDIENCE")),
+		TrustedIssuersFile:        os.Getenv("TRUSTED_ISSUERS_FILE"),
+		JwtLeeway:                 parseDuration("JWT_LEEWAY", os.Getenv("JWT_LEEWAY")),
+		IntrospectionUrl:          os.Getenv("INTROSPECTION_URL"),
+		IntrospectionClientId:     os.Getenv("INTROSPECTION_CLIENT_ID"),
+		IntrospectionClientSecret: os.Getenv("INTROSPECTION_CLIENT_SECRET"),
+		RevocationStore:           getEnvOrDefault("REVOCATION_STORE", defaultRevocationStore(os.Getenv("DB_DRIVER_NAME"))),
+		RevocationTtl:             parseDuration("REVOCATION_TTL", getEnvOrDefault("REVOCATION_TTL", "24h")),
+		IdentityAutoLink:          getEnvOrDefault("IDENTITY_AUTO_LINK", "true") == "true",
+		MtlsEnabled:               os.Getenv("MTLS_ENABLED") == "true",
+		MtlsCaFile:                os.Getenv("MTLS_CA_FILE"),
+		MtlsPrincipalsFile:        os.Getenv("MTLS_PRINCIPALS_FILE"),
+		DevTokenIssuerEnabled:     os.Getenv("DEV_TOKEN_ISSUER_ENABLED") == "true",
 	}
 	err := validator.New().Struct(cfg)
 	if err != nil {
@@ -47,3 +134,48 @@ func GetConfig(envFile string) Config {
 	}
 	return cfg
 }
+
+// defaultRevocationStore без базы отзывы хранятся в памяти
+func defaultRevocationStore(driverName string) string {
+	if driverName == "memory" {
+		return "memory"
+	}
+	return "postgres"
+}
+
+func getEnvOrDefault(name, def string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return def
+}
+
+func parseDuration(name, value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		panic(fmt.Sprintf("config validation error: %s: %v", name, err))
+	}
+	return duration
+}
+
+func parseInt(name, value string) int {
+	number, err := strconv.Atoi(value)
+	if err != nil {
+		panic(fmt.Sprintf("config validation error: %s: %v", name, err))
+	}
+	return number
+}
+
+// splitList значения через запятую без пустых элементов
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -4,6 +4,7 @@ import (
 	"github.com/stretchr/testify/assert"
 	"os"
 	"testing"
+	"time"
 )
 
 func TestGetConfig(t *testing.T) {
@@ -16,6 +17,8 @@ func TestGetConfig(t *testing.T) {
 		t.Setenv("SSL_SERT", "certs/ssl.cert")
 		t.Setenv("SSL_KEY", "certs/ssl.key")
 		t.Setenv("KEYCLOAK_JWK_URL", "http://localhost:9990/realms/idm/")
+		t.Setenv("KEYCLOAK_ISSUER", "http://localhost:9990/realms/idm")
+		t.Setenv("KEYCLOAK_AUDIENCE", "account")
 		cnf := GetConfig("")
 		assert.Equal(t, "postgres", cnf.DbDriverName)
 		assert.Equal(t, "great dsn string", cnf.Dsn)
@@ -29,6 +32,8 @@ func TestGetConfig(t *testing.T) {
 		t.Setenv("SSL_KEY", "certs/ssl.key")
 		t.Setenv("SSL_KEY", "certs/ssl.key")
 		t.Setenv("KEYCLOAK_JWK_URL", "http://localhost:9990/realms/idm/")
+		t.Setenv("KEYCLOAK_ISSUER", "http://localhost:9990/realms/idm")
+		t.Setenv("KEYCLOAK_AUDIENCE", "account")
 		file := eachEnvFile(t, "")
 		cnf := GetConfig(file)
 		assert.NotEqual(t, Config{}, cnf, "config not exists")
@@ -44,11 +49,182 @@ func TestGetConfig(t *testing.T) {
 		t.Setenv("SSL_KEY", "certs/ssl.key")
 		t.Setenv("SSL_KEY", "certs/ssl.key")
 		t.Setenv("KEYCLOAK_JWK_URL", "http://localhost:9990/realms/idm/")
+		t.Setenv("KEYCLOAK_ISSUER", "http://localhost:9990/realms/idm")
+		t.Setenv("KEYCLOAK_AUDIENCE", "account")
 		file := eachEnvFile(t, "GOOSE_DBSTRING=mock_DBSTRING\nDB_DRIVER_NAME=postgres\nDB_DSN=mock_DSN\nAPP_NAME=idm\nAPP_VERSION=0.0.0")
 		cnf := GetConfig(file)
 		assert.Equal(t, "ram_env", cnf.Dsn, "expected values from environment")
 		assert.Equal(t, "ram_env", cnf.DbDriverName, "expected values from environment")
 	})
+	t.Run("token validation settings", func(t *testing.T) {
+		_ = eachEnvFile(t, "")
+		setRequiredEnv(t)
+		t.Setenv("KEYCLOAK_CLIENT_ID", "idm-api")
+		t.Setenv("JWT_LEEWAY", "30s")
+		t.Setenv("TRUSTED_ISSUERS_FILE", "config/issuers.json")
+		cnf := GetConfig("")
+		assert.Equal(t, "http://localhost:9990/realms/idm", cnf.KeycloakIssuer)
+		assert.Equal(t, "account", cnf.KeycloakAudience)
+		assert.Equal(t, "idm-api", cnf.KeycloakClientId)
+		assert.Equal(t, 30*time.Second, cnf.JwtLeeway)
+		assert.Equal(t, "config/issuers.json", cnf.TrustedIssuersFile)
+	})
+	t.Run("resource client defaults to audience", func(t *testing.T) {
+		setRequiredEnv(t)
+		assert.Equal(t, "account", GetConfig("").KeycloakResourceClient)
+		t.Setenv("KEYCLOAK_RESOURCE_CLIENT", "idm-api")
+		assert.Equal(t, "idm-api", GetConfig("").KeycloakResourceClient)
+	})
+	t.Run("missing issuer panics", func(t *testing.T) {
+		setRequiredEnv(t)
+		t.Setenv("KEYCLOAK_ISSUER", "")
+		assert.Panics(t, func() { GetConfig("") })
+	})
+	t.Run("signing mode defaults to jwks", func(t *testing.T) {
+		setRequiredEnv(t)
+		cnf := GetConfig("")
+		assert.Equal(t, "jwks", cnf.JwtSigningMode)
+	})
+	t.Run("hmac mode does not need jwk url", func(t *testing.T) {
+		setRequiredEnv(t)
+		t.Setenv("KEYCLOAK_JWK_URL", "")
+		t.Setenv("JWT_SIGNING_MODE", "hmac")
+		t.Setenv("JWT_HMAC_SECRET", "0123456789abcdef0123456789abcdef")
+		cnf := GetConfig("")
+		assert.Equal(t, "hmac", cnf.JwtSigningMode)
+	})
+	t.Run("hmac mode without secret panics", func(t *testing.T) {
+		setRequiredEnv(t)
+		t.Setenv("JWT_SIGNING_MODE", "hmac")
+		assert.Panics(t, func() { GetConfig("") })
+	})
+	t.Run("pem mode without key file panics", func(t *testing.T) {
+		setRequiredEnv(t)
+		t.Setenv("JWT_SIGNING_MODE", "pem")
+		assert.Panics(t, func() { GetConfig("") })
+	})
+	t.Run("mtls settings", func(t *testing.T) {
+		setRequiredEnv(t)
+		t.Setenv("MTLS_ENABLED", "true")
+		t.Setenv("MTLS_CA_FILE", "certs/clients-ca.pem")
+		t.Setenv("MTLS_PRINCIPALS_FILE", "certs/principals.json")
+		cnf := GetConfig("")
+		assert.True(t, cnf.MtlsEnabled)
+		assert.Equal(t, "certs/clients-ca.pem", cnf.MtlsCaFile)
+		assert.Equal(t, "certs/principals.json", cnf.MtlsPrincipalsFile)
+	})
+	t.Run("mtls without ca bundle panics", func(t *testing.T) {
+		setRequiredEnv(t)
+		t.Setenv("MTLS_ENABLED", "true")
+		t.Setenv("MTLS_PRINCIPALS_FILE", "certs/principals.json")
+		assert.Panics(t, func() { GetConfig("") })
+	})
+	t.Run("revocation defaults", func(t *testing.T) {
+		setRequiredEnv(t)
+		cnf := GetConfig("")
+		assert.Equal(t, "postgres", cnf.RevocationStore)
+		assert.Equal(t, 24*time.Hour, cnf.RevocationTtl)
+	})
+	t.Run("identity auto link is enabled by default", func(t *testing.T) {
+		setRequiredEnv(t)
+		assert.True(t, GetConfig("").IdentityAutoLink)
+		t.Setenv("IDENTITY_AUTO_LINK", "false")
+		assert.False(t, GetConfig("").IdentityAutoLink)
+	})
+	t.Run("db timeout defaults to 5 seconds", func(t *testing.T) {
+		setRequiredEnv(t)
+		assert.Equal(t, 5*time.Second, GetConfig("").DbTimeout)
+		t.Setenv("DB_TIMEOUT", "750ms")
+		assert.Equal(t, 750*time.Millisecond, GetConfig("").DbTimeout)
+	})
+	t.Run("negative db timeout panics", func(t *testing.T) {
+		setRequiredEnv(t)
+		t.Setenv("DB_TIMEOUT", "-1s")
+		assert.Panics(t, func() { GetConfig("") })
+	})
+	t.Run("transaction attempts default to 3", func(t *testing.T) {
+		setRequiredEnv(t)
+		assert.Equal(t, 3, GetConfig("").DbTxMaxAttempts)
+		t.Setenv("DB_TX_MAX_ATTEMPTS", "5")
+		assert.Equal(t, 5, GetConfig("").DbTxMaxAttempts)
+	})
+	t.Run("wrong transaction attempts panics", func(t *testing.T) {
+		setRequiredEnv(t)
+		t.Setenv("DB_TX_MAX_ATTEMPTS", "0")
+		assert.Panics(t, func() { GetConfig("") })
+		t.Setenv("DB_TX_MAX_ATTEMPTS", "many")
+		assert.Panics(t, func() { GetConfig("") })
+	})
+	t.Run("pool settings", func(t *testing.T) {
+		setRequiredEnv(t)
+		cnf := GetConfig("")
+		assert.Equal(t, 20, cnf.DbMaxOpenConns)
+		assert.Equal(t, 5, cnf.DbMaxIdleConns)
+		assert.Equal(t, time.Minute, cnf.DbConnMaxLifetime)
+		assert.Equal(t, 10*time.Minute, cnf.DbConnMaxIdleTime)
+		assert.Zero(t, cnf.DbConnectRetryTimeout)
+		t.Setenv("DB_MAX_OPEN_CONNS", "50")
+		t.Setenv("DB_MAX_IDLE_CONNS", "10")
+		t.Setenv("DB_CONN_MAX_LIFETIME", "30m")
+		t.Setenv("DB_CONNECT_RETRY_TIMEOUT", "1m")
+		cnf = GetConfig("")
+		assert.Equal(t, 50, cnf.DbMaxOpenConns)
+		assert.Equal(t, 10, cnf.DbMaxIdleConns)
+		assert.Equal(t, 30*time.Minute, cnf.DbConnMaxLifetime)
+		assert.Equal(t, time.Minute, cnf.DbConnectRetryTimeout)
+	})
+	t.Run("more idle than open connections panics", func(t *testing.T) {
+		setRequiredEnv(t)
+		t.Setenv("DB_MAX_OPEN_CONNS", "4")
+		assert.Panics(t, func() { GetConfig("") })
+	})
+	t.Run("replicas are optional", func(t *testing.T) {
+		setRequiredEnv(t)
+		cnf := GetConfig("")
+		assert.Empty(t, cnf.DbReplicaDsns)
+		assert.Equal(t, 5*time.Second, cnf.DbReplicaCheckInterval)
+		t.Setenv("DB_REPLICA_DSNS", "host=replica1 dbname=idm, host=replica2 dbname=idm,")
+		assert.Equal(t, []string{"host=replica1 dbname=idm", "host=replica2 dbname=idm"}, GetConfig("").DbReplicaDsns)
+	})
+	t.Run("auto migrate is disabled by default", func(t *testing.T) {
+		setRequiredEnv(t)
+		assert.False(t, GetConfig("").DbAutoMigrate)
+		t.Setenv("DB_AUTO_MIGRATE", "true")
+		assert.True(t, GetConfig("").DbAutoMigrate)
+	})
+	t.Run("memory driver does not need dsn", func(t *testing.T) {
+		setRequiredEnv(t)
+		t.Setenv("DB_DRIVER_NAME", "memory")
+		t.Setenv("DB_DSN", "")
+		cnf := GetConfig("")
+		assert.Equal(t, "memory", cnf.DbDriverName)
+		assert.Equal(t, "memory", cnf.RevocationStore)
+		t.Setenv("DB_DRIVER_NAME", "postgres")
+		assert.Panics(t, func() { GetConfig("") })
+	})
+	t.Run("unknown revocation store panics", func(t *testing.T) {
+		setRequiredEnv(t)
+		t.Setenv("REVOCATION_STORE", "redis")
+		assert.Panics(t, func() { GetConfig("") })
+	})
+	t.Run("wrong leeway panics", func(t *testing.T) {
+		setRequiredEnv(t)
+		t.Setenv("JWT_LEEWAY", "soon")
+		assert.Panics(t, func() { GetConfig("") })
+	})
+}
+
+func setRequiredEnv(t *testing.T) {
+	t.Helper()
+	t.Setenv("DB_DRIVER_NAME", "postgres")
+	t.Setenv("DB_DSN", "great dsn string")
+	t.Setenv("APP_NAME", "idm")
+	t.Setenv("APP_VERSION", "0.0.0")
+	t.Setenv("SSL_SERT", "certs/ssl.cert")
+	t.Setenv("SSL_KEY", "certs/ssl.key")
+	t.Setenv("KEYCLOAK_JWK_URL", "http://localhost:9990/realms/idm/")
+	t.Setenv("KEYCLOAK_ISSUER", "http://localhost:9990/realms/idm")
+	t.Setenv("KEYCLOAK_AUDIENCE", "account")
 }
 
 func eachEnvFile(t *testing.T, str string) string {
@@ -23,3 +23,12 @@ type NotFoundError struct {
 func (err *NotFoundError) Error() string {
 	return err.Massage
 }
+
+// ConflictError операция противоречит связанным данным, например ссылается на удалённую запись
+type ConflictError struct {
+	Massage string
+}
+
+func (err *ConflictError) Error() string {
+	return err.Massage
+}
@@ -0,0 +1,27 @@
+package common
+
+// DefaultTenant арендатор пользователей, в токенах которых нет claim "tenant_id"
+const DefaultTenant = "default"
+
+// Tenant арендатор, данными которого может оперировать запрос.
+// All - все арендаторы сразу, доступно только супер-администратору.
+type Tenant struct {
+	Id  string
+	All bool
+}
+
+func SingleTenant(id string) Tenant {
+	return Tenant{Id: id}
+}
+
+func AllTenants() Tenant {
+	return Tenant{All: true}
+}
+
+// ForWrite возвращает арендатора для новых записей: создать запись "во всех арендаторах" нельзя
+func (t Tenant) ForWrite() (string, error) {
+	if t.All || t.Id == "" {
+		return "", &RequestValidationError{Massage: "tenant is required, select it with the X-Tenant-ID header"}
+	}
+	return t.Id, nil
+}
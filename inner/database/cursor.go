@@ -0,0 +1,58 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"sync/atomic"
+)
+
+// cursorBatch строк за один FETCH серверного курсора
+const cursorBatch = 500
+
+var cursorSeq atomic.Uint64
+
+// EachRow вызывает fn для каждой строки результата query в транзакции tx.
+// В Postgres строки читаются серверным курсором порциями по cursorBatch, поэтому память
+// не зависит от размера результата. SQLite и так отдаёт строки по одной, курсор ему не нужен.
+func EachRow(ctx context.Context, tx *sqlx.Tx, query string, args []any, fn func(rows *sqlx.Rows) error) error {
+	if tx.DriverName() == SQLiteDriver {
+		rows, err := tx.QueryxContext(ctx, query, args...)
+		if err != nil {
+			return err
+		}
+		_, err = scanRows(rows, fn)
+		return err
+	}
+	cursor := fmt.Sprintf("idm_cursor_%d", cursorSeq.Add(1))
+	if _, err := tx.ExecContext(ctx, "DECLARE "+cursor+" NO SCROLL CURSOR FOR "+query, args...); err != nil {
+		return fmt.Errorf("declare cursor: %w", err)
+	}
+	for {
+		rows, err := tx.QueryxContext(ctx, fmt.Sprintf("FETCH %d FROM %s", cursorBatch, cursor))
+		if err != nil {
+			return fmt.Errorf("fetch cursor: %w", err)
+		}
+		count, err := scanRows(rows, fn)
+		if err != nil {
+			return err
+		}
+		if count < cursorBatch {
+			break
+		}
+	}
+	_, err := tx.ExecContext(ctx, "CLOSE "+cursor)
+	return err
+}
+
+// scanRows вызывает fn для каждой строки rows и закрывает их
+func scanRows(rows *sqlx.Rows, fn func(rows *sqlx.Rows) error) (count int, err error) {
+	defer func() { _ = rows.Close() }()
+	for rows.Next() {
+		if err = fn(rows); err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, rows.Err()
+}
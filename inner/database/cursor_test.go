@@ -0,0 +1,57 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestEachRow(t *testing.T) {
+	ctx := context.Background()
+	begin := func(t *testing.T) (*sqlx.Tx, sqlmock.Sqlmock) {
+		db, mock := newMockDb(t)
+		mock.ExpectBegin()
+		tx, err := db.Beginx()
+		require.NoError(t, err)
+		return tx, mock
+	}
+	t.Run("should fetch cursor in batches until short batch", func(t *testing.T) {
+		tx, mock := begin(t)
+		mock.ExpectExec(`DECLARE idm_cursor_\d+ NO SCROLL CURSOR FOR SELECT id FROM employee WHERE tenant_id = \$1`).
+			WithArgs("acme").WillReturnResult(sqlmock.NewResult(0, 0))
+		full := sqlmock.NewRows([]string{"id"})
+		for i := range cursorBatch {
+			full.AddRow(i)
+		}
+		mock.ExpectQuery(`FETCH 500 FROM idm_cursor_\d+`).WillReturnRows(full)
+		mock.ExpectQuery(`FETCH 500 FROM idm_cursor_\d+`).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(cursorBatch))
+		mock.ExpectExec(`CLOSE idm_cursor_\d+`).WillReturnResult(sqlmock.NewResult(0, 0))
+		var ids []int64
+		err := EachRow(ctx, tx, "SELECT id FROM employee WHERE tenant_id = $1", []any{"acme"}, func(rows *sqlx.Rows) error {
+			var id int64
+			err := rows.Scan(&id)
+			ids = append(ids, id)
+			return err
+		})
+		assert.NoError(t, err)
+		assert.Len(t, ids, cursorBatch+1)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+	t.Run("should stop on callback error", func(t *testing.T) {
+		tx, mock := begin(t)
+		mock.ExpectExec("DECLARE").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectQuery("FETCH").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1).AddRow(2))
+		calls := 0
+		err := EachRow(ctx, tx, "SELECT id FROM employee", nil, func(rows *sqlx.Rows) error {
+			calls++
+			return errors.New("client disconnected")
+		})
+		assert.EqualError(t, err, "client disconnected")
+		assert.Equal(t, 1, calls)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
@@ -1,22 +1,95 @@
 package database
 
 import (
+	"context"
+	"fmt"
 	"github.com/jmoiron/sqlx"
 	_ "github.com/lib/pq"
+	"go.uber.org/zap"
 	"idm/inner/common"
+	_ "modernc.org/sqlite"
 	"time"
 )
 
+const (
+	connectBaseDelay = 100 * time.Millisecond
+	connectMaxDelay  = 5 * time.Second
+)
+
 func ConnectDb() *sqlx.DB {
 	cfg := common.GetConfig(".env")
 	return ConnectDbWithCfg(cfg)
 }
 
+// ConnectDbWithCfg подключается к основной базе одной попыткой и паникует, если база недоступна
 func ConnectDbWithCfg(cfg common.Config) *sqlx.DB {
 	db := sqlx.MustConnect(cfg.DbDriverName, cfg.Dsn)
-	db.SetMaxIdleConns(5)
-	db.SetMaxOpenConns(20)
-	db.SetConnMaxLifetime(1 * time.Minute)
-	db.SetConnMaxIdleTime(10 * time.Minute)
+	configurePool(db, cfg)
 	return db
 }
+
+// ConnectDbWithRetry подключается к основной базе, повторяя попытки с нарастающей паузой
+// в течение cfg.DbConnectRetryTimeout, чтобы кратковременная недоступность базы не прерывала запуск
+func ConnectDbWithRetry(ctx context.Context, cfg common.Config, logger *common.Logger) (*sqlx.DB, error) {
+	db, err := sqlx.Open(cfg.DbDriverName, cfg.Dsn)
+	if err != nil {
+		return nil, fmt.Errorf("connect to database: %w", err)
+	}
+	deadline := time.Now().Add(cfg.DbConnectRetryTimeout)
+	for attempt := 1; ; attempt++ {
+		if err = db.PingContext(ctx); err == nil {
+			configurePool(db, cfg)
+			return db, nil
+		}
+		delay := connectDelay(attempt)
+		if time.Now().Add(delay).After(deadline) {
+			_ = db.Close()
+			return nil, fmt.Errorf("connect to database: %d attempts: %w", attempt, err)
+		}
+		logger.Warn("database is unavailable, retrying",
+			zap.Int("attempt", attempt),
+			zap.Duration("delay", delay),
+			zap.Error(err))
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			_ = db.Close()
+			return nil, fmt.Errorf("connect to database: %w", ctx.Err())
+		case <-timer.C:
+		}
+	}
+}
+
+// ConnectReplicas открывает пулы реплик без проверки соединения:
+// недоступная при старте реплика не мешает запуску, её исключит проверка Router.CheckHealth
+func ConnectReplicas(cfg common.Config) ([]*sqlx.DB, error) {
+	var replicas []*sqlx.DB
+	for _, dsn := range cfg.DbReplicaDsns {
+		db, err := sqlx.Open(cfg.DbDriverName, dsn)
+		if err != nil {
+			for _, opened := range replicas {
+				_ = opened.Close()
+			}
+			return nil, err
+		}
+		configurePool(db, cfg)
+		replicas = append(replicas, db)
+	}
+	return replicas, nil
+}
+
+func configurePool(db *sqlx.DB, cfg common.Config) {
+	db.SetMaxOpenConns(cfg.DbMaxOpenConns)
+	db.SetMaxIdleConns(cfg.DbMaxIdleConns)
+	db.SetConnMaxLifetime(cfg.DbConnMaxLifetime)
+	db.SetConnMaxIdleTime(cfg.DbConnMaxIdleTime)
+}
+
+// connectDelay экспоненциальная пауза между попытками подключения
+func connectDelay(attempt int) time.Duration {
+	if shift := attempt - 1; shift < 16 {
+		return min(connectBaseDelay<<shift, connectMaxDelay)
+	}
+	return connectMaxDelay
+}
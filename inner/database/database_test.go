@@ -0,0 +1,40 @@
+package database
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"idm/inner/common"
+	"testing"
+	"time"
+)
+
+func TestConnectDbWithRetry(t *testing.T) {
+	cfg := common.Config{
+		DbDriverName: "postgres",
+		Dsn:          "host=127.0.0.1 port=1 user=idm dbname=idm sslmode=disable connect_timeout=1",
+	}
+	t.Run("should fail after first attempt without retry timeout", func(t *testing.T) {
+		_, err := ConnectDbWithRetry(context.Background(), cfg, testLogger())
+		assert.ErrorContains(t, err, "connect to database: 1 attempts")
+	})
+	t.Run("should retry until timeout", func(t *testing.T) {
+		cfg := cfg
+		cfg.DbConnectRetryTimeout = 250 * time.Millisecond
+		_, err := ConnectDbWithRetry(context.Background(), cfg, testLogger())
+		assert.ErrorContains(t, err, "connect to database: 2 attempts")
+	})
+	t.Run("should stop when context is done", func(t *testing.T) {
+		cfg := cfg
+		cfg.DbConnectRetryTimeout = time.Minute
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		_, err := ConnectDbWithRetry(ctx, cfg, testLogger())
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+}
+
+func TestConnectDelay(t *testing.T) {
+	assert.Equal(t, connectBaseDelay, connectDelay(1))
+	assert.Equal(t, 2*connectBaseDelay, connectDelay(2))
+	assert.Equal(t, connectMaxDelay, connectDelay(100))
+}
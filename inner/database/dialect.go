@@ -0,0 +1,60 @@
+package database
+
+import (
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"github.com/pressly/goose/v3"
+	"idm/migrations"
+	"io/fs"
+)
+
+// SQLiteDriver значение DB_DRIVER_NAME для встроенной базы в файле (драйвер modernc.org/sqlite).
+// Рекомендуемый DSN: file:idm.db?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)
+const SQLiteDriver = "sqlite"
+
+// Dialect различия SQL Postgres и SQLite, которые видят репозитории.
+// Плейсхолдеры $n, RETURNING и ON CONFLICT одинаково понимают обе базы.
+type Dialect struct {
+	sqlite bool
+}
+
+// DialectOf диалект по имени драйвера db, всё, кроме SQLite, считается Postgres
+func DialectOf(db *sqlx.DB) Dialect {
+	return Dialect{sqlite: db.DriverName() == SQLiteDriver}
+}
+
+func (d Dialect) IsSQLite() bool {
+	return d.sqlite
+}
+
+// ILike условие "column содержит подстроку без учёта регистра" с одним плейсхолдером ?.
+// В SQLite LIKE не различает регистр только для латиницы.
+func (d Dialect) ILike(column string) string {
+	if d.sqlite {
+		return column + " LIKE ?"
+	}
+	return column + " ILIKE ?"
+}
+
+// StringAgg агрегат, склеивающий значения column через separator.
+// Postgres упорядочивает значения, group_concat в SQLite - нет.
+func (d Dialect) StringAgg(column, separator string) string {
+	if d.sqlite {
+		return fmt.Sprintf("group_concat(%s, '%s')", column, separator)
+	}
+	return fmt.Sprintf("string_agg(%s, '%s' ORDER BY %s)", column, separator, column)
+}
+
+// RowLevelSecurity база поддерживает политики RLS: в SQLite арендатора ограничивают только условия запросов
+func (d Dialect) RowLevelSecurity() bool {
+	return !d.sqlite
+}
+
+// Migrations набор миграций диалекта и его имя в goose
+func (d Dialect) Migrations() (fs.FS, goose.Dialect, error) {
+	if d.sqlite {
+		fsys, err := fs.Sub(migrations.SQLite, "sqlite")
+		return fsys, goose.DialectSQLite3, err
+	}
+	return migrations.FS, goose.DialectPostgres, nil
+}
@@ -0,0 +1,30 @@
+package database
+
+import (
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"io/fs"
+	"testing"
+)
+
+func TestDialect(t *testing.T) {
+	t.Run("postgres", func(t *testing.T) {
+		db, _ := newMockDb(t)
+		dialect := DialectOf(db)
+		assert.Equal(t, "name ILIKE ?", dialect.ILike("name"))
+		assert.Equal(t, "string_agg(r.name, ';' ORDER BY r.name)", dialect.StringAgg("r.name", ";"))
+		assert.True(t, dialect.RowLevelSecurity())
+	})
+	t.Run("sqlite", func(t *testing.T) {
+		mock, _ := newMockDb(t)
+		dialect := DialectOf(sqlx.NewDb(mock.DB, SQLiteDriver))
+		assert.Equal(t, "name LIKE ?", dialect.ILike("name"))
+		assert.Equal(t, "group_concat(r.name, ';')", dialect.StringAgg("r.name", ";"))
+		assert.False(t, dialect.RowLevelSecurity())
+		fsys, _, err := dialect.Migrations()
+		assert.NoError(t, err)
+		files, err := fs.Glob(fsys, "*.sql")
+		assert.NoError(t, err)
+		assert.NotEmpty(t, files)
+	})
+}
@@ -0,0 +1,73 @@
+package database
+
+import (
+	"errors"
+	"github.com/lib/pq"
+	"idm/inner/common"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// коды SQLSTATE, которые приложение обрабатывает отдельно
+const (
+	uniqueViolation      = "23505"
+	foreignKeyViolation  = "23503"
+	serializationFailure = "40001"
+	deadlockDetected     = "40P01"
+)
+
+// IsRetryable сообщает, что транзакция откачена из-за конфликта сериализации или взаимной блокировки,
+// в SQLite - что база занята другой транзакцией записи (SQLITE_BUSY)
+func IsRetryable(err error) bool {
+	var sqliteErr *sqlite.Error
+	if errors.As(err, &sqliteErr) {
+		return sqliteErr.Code()&0xff == sqlite3.SQLITE_BUSY
+	}
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return false
+	}
+	return pqErr.Code == serializationFailure || pqErr.Code == deadlockDetected
+}
+
+// TranslateError переводит нарушения ограничений в ошибки приложения:
+// уникальность (23505) - common.AlreadyExistsError, внешний ключ (23503) - common.ConflictError.
+// Остальные ошибки возвращаются без изменений.
+func TranslateError(err error) error {
+	var sqliteErr *sqlite.Error
+	if errors.As(err, &sqliteErr) {
+		return translateSQLiteError(sqliteErr)
+	}
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return err
+	}
+	switch pqErr.Code {
+	case uniqueViolation:
+		return &common.AlreadyExistsError{Massage: "already exists: " + constraintDetail(pqErr)}
+	case foreignKeyViolation:
+		return &common.ConflictError{Massage: "conflicts with related data: " + constraintDetail(pqErr)}
+	default:
+		return err
+	}
+}
+
+// constraintDetail Detail содержит значения ключа, например "Key (tenant_id, lower(name))=(acme, john) already exists."
+func constraintDetail(pqErr *pq.Error) string {
+	if pqErr.Detail != "" {
+		return pqErr.Detail
+	}
+	return pqErr.Message
+}
+
+// translateSQLiteError расширенные коды SQLite вместо SQLSTATE, значения ключа SQLite не сообщает
+func translateSQLiteError(err *sqlite.Error) error {
+	switch err.Code() {
+	case sqlite3.SQLITE_CONSTRAINT_UNIQUE, sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY:
+		return &common.AlreadyExistsError{Massage: "already exists: " + err.Error()}
+	case sqlite3.SQLITE_CONSTRAINT_FOREIGNKEY:
+		return &common.ConflictError{Massage: "conflicts with related data: " + err.Error()}
+	default:
+		return err
+	}
+}
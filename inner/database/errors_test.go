@@ -0,0 +1,36 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"idm/inner/common"
+	"testing"
+)
+
+func TestTranslateError(t *testing.T) {
+	t.Run("unique violation is already exists error", func(t *testing.T) {
+		err := fmt.Errorf("insert: %w", &pq.Error{
+			Code:       "23505",
+			Constraint: "role_name_uidx",
+			Detail:     "Key (tenant_id, lower(name))=(acme, admin) already exists.",
+		})
+		var existsErr *common.AlreadyExistsError
+		assert.ErrorAs(t, TranslateError(err), &existsErr)
+		assert.Contains(t, existsErr.Error(), "(acme, admin)")
+	})
+	t.Run("foreign key violation is conflict error", func(t *testing.T) {
+		err := &pq.Error{Code: "23503", Message: "insert or update on table \"employee_role\" violates foreign key constraint"}
+		var conflictErr *common.ConflictError
+		assert.ErrorAs(t, TranslateError(err), &conflictErr)
+		assert.Contains(t, conflictErr.Error(), "employee_role")
+	})
+	t.Run("other errors are returned as is", func(t *testing.T) {
+		want := errors.New("connection reset")
+		assert.Same(t, want, TranslateError(want))
+		assert.Nil(t, TranslateError(nil))
+		syntaxErr := &pq.Error{Code: "42601"}
+		assert.Same(t, syntaxErr, TranslateError(syntaxErr))
+	})
+}
@@ -0,0 +1,152 @@
+package database
+
+import (
+	"cmp"
+	"context"
+	"maps"
+	"slices"
+	"sync"
+)
+
+// MemoryDriver значение DB_DRIVER_NAME, при котором данные хранятся в памяти процесса и теряются при перезапуске
+const MemoryDriver = "memory"
+
+// MemoryStore TxManager для репозиториев в памяти.
+// Все таблицы хранилища защищены одной блокировкой: транзакции выполняются по очереди,
+// что соответствует SERIALIZABLE без конфликтов. Изменения таблиц в транзакции записываются в журнал отмены:
+// при ошибке fn отменяются изменения с начала транзакции или вложенного вызова WithTx,
+// поэтому точка сохранения стоит столько, сколько изменений под ней, а не размер таблиц.
+// TxFunc получает nil вместо *sqlx.Tx.
+type MemoryStore struct {
+	mu sync.Mutex
+	// undo отмена изменений открытой транзакции в порядке их внесения, вне транзакции журнал не ведётся
+	undo      []func()
+	recording bool
+}
+
+type memoryTxKey struct{}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{}
+}
+
+func (s *MemoryStore) WithTx(ctx context.Context, _ TxOptions, fn TxFunc) error {
+	if s.inTx(ctx) {
+		return s.savepoint(ctx, fn)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.recording = true
+	defer func() {
+		s.undo, s.recording = nil, false
+	}()
+	return s.savepoint(context.WithValue(ctx, memoryTxKey{}, s), fn)
+}
+
+// Run выполняет fn под блокировкой хранилища, внутри WithTx - в уже открытой транзакции
+func (s *MemoryStore) Run(ctx context.Context, fn func() error) error {
+	if s.inTx(ctx) {
+		return fn()
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return fn()
+}
+
+func (s *MemoryStore) inTx(ctx context.Context) bool {
+	store, ok := ctx.Value(memoryTxKey{}).(*MemoryStore)
+	return ok && store == s
+}
+
+func (s *MemoryStore) savepoint(ctx context.Context, fn TxFunc) (err error) {
+	mark := len(s.undo)
+	rollback := func() {
+		for i := len(s.undo) - 1; i >= mark; i-- {
+			s.undo[i]()
+		}
+		clear(s.undo[mark:])
+		s.undo = s.undo[:mark]
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			rollback()
+			panic(p)
+		}
+	}()
+	if err = fn(ctx, nil); err != nil {
+		rollback()
+	}
+	return err
+}
+
+// record добавляет в журнал отмену изменения таблицы
+func (s *MemoryStore) record(undo func()) {
+	if s.recording {
+		s.undo = append(s.undo, undo)
+	}
+}
+
+// MemoryTable таблица в памяти с последовательными id.
+// Читать и менять её можно только внутри MemoryStore.Run или MemoryStore.WithTx.
+type MemoryTable[T any] struct {
+	store  *MemoryStore
+	rows   map[int64]T
+	lastId int64
+}
+
+// NewMemoryTable создаёт таблицу в store, изменения которой откатываются вместе с транзакциями store
+func NewMemoryTable[T any](store *MemoryStore) *MemoryTable[T] {
+	return &MemoryTable[T]{store: store, rows: make(map[int64]T)}
+}
+
+// Insert сохраняет строку, которую build строит по выделенному id
+func (t *MemoryTable[T]) Insert(build func(id int64) T) int64 {
+	id := t.lastId + 1
+	t.rows[id], t.lastId = build(id), id
+	t.store.record(func() {
+		delete(t.rows, id)
+		t.lastId = id - 1
+	})
+	return id
+}
+
+func (t *MemoryTable[T]) Get(id int64) (T, bool) {
+	row, ok := t.rows[id]
+	return row, ok
+}
+
+func (t *MemoryTable[T]) Put(id int64, row T) {
+	previous, existed := t.rows[id]
+	t.rows[id] = row
+	t.store.record(func() {
+		if existed {
+			t.rows[id] = previous
+		} else {
+			delete(t.rows, id)
+		}
+	})
+}
+
+func (t *MemoryTable[T]) Delete(id int64) bool {
+	previous, ok := t.rows[id]
+	if !ok {
+		return false
+	}
+	delete(t.rows, id)
+	t.store.record(func() {
+		t.rows[id] = previous
+	})
+	return true
+}
+
+// Select строки, для которых match вернула true, по возрастанию id
+func (t *MemoryTable[T]) Select(match func(row T) bool) []T {
+	ids := slices.SortedFunc(maps.Keys(t.rows), cmp.Compare[int64])
+	var rows []T
+	for _, id := range ids {
+		if row := t.rows[id]; match(row) {
+			rows = append(rows, row)
+		}
+	}
+	return rows
+}
@@ -0,0 +1,100 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"testing"
+)
+
+func TestMemoryStore(t *testing.T) {
+	ctx := context.Background()
+	insert := func(table *MemoryTable[string], value string) int64 {
+		return table.Insert(func(int64) string { return value })
+	}
+	t.Run("should rollback all tables on error", func(t *testing.T) {
+		store := NewMemoryStore()
+		employees, roles := NewMemoryTable[string](store), NewMemoryTable[string](store)
+		want := errors.New("duplicate")
+		err := store.WithTx(ctx, TxOptions{}, func(ctx context.Context, tx *sqlx.Tx) error {
+			assert.Nil(t, tx)
+			insert(employees, "john")
+			insert(roles, "admin")
+			return want
+		})
+		assert.ErrorIs(t, err, want)
+		assert.Empty(t, employees.Select(func(string) bool { return true }))
+		assert.Empty(t, roles.Select(func(string) bool { return true }))
+		assert.Equal(t, int64(1), insert(roles, "admin"), "id sequence should be rolled back too")
+	})
+	t.Run("nested error should rollback only nested changes", func(t *testing.T) {
+		store := NewMemoryStore()
+		table := NewMemoryTable[string](store)
+		err := store.WithTx(ctx, TxOptions{}, func(ctx context.Context, _ *sqlx.Tx) error {
+			insert(table, "kept")
+			nestedErr := store.WithTx(ctx, TxOptions{}, func(ctx context.Context, _ *sqlx.Tx) error {
+				insert(table, "dropped")
+				return errors.New("nested")
+			})
+			assert.Error(t, nestedErr)
+			return nil
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"kept"}, table.Select(func(string) bool { return true }))
+	})
+	t.Run("nested error should restore updated and deleted rows", func(t *testing.T) {
+		store := NewMemoryStore()
+		table := NewMemoryTable[string](store)
+		var updated, deleted int64
+		err := store.WithTx(ctx, TxOptions{}, func(ctx context.Context, _ *sqlx.Tx) error {
+			updated, deleted = insert(table, "john"), insert(table, "jane")
+			nestedErr := store.WithTx(ctx, TxOptions{}, func(ctx context.Context, _ *sqlx.Tx) error {
+				table.Put(updated, "johnny")
+				table.Delete(deleted)
+				table.Put(updated, "jonathan")
+				insert(table, "dropped")
+				return errors.New("nested")
+			})
+			assert.Error(t, nestedErr)
+			return nil
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"john", "jane"}, table.Select(func(string) bool { return true }))
+		assert.Equal(t, int64(3), insert(table, "next"))
+	})
+	t.Run("should rollback and rethrow panic", func(t *testing.T) {
+		store := NewMemoryStore()
+		table := NewMemoryTable[string](store)
+		assert.PanicsWithValue(t, "boom", func() {
+			_ = store.WithTx(ctx, TxOptions{}, func(ctx context.Context, _ *sqlx.Tx) error {
+				insert(table, "lost")
+				panic("boom")
+			})
+		})
+		assert.Empty(t, table.Select(func(string) bool { return true }))
+	})
+	t.Run("concurrent transactions should not lose updates", func(t *testing.T) {
+		store := NewMemoryStore()
+		table := NewMemoryTable[int](store)
+		id := table.Insert(func(int64) int { return 0 })
+		var wg sync.WaitGroup
+		for range 50 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_ = store.WithTx(ctx, TxOptions{}, func(ctx context.Context, _ *sqlx.Tx) error {
+					return store.Run(ctx, func() error {
+						value, _ := table.Get(id)
+						table.Put(id, value+1)
+						return nil
+					})
+				})
+			}()
+		}
+		wg.Wait()
+		value, _ := table.Get(id)
+		assert.Equal(t, 50, value)
+	})
+}
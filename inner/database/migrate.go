@@ -0,0 +1,99 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"github.com/pressly/goose/v3"
+	"github.com/pressly/goose/v3/lock"
+	"go.uber.org/zap"
+	"idm/inner/common"
+	"slices"
+)
+
+// MigrateCommands команды подкоманды migrate
+var MigrateCommands = []string{"up", "down", "status", "redo"}
+
+// NewMigrator goose provider для встроенных миграций диалекта db.
+// В Postgres миграции выполняются под advisory lock, поэтому экземпляры,
+// запущенные одновременно, применяют их по очереди. Файл SQLite блокирует сама база.
+func NewMigrator(db *sqlx.DB) (*goose.Provider, error) {
+	dialect := DialectOf(db)
+	fsys, gooseDialect, err := dialect.Migrations()
+	if err != nil {
+		return nil, fmt.Errorf("create migrator: %w", err)
+	}
+	var opts []goose.ProviderOption
+	if !dialect.IsSQLite() {
+		locker, err := lock.NewPostgresSessionLocker()
+		if err != nil {
+			return nil, fmt.Errorf("create migration lock: %w", err)
+		}
+		opts = append(opts, goose.WithSessionLocker(locker))
+	}
+	provider, err := goose.NewProvider(gooseDialect, db.DB, fsys, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("create migrator: %w", err)
+	}
+	return provider, nil
+}
+
+// Migrate выполняет команду migrate: up применяет все новые миграции, down откатывает последнюю,
+// redo откатывает и заново применяет последнюю, status выводит состояние миграций в лог
+func Migrate(ctx context.Context, db *sqlx.DB, command string, logger *common.Logger) error {
+	if !slices.Contains(MigrateCommands, command) {
+		return fmt.Errorf("migrate: unknown command %q, expected one of %v", command, MigrateCommands)
+	}
+	migrator, err := NewMigrator(db)
+	if err != nil {
+		return err
+	}
+	var results []*goose.MigrationResult
+	switch command {
+	case "up":
+		results, err = migrator.Up(ctx)
+	case "down":
+		var result *goose.MigrationResult
+		result, err = migrator.Down(ctx)
+		results = append(results, result)
+	case "redo":
+		results, err = redo(ctx, migrator)
+	case "status":
+		return logStatus(ctx, migrator, logger)
+	}
+	for _, result := range results {
+		if result != nil && result.Error == nil {
+			logger.Info("migration "+result.Direction,
+				zap.String("source", result.Source.Path),
+				zap.Duration("duration", result.Duration))
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("migrate %s: %w", command, err)
+	}
+	return nil
+}
+
+func redo(ctx context.Context, migrator *goose.Provider) ([]*goose.MigrationResult, error) {
+	down, err := migrator.Down(ctx)
+	if err != nil {
+		return []*goose.MigrationResult{down}, err
+	}
+	up, err := migrator.ApplyVersion(ctx, down.Source.Version, true)
+	return []*goose.MigrationResult{down, up}, err
+}
+
+func logStatus(ctx context.Context, migrator *goose.Provider, logger *common.Logger) error {
+	statuses, err := migrator.Status(ctx)
+	if err != nil {
+		return fmt.Errorf("migrate status: %w", err)
+	}
+	for _, status := range statuses {
+		fields := []zap.Field{zap.String("source", status.Source.Path), zap.String("state", string(status.State))}
+		if !status.AppliedAt.IsZero() {
+			fields = append(fields, zap.Time("appliedAt", status.AppliedAt))
+		}
+		logger.Info("migration status", fields...)
+	}
+	return nil
+}
@@ -0,0 +1,31 @@
+package database
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"idm/migrations"
+	"io/fs"
+	"testing"
+)
+
+func TestMigrate(t *testing.T) {
+	t.Run("migrator should find embedded migrations", func(t *testing.T) {
+		files, err := fs.Glob(migrations.FS, "*.sql")
+		assert.NoError(t, err)
+		assert.NotEmpty(t, files)
+		db, _ := newMockDb(t)
+		migrator, err := NewMigrator(db)
+		assert.NoError(t, err)
+		sources := migrator.ListSources()
+		assert.Len(t, sources, len(files))
+		for i := 1; i < len(sources); i++ {
+			assert.Less(t, sources[i-1].Version, sources[i].Version)
+		}
+	})
+	t.Run("unknown command should fail without touching database", func(t *testing.T) {
+		db, mock := newMockDb(t)
+		err := Migrate(context.Background(), db, "sideways", testLogger())
+		assert.ErrorContains(t, err, "unknown command \"sideways\"")
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
@@ -0,0 +1,149 @@
+package database
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/zap"
+	"idm/inner/common"
+	"net"
+	"sync/atomic"
+	"time"
+)
+
+// Router выбирает базу для транзакции: запись и транзакции, в которых читаются свои же изменения,
+// идут в основную базу, транзакции только для чтения - по кругу на исправные реплики.
+// Если исправных реплик нет, чтение идёт в основную базу.
+type Router struct {
+	primary  *sqlx.DB
+	replicas []*replica
+	next     atomic.Uint64
+	logger   *common.Logger
+}
+
+type replica struct {
+	db      *sqlx.DB
+	healthy atomic.Bool
+}
+
+// NewRouter реплики считаются исправными до первой неудачной проверки или ошибки соединения
+func NewRouter(primary *sqlx.DB, replicas []*sqlx.DB, logger *common.Logger) *Router {
+	router := &Router{primary: primary, logger: logger}
+	for _, db := range replicas {
+		r := &replica{db: db}
+		r.healthy.Store(true)
+		router.replicas = append(router.replicas, r)
+	}
+	return router
+}
+
+func (r *Router) Primary() *sqlx.DB {
+	return r.primary
+}
+
+// Replicas пулы всех реплик, включая неисправные
+func (r *Router) Replicas() []*sqlx.DB {
+	replicas := make([]*sqlx.DB, 0, len(r.replicas))
+	for _, candidate := range r.replicas {
+		replicas = append(replicas, candidate.db)
+	}
+	return replicas
+}
+
+// Reader исправная реплика или основная база, если исправных реплик нет
+func (r *Router) Reader() *sqlx.DB {
+	count := uint64(len(r.replicas))
+	start := r.next.Add(1)
+	for i := uint64(0); i < count; i++ {
+		if candidate := r.replicas[(start+i)%count]; candidate.healthy.Load() {
+			return candidate.db
+		}
+	}
+	return r.primary
+}
+
+// route база транзакции: вложенная транзакция остаётся в базе внешней
+func (r *Router) route(ctx context.Context, opts TxOptions) *sqlx.DB {
+	if outer, ok := ctx.Value(txKey{}).(*txState); ok && r.owns(outer.db) {
+		return outer.db
+	}
+	if opts.ReadOnly {
+		return r.Reader()
+	}
+	return r.primary
+}
+
+func (r *Router) owns(db *sqlx.DB) bool {
+	return db == r.primary || r.find(db) >= 0
+}
+
+func (r *Router) find(db *sqlx.DB) int {
+	for i, candidate := range r.replicas {
+		if candidate.db == db {
+			return i
+		}
+	}
+	return -1
+}
+
+// markUnhealthy исключает реплику из чтения до следующей успешной проверки CheckHealth
+func (r *Router) markUnhealthy(db *sqlx.DB, err error) {
+	if i := r.find(db); i >= 0 && r.replicas[i].healthy.Swap(false) {
+		r.logger.Warn("replica is unhealthy", zap.Int("replica", i), zap.Error(err))
+	}
+}
+
+// CheckHealth проверяет соединение с каждой репликой
+func (r *Router) CheckHealth(ctx context.Context, timeout time.Duration) {
+	for i, candidate := range r.replicas {
+		pingCtx, cancel := context.WithTimeout(ctx, timeout)
+		err := candidate.db.PingContext(pingCtx)
+		cancel()
+		if err != nil {
+			r.markUnhealthy(candidate.db, err)
+			continue
+		}
+		if !candidate.healthy.Swap(true) {
+			r.logger.Info("replica is healthy again", zap.Int("replica", i))
+		}
+	}
+}
+
+// StartHealthCheck проверяет реплики каждые interval, пока не завершён ctx
+func (r *Router) StartHealthCheck(ctx context.Context, interval time.Duration) {
+	if len(r.replicas) == 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				r.CheckHealth(ctx, interval)
+			}
+		}
+	}()
+}
+
+// Close закрывает пулы реплик, основная база закрывается её владельцем
+func (r *Router) Close() error {
+	var errs []error
+	for _, candidate := range r.replicas {
+		errs = append(errs, candidate.db.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// isConnectionError ошибка соединения с базой, а не запроса.
+// Истёкший или отменённый ctx запроса тоже реализует net.Error, но о реплике ничего не говорит
+func isConnectionError(ctx context.Context, err error) bool {
+	if ctx.Err() != nil || errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+		return false
+	}
+	var netErr net.Error
+	return errors.Is(err, driver.ErrBadConn) || errors.As(err, &netErr)
+}
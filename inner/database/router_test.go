@@ -0,0 +1,118 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"idm/inner/common"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestRouter(t *testing.T) {
+	ctx := context.Background()
+	readOnly := TxOptions{Tenant: common.SingleTenant("acme"), ReadOnly: true}
+	t.Run("reader should rotate healthy replicas", func(t *testing.T) {
+		primary, _ := newMockDb(t)
+		first, _ := newMockDb(t)
+		second, _ := newMockDb(t)
+		router := NewRouter(primary, []*sqlx.DB{first, second}, testLogger())
+		assert.NotSame(t, router.Reader(), router.Reader())
+		router.markUnhealthy(first, errors.New("connection refused"))
+		assert.Same(t, second, router.Reader())
+		assert.Same(t, second, router.Reader())
+		router.markUnhealthy(second, errors.New("connection refused"))
+		assert.Same(t, primary, router.Reader())
+	})
+	t.Run("writes and nested transactions should use primary", func(t *testing.T) {
+		primary, _ := newMockDb(t)
+		replica, _ := newMockDb(t)
+		router := NewRouter(primary, []*sqlx.DB{replica}, testLogger())
+		assert.Same(t, primary, router.route(ctx, TxOptions{}))
+		assert.Same(t, replica, router.route(ctx, readOnly))
+		inTx := context.WithValue(ctx, txKey{}, &txState{db: primary})
+		assert.Same(t, primary, router.route(inTx, readOnly))
+	})
+	t.Run("read should fall back to primary when replica is down", func(t *testing.T) {
+		primary, primaryMock := newMockDb(t)
+		replica, replicaMock := newMockDb(t)
+		router := NewRouter(primary, []*sqlx.DB{replica}, testLogger())
+		replicaMock.ExpectBegin().WillReturnError(&net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")})
+		primaryMock.ExpectBegin()
+		primaryMock.ExpectExec("SET LOCAL").WillReturnResult(sqlmock.NewResult(0, 0))
+		primaryMock.ExpectCommit()
+		err := NewRoutedTxManager(router, testLogger(), 1).WithTx(ctx, readOnly, func(ctx context.Context, tx *sqlx.Tx) error {
+			return nil
+		})
+		assert.NoError(t, err)
+		assert.NoError(t, primaryMock.ExpectationsWereMet())
+		assert.Same(t, primary, router.Reader())
+	})
+	t.Run("request timeout should not mark replica unhealthy", func(t *testing.T) {
+		primary, primaryMock := newMockDb(t)
+		replica, replicaMock := newMockDb(t)
+		router := NewRouter(primary, []*sqlx.DB{replica}, testLogger())
+		replicaMock.ExpectBegin()
+		replicaMock.ExpectExec("SET LOCAL").WillReturnResult(sqlmock.NewResult(0, 0))
+		replicaMock.ExpectRollback()
+		timeoutCtx, cancel := context.WithTimeout(ctx, time.Millisecond)
+		defer cancel()
+		err := NewRoutedTxManager(router, testLogger(), 1).WithTx(timeoutCtx, readOnly, func(ctx context.Context, tx *sqlx.Tx) error {
+			<-ctx.Done()
+			return ctx.Err()
+		})
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.NoError(t, replicaMock.ExpectationsWereMet())
+		assert.NoError(t, primaryMock.ExpectationsWereMet())
+		assert.Same(t, replica, router.Reader())
+	})
+	t.Run("context errors are not connection errors", func(t *testing.T) {
+		assert.False(t, isConnectionError(ctx, context.DeadlineExceeded))
+		assert.False(t, isConnectionError(ctx, fmt.Errorf("query: %w", context.Canceled)))
+		canceled, cancel := context.WithCancel(ctx)
+		cancel()
+		assert.False(t, isConnectionError(canceled, &net.OpError{Op: "read", Net: "tcp", Err: errors.New("i/o timeout")}))
+		assert.True(t, isConnectionError(ctx, &net.OpError{Op: "read", Net: "tcp", Err: errors.New("connection reset by peer")}))
+	})
+	t.Run("single attempt read should not fail over", func(t *testing.T) {
+		primary, primaryMock := newMockDb(t)
+		replica, replicaMock := newMockDb(t)
+		router := NewRouter(primary, []*sqlx.DB{replica}, testLogger())
+		replicaMock.ExpectBegin()
+		replicaMock.ExpectExec("SET LOCAL").WillReturnResult(sqlmock.NewResult(0, 0))
+		replicaMock.ExpectRollback()
+		opts := readOnly
+		opts.SingleAttempt = true
+		calls := 0
+		err := NewRoutedTxManager(router, testLogger(), 3).WithTx(ctx, opts, func(ctx context.Context, tx *sqlx.Tx) error {
+			calls++
+			return &net.OpError{Op: "read", Net: "tcp", Err: errors.New("connection reset by peer")}
+		})
+		var netErr net.Error
+		assert.ErrorAs(t, err, &netErr)
+		assert.Equal(t, 1, calls)
+		assert.NoError(t, replicaMock.ExpectationsWereMet())
+		assert.NoError(t, primaryMock.ExpectationsWereMet())
+		assert.Same(t, primary, router.Reader())
+	})
+	t.Run("health check should return recovered replica", func(t *testing.T) {
+		primary, _ := newMockDb(t)
+		db, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = db.Close() })
+		replica := sqlx.NewDb(db, "postgres")
+		router := NewRouter(primary, []*sqlx.DB{replica}, testLogger())
+		mock.ExpectPing().WillReturnError(errors.New("connection refused"))
+		router.CheckHealth(ctx, time.Second)
+		assert.Same(t, primary, router.Reader())
+		mock.ExpectPing()
+		router.CheckHealth(ctx, time.Second)
+		assert.Same(t, replica, router.Reader())
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
@@ -0,0 +1,38 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"idm/inner/common"
+)
+
+// TenantSetting параметр транзакции, по которому политики RLS отбирают строки арендатора
+const TenantSetting = "app.tenant_id"
+
+// AllTenantsSetting значение TenantSetting, открывающее строки всех арендаторов (супер-администратор)
+const AllTenantsSetting = "*"
+
+// SetTenant выполняет SET LOCAL app.tenant_id: значение действует до конца транзакции
+// и не попадает в следующие транзакции того же соединения из пула.
+// Без SetTenant политики RLS не показывают ни одной строки.
+func SetTenant(ctx context.Context, tx *sqlx.Tx, tenant common.Tenant) error {
+	value := tenant.Id
+	if tenant.All {
+		value = AllTenantsSetting
+	}
+	// SET не принимает параметры запроса, значение экранируется как литерал
+	if _, err := tx.ExecContext(ctx, "SET LOCAL "+TenantSetting+" = "+pq.QuoteLiteral(value)); err != nil {
+		return fmt.Errorf("set tenant %q: %w", value, err)
+	}
+	return nil
+}
+
+// InTenantTx выполняет fn в транзакции арендатора: commit, если fn вернула nil, иначе rollback.
+// Внутри WithTx запросы fn выполняются в уже открытой транзакции.
+func InTenantTx(ctx context.Context, db *sqlx.DB, tenant common.Tenant, fn func(tx *sqlx.Tx) error) error {
+	return WithTx(ctx, db, TxOptions{Tenant: tenant}, func(_ context.Context, tx *sqlx.Tx) error {
+		return fn(tx)
+	})
+}
@@ -0,0 +1,92 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"idm/inner/common"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func newMockDb(t *testing.T) (*sqlx.DB, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = db.Close() })
+	return sqlx.NewDb(db, "postgres"), mock
+}
+
+func TestInTenantTx(t *testing.T) {
+	ctx := context.Background()
+	t.Run("should set tenant before queries and commit", func(t *testing.T) {
+		db, mock := newMockDb(t)
+		mock.ExpectBegin()
+		mock.ExpectExec(regexp.QuoteMeta("SET LOCAL app.tenant_id = 'acme'")).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec("DELETE FROM employee").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+		err := InTenantTx(ctx, db, common.SingleTenant("acme"), func(tx *sqlx.Tx) error {
+			_, err := tx.Exec("DELETE FROM employee")
+			return err
+		})
+		assert.NoError(t, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+	t.Run("should open all tenants for super admin", func(t *testing.T) {
+		db, mock := newMockDb(t)
+		mock.ExpectBegin()
+		mock.ExpectExec(regexp.QuoteMeta("SET LOCAL app.tenant_id = '*'")).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectCommit()
+		assert.NoError(t, InTenantTx(ctx, db, common.AllTenants(), func(tx *sqlx.Tx) error { return nil }))
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+	t.Run("should quote tenant id", func(t *testing.T) {
+		db, mock := newMockDb(t)
+		mock.ExpectBegin()
+		mock.ExpectExec(regexp.QuoteMeta("SET LOCAL app.tenant_id = 'x'' OR ''1'")).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectCommit()
+		assert.NoError(t, InTenantTx(ctx, db, common.SingleTenant("x' OR '1"), func(tx *sqlx.Tx) error { return nil }))
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+	t.Run("should rollback on error", func(t *testing.T) {
+		db, mock := newMockDb(t)
+		want := errors.New("query failed")
+		mock.ExpectBegin()
+		mock.ExpectExec("SET LOCAL").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectRollback()
+		err := InTenantTx(ctx, db, common.SingleTenant("acme"), func(tx *sqlx.Tx) error { return want })
+		assert.ErrorIs(t, err, want)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+	t.Run("should not run queries when tenant is not set", func(t *testing.T) {
+		db, mock := newMockDb(t)
+		mock.ExpectBegin()
+		mock.ExpectExec("SET LOCAL").WillReturnError(errors.New("connection reset"))
+		mock.ExpectRollback()
+		called := false
+		err := InTenantTx(ctx, db, common.SingleTenant("acme"), func(tx *sqlx.Tx) error {
+			called = true
+			return nil
+		})
+		assert.Error(t, err)
+		assert.False(t, called)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestSetTenant(t *testing.T) {
+	t.Run("should stop on cancelled context", func(t *testing.T) {
+		db, mock := newMockDb(t)
+		mock.ExpectBegin()
+		mock.ExpectExec("SET LOCAL").WillDelayFor(time.Second).WillReturnResult(sqlmock.NewResult(0, 0))
+		tx, err := db.Beginx()
+		require.NoError(t, err)
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		err = SetTenant(ctx, tx, common.SingleTenant("acme"))
+		assert.ErrorIs(t, err, sqlmock.ErrCancelled)
+	})
+}
@@ -0,0 +1,168 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/zap"
+	"idm/inner/common"
+	"math/rand/v2"
+	"time"
+)
+
+// TxOptions параметры транзакции WithTx
+type TxOptions struct {
+	// Tenant арендатор, строки которого пропускают политики RLS
+	Tenant common.Tenant
+	// Isolation уровень изоляции, sql.LevelDefault - уровень базы (READ COMMITTED)
+	Isolation sql.IsolationLevel
+	ReadOnly  bool
+	// SingleAttempt единица работы выполняется один раз и не переходит на другую базу:
+	// для fn с побочными эффектами вне базы, например записи строк выгрузки в ответ
+	SingleAttempt bool
+}
+
+// TxFunc выполняется в транзакции; ctx несёт транзакцию для вложенных вызовов WithTx
+type TxFunc func(ctx context.Context, tx *sqlx.Tx) error
+
+// TxManager открывает единицу работы: все запросы fn выполняются в одной транзакции
+type TxManager interface {
+	WithTx(ctx context.Context, opts TxOptions, fn TxFunc) error
+}
+
+type txKey struct{}
+
+// txState транзакция, открытая WithTx, и глубина вложенности точек сохранения
+type txState struct {
+	db    *sqlx.DB
+	tx    *sqlx.Tx
+	depth int
+}
+
+// WithTx выполняет fn в транзакции: commit, если fn вернула nil, иначе rollback.
+// Если ctx уже несёт транзакцию той же базы, fn выполняется в ней под точкой сохранения:
+// ошибка fn откатывает только изменения fn. Параметры вложенного вызова не применяются,
+// действуют уровень изоляции и арендатор внешней транзакции.
+func WithTx(ctx context.Context, db *sqlx.DB, opts TxOptions, fn TxFunc) (err error) {
+	if outer, ok := ctx.Value(txKey{}).(*txState); ok && outer.db == db {
+		return withSavepoint(ctx, outer, fn)
+	}
+	tx, err := db.BeginTxx(ctx, &sql.TxOptions{Isolation: opts.Isolation, ReadOnly: opts.ReadOnly})
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			_ = tx.Rollback()
+			panic(p)
+		}
+		if err != nil {
+			_ = tx.Rollback()
+			return
+		}
+		if err = tx.Commit(); err != nil {
+			err = fmt.Errorf("commit transaction: %w", err)
+		}
+	}()
+	if DialectOf(db).RowLevelSecurity() {
+		if err = SetTenant(ctx, tx, opts.Tenant); err != nil {
+			return err
+		}
+	}
+	return fn(context.WithValue(ctx, txKey{}, &txState{db: db, tx: tx}), tx)
+}
+
+func withSavepoint(ctx context.Context, outer *txState, fn TxFunc) (err error) {
+	state := &txState{db: outer.db, tx: outer.tx, depth: outer.depth + 1}
+	savepoint := fmt.Sprintf("sp_%d", state.depth)
+	if _, err = state.tx.ExecContext(ctx, "SAVEPOINT "+savepoint); err != nil {
+		return fmt.Errorf("create savepoint: %w", err)
+	}
+	// при панике точку сохранения не трогаем: внешняя транзакция откатится целиком
+	if err = fn(context.WithValue(ctx, txKey{}, state), state.tx); err != nil {
+		if _, rbErr := state.tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT "+savepoint); rbErr != nil {
+			return fmt.Errorf("rollback to savepoint: %v: %w", rbErr, err)
+		}
+		return err
+	}
+	if _, err = state.tx.ExecContext(ctx, "RELEASE SAVEPOINT "+savepoint); err != nil {
+		return fmt.Errorf("release savepoint: %w", err)
+	}
+	return nil
+}
+
+const (
+	retryBaseDelay = 10 * time.Millisecond
+	retryMaxDelay  = 500 * time.Millisecond
+)
+
+// DbTxManager TxManager поверх пула соединений.
+// Единица работы, откаченная с 40001 или 40P01, повторяется до maxAttempts раз,
+// поэтому fn не должна иметь побочных эффектов вне базы, иначе нужен TxOptions.SingleAttempt.
+// Транзакции с TxOptions.ReadOnly выполняются на репликах Router.
+type DbTxManager struct {
+	router      *Router
+	logger      *common.Logger
+	maxAttempts int
+}
+
+// NewTxManager все транзакции выполняются в db
+func NewTxManager(db *sqlx.DB, logger *common.Logger, maxAttempts int) *DbTxManager {
+	return NewRoutedTxManager(NewRouter(db, nil, logger), logger, maxAttempts)
+}
+
+func NewRoutedTxManager(router *Router, logger *common.Logger, maxAttempts int) *DbTxManager {
+	return &DbTxManager{router: router, logger: logger, maxAttempts: max(maxAttempts, 1)}
+}
+
+// WithTx внутри уже открытой транзакции повтор не выполняется: ошибку получит внешний вызов WithTx
+func (m *DbTxManager) WithTx(ctx context.Context, opts TxOptions, fn TxFunc) error {
+	db := m.router.route(ctx, opts)
+	if outer, ok := ctx.Value(txKey{}).(*txState); ok && outer.db == db {
+		return WithTx(ctx, db, opts, fn)
+	}
+	if opts.SingleAttempt {
+		err := WithTx(ctx, db, opts, fn)
+		if err != nil && db != m.router.Primary() && isConnectionError(ctx, err) {
+			m.router.markUnhealthy(db, err)
+		}
+		return err
+	}
+	for attempt := 1; ; attempt++ {
+		err := WithTx(ctx, db, opts, fn)
+		if err != nil && db != m.router.Primary() && isConnectionError(ctx, err) {
+			// реплика недоступна: попытка не тратится, чтение повторяется на другой реплике или основной базе
+			m.router.markUnhealthy(db, err)
+			db = m.router.route(ctx, opts)
+			attempt--
+			continue
+		}
+		if err == nil || !IsRetryable(err) || attempt >= m.maxAttempts {
+			return err
+		}
+		delay := retryDelay(attempt)
+		m.logger.Warn("transaction retry",
+			zap.Int("attempt", attempt),
+			zap.Int("maxAttempts", m.maxAttempts),
+			zap.Duration("delay", delay),
+			zap.Error(err))
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return fmt.Errorf("transaction retry: %w", ctx.Err())
+		case <-timer.C:
+		}
+	}
+}
+
+// retryDelay экспоненциальная задержка со случайным разбросом (full jitter),
+// чтобы конфликтующие транзакции не повторялись одновременно
+func retryDelay(attempt int) time.Duration {
+	ceiling := retryMaxDelay
+	if shift := attempt - 1; shift < 16 {
+		ceiling = min(retryBaseDelay<<shift, retryMaxDelay)
+	}
+	return time.Duration(rand.Int64N(int64(ceiling))) + 1
+}
@@ -0,0 +1,185 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+	"idm/inner/common"
+	"testing"
+)
+
+func TestWithTx(t *testing.T) {
+	ctx := context.Background()
+	acme := TxOptions{Tenant: common.SingleTenant("acme"), Isolation: sql.LevelSerializable}
+	t.Run("should commit transaction", func(t *testing.T) {
+		db, mock := newMockDb(t)
+		mock.ExpectBegin()
+		mock.ExpectExec("SET LOCAL").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec("INSERT INTO role").WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+		err := NewTxManager(db, testLogger(), 1).WithTx(ctx, acme, func(ctx context.Context, tx *sqlx.Tx) error {
+			_, err := tx.ExecContext(ctx, "INSERT INTO role")
+			return err
+		})
+		assert.NoError(t, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+	t.Run("should wrap begin error", func(t *testing.T) {
+		db, mock := newMockDb(t)
+		want := errors.New("connection refused")
+		mock.ExpectBegin().WillReturnError(want)
+		err := WithTx(ctx, db, acme, func(ctx context.Context, tx *sqlx.Tx) error { return nil })
+		assert.ErrorIs(t, err, want)
+		assert.ErrorContains(t, err, "begin transaction")
+	})
+	t.Run("should rollback and rethrow panic", func(t *testing.T) {
+		db, mock := newMockDb(t)
+		mock.ExpectBegin()
+		mock.ExpectExec("SET LOCAL").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectRollback()
+		assert.PanicsWithValue(t, "boom", func() {
+			_ = WithTx(ctx, db, acme, func(ctx context.Context, tx *sqlx.Tx) error { panic("boom") })
+		})
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+	t.Run("nested call should use savepoint of outer transaction", func(t *testing.T) {
+		db, mock := newMockDb(t)
+		mock.ExpectBegin()
+		mock.ExpectExec("SET LOCAL").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec("SAVEPOINT sp_1").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec("RELEASE SAVEPOINT sp_1").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectCommit()
+		err := WithTx(ctx, db, acme, func(ctx context.Context, outer *sqlx.Tx) error {
+			return WithTx(ctx, db, TxOptions{}, func(ctx context.Context, inner *sqlx.Tx) error {
+				assert.Same(t, outer, inner)
+				return nil
+			})
+		})
+		assert.NoError(t, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+	t.Run("nested error should rollback only savepoint", func(t *testing.T) {
+		db, mock := newMockDb(t)
+		want := errors.New("duplicate")
+		mock.ExpectBegin()
+		mock.ExpectExec("SET LOCAL").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec("SAVEPOINT sp_1").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec("ROLLBACK TO SAVEPOINT sp_1").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectCommit()
+		err := WithTx(ctx, db, acme, func(ctx context.Context, tx *sqlx.Tx) error {
+			nestedErr := WithTx(ctx, db, acme, func(ctx context.Context, tx *sqlx.Tx) error { return want })
+			assert.ErrorIs(t, nestedErr, want)
+			return nil
+		})
+		assert.NoError(t, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+	t.Run("repository call inside unit of work should join it", func(t *testing.T) {
+		db, mock := newMockDb(t)
+		mock.ExpectBegin()
+		mock.ExpectExec("SET LOCAL").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec("SAVEPOINT sp_1").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec("DELETE FROM role").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("RELEASE SAVEPOINT sp_1").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectCommit()
+		err := WithTx(ctx, db, acme, func(ctx context.Context, tx *sqlx.Tx) error {
+			return InTenantTx(ctx, db, acme.Tenant, func(tx *sqlx.Tx) error {
+				_, err := tx.ExecContext(ctx, "DELETE FROM role")
+				return err
+			})
+		})
+		assert.NoError(t, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func testLogger() *common.Logger {
+	return &common.Logger{Logger: zap.NewNop()}
+}
+
+func TestTxManagerRetry(t *testing.T) {
+	ctx := context.Background()
+	opts := TxOptions{Tenant: common.SingleTenant("acme"), Isolation: sql.LevelSerializable}
+	conflict := &pq.Error{Code: "40001", Message: "could not serialize access"}
+	expectFailedAttempt := func(mock sqlmock.Sqlmock, err error) {
+		mock.ExpectBegin()
+		mock.ExpectExec("SET LOCAL").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec("UPDATE role").WillReturnError(err)
+		mock.ExpectRollback()
+	}
+	update := func(ctx context.Context, tx *sqlx.Tx) error {
+		_, err := tx.ExecContext(ctx, "UPDATE role")
+		return err
+	}
+	t.Run("should retry serialization failure and log attempt", func(t *testing.T) {
+		db, mock := newMockDb(t)
+		core, logs := observer.New(zap.WarnLevel)
+		manager := NewTxManager(db, &common.Logger{Logger: zap.New(core)}, 3)
+		expectFailedAttempt(mock, conflict)
+		expectFailedAttempt(mock, &pq.Error{Code: "40P01", Message: "deadlock detected"})
+		mock.ExpectBegin()
+		mock.ExpectExec("SET LOCAL").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec("UPDATE role").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+		assert.NoError(t, manager.WithTx(ctx, opts, update))
+		assert.NoError(t, mock.ExpectationsWereMet())
+		assert.Equal(t, 2, logs.FilterMessage("transaction retry").Len())
+	})
+	t.Run("should give up after max attempts", func(t *testing.T) {
+		db, mock := newMockDb(t)
+		expectFailedAttempt(mock, conflict)
+		expectFailedAttempt(mock, conflict)
+		err := NewTxManager(db, testLogger(), 2).WithTx(ctx, opts, update)
+		assert.ErrorIs(t, err, conflict)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+	t.Run("should not retry other errors", func(t *testing.T) {
+		db, mock := newMockDb(t)
+		want := &pq.Error{Code: "23505", Message: "duplicate key"}
+		expectFailedAttempt(mock, want)
+		err := NewTxManager(db, testLogger(), 3).WithTx(ctx, opts, update)
+		assert.ErrorIs(t, err, want)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+	t.Run("should not retry nested unit of work", func(t *testing.T) {
+		db, mock := newMockDb(t)
+		manager := NewTxManager(db, testLogger(), 3)
+		mock.ExpectBegin()
+		mock.ExpectExec("SET LOCAL").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec("SAVEPOINT sp_1").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec("UPDATE role").WillReturnError(conflict)
+		mock.ExpectExec("ROLLBACK TO SAVEPOINT sp_1").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectRollback()
+		err := WithTx(ctx, db, opts, func(ctx context.Context, tx *sqlx.Tx) error {
+			return manager.WithTx(ctx, opts, update)
+		})
+		assert.ErrorIs(t, err, conflict)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+	t.Run("should stop waiting when context is done", func(t *testing.T) {
+		db, mock := newMockDb(t)
+		ctx, cancel := context.WithCancel(ctx)
+		mock.ExpectBegin()
+		mock.ExpectExec("SET LOCAL").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectRollback()
+		err := NewTxManager(db, testLogger(), 3).WithTx(ctx, opts, func(ctx context.Context, tx *sqlx.Tx) error {
+			cancel()
+			return conflict
+		})
+		assert.ErrorIs(t, err, context.Canceled)
+	})
+}
+
+func TestRetryDelay(t *testing.T) {
+	for attempt := 1; attempt < 100; attempt++ {
+		delay := retryDelay(attempt)
+		assert.Positive(t, delay)
+		assert.LessOrEqual(t, delay, retryMaxDelay)
+	}
+}
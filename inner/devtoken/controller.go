@@ -0,0 +1,74 @@
+package devtoken
+
+import (
+	"github.com/gofiber/fiber/v3"
+	"go.uber.org/zap"
+	"idm/inner/common"
+	"idm/inner/web"
+)
+
+type Controller struct {
+	server    *web.Server
+	issuer    *Issuer
+	validator Validator
+	logger    *common.Logger
+}
+
+type Validator interface {
+	Validate(request any) error
+}
+
+func NewController(server *web.Server, issuer *Issuer, validator Validator, logger *common.Logger) *Controller {
+	return &Controller{
+		server:    server,
+		issuer:    issuer,
+		validator: validator,
+		logger:    logger,
+	}
+}
+
+func (c *Controller) RegisterRoutes() {
+	c.server.GroupInternal.Post("/dev/token", c.IssueToken)
+	c.server.GroupInternal.Get("/dev/jwks", c.GetJwkSet)
+}
+
+// IssueToken godoc
+// @Summary      Issue development token
+// @Description  Выпускает подписанный JWT с заданными realm ролями. Доступно только при DEV_TOKEN_ISSUER_ENABLED=true
+// @Tags         dev
+// @Accept       json
+// @Produce      json
+// @Param        request body TokenRequest true "Token claims"
+// @Success      200 {object} TokenResponse
+// @Failure      400 {object} common.Response[any]
+// @Failure      500 {object} common.Response[any]
+// @Router       /internal/dev/token [post]
+func (c *Controller) IssueToken(ctx fiber.Ctx) error {
+	var request TokenRequest
+	if err := ctx.Bind().Body(&request); err != nil {
+		c.logger.Error("issue dev token", zap.Error(err))
+		return common.ErrResponse(ctx, fiber.StatusBadRequest, err.Error())
+	}
+	if err := c.validator.Validate(request); err != nil {
+		c.logger.Error("issue dev token", zap.Error(err))
+		return common.ErrResponse(ctx, fiber.StatusBadRequest, err.Error())
+	}
+	token, err := c.issuer.Issue(request)
+	if err != nil {
+		c.logger.Error("issue dev token", zap.Error(err))
+		return common.ErrResponse(ctx, fiber.StatusInternalServerError, err.Error())
+	}
+	c.logger.Info("dev token issued", zap.String("sub", request.Subject), zap.Strings("roles", request.Roles))
+	return common.OkResponse(ctx, token)
+}
+
+// GetJwkSet godoc
+// @Summary      Development JWKS
+// @Description  Открытые ключи для проверки токенов, выпущенных /internal/dev/token
+// @Tags         dev
+// @Produce      json
+// @Success      200 {object} JwkSet
+// @Router       /internal/dev/jwks [get]
+func (c *Controller) GetJwkSet(ctx fiber.Ctx) error {
+	return ctx.JSON(c.issuer.JwkSet())
+}
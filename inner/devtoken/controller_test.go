@@ -0,0 +1,117 @@
+package devtoken
+
+import (
+	"encoding/json"
+	"github.com/gofiber/fiber/v3"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"idm/inner/common"
+	"idm/inner/validator"
+	"idm/inner/web"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func newTestConfig() common.Config {
+	return common.Config{
+		KeycloakIssuer:   "http://localhost:8080/realms/dev",
+		KeycloakAudience: "idm",
+		KeycloakClientId: "idm-api",
+	}
+}
+
+// startIssuer поднимает настоящий http сервер, чтобы AuthMiddleware загрузил JWKS по сети
+func startIssuer(t *testing.T, cfg common.Config) string {
+	t.Helper()
+	issuer, err := NewIssuer(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := web.NewServer()
+	logger := &common.Logger{Logger: zap.NewNop()}
+	NewController(server, issuer, validator.New(), logger).RegisterRoutes()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() { _ = server.App.Listener(ln, fiber.ListenConfig{DisableStartupMessage: true}) }()
+	t.Cleanup(func() { _ = server.App.Shutdown() })
+	return "http://" + ln.Addr().String()
+}
+
+func requestToken(t *testing.T, baseUrl string, body string) (int, common.Response[TokenResponse]) {
+	t.Helper()
+	resp, err := http.Post(baseUrl+"/api/internal/dev/token", fiber.MIMEApplicationJSON, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var result common.Response[TokenResponse]
+	_ = json.Unmarshal(data, &result)
+	return resp.StatusCode, result
+}
+
+func TestDevTokenIssuer(t *testing.T) {
+	cfg := newTestConfig()
+	baseUrl := startIssuer(t, cfg)
+	t.Run("token validated by unchanged jwks middleware", func(t *testing.T) {
+		a := assert.New(t)
+		status, result := requestToken(t, baseUrl, `{"sub": "dev-user", "roles": ["IDM_ADMIN"]}`)
+		a.Equal(http.StatusOK, status)
+		a.Equal("Bearer", result.Data.TokenType)
+		a.Equal(int64(3600), result.Data.ExpiresIn)
+
+		authCfg := cfg
+		authCfg.JwtSigningMode = web.SigningModeJwks
+		authCfg.KeycloakJwkUrl = baseUrl + "/api/internal/dev/jwks"
+		app := fiber.New()
+		app.Use(web.AuthMiddleware(authCfg, &common.Logger{Logger: zap.NewNop()}))
+		app.Get("/me", func(c fiber.Ctx) error {
+			claims := c.Locals(web.JwtKey).(*jwt.Token).Claims.(*web.IdmClaims)
+			return c.JSON(claims)
+		})
+		req := httptest.NewRequest(fiber.MethodGet, "/me", nil)
+		req.Header.Set(fiber.HeaderAuthorization, "Bearer "+result.Data.AccessToken)
+		resp, err := app.Test(req)
+		a.NoError(err)
+		a.Equal(http.StatusOK, resp.StatusCode)
+		var claims web.IdmClaims
+		a.NoError(json.NewDecoder(resp.Body).Decode(&claims))
+		a.Equal("dev-user", claims.Subject)
+		a.Equal([]string{web.IdmAdmin}, claims.RealmAccess.Roles)
+		a.Equal("idm-api", claims.AuthorizedParty)
+	})
+	t.Run("roles are required", func(t *testing.T) {
+		a := assert.New(t)
+		status, result := requestToken(t, baseUrl, `{"sub": "dev-user", "roles": []}`)
+		a.Equal(http.StatusBadRequest, status)
+		a.False(result.Success)
+	})
+	t.Run("custom ttl", func(t *testing.T) {
+		a := assert.New(t)
+		status, result := requestToken(t, baseUrl, `{"sub": "dev-user", "roles": ["IDM_USER"], "ttl_seconds": 60}`)
+		a.Equal(http.StatusOK, status)
+		a.Equal(int64(60), result.Data.ExpiresIn)
+	})
+	t.Run("jwks publishes signing key", func(t *testing.T) {
+		a := assert.New(t)
+		resp, err := http.Get(baseUrl + "/api/internal/dev/jwks")
+		a.NoError(err)
+		defer func() { _ = resp.Body.Close() }()
+		var set JwkSet
+		a.NoError(json.NewDecoder(resp.Body).Decode(&set))
+		a.Len(set.Keys, 1)
+		a.Equal("RSA", set.Keys[0].Kty)
+		a.Equal("RS256", set.Keys[0].Alg)
+		a.NotEmpty(set.Keys[0].Kid)
+	})
+}
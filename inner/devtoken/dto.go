@@ -0,0 +1,29 @@
+package devtoken
+
+type TokenRequest struct {
+	Subject           string   `json:"sub" validate:"required,max=255"`
+	PreferredUsername string   `json:"preferred_username" validate:"max=255"`
+	Roles             []string `json:"roles" validate:"required,min=1,dive,required"`
+	Scope             string   `json:"scope" validate:"max=1024"`
+	TtlSeconds        int64    `json:"ttl_seconds" validate:"omitempty,min=1,max=86400"`
+}
+
+type TokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in"`
+}
+
+// Jwk открытый RSA ключ в формате RFC 7517
+type Jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+type JwkSet struct {
+	Keys []Jwk `json:"keys"`
+}
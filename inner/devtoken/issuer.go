@@ -0,0 +1,83 @@
+package devtoken
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"fmt"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"idm/inner/common"
+	"idm/inner/web"
+	"math/big"
+	"time"
+)
+
+const defaultTtl = time.Hour
+
+// Issuer выпускает токены, совместимые с web.IdmClaims, ключом, сгенерированным при старте приложения.
+// Ключ не сохраняется, поэтому после перезапуска все выпущенные токены становятся недействительными.
+type Issuer struct {
+	cfg    common.Config
+	key    *rsa.PrivateKey
+	kid    string
+	minter *web.TokenMinter
+}
+
+func NewIssuer(cfg common.Config) (*Issuer, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, fmt.Errorf("dev token issuer: generate key: %w", err)
+	}
+	kid := uuid.NewString()
+	return &Issuer{
+		cfg:    cfg,
+		key:    key,
+		kid:    kid,
+		minter: web.NewSignerTokenMinter(key, jwt.SigningMethodRS256.Name, kid),
+	}, nil
+}
+
+func (i *Issuer) Issue(request TokenRequest) (TokenResponse, error) {
+	ttl := defaultTtl
+	if request.TtlSeconds > 0 {
+		ttl = time.Duration(request.TtlSeconds) * time.Second
+	}
+	now := time.Now()
+	claims := &web.IdmClaims{
+		RealmAccess:       web.RealmAccessClaims{Roles: request.Roles},
+		Scope:             request.Scope,
+		AuthorizedParty:   i.cfg.KeycloakClientId,
+		PreferredUsername: request.PreferredUsername,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.NewString(),
+			Subject:   request.Subject,
+			Issuer:    i.cfg.KeycloakIssuer,
+			Audience:  jwt.ClaimStrings{i.cfg.KeycloakAudience},
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+		},
+	}
+	token, err := i.minter.Mint(claims)
+	if err != nil {
+		return TokenResponse{}, fmt.Errorf("dev token issuer: sign token: %w", err)
+	}
+	return TokenResponse{
+		AccessToken: token,
+		TokenType:   "Bearer",
+		ExpiresIn:   int64(ttl.Seconds()),
+	}, nil
+}
+
+func (i *Issuer) JwkSet() JwkSet {
+	public := i.key.PublicKey
+	return JwkSet{Keys: []Jwk{{
+		Kty: "RSA",
+		Kid: i.kid,
+		Use: "sig",
+		Alg: jwt.SigningMethodRS256.Name,
+		N:   base64.RawURLEncoding.EncodeToString(public.N.Bytes()),
+		E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes()),
+	}}}
+}
@@ -5,13 +5,12 @@ import (
 	"encoding/json"
 	"errors"
 	"github.com/gofiber/fiber/v3"
-	"github.com/golang-jwt/jwt/v5"
 	"go.uber.org/zap"
 	"idm/inner/common"
+	"idm/inner/export"
 	"idm/inner/web"
-	"slices"
+	"io"
 	"strconv"
-	"time"
 )
 
 type Controller struct {
@@ -20,15 +19,41 @@ type Controller struct {
 	logger  *common.Logger
 }
 
+var (
+	readPolicy = web.Policy{
+		Roles:       []string{web.IdmAdmin, web.IdmUser},
+		Scopes:      []string{web.ScopeEmployeesRead, web.ScopeEmployeesWrite},
+		ClientRoles: []string{web.IdmAdmin, web.IdmUser},
+	}
+	// listPolicy список всех сотрудников доступен с любой из realm ролей
+	listPolicy = web.Policy{
+		AnyRoles:    []string{web.IdmAdmin, web.IdmUser},
+		Scopes:      []string{web.ScopeEmployeesRead, web.ScopeEmployeesWrite},
+		ClientRoles: []string{web.IdmAdmin, web.IdmUser},
+	}
+	// writePolicy менять данные могут только пользователи основного realm
+	writePolicy = web.Policy{
+		Roles:       []string{web.IdmAdmin},
+		Scopes:      []string{web.ScopeEmployeesWrite},
+		ClientRoles: []string{web.IdmAdmin},
+		Realms:      []string{web.PrimaryRealm},
+	}
+)
+
 type Svc interface {
-	FindById(id IdRequest) (employee Response, err error)
-	GetAll(ctx context.Context) ([]Response, error)
-	Add(request NameRequest) (id int64, err error)
-	GetGroupById(ids IdsRequest) ([]Response, error)
-	Delete(id IdRequest) error
-	DeleteGroup(ids IdsRequest) error
-	GetPage(request PageRequest) (PageResponse, error)
-	GetKeySetPage(request PageKeySetRequest) (PageKeySetResponse, error)
+	FindById(ctx context.Context, tenant common.Tenant, id IdRequest) (employee Response, err error)
+	GetAll(ctx context.Context, tenant common.Tenant) ([]Response, error)
+	Add(ctx context.Context, tenant common.Tenant, request NameRequest) (id int64, err error)
+	GetGroupById(ctx context.Context, tenant common.Tenant, ids IdsRequest) ([]Response, error)
+	Delete(ctx context.Context, tenant common.Tenant, id IdRequest) error
+	DeleteGroup(ctx context.Context, tenant common.Tenant, ids IdsRequest) error
+	GetPage(ctx context.Context, tenant common.Tenant, request PageRequest) (PageResponse, error)
+	GetKeySetPage(ctx context.Context, tenant common.Tenant, request PageKeySetRequest) (PageKeySetResponse, error)
+	Search(ctx context.Context, tenant common.Tenant, request SearchRequest) ([]SearchResult, error)
+	Export(ctx context.Context, tenant common.Tenant, request ExportRequest, write func(ExportRow) error) error
+	Import(ctx context.Context, tenant common.Tenant, request ImportRequest, progress func(processed int)) (ImportReport, error)
+	StartImport(ctx context.Context, tenant common.Tenant, request ImportRequest) (ImportJob, error)
+	FindImportJob(ctx context.Context, tenant common.Tenant, id string) (ImportJob, error)
 }
 
 func NewController(server *web.Server, service Svc, logger *common.Logger) *Controller {
@@ -42,7 +67,12 @@ func NewController(server *web.Server, service Svc, logger *common.Logger) *Cont
 func (c *Controller) RegisterRoutes() {
 	c.server.GroupApiV1.Post("/employees", c.CreateEmployee)
 	c.server.GroupApiV1.Get("/employees/page", c.GetPage)
-	c.server.GroupApiV1.Get("/employees/page-key-set", c.GetPage)
+	c.server.GroupApiV1.Get("/employees/page-key-set", c.GetKeySetPage)
+	c.server.GroupApiV1.Get("/employees/search", c.Search)
+	c.server.GroupApiV1.Get("/employees/export", c.Export)
+	c.server.GroupApiV1.Post("/employees/import", c.Import)
+	c.server.GroupApiV1.Get("/employees/import/:jobId", c.GetImportJob)
+	c.server.GroupApiV1.Get("/employees/import/:jobId/errors", c.GetImportErrors)
 	c.server.GroupApiV1.Get("/employees/:id", c.FindById)
 	c.server.GroupApiV1.Get("/employees", c.GetAll)
 	c.server.GroupApiV1.Post("/employees/search", c.GetGroupById)
@@ -58,14 +88,13 @@ func (c *Controller) RegisterRoutes() {
 // @Produce      json
 // @Param        request  body      NameRequest  true  "Employee name payload"
 // @Success      200      {object}  Response  "ID of created employee"
-// @Failure      400      {object}  Response  "Bad request - validation or already exists error"
+// @Failure      400      {object}  Response  "Bad request - validation error"
+// @Failure      409      {object}  Response  "Employee already exists"
 // @Failure      500      {object}  Response  "Internal server error"
 // @Router       /employees [post]
 // @Security BearerAuth
 func (c *Controller) CreateEmployee(ctx fiber.Ctx) error {
-	token := ctx.Locals(web.JwtKey).(*jwt.Token)
-	claims := token.Claims.(*web.IdmClaims)
-	if !slices.Contains(claims.RealmAccess.Roles, web.IdmAdmin) {
+	if !web.Authorize(ctx, writePolicy) {
 		return common.ErrResponse(ctx, fiber.StatusForbidden, "Permission denied")
 	}
 	var request NameRequest
@@ -74,15 +103,21 @@ func (c *Controller) CreateEmployee(ctx fiber.Ctx) error {
 		return common.ErrResponse(ctx, fiber.StatusBadRequest, err.Error())
 	}
 	c.logger.DebugCtx(ctx, "create employee: received request", zap.Any("request", request))
-	newEmployeeId, err := c.service.Add(request)
+	newEmployeeId, err := c.service.Add(ctx.Context(), web.TenantFrom(ctx), request)
 	var reqErr *common.RequestValidationError
 	var existsErr *common.AlreadyExistsError
+	var conflictErr *common.ConflictError
 	if err != nil {
 		c.logger.Error("create employee", zap.Error(err))
-		if errors.As(err, &reqErr) || errors.As(err, &existsErr) {
-			c.logger.Error("create employee", zap.Error(err))
+		if errors.As(err, &reqErr) {
 			return common.ErrResponse(ctx, fiber.StatusBadRequest, err.Error())
 		}
+		if errors.As(err, &existsErr) || errors.As(err, &conflictErr) {
+			return common.ErrResponse(ctx, fiber.StatusConflict, err.Error())
+		}
+		if errors.Is(err, context.DeadlineExceeded) {
+			return common.ErrResponse(ctx, fiber.StatusGatewayTimeout, "timeout exceeded")
+		}
 		return common.ErrResponse(ctx, fiber.StatusInternalServerError, err.Error())
 	}
 	c.logger.Info("employee created", zap.Int64("id", newEmployeeId))
@@ -101,9 +136,7 @@ func (c *Controller) CreateEmployee(ctx fiber.Ctx) error {
 // @Router       /employees/{id} [get]
 // @Security BearerAuth
 func (c *Controller) FindById(ctx fiber.Ctx) error {
-	token := ctx.Locals(web.JwtKey).(*jwt.Token)
-	claims := token.Claims.(*web.IdmClaims)
-	if !slices.Contains(claims.RealmAccess.Roles, web.IdmAdmin) || !slices.Contains(claims.RealmAccess.Roles, web.IdmUser) {
+	if !web.Authorize(ctx, readPolicy) {
 		return common.ErrResponse(ctx, fiber.StatusForbidden, "Permission denied")
 	}
 	param := ctx.Params("id")
@@ -114,7 +147,7 @@ func (c *Controller) FindById(ctx fiber.Ctx) error {
 		return common.ErrResponse(ctx, fiber.StatusBadRequest, err.Error())
 	}
 	id := IdRequest{Id: int64(request)}
-	employee, err := c.service.FindById(id)
+	employee, err := c.service.FindById(ctx.Context(), web.TenantFrom(ctx), id)
 	var reqErr *common.RequestValidationError
 	var notFoundErr *common.NotFoundError
 	if err != nil {
@@ -124,6 +157,8 @@ func (c *Controller) FindById(ctx fiber.Ctx) error {
 			return common.ErrResponse(ctx, fiber.StatusOK, err.Error())
 		case errors.As(err, &reqErr):
 			return common.ErrResponse(ctx, fiber.StatusBadRequest, err.Error())
+		case errors.Is(err, context.DeadlineExceeded):
+			return common.ErrResponse(ctx, fiber.StatusGatewayTimeout, "timeout exceeded")
 		default:
 			return common.ErrResponse(ctx, fiber.StatusInternalServerError, err.Error())
 		}
@@ -140,15 +175,10 @@ func (c *Controller) FindById(ctx fiber.Ctx) error {
 // @Router       /employees [get]
 // @Security BearerAuth
 func (c *Controller) GetAll(ctx fiber.Ctx) error {
-	token := ctx.Locals(web.JwtKey).(*jwt.Token)
-	claims := token.Claims.(*web.IdmClaims)
-	if !(slices.Contains(claims.RealmAccess.Roles, web.IdmAdmin) || slices.Contains(claims.RealmAccess.Roles, web.IdmUser)) {
+	if !web.Authorize(ctx, listPolicy) {
 		return common.ErrResponse(ctx, fiber.StatusForbidden, "Permission denied")
 	}
-	myCxt := ctx.Context()
-	timeoutCtx, cancel := context.WithTimeout(myCxt, time.Second*5)
-	defer cancel()
-	employees, err := c.service.GetAll(timeoutCtx)
+	employees, err := c.service.GetAll(ctx.Context(), web.TenantFrom(ctx))
 	var notFoundErr *common.NotFoundError
 	if err != nil {
 		c.logger.Error("get all employees", zap.Error(err))
@@ -177,9 +207,7 @@ func (c *Controller) GetAll(ctx fiber.Ctx) error {
 // @Router       /employees/search [post]
 // @Security BearerAuth
 func (c *Controller) GetGroupById(ctx fiber.Ctx) error {
-	token := ctx.Locals(web.JwtKey).(*jwt.Token)
-	claims := token.Claims.(*web.IdmClaims)
-	if !slices.Contains(claims.RealmAccess.Roles, web.IdmAdmin) || !slices.Contains(claims.RealmAccess.Roles, web.IdmUser) {
+	if !web.Authorize(ctx, readPolicy) {
 		return common.ErrResponse(ctx, fiber.StatusForbidden, "Permission denied")
 	}
 	var request IdsRequest
@@ -187,7 +215,7 @@ func (c *Controller) GetGroupById(ctx fiber.Ctx) error {
 		c.logger.Error("get employees by ids", zap.Error(err))
 		return common.ErrResponse(ctx, fiber.StatusBadRequest, err.Error())
 	}
-	employees, err := c.service.GetGroupById(request)
+	employees, err := c.service.GetGroupById(ctx.Context(), web.TenantFrom(ctx), request)
 	var reqErr *common.RequestValidationError
 	var notFoundErr *common.NotFoundError
 	if err != nil {
@@ -197,6 +225,8 @@ func (c *Controller) GetGroupById(ctx fiber.Ctx) error {
 			return common.ErrResponse(ctx, fiber.StatusOK, err.Error())
 		case errors.As(err, &reqErr):
 			return common.ErrResponse(ctx, fiber.StatusBadRequest, err.Error())
+		case errors.Is(err, context.DeadlineExceeded):
+			return common.ErrResponse(ctx, fiber.StatusGatewayTimeout, "timeout exceeded")
 		default:
 			return common.ErrResponse(ctx, fiber.StatusInternalServerError, err.Error())
 		}
@@ -211,13 +241,12 @@ func (c *Controller) GetGroupById(ctx fiber.Ctx) error {
 // @Param        id path int true "Employee ID"
 // @Success      200 "Deleted"
 // @Failure      400 {object} Response
+// @Failure      409 {object} Response "Conflicts with related data"
 // @Failure      500 {object} Response
 // @Router       /employees/{id} [delete]
 // @Security BearerAuth
 func (c *Controller) Delete(ctx fiber.Ctx) error {
-	token := ctx.Locals(web.JwtKey).(*jwt.Token)
-	claims := token.Claims.(*web.IdmClaims)
-	if !slices.Contains(claims.RealmAccess.Roles, web.IdmAdmin) {
+	if !web.Authorize(ctx, writePolicy) {
 		return common.ErrResponse(ctx, fiber.StatusForbidden, "Permission denied")
 	}
 	param := ctx.Params("id")
@@ -228,13 +257,18 @@ func (c *Controller) Delete(ctx fiber.Ctx) error {
 		return common.ErrResponse(ctx, fiber.StatusBadRequest, err.Error())
 	}
 	id := IdRequest{Id: int64(request)}
-	err = c.service.Delete(id)
+	err = c.service.Delete(ctx.Context(), web.TenantFrom(ctx), id)
 	var reqErr *common.RequestValidationError
+	var conflictErr *common.ConflictError
 	if err != nil {
 		c.logger.Error("delete employee", zap.Error(err))
 		switch {
 		case errors.As(err, &reqErr):
 			return common.ErrResponse(ctx, fiber.StatusBadRequest, err.Error())
+		case errors.As(err, &conflictErr):
+			return common.ErrResponse(ctx, fiber.StatusConflict, err.Error())
+		case errors.Is(err, context.DeadlineExceeded):
+			return common.ErrResponse(ctx, fiber.StatusGatewayTimeout, "timeout exceeded")
 		default:
 			return common.ErrResponse(ctx, fiber.StatusInternalServerError, err.Error())
 		}
@@ -252,13 +286,12 @@ func (c *Controller) Delete(ctx fiber.Ctx) error {
 // @Param        request body IdsRequest true "IDs"
 // @Success      200 "Batch deleted"
 // @Failure      400 {object} Response
+// @Failure      409 {object} Response "Conflicts with related data"
 // @Failure      500 {object} Response
 // @Router       /employees/batch-delete [delete]
 // @Security BearerAuth
 func (c *Controller) DeleteGroup(ctx fiber.Ctx) error {
-	token := ctx.Locals(web.JwtKey).(*jwt.Token)
-	claims := token.Claims.(*web.IdmClaims)
-	if !slices.Contains(claims.RealmAccess.Roles, web.IdmAdmin) {
+	if !web.Authorize(ctx, writePolicy) {
 		return common.ErrResponse(ctx, fiber.StatusForbidden, "Permission denied")
 	}
 	var request IdsRequest
@@ -268,13 +301,18 @@ func (c *Controller) DeleteGroup(ctx fiber.Ctx) error {
 		return common.ErrResponse(ctx, fiber.StatusBadRequest, err.Error())
 	}
 	c.logger.Debug("delete group employees: received request", zap.Any("request", request))
-	err := c.service.DeleteGroup(request)
+	err := c.service.DeleteGroup(ctx.Context(), web.TenantFrom(ctx), request)
 	var reqErr *common.RequestValidationError
+	var conflictErr *common.ConflictError
 	if err != nil {
 		c.logger.Error("delete group employees by ids", zap.Error(err))
 		switch {
 		case errors.As(err, &reqErr):
 			return common.ErrResponse(ctx, fiber.StatusBadRequest, err.Error())
+		case errors.As(err, &conflictErr):
+			return common.ErrResponse(ctx, fiber.StatusConflict, err.Error())
+		case errors.Is(err, context.DeadlineExceeded):
+			return common.ErrResponse(ctx, fiber.StatusGatewayTimeout, "timeout exceeded")
 		default:
 			return common.ErrResponse(ctx, fiber.StatusInternalServerError, err.Error())
 		}
@@ -290,15 +328,14 @@ func (c *Controller) DeleteGroup(ctx fiber.Ctx) error {
 // @Param        pageNumber query int true "Page number"
 // @Param        pageSize query int true "Page size"
 // @Param        textFilter query string false "Filter by name"
+// @Param        count query string false "How to count total: exact, estimate or none" Enums(exact, estimate, none) default(exact)
 // @Success      200 {array} Response
 // @Failure      400 {object} Response
 // @Failure      500 {object} Response
 // @Router       /employees/page [get]
 // @Security BearerAuth
 func (c *Controller) GetPage(ctx fiber.Ctx) error {
-	token := ctx.Locals(web.JwtKey).(*jwt.Token)
-	claims := token.Claims.(*web.IdmClaims)
-	if !slices.Contains(claims.RealmAccess.Roles, web.IdmAdmin) || !slices.Contains(claims.RealmAccess.Roles, web.IdmUser) {
+	if !web.Authorize(ctx, readPolicy) {
 		return common.ErrResponse(ctx, fiber.StatusForbidden, "Permission denied")
 	}
 	number, err := strconv.ParseInt(ctx.Query("pageNumber", "0"), 10, 64)
@@ -316,8 +353,9 @@ func (c *Controller) GetPage(ctx fiber.Ctx) error {
 		PageSize:   size,
 		PageNumber: number,
 		TextFilter: name,
+		Count:      CountMode(ctx.Query("count")),
 	}
-	employees, err := c.service.GetPage(request)
+	employees, err := c.service.GetPage(ctx.Context(), web.TenantFrom(ctx), request)
 	var reqErr *common.RequestValidationError
 	var notFoundErr *common.NotFoundError
 	if err != nil {
@@ -327,6 +365,8 @@ func (c *Controller) GetPage(ctx fiber.Ctx) error {
 			return common.ErrResponse(ctx, fiber.StatusOK, err.Error())
 		case errors.As(err, &reqErr):
 			return common.ErrResponse(ctx, fiber.StatusBadRequest, err.Error())
+		case errors.Is(err, context.DeadlineExceeded):
+			return common.ErrResponse(ctx, fiber.StatusGatewayTimeout, "timeout exceeded")
 		default:
 			return common.ErrResponse(ctx, fiber.StatusInternalServerError, err.Error())
 		}
@@ -334,21 +374,225 @@ func (c *Controller) GetPage(ctx fiber.Ctx) error {
 	return common.OkResponse(ctx, employees)
 }
 
+// Search godoc
+// @Summary      Search employees
+// @Description  Ищет сотрудников по имени, логину, почте и отделу с учётом опечаток и транслитерации, самые релевантные первыми.
+// @Description  highlight - безопасный HTML: текст экранирован, совпавшие слова выделены <mark>
+// @Tags         employees
+// @Param        q query string true "Search query"
+// @Param        limit query int false "Max results" default(20)
+// @Success      200 {array} SearchResult
+// @Failure      400 {object} Response
+// @Failure      500 {object} Response
+// @Router       /employees/search [get]
+// @Security BearerAuth
+func (c *Controller) Search(ctx fiber.Ctx) error {
+	if !web.Authorize(ctx, readPolicy) {
+		return common.ErrResponse(ctx, fiber.StatusForbidden, "Permission denied")
+	}
+	limit, err := strconv.ParseInt(ctx.Query("limit", "20"), 10, 64)
+	if err != nil {
+		c.logger.Error("search employees: wrong limit", zap.Error(err))
+		return common.ErrResponse(ctx, fiber.StatusBadRequest, err.Error())
+	}
+	request := SearchRequest{Query: ctx.Query("q"), Limit: limit}
+	c.logger.DebugCtx(ctx, "search employees: received request", zap.Any("request", request))
+	employees, err := c.service.Search(ctx.Context(), web.TenantFrom(ctx), request)
+	var reqErr *common.RequestValidationError
+	if err != nil {
+		c.logger.Error("search employees", zap.Error(err))
+		switch {
+		case errors.As(err, &reqErr):
+			return common.ErrResponse(ctx, fiber.StatusBadRequest, err.Error())
+		case errors.Is(err, context.DeadlineExceeded):
+			return common.ErrResponse(ctx, fiber.StatusGatewayTimeout, "timeout exceeded")
+		default:
+			return common.ErrResponse(ctx, fiber.StatusInternalServerError, err.Error())
+		}
+	}
+	return common.OkResponse(ctx, employees)
+}
+
+// Export godoc
+// @Summary      Export employees
+// @Description  Выгружает сотрудников с назначенными ролями потоком, без загрузки всей таблицы в память.
+// @Description  При DB_DRIVER_NAME=memory назначений ролей нет и колонка ролей пустая
+// @Tags         employees
+// @Produce      text/csv
+// @Produce      application/jsonl
+// @Param        format query string false "File format" Enums(csv, jsonl) default(csv)
+// @Param        textFilter query string false "Filter by name"
+// @Success      200 {array} ExportRow
+// @Failure      400 {object} Response
+// @Router       /employees/export [get]
+// @Security BearerAuth
+func (c *Controller) Export(ctx fiber.Ctx) error {
+	if !web.Authorize(ctx, readPolicy) {
+		return common.ErrResponse(ctx, fiber.StatusForbidden, "Permission denied")
+	}
+	format, err := export.ParseFormat(ctx.Query("format", string(export.Csv)))
+	if err != nil {
+		c.logger.Error("export employees", zap.Error(err))
+		return common.ErrResponse(ctx, fiber.StatusBadRequest, err.Error())
+	}
+	tenant := web.TenantFrom(ctx)
+	request := ExportRequest{TextFilter: ctx.Query("textFilter")}
+	c.logger.DebugCtx(ctx, "export employees: received request", zap.Any("request", request), zap.String("format", string(format)))
+	return export.Send(ctx, "employees", format, ExportHeader, c.logger, func(reqCtx context.Context, w *export.Writer) error {
+		return c.service.Export(reqCtx, tenant, request, func(row ExportRow) error {
+			return w.Write(row)
+		})
+	})
+}
+
+// Import godoc
+// @Summary      Import employees from CSV or XLSX
+// @Description  Добавляет сотрудников из файла, сотрудники с тем же логином обновляются. Строки с ошибками пропускаются и попадают в отчёт.
+// @Description  Файл длиннее ImportSyncRows строк или с async=true импортируется в фоне: ответ 202 с задачей, её состояние - GET /employees/import/{jobId}.
+// @Tags         employees
+// @Accept       multipart/form-data
+// @Produce      json
+// @Param        file formData file true "CSV or XLSX file, first row is header"
+// @Param        mapping query string false "Column mapping, e.g. ФИО:name,Почта:email"
+// @Param        dry_run query bool false "Validate and roll back"
+// @Param        async query bool false "Run as background job regardless of size"
+// @Success      200 {object} ImportReport
+// @Success      202 {object} ImportJob
+// @Failure      400 {object} Response
+// @Failure      500 {object} Response
+// @Router       /employees/import [post]
+// @Security BearerAuth
+func (c *Controller) Import(ctx fiber.Ctx) error {
+	if !web.Authorize(ctx, writePolicy) {
+		return common.ErrResponse(ctx, fiber.StatusForbidden, "Permission denied")
+	}
+	request, err := c.readImport(ctx)
+	if err != nil {
+		c.logger.Error("import employees", zap.Error(err))
+		return common.ErrResponse(ctx, fiber.StatusBadRequest, err.Error())
+	}
+	tenant := web.TenantFrom(ctx)
+	if ctx.Query("async") == "true" || len(request.Rows) > ImportSyncRows {
+		job, err := c.service.StartImport(context.WithoutCancel(ctx.Context()), tenant, request)
+		if err != nil {
+			c.logger.Error("import employees", zap.Error(err))
+			return common.ErrResponse(ctx, fiber.StatusInternalServerError, err.Error())
+		}
+		c.logger.Info("employee import started", zap.String("job", job.Id), zap.Int("rows", job.Total))
+		ctx.Status(fiber.StatusAccepted)
+		return common.OkResponse(ctx, job)
+	}
+	report, err := c.service.Import(ctx.Context(), tenant, request, nil)
+	if err != nil {
+		c.logger.Error("import employees", zap.Error(err))
+		switch {
+		case errors.Is(err, context.DeadlineExceeded):
+			return common.ErrResponse(ctx, fiber.StatusGatewayTimeout, "timeout exceeded")
+		default:
+			return common.ErrResponse(ctx, fiber.StatusInternalServerError, err.Error())
+		}
+	}
+	c.logger.Info("employees imported", zap.Int("created", report.Created), zap.Int("updated", report.Updated),
+		zap.Int("failed", report.Failed), zap.Bool("dry_run", report.DryRun))
+	return common.OkResponse(ctx, report)
+}
+
+// readImport разбирает файл из поля file формы и параметры импорта
+func (c *Controller) readImport(ctx fiber.Ctx) (ImportRequest, error) {
+	mapping, err := ParseImportMapping(ctx.Query("mapping"))
+	if err != nil {
+		return ImportRequest{}, err
+	}
+	header, err := ctx.FormFile("file")
+	if err != nil {
+		return ImportRequest{}, err
+	}
+	file, err := header.Open()
+	if err != nil {
+		return ImportRequest{}, err
+	}
+	defer func() { _ = file.Close() }()
+	content, err := io.ReadAll(file)
+	if err != nil {
+		return ImportRequest{}, err
+	}
+	rows, err := ParseImport(header.Filename, content, mapping)
+	if err != nil {
+		return ImportRequest{}, err
+	}
+	return ImportRequest{Rows: rows, DryRun: ctx.Query("dry_run") == "true"}, nil
+}
+
+// GetImportJob godoc
+// @Summary      Get employee import job
+// @Description  Состояние фонового импорта и его отчёт после завершения
+// @Tags         employees
+// @Param        jobId path string true "Import job ID"
+// @Success      200 {object} ImportJob
+// @Failure      404 {object} Response
+// @Router       /employees/import/{jobId} [get]
+// @Security BearerAuth
+func (c *Controller) GetImportJob(ctx fiber.Ctx) error {
+	if !web.Authorize(ctx, writePolicy) {
+		return common.ErrResponse(ctx, fiber.StatusForbidden, "Permission denied")
+	}
+	job, err := c.service.FindImportJob(ctx.Context(), web.TenantFrom(ctx), ctx.Params("jobId"))
+	if err != nil {
+		c.logger.Error("get import job", zap.Error(err))
+		return common.ErrResponse(ctx, fiber.StatusNotFound, err.Error())
+	}
+	return common.OkResponse(ctx, job)
+}
+
+// GetImportErrors godoc
+// @Summary      Download employee import error report
+// @Description  Строки файла, которые не удалось импортировать, в CSV: номер строки, логин и причина
+// @Tags         employees
+// @Produce      text/csv
+// @Param        jobId path string true "Import job ID"
+// @Success      200 {array} ImportError
+// @Failure      404 {object} Response
+// @Failure      409 {object} Response "Job is still running"
+// @Router       /employees/import/{jobId}/errors [get]
+// @Security BearerAuth
+func (c *Controller) GetImportErrors(ctx fiber.Ctx) error {
+	if !web.Authorize(ctx, writePolicy) {
+		return common.ErrResponse(ctx, fiber.StatusForbidden, "Permission denied")
+	}
+	job, err := c.service.FindImportJob(ctx.Context(), web.TenantFrom(ctx), ctx.Params("jobId"))
+	if err != nil {
+		c.logger.Error("get import errors", zap.Error(err))
+		return common.ErrResponse(ctx, fiber.StatusNotFound, err.Error())
+	}
+	if job.Status == ImportRunning {
+		return common.ErrResponse(ctx, fiber.StatusConflict, "import job is still running")
+	}
+	return export.Send(ctx, "import-"+job.Id+"-errors", export.Csv, ImportErrorHeader, c.logger,
+		func(_ context.Context, w *export.Writer) error {
+			for _, importErr := range job.Report.Errors {
+				if err := w.Write(importErr); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+}
+
 // GetKeySetPage godoc
 // @Summary      Get keyset paginated employees
 // @Description  Возвращает сотрудников с пагинацией по ID (keyset)
 // @Tags         employees
 // @Param        lastId query int true "Last ID"
 // @Param        pageSize query int true "Page size"
+// @Param        textFilter query string false "Filter by name"
+// @Param        count query string false "How to count total: exact, estimate or none" Enums(exact, estimate, none) default(none)
 // @Success      200 {array} Response
 // @Failure      400 {object} Response
 // @Failure      500 {object} Response
 // @Router       /employees/page-key-set [get]
 // @Security BearerAuth
 func (c *Controller) GetKeySetPage(ctx fiber.Ctx) error {
-	token := ctx.Locals(web.JwtKey).(*jwt.Token)
-	claims := token.Claims.(*web.IdmClaims)
-	if !slices.Contains(claims.RealmAccess.Roles, web.IdmAdmin) || !slices.Contains(claims.RealmAccess.Roles, web.IdmUser) {
+	if !web.Authorize(ctx, readPolicy) {
 		return common.ErrResponse(ctx, fiber.StatusForbidden, "Permission denied")
 	}
 	lastId, err := strconv.ParseInt(ctx.Query("lastId", "1"), 10, 64)
@@ -362,11 +606,13 @@ func (c *Controller) GetKeySetPage(ctx fiber.Ctx) error {
 		return common.ErrResponse(ctx, fiber.StatusBadRequest, err.Error())
 	}
 	request := PageKeySetRequest{
-		LastId:   lastId,
-		PageSize: size,
-		IsNext:   true,
+		LastId:     lastId,
+		PageSize:   size,
+		IsNext:     true,
+		TextFilter: ctx.Query("textFilter"),
+		Count:      CountMode(ctx.Query("count")),
 	}
-	employees, err := c.service.GetKeySetPage(request)
+	employees, err := c.service.GetKeySetPage(ctx.Context(), web.TenantFrom(ctx), request)
 	var reqErr *common.RequestValidationError
 	var notFoundErr *common.NotFoundError
 	if err != nil {
@@ -376,6 +622,8 @@ func (c *Controller) GetKeySetPage(ctx fiber.Ctx) error {
 			return common.ErrResponse(ctx, fiber.StatusOK, err.Error())
 		case errors.As(err, &reqErr):
 			return common.ErrResponse(ctx, fiber.StatusBadRequest, err.Error())
+		case errors.Is(err, context.DeadlineExceeded):
+			return common.ErrResponse(ctx, fiber.StatusGatewayTimeout, "timeout exceeded")
 		default:
 			return common.ErrResponse(ctx, fiber.StatusInternalServerError, err.Error())
 		}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"fmt"
 	"github.com/gofiber/fiber/v3"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/stretchr/testify/assert"
@@ -12,6 +13,7 @@ import (
 	"idm/inner/common"
 	"idm/inner/web"
 	"io"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
 	"reflect"
@@ -22,46 +24,90 @@ import (
 
 type MockService struct {
 	mock.Mock
+	tenant common.Tenant
 }
 
-func (svc *MockService) GetKeySetPage(request PageKeySetRequest) (PageKeySetResponse, error) {
+func (svc *MockService) GetKeySetPage(ctx context.Context, tenant common.Tenant, request PageKeySetRequest) (PageKeySetResponse, error) {
+	svc.tenant = tenant
 	panic("implement me")
 }
 
-func (svc *MockService) GetPage(request PageRequest) (PageResponse, error) {
+func (svc *MockService) GetPage(ctx context.Context, tenant common.Tenant, request PageRequest) (PageResponse, error) {
+	svc.tenant = tenant
 	panic("implement me")
 }
 
-func (svc *MockService) FindById(id IdRequest) (Response, error) {
+func (svc *MockService) FindById(ctx context.Context, tenant common.Tenant, id IdRequest) (Response, error) {
+	svc.tenant = tenant
 	args := svc.Called(id)
 	return args.Get(0).(Response), args.Error(1)
 }
 
-func (svc *MockService) Add(request NameRequest) (int64, error) {
+func (svc *MockService) Add(ctx context.Context, tenant common.Tenant, request NameRequest) (int64, error) {
+	svc.tenant = tenant
 	args := svc.Called(request)
 	return args.Get(0).(int64), args.Error(1)
 }
 
-func (svc *MockService) GetAll(ctx context.Context) ([]Response, error) {
+func (svc *MockService) GetAll(ctx context.Context, tenant common.Tenant) ([]Response, error) {
+	svc.tenant = tenant
 	args := svc.Called()
 	return args.Get(0).([]Response), args.Error(1)
 }
 
-func (svc *MockService) GetGroupById(ids IdsRequest) ([]Response, error) {
+func (svc *MockService) GetGroupById(ctx context.Context, tenant common.Tenant, ids IdsRequest) ([]Response, error) {
+	svc.tenant = tenant
 	args := svc.Called(ids)
 	return args.Get(0).([]Response), args.Error(1)
 }
 
-func (svc *MockService) Delete(id IdRequest) error {
+func (svc *MockService) Delete(ctx context.Context, tenant common.Tenant, id IdRequest) error {
+	svc.tenant = tenant
 	args := svc.Called(id)
 	return args.Error(0)
 }
 
-func (svc *MockService) DeleteGroup(ids IdsRequest) error {
+func (svc *MockService) DeleteGroup(ctx context.Context, tenant common.Tenant, ids IdsRequest) error {
+	svc.tenant = tenant
 	args := svc.Called(ids)
 	return args.Error(0)
 }
 
+func (svc *MockService) Search(ctx context.Context, tenant common.Tenant, request SearchRequest) ([]SearchResult, error) {
+	svc.tenant = tenant
+	args := svc.Called(request)
+	return args.Get(0).([]SearchResult), args.Error(1)
+}
+
+func (svc *MockService) Export(ctx context.Context, tenant common.Tenant, request ExportRequest, write func(ExportRow) error) error {
+	svc.tenant = tenant
+	args := svc.Called(request)
+	for _, row := range args.Get(0).([]ExportRow) {
+		if err := write(row); err != nil {
+			return err
+		}
+	}
+	return args.Error(1)
+}
+
+func (svc *MockService) Import(ctx context.Context, tenant common.Tenant, request ImportRequest, progress func(processed int)) (ImportReport, error) {
+	svc.tenant = tenant
+	args := svc.Called(request)
+	return args.Get(0).(ImportReport), args.Error(1)
+}
+
+func (svc *MockService) StartImport(ctx context.Context, tenant common.Tenant, request ImportRequest) (ImportJob, error) {
+	svc.tenant = tenant
+	args := svc.Called(request)
+	return args.Get(0).(ImportJob), args.Error(1)
+}
+
+func (svc *MockService) FindImportJob(ctx context.Context, tenant common.Tenant, id string) (ImportJob, error) {
+	svc.tenant = tenant
+	args := svc.Called(id)
+	return args.Get(0).(ImportJob), args.Error(1)
+}
+
 func TestController_Add(t *testing.T) {
 	var a = assert.New(t)
 	logger := &common.Logger{
@@ -142,7 +188,50 @@ func TestController_Add(t *testing.T) {
 		svc.On("Add", mock.AnythingOfType("NameRequest")).Return(int64(0), &common.AlreadyExistsError{Massage: "employee already exists"})
 		resp, err := server.App.Test(req)
 		a.Nil(err)
-		a.Equal(http.StatusBadRequest, resp.StatusCode) // 409
+		a.Equal(http.StatusConflict, resp.StatusCode)
+	})
+	t.Run("client credentials token with write scope creates employee", func(t *testing.T) {
+		a := assert.New(t)
+		claims := &web.IdmClaims{
+			Scope: web.ScopeEmployeesWrite,
+		}
+		auth := func(c fiber.Ctx) error {
+			c.Locals(web.JwtKey, &jwt.Token{Claims: claims})
+			return c.Next()
+		}
+		server := web.NewServer()
+		server.GroupApiV1.Use(auth)
+		svc := new(MockService)
+		controller := NewController(server, svc, logger)
+		controller.RegisterRoutes()
+		body := strings.NewReader(`{"name": "john doe"}`)
+		req := httptest.NewRequest(fiber.MethodPost, "/api/v1/employees", body)
+		req.Header.Set("Content-Type", "application/json")
+		svc.On("Add", mock.AnythingOfType("NameRequest")).Return(int64(123), nil)
+		resp, err := server.App.Test(req)
+		a.Nil(err)
+		a.Equal(http.StatusOK, resp.StatusCode)
+	})
+	t.Run("read scope is not enough to create employee", func(t *testing.T) {
+		a := assert.New(t)
+		claims := &web.IdmClaims{
+			Scope: web.ScopeEmployeesRead,
+		}
+		auth := func(c fiber.Ctx) error {
+			c.Locals(web.JwtKey, &jwt.Token{Claims: claims})
+			return c.Next()
+		}
+		server := web.NewServer()
+		server.GroupApiV1.Use(auth)
+		svc := new(MockService)
+		controller := NewController(server, svc, logger)
+		controller.RegisterRoutes()
+		body := strings.NewReader(`{"name": "john doe"}`)
+		req := httptest.NewRequest(fiber.MethodPost, "/api/v1/employees", body)
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := server.App.Test(req)
+		a.Nil(err)
+		a.Equal(http.StatusForbidden, resp.StatusCode)
 	})
 	t.Run("wrong role returns 403", func(t *testing.T) {
 		claims := &web.IdmClaims{
@@ -286,6 +375,24 @@ func TestController_FindById(t *testing.T) {
 		a.Nil(err)
 		a.Equal(http.StatusForbidden, resp.StatusCode)
 	})
+	t.Run("single realm role returns 403", func(t *testing.T) {
+		claims := &web.IdmClaims{
+			RealmAccess: web.RealmAccessClaims{Roles: []string{web.IdmUser}},
+		}
+		auth := func(c fiber.Ctx) error {
+			c.Locals(web.JwtKey, &jwt.Token{Claims: claims})
+			return c.Next()
+		}
+		server := web.NewServer()
+		server.GroupApiV1.Use(auth)
+		svc := new(MockService)
+		controller := NewController(server, svc, logger)
+		controller.RegisterRoutes()
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/employees/1", nil)
+		resp, err := server.App.Test(req)
+		a.Nil(err)
+		a.Equal(http.StatusForbidden, resp.StatusCode)
+	})
 }
 func TestController_GetAll(t *testing.T) {
 	var a = assert.New(t)
@@ -353,6 +460,26 @@ func TestController_GetAll(t *testing.T) {
 		a.Nil(err)
 		a.Equal(http.StatusOK, resp.StatusCode)
 	})
+	t.Run("should return 504 if database timeout exceeded", func(t *testing.T) {
+		claims := &web.IdmClaims{
+			RealmAccess: web.RealmAccessClaims{Roles: []string{web.IdmAdmin, web.IdmUser}},
+		}
+		auth := func(c fiber.Ctx) error {
+			c.Locals(web.JwtKey, &jwt.Token{Claims: claims})
+			return c.Next()
+		}
+		server := web.NewServer()
+		server.GroupApiV1.Use(auth)
+		svc := new(MockService)
+		controller := NewController(server, svc, logger)
+		controller.RegisterRoutes()
+		timeoutErr := fmt.Errorf("employee service: get all employees: %w", context.DeadlineExceeded)
+		svc.On("GetAll").Return([]Response{}, timeoutErr)
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/employees/", nil)
+		resp, err := server.App.Test(req)
+		a.Nil(err)
+		a.Equal(http.StatusGatewayTimeout, resp.StatusCode)
+	})
 	t.Run("invalid token returns 401", func(t *testing.T) {
 		fakeAuth := func(c fiber.Ctx) error {
 			return c.SendStatus(fiber.StatusUnauthorized)
@@ -388,6 +515,25 @@ func TestController_GetAll(t *testing.T) {
 		a.Equal(http.StatusForbidden, resp.StatusCode)
 	})
 
+	t.Run("any realm role is enough to list employees", func(t *testing.T) {
+		claims := &web.IdmClaims{
+			RealmAccess: web.RealmAccessClaims{Roles: []string{web.IdmUser}},
+		}
+		auth := func(c fiber.Ctx) error {
+			c.Locals(web.JwtKey, &jwt.Token{Claims: claims})
+			return c.Next()
+		}
+		server := web.NewServer()
+		server.GroupApiV1.Use(auth)
+		svc := new(MockService)
+		controller := NewController(server, svc, logger)
+		controller.RegisterRoutes()
+		svc.On("GetAll").Return([]Response{}, nil)
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/employees", nil)
+		resp, err := server.App.Test(req)
+		a.Nil(err)
+		a.Equal(http.StatusOK, resp.StatusCode)
+	})
 }
 func TestController_GetGroupById(t *testing.T) {
 	var a = assert.New(t)
@@ -558,6 +704,25 @@ func TestController_Delete(t *testing.T) {
 		a.NotEmpty(resp)
 		a.Equal(http.StatusOK, resp.StatusCode)
 	})
+	t.Run("should return 409 if employee is referenced (ConflictError)", func(t *testing.T) {
+		claims := &web.IdmClaims{
+			RealmAccess: web.RealmAccessClaims{Roles: []string{web.IdmAdmin}},
+		}
+		auth := func(c fiber.Ctx) error {
+			c.Locals(web.JwtKey, &jwt.Token{Claims: claims})
+			return c.Next()
+		}
+		server := web.NewServer()
+		server.GroupApiV1.Use(auth)
+		svc := new(MockService)
+		controller := NewController(server, svc, logger)
+		controller.RegisterRoutes()
+		req := httptest.NewRequest("DELETE", "/api/v1/employees/1", nil)
+		svc.On("Delete", IdRequest{1}).Return(fmt.Errorf("employee service: delete: %w", &common.ConflictError{Massage: "conflicts with related data"}))
+		resp, err := server.App.Test(req)
+		a.Nil(err)
+		a.Equal(http.StatusConflict, resp.StatusCode)
+	})
 	t.Run("should return 400 if request is invalid (RequestValidationError)", func(t *testing.T) {
 		var a = assert.New(t)
 		claims := &web.IdmClaims{
@@ -720,3 +885,203 @@ func TestController_DeleteGroup(t *testing.T) {
 		a.Equal(http.StatusForbidden, resp.StatusCode)
 	})
 }
+
+func TestController_Search(t *testing.T) {
+	var a = assert.New(t)
+	logger := &common.Logger{
+		Logger: zap.NewNop(),
+	}
+	newServer := func(svc *MockService) *web.Server {
+		claims := &web.IdmClaims{
+			RealmAccess: web.RealmAccessClaims{Roles: []string{web.IdmAdmin, web.IdmUser}},
+		}
+		auth := func(c fiber.Ctx) error {
+			c.Locals(web.JwtKey, &jwt.Token{Claims: claims})
+			return c.Next()
+		}
+		server := web.NewServer()
+		server.GroupApiV1.Use(auth)
+		NewController(server, svc, logger).RegisterRoutes()
+		return server
+	}
+	t.Run("should return ranked employees", func(t *testing.T) {
+		svc := new(MockService)
+		server := newServer(svc)
+		found := []SearchResult{{Response: Response{Id: 1, Name: "Иванов"}, Rank: 0.9, Highlight: "<mark>Иванов</mark>"}}
+		svc.On("Search", SearchRequest{Query: "иванов", Limit: 20}).Return(found, nil)
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/employees/search?q=%D0%B8%D0%B2%D0%B0%D0%BD%D0%BE%D0%B2", nil)
+		resp, err := server.App.Test(req)
+		a.Nil(err)
+		a.Equal(http.StatusOK, resp.StatusCode)
+		var body common.Response[[]SearchResult]
+		a.NoError(json.NewDecoder(resp.Body).Decode(&body))
+		a.Equal(found, body.Data)
+	})
+	t.Run("should return 400 on validation error", func(t *testing.T) {
+		svc := new(MockService)
+		server := newServer(svc)
+		svc.On("Search", mock.Anything).Return([]SearchResult{}, &common.RequestValidationError{Massage: "too short"})
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/employees/search?q=a&limit=5", nil)
+		resp, err := server.App.Test(req)
+		a.Nil(err)
+		a.Equal(http.StatusBadRequest, resp.StatusCode)
+	})
+	t.Run("should return 400 on wrong limit", func(t *testing.T) {
+		svc := new(MockService)
+		server := newServer(svc)
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/employees/search?q=ivanov&limit=many", nil)
+		resp, err := server.App.Test(req)
+		a.Nil(err)
+		a.Equal(http.StatusBadRequest, resp.StatusCode)
+		svc.AssertNotCalled(t, "Search")
+	})
+}
+
+func TestController_Export(t *testing.T) {
+	var a = assert.New(t)
+	logger := &common.Logger{
+		Logger: zap.NewNop(),
+	}
+	newServer := func(svc *MockService) *web.Server {
+		claims := &web.IdmClaims{
+			RealmAccess: web.RealmAccessClaims{Roles: []string{web.IdmAdmin, web.IdmUser}},
+		}
+		auth := func(c fiber.Ctx) error {
+			c.Locals(web.JwtKey, &jwt.Token{Claims: claims})
+			return c.Next()
+		}
+		server := web.NewServer()
+		server.GroupApiV1.Use(auth)
+		NewController(server, svc, logger).RegisterRoutes()
+		return server
+	}
+	created := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	login := "anna"
+	rows := []ExportRow{
+		{Response: Response{Id: 1, TenantId: "acme", Name: "Anna", Login: &login, CreatedAt: created, UpdatedAt: created},
+			Roles: []string{"Admin", "Dev"}},
+		{Response: Response{Id: 2, TenantId: "acme", Name: "Boris, Jr.", CreatedAt: created, UpdatedAt: created}, Roles: []string{}},
+	}
+	t.Run("should stream csv with roles column", func(t *testing.T) {
+		svc := new(MockService)
+		server := newServer(svc)
+		svc.On("Export", ExportRequest{TextFilter: "a"}).Return(rows, nil)
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/employees/export?textFilter=a", nil)
+		resp, err := server.App.Test(req)
+		a.Nil(err)
+		a.Equal(http.StatusOK, resp.StatusCode)
+		a.Equal(`attachment; filename="employees.csv"`, resp.Header.Get(fiber.HeaderContentDisposition))
+		body, err := io.ReadAll(resp.Body)
+		a.NoError(err)
+		a.Equal("id,tenant_id,name,login,email,department,created_at,updated_at,roles\n"+
+			"1,acme,Anna,anna,,,2026-10-18T12:00:00Z,2026-10-18T12:00:00Z,Admin;Dev\n"+
+			"2,acme,\"Boris, Jr.\",,,,2026-10-18T12:00:00Z,2026-10-18T12:00:00Z,\n", string(body))
+	})
+	t.Run("should stream json lines", func(t *testing.T) {
+		svc := new(MockService)
+		server := newServer(svc)
+		svc.On("Export", ExportRequest{}).Return(rows, nil)
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/employees/export?format=jsonl", nil)
+		resp, err := server.App.Test(req)
+		a.Nil(err)
+		a.Equal(http.StatusOK, resp.StatusCode)
+		body, err := io.ReadAll(resp.Body)
+		a.NoError(err)
+		lines := strings.Split(strings.TrimSpace(string(body)), "\n")
+		a.Len(lines, 2)
+		var first ExportRow
+		a.NoError(json.Unmarshal([]byte(lines[0]), &first))
+		a.Equal(rows[0], first)
+	})
+	t.Run("should return 400 on unknown format", func(t *testing.T) {
+		svc := new(MockService)
+		server := newServer(svc)
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/employees/export?format=xml", nil)
+		resp, err := server.App.Test(req)
+		a.Nil(err)
+		a.Equal(http.StatusBadRequest, resp.StatusCode)
+		svc.AssertNotCalled(t, "Export")
+	})
+}
+
+func TestController_Import(t *testing.T) {
+	var a = assert.New(t)
+	logger := &common.Logger{
+		Logger: zap.NewNop(),
+	}
+	newServer := func(svc *MockService) *web.Server {
+		claims := &web.IdmClaims{
+			RealmAccess: web.RealmAccessClaims{Roles: []string{web.IdmAdmin}},
+		}
+		auth := func(c fiber.Ctx) error {
+			c.Locals(web.JwtKey, &jwt.Token{Claims: claims})
+			return c.Next()
+		}
+		server := web.NewServer()
+		server.GroupApiV1.Use(auth)
+		NewController(server, svc, logger).RegisterRoutes()
+		return server
+	}
+	upload := func(url, filename, content string) *http.Request {
+		var body bytes.Buffer
+		form := multipart.NewWriter(&body)
+		part, err := form.CreateFormFile("file", filename)
+		a.NoError(err)
+		_, _ = part.Write([]byte(content))
+		a.NoError(form.Close())
+		req := httptest.NewRequest(http.MethodPost, url, &body)
+		req.Header.Set(fiber.HeaderContentType, form.FormDataContentType())
+		return req
+	}
+	t.Run("should import small file synchronously", func(t *testing.T) {
+		svc := new(MockService)
+		server := newServer(svc)
+		request := ImportRequest{Rows: []ImportRow{{Line: 2, NameRequest: NameRequest{Name: "Анна", Login: "anna"}}}, DryRun: true}
+		report := ImportReport{DryRun: true, Total: 1, Created: 1, Errors: []ImportError{}}
+		svc.On("Import", request).Return(report, nil)
+		resp, err := server.App.Test(upload("/api/v1/employees/import?dry_run=true&mapping=ФИО:name", "hr.csv", "ФИО;Логин\nАнна;anna\n"))
+		a.Nil(err)
+		a.Equal(http.StatusOK, resp.StatusCode)
+		var body common.Response[ImportReport]
+		a.NoError(json.NewDecoder(resp.Body).Decode(&body))
+		a.Equal(report, body.Data)
+	})
+	t.Run("should start job for async import", func(t *testing.T) {
+		svc := new(MockService)
+		server := newServer(svc)
+		job := ImportJob{Id: "job-1", TenantId: "default", Status: ImportRunning, Total: 1}
+		svc.On("StartImport", mock.Anything).Return(job, nil)
+		resp, err := server.App.Test(upload("/api/v1/employees/import?async=true", "hr.csv", "name\nAnna\n"))
+		a.Nil(err)
+		a.Equal(http.StatusAccepted, resp.StatusCode)
+		svc.AssertNotCalled(t, "Import", mock.Anything)
+	})
+	t.Run("should return 400 for unsupported file", func(t *testing.T) {
+		svc := new(MockService)
+		server := newServer(svc)
+		resp, err := server.App.Test(upload("/api/v1/employees/import", "hr.txt", "name\nAnna\n"))
+		a.Nil(err)
+		a.Equal(http.StatusBadRequest, resp.StatusCode)
+	})
+	t.Run("should download error report of finished job", func(t *testing.T) {
+		svc := new(MockService)
+		server := newServer(svc)
+		job := ImportJob{Id: "job-1", Status: ImportDone,
+			Report: ImportReport{Failed: 1, Errors: []ImportError{{Line: 3, Login: "boris", Message: "bad email"}}}}
+		svc.On("FindImportJob", "job-1").Return(job, nil)
+		resp, err := server.App.Test(httptest.NewRequest(http.MethodGet, "/api/v1/employees/import/job-1/errors", nil))
+		a.Nil(err)
+		a.Equal(http.StatusOK, resp.StatusCode)
+		body, err := io.ReadAll(resp.Body)
+		a.NoError(err)
+		a.Equal("line,login,message\n3,boris,bad email\n", string(body))
+	})
+	t.Run("should return 404 for unknown job", func(t *testing.T) {
+		svc := new(MockService)
+		server := newServer(svc)
+		svc.On("FindImportJob", "missing").Return(ImportJob{}, &common.NotFoundError{Massage: "job not found"})
+		resp, err := server.App.Test(httptest.NewRequest(http.MethodGet, "/api/v1/employees/import/missing", nil))
+		a.Nil(err)
+		a.Equal(http.StatusNotFound, resp.StatusCode)
+	})
+}
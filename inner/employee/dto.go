@@ -1,12 +1,21 @@
 package employee
 
-import "time"
+import (
+	"html"
+	"strconv"
+	"strings"
+	"time"
+)
 
 type Entity struct {
-	Id        int64     `db:"id"`
-	Name      string    `db:"name"`
-	CreatedAt time.Time `db:"created_at"`
-	UpdatedAt time.Time `db:"updated_at"`
+	Id         int64     `db:"id"`
+	TenantId   string    `db:"tenant_id"`
+	Name       string    `db:"name"`
+	Login      *string   `db:"login"`
+	Email      *string   `db:"email"`
+	Department *string   `db:"department"`
+	CreatedAt  time.Time `db:"created_at"`
+	UpdatedAt  time.Time `db:"updated_at"`
 }
 
 func (e Entity) toResponse() Response {
@@ -14,17 +23,111 @@ func (e Entity) toResponse() Response {
 }
 
 type Response struct {
-	Id        int64     `json:"id"`
-	Name      string    `json:"name"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	Id         int64     `json:"id"`
+	TenantId   string    `json:"tenant_id"`
+	Name       string    `json:"name"`
+	Login      *string   `json:"login"`
+	Email      *string   `json:"email"`
+	Department *string   `json:"department"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
 }
 type NameRequest struct {
 	Name string `json:"name" validate:"required,min=2,max=155"`
+	// Login и Email связывают сотрудника с учётной записью в Keycloak, см. пакет me
+	Login      string `json:"login" validate:"omitempty,max=155"`
+	Email      string `json:"email" validate:"omitempty,email,max=255"`
+	Department string `json:"department" validate:"omitempty,max=155"`
 }
 
-func (req *NameRequest) toEntity() Entity {
-	return Entity{Name: req.Name}
+func (req *NameRequest) toEntity(tenantId string) Entity {
+	return Entity{TenantId: tenantId, Name: req.Name, Login: nullable(req.Login), Email: nullable(req.Email),
+		Department: nullable(req.Department)}
+}
+
+func nullable(value string) *string {
+	if value == "" {
+		return nil
+	}
+	return &value
+}
+
+// SearchRequest Query ищется по имени, логину, почте и отделу, в том числе в транслитерации
+type SearchRequest struct {
+	Query string `validate:"required,min=2,max=100"`
+	Limit int64  `validate:"min=1,max=100"`
+}
+
+// Границы совпавших слов во фрагменте из базы: символы из области частного использования Unicode
+// не встречаются в именах, поэтому их нельзя подделать данными сотрудника
+const (
+	highlightStart = "\uE000"
+	highlightStop  = "\uE001"
+)
+
+// SearchEntity сотрудник с релевантностью и фрагментом, в котором совпавшие слова
+// заключены между highlightStart и highlightStop
+type SearchEntity struct {
+	Entity
+	Rank      float64 `db:"rank"`
+	Highlight string  `db:"highlight"`
+}
+
+func (e SearchEntity) toResult() SearchResult {
+	return SearchResult{Response: e.toResponse(), Rank: e.Rank, Highlight: highlightHtml(e.Highlight)}
+}
+
+// highlightHtml экранирует фрагмент как HTML и заменяет границы совпадений тегами <mark>
+func highlightHtml(text string) string {
+	return strings.NewReplacer(highlightStart, "<mark>", highlightStop, "</mark>").Replace(html.EscapeString(text))
+}
+
+type SearchResult struct {
+	Response
+	Rank float64 `json:"rank"`
+	// Highlight безопасный HTML: текст экранирован, совпавшие слова выделены <mark>
+	Highlight string `json:"highlight"`
+}
+
+// ExportRequest фильтры выгрузки те же, что у страниц
+type ExportRequest struct {
+	TextFilter string
+}
+
+// ExportEntity сотрудник с названиями назначенных ролей через ";"
+type ExportEntity struct {
+	Entity
+	Roles string `db:"roles"`
+}
+
+func (e ExportEntity) toRow() ExportRow {
+	row := ExportRow{Response: e.toResponse(), Roles: []string{}}
+	if e.Roles != "" {
+		row.Roles = strings.Split(e.Roles, ";")
+	}
+	return row
+}
+
+// ExportHeader колонки CSV в порядке ExportRow.Record
+var ExportHeader = []string{"id", "tenant_id", "name", "login", "email", "department", "created_at", "updated_at", "roles"}
+
+type ExportRow struct {
+	Response
+	Roles []string `json:"roles"`
+}
+
+func (r ExportRow) Record() []string {
+	return []string{
+		strconv.FormatInt(r.Id, 10), r.TenantId, r.Name, deref(r.Login), deref(r.Email), deref(r.Department),
+		r.CreatedAt.Format(time.RFC3339), r.UpdatedAt.Format(time.RFC3339), strings.Join(r.Roles, ";"),
+	}
+}
+
+func deref(value *string) string {
+	if value == nil {
+		return ""
+	}
+	return *value
 }
 
 type IdRequest struct {
@@ -35,17 +138,33 @@ type IdsRequest struct {
 	Ids []int64 `json:"ids" validate:"required,min=1,dive,gt=0"`
 }
 
+// CountMode способ подсчёта Total страницы
+type CountMode string
+
+const (
+	// CountExact COUNT(*) по фильтру в том же снимке данных, что и страница
+	CountExact CountMode = "exact"
+	// CountEstimate оценка планировщика по статистике таблицы: не читает строки, но неточна до ANALYZE
+	CountEstimate CountMode = "estimate"
+	// CountNone Total не считается и равен 0
+	CountNone CountMode = "none"
+)
+
+// PageRequest без Count считает Total точно
 type PageRequest struct {
 	PageSize   int64 `validate:"min=1,max=100"`
 	PageNumber int64 `validate:"min=0"`
 	TextFilter string
+	Count      CountMode `validate:"omitempty,oneof=exact estimate none"`
 }
 
+// PageKeySetRequest без Count не считает Total: переход по LastId в нём не нуждается
 type PageKeySetRequest struct {
 	LastId     int64 `validate:"min=0"`
 	PageSize   int64 `validate:"min=1,max=100"`
 	IsNext     bool
 	TextFilter string
+	Count      CountMode `validate:"omitempty,oneof=exact estimate none"`
 }
 
 type PageResponse struct {
@@ -53,10 +172,14 @@ type PageResponse struct {
 	PageSize   int64    `json:"page_size" `
 	PageNumber int64    `json:"page_number"`
 	Total      int64    `json:"total"`
+	// Count как посчитан Total
+	Count CountMode `json:"count"`
 }
 
 type PageKeySetResponse struct {
 	Result []Entity `json:"result"`
 	LastId int64    `json:"last_id"`
 	Total  int64    `json:"total"`
+	// Count как посчитан Total
+	Count CountMode `json:"count"`
 }
@@ -0,0 +1,270 @@
+package employee
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/xuri/excelize/v2"
+	"idm/inner/common"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// ImportSyncRows файлы длиннее выполняются асинхронной задачей
+	ImportSyncRows = 500
+	// importMaxRows ограничивает память, которую занимает разобранный файл
+	importMaxRows = 100_000
+	// importJobTTL сколько хранится завершённая задача импорта
+	importJobTTL = 24 * time.Hour
+)
+
+// importColumns поля NameRequest и названия колонок, которые им соответствуют без явного сопоставления
+var importColumns = map[string][]string{
+	"name":       {"name", "фио", "имя", "сотрудник"},
+	"login":      {"login", "логин"},
+	"email":      {"email", "e-mail", "почта", "электронная почта"},
+	"department": {"department", "отдел", "подразделение"},
+}
+
+// ImportRow строка файла, Line - её номер в файле, заголовок - строка 1
+type ImportRow struct {
+	Line int
+	NameRequest
+}
+
+// ImportRequest строки сохраняются по логину: сотрудник с тем же логином обновляется, остальные добавляются.
+// При DryRun всё проверяется в транзакции, которая затем откатывается.
+type ImportRequest struct {
+	Rows   []ImportRow
+	DryRun bool
+}
+
+// ImportError ошибка строки файла, такие строки пропускаются
+type ImportError struct {
+	Line    int    `json:"line"`
+	Login   string `json:"login"`
+	Message string `json:"message"`
+}
+
+// ImportErrorHeader колонки CSV отчёта об ошибках в порядке ImportError.Record
+var ImportErrorHeader = []string{"line", "login", "message"}
+
+func (e ImportError) Record() []string {
+	return []string{strconv.Itoa(e.Line), e.Login, e.Message}
+}
+
+type ImportReport struct {
+	DryRun  bool          `json:"dry_run"`
+	Total   int           `json:"total"`
+	Created int           `json:"created"`
+	Updated int           `json:"updated"`
+	Failed  int           `json:"failed"`
+	Errors  []ImportError `json:"errors"`
+}
+
+// ParseImportMapping разбирает сопоставление колонок вида "ФИО:name,Почта:email"
+func ParseImportMapping(value string) (map[string]string, error) {
+	mapping := make(map[string]string)
+	if strings.TrimSpace(value) == "" {
+		return mapping, nil
+	}
+	for _, pair := range strings.Split(value, ",") {
+		column, field, ok := strings.Cut(pair, ":")
+		field = strings.TrimSpace(field)
+		if _, known := importColumns[field]; !ok || !known {
+			return nil, &common.RequestValidationError{Massage: fmt.Sprintf("invalid column mapping %q, want column:field "+
+				"with field one of name, login, email, department", pair)}
+		}
+		mapping[normalizeColumn(column)] = field
+	}
+	return mapping, nil
+}
+
+// ParseImport читает строки CSV или XLSX (первый лист) по расширению filename.
+// Первая строка - заголовок: колонки сопоставляются полям по mapping, затем по importColumns, остальные пропускаются.
+// CSV может быть в UTF-8 с BOM и с разделителем "," или ";", как его сохраняет Excel.
+func ParseImport(filename string, content []byte, mapping map[string]string) ([]ImportRow, error) {
+	var records [][]string
+	var err error
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".csv":
+		records, err = readCsv(content)
+	case ".xlsx":
+		records, err = readXlsx(content)
+	default:
+		return nil, &common.RequestValidationError{Massage: fmt.Sprintf("unsupported import file %q, want .csv or .xlsx", filename)}
+	}
+	if err != nil {
+		return nil, &common.RequestValidationError{Massage: fmt.Sprintf("read import file %q: %v", filename, err)}
+	}
+	if len(records) == 0 {
+		return nil, &common.RequestValidationError{Massage: "import file is empty"}
+	}
+	if len(records) > importMaxRows+1 {
+		return nil, &common.RequestValidationError{Massage: fmt.Sprintf("import file has more than %d rows", importMaxRows)}
+	}
+	fields := mapColumns(records[0], mapping)
+	if !slices.Contains(fields, "name") {
+		return nil, &common.RequestValidationError{Massage: "import file has no name column"}
+	}
+	rows := make([]ImportRow, 0, len(records)-1)
+	for i, record := range records[1:] {
+		row := ImportRow{Line: i + 2}
+		empty := true
+		for col, value := range record {
+			if col >= len(fields) {
+				break
+			}
+			value = strings.TrimSpace(value)
+			empty = empty && value == ""
+			switch fields[col] {
+			case "name":
+				row.Name = value
+			case "login":
+				row.Login = value
+			case "email":
+				row.Email = value
+			case "department":
+				row.Department = value
+			}
+		}
+		if !empty {
+			rows = append(rows, row)
+		}
+	}
+	return rows, nil
+}
+
+// mapColumns поле для каждой колонки заголовка, "" - колонка не импортируется
+func mapColumns(header []string, mapping map[string]string) []string {
+	fields := make([]string, len(header))
+	for i, column := range header {
+		column = normalizeColumn(column)
+		if field, ok := mapping[column]; ok {
+			fields[i] = field
+			continue
+		}
+		for field, aliases := range importColumns {
+			if slices.Contains(aliases, column) {
+				fields[i] = field
+			}
+		}
+	}
+	return fields
+}
+
+func normalizeColumn(column string) string {
+	return strings.ToLower(strings.TrimSpace(column))
+}
+
+func readCsv(content []byte) ([][]string, error) {
+	content = bytes.TrimPrefix(content, []byte("\uFEFF"))
+	reader := csv.NewReader(bytes.NewReader(content))
+	firstLine, _, _ := bytes.Cut(content, []byte("\n"))
+	if bytes.Count(firstLine, []byte(";")) > bytes.Count(firstLine, []byte(",")) {
+		reader.Comma = ';'
+	}
+	reader.FieldsPerRecord = -1
+	return reader.ReadAll()
+}
+
+func readXlsx(content []byte) ([][]string, error) {
+	file, err := excelize.OpenReader(bytes.NewReader(content))
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = file.Close() }()
+	sheets := file.GetSheetList()
+	if len(sheets) == 0 {
+		return nil, errors.New("workbook has no sheets")
+	}
+	return file.GetRows(sheets[0])
+}
+
+type ImportStatus string
+
+const (
+	ImportRunning ImportStatus = "running"
+	ImportDone    ImportStatus = "done"
+	ImportFailed  ImportStatus = "failed"
+)
+
+// ImportJob асинхронный импорт, Report заполняется по завершении
+type ImportJob struct {
+	Id         string       `json:"id"`
+	TenantId   string       `json:"tenant_id"`
+	Status     ImportStatus `json:"status"`
+	Total      int          `json:"total"`
+	Processed  int          `json:"processed"`
+	Report     ImportReport `json:"report"`
+	Error      string       `json:"error,omitempty"`
+	CreatedAt  time.Time    `json:"created_at"`
+	FinishedAt *time.Time   `json:"finished_at,omitempty"`
+}
+
+// importJobs задачи импорта хранятся в памяти процесса и теряются при перезапуске
+type importJobs struct {
+	mu   sync.Mutex
+	jobs map[string]*ImportJob
+}
+
+func newImportJobs() *importJobs {
+	return &importJobs{jobs: make(map[string]*ImportJob)}
+}
+
+// start выполняет run в отдельной горутине, контекст ctx не должен отменяться вместе с HTTP запросом
+func (j *importJobs) start(ctx context.Context, tenantId string, total int,
+	run func(ctx context.Context, progress func(processed int)) (ImportReport, error)) ImportJob {
+	job := &ImportJob{Id: uuid.NewString(), TenantId: tenantId, Status: ImportRunning, Total: total, CreatedAt: time.Now()}
+	j.mu.Lock()
+	j.prune(job.CreatedAt)
+	j.jobs[job.Id] = job
+	started := *job
+	j.mu.Unlock()
+	go func() {
+		report, err := run(ctx, func(processed int) {
+			j.mu.Lock()
+			defer j.mu.Unlock()
+			job.Processed = processed
+		})
+		j.mu.Lock()
+		defer j.mu.Unlock()
+		now := time.Now()
+		job.FinishedAt = &now
+		job.Report = report
+		job.Status = ImportDone
+		if err != nil {
+			job.Status = ImportFailed
+			job.Error = err.Error()
+		}
+	}()
+	return started
+}
+
+// get копия задачи, чтобы читать её без блокировки
+func (j *importJobs) get(id string) (ImportJob, bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	job, ok := j.jobs[id]
+	if !ok {
+		return ImportJob{}, false
+	}
+	return *job, true
+}
+
+// prune удаляет задачи, завершённые раньше importJobTTL до now
+func (j *importJobs) prune(now time.Time) {
+	for id, job := range j.jobs {
+		if job.FinishedAt != nil && now.Sub(*job.FinishedAt) > importJobTTL {
+			delete(j.jobs, id)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package employee
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xuri/excelize/v2"
+	"idm/inner/common"
+	"testing"
+)
+
+func TestParseImport(t *testing.T) {
+	t.Run("should read excel csv with bom, semicolons and russian header", func(t *testing.T) {
+		content := "\uFEFFФИО;Логин;Почта;Отдел;Комментарий\nИванов Иван; ivanov ;ivanov@example.com;ИТ;новый\n;;;;\nПетров;;;;\n"
+		rows, err := ParseImport("hr.CSV", []byte(content), nil)
+		require.NoError(t, err)
+		assert.Equal(t, []ImportRow{
+			{Line: 2, NameRequest: NameRequest{Name: "Иванов Иван", Login: "ivanov", Email: "ivanov@example.com", Department: "ИТ"}},
+			{Line: 4, NameRequest: NameRequest{Name: "Петров"}},
+		}, rows)
+	})
+	t.Run("should apply column mapping", func(t *testing.T) {
+		mapping, err := ParseImportMapping("Сотрудник полностью:name, Учётка:login")
+		require.NoError(t, err)
+		rows, err := ParseImport("hr.csv", []byte("Учётка,Сотрудник полностью\nanna,Анна\n"), mapping)
+		require.NoError(t, err)
+		assert.Equal(t, []ImportRow{{Line: 2, NameRequest: NameRequest{Name: "Анна", Login: "anna"}}}, rows)
+	})
+	t.Run("should read first sheet of xlsx", func(t *testing.T) {
+		file := excelize.NewFile()
+		sheet := file.GetSheetName(0)
+		require.NoError(t, file.SetSheetRow(sheet, "A1", &[]any{"name", "login"}))
+		require.NoError(t, file.SetSheetRow(sheet, "A2", &[]any{"Anna", "anna"}))
+		var content bytes.Buffer
+		require.NoError(t, file.Write(&content))
+		rows, err := ParseImport("hr.xlsx", content.Bytes(), nil)
+		require.NoError(t, err)
+		assert.Equal(t, []ImportRow{{Line: 2, NameRequest: NameRequest{Name: "Anna", Login: "anna"}}}, rows)
+	})
+	t.Run("should reject file without name column", func(t *testing.T) {
+		_, err := ParseImport("hr.csv", []byte("login\nanna\n"), nil)
+		var reqErr *common.RequestValidationError
+		assert.ErrorAs(t, err, &reqErr)
+	})
+	t.Run("should reject mapping to unknown field", func(t *testing.T) {
+		_, err := ParseImportMapping("Должность:position")
+		var reqErr *common.RequestValidationError
+		assert.ErrorAs(t, err, &reqErr)
+	})
+}
@@ -0,0 +1,259 @@
+package employee
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"idm/inner/common"
+	"idm/inner/database"
+	"slices"
+	"strings"
+	"time"
+)
+
+// MemoryRepository хранит сотрудников в памяти процесса (DB_DRIVER_NAME=memory).
+// Транзакции обеспечивает database.MemoryStore, параметр tx методов не используется.
+type MemoryRepository struct {
+	store     *database.MemoryStore
+	employees *database.MemoryTable[Entity]
+}
+
+func NewMemoryRepository(store *database.MemoryStore) *MemoryRepository {
+	return &MemoryRepository{store: store, employees: database.NewMemoryTable[Entity](store)}
+}
+
+func (r *MemoryRepository) WithTx(ctx context.Context, opts database.TxOptions, fn database.TxFunc) error {
+	return r.store.WithTx(ctx, opts, fn)
+}
+
+func (r *MemoryRepository) FindById(ctx context.Context, tenant common.Tenant, id int64) (employee Entity, err error) {
+	err = r.store.Run(ctx, func() error {
+		found, ok := r.employees.Get(id)
+		if !ok || !visible(tenant, found) {
+			return sql.ErrNoRows
+		}
+		employee = found
+		return nil
+	})
+	return employee, err
+}
+
+func (r *MemoryRepository) FindByNameTx(ctx context.Context, _ *sqlx.Tx, tenantId string, name string) (isExists bool, err error) {
+	err = r.store.Run(ctx, func() error {
+		isExists = r.existsByName(tenantId, name)
+		return nil
+	})
+	return isExists, err
+}
+
+func (r *MemoryRepository) GetAll(ctx context.Context, tenant common.Tenant) (employees []Entity, err error) {
+	err = r.store.Run(ctx, func() error {
+		employees = r.employees.Select(func(e Entity) bool { return visible(tenant, e) })
+		return nil
+	})
+	return employees, err
+}
+
+func (r *MemoryRepository) Add(ctx context.Context, _ *sqlx.Tx, employee Entity) (id int64, err error) {
+	err = r.store.Run(ctx, func() error {
+		if field, value, ok := r.duplicate(employee); ok {
+			return &common.AlreadyExistsError{Massage: fmt.Sprintf("already exists: employee %s %q in tenant %s",
+				field, value, employee.TenantId)}
+		}
+		now := time.Now()
+		id = r.employees.Insert(func(id int64) Entity {
+			employee.Id, employee.CreatedAt, employee.UpdatedAt = id, now, now
+			return employee
+		})
+		return nil
+	})
+	if err != nil {
+		return -1, err
+	}
+	return id, nil
+}
+
+func (r *MemoryRepository) FindByLoginTx(ctx context.Context, _ *sqlx.Tx, tenantId string, login string) (employee Entity, err error) {
+	err = r.store.Run(ctx, func() error {
+		found := r.employees.Select(func(e Entity) bool {
+			return e.TenantId == tenantId && e.Login != nil && strings.EqualFold(*e.Login, login)
+		})
+		if len(found) == 0 {
+			return sql.ErrNoRows
+		}
+		employee = found[0]
+		return nil
+	})
+	return employee, err
+}
+
+func (r *MemoryRepository) UpdateTx(ctx context.Context, _ *sqlx.Tx, employee Entity) error {
+	return r.store.Run(ctx, func() error {
+		existing, ok := r.employees.Get(employee.Id)
+		if !ok || existing.TenantId != employee.TenantId {
+			return nil
+		}
+		existing.Name = employee.Name
+		existing.Email = cmp.Or(employee.Email, existing.Email)
+		existing.Department = cmp.Or(employee.Department, existing.Department)
+		if field, value, ok := r.duplicate(existing); ok {
+			return &common.AlreadyExistsError{Massage: fmt.Sprintf("already exists: employee %s %q in tenant %s",
+				field, value, existing.TenantId)}
+		}
+		existing.UpdatedAt = time.Now()
+		r.employees.Put(existing.Id, existing)
+		return nil
+	})
+}
+
+func (r *MemoryRepository) GetGroupById(ctx context.Context, tenant common.Tenant, ids []int64) (employees []Entity, err error) {
+	err = r.store.Run(ctx, func() error {
+		employees = r.employees.Select(func(e Entity) bool { return visible(tenant, e) && slices.Contains(ids, e.Id) })
+		return nil
+	})
+	return employees, err
+}
+
+func (r *MemoryRepository) Delete(ctx context.Context, tenant common.Tenant, id int64) error {
+	return r.DeleteGroup(ctx, tenant, []int64{id})
+}
+
+func (r *MemoryRepository) DeleteGroup(ctx context.Context, tenant common.Tenant, ids []int64) error {
+	return r.store.Run(ctx, func() error {
+		for _, id := range ids {
+			if found, ok := r.employees.Get(id); ok && visible(tenant, found) {
+				r.employees.Delete(id)
+			}
+		}
+		return nil
+	})
+}
+
+func (r *MemoryRepository) FindPageWithFilter(ctx context.Context, _ *sqlx.Tx, tenant common.Tenant, offset, limit int64, name string) (employees []Entity, err error) {
+	err = r.store.Run(ctx, func() error {
+		employees = page(r.filter(tenant, name), offset, limit)
+		return nil
+	})
+	return employees, err
+}
+
+func (r *MemoryRepository) GetTotal(ctx context.Context, _ *sqlx.Tx, tenant common.Tenant, name string) (count int64, err error) {
+	err = r.store.Run(ctx, func() error {
+		count = int64(len(r.filter(tenant, name)))
+		return nil
+	})
+	return count, err
+}
+
+// EstimateTotal в памяти точный подсчёт не дороже оценки
+func (r *MemoryRepository) EstimateTotal(ctx context.Context, tx *sqlx.Tx, tenant common.Tenant, name string) (int64, error) {
+	return r.GetTotal(ctx, tx, tenant, name)
+}
+
+func (r *MemoryRepository) FindKeySetPagination(ctx context.Context, _ *sqlx.Tx, tenant common.Tenant, lastId, limit int64, name string) (employees []Entity, err error) {
+	err = r.store.Run(ctx, func() error {
+		after := slices.DeleteFunc(r.filter(tenant, name), func(e Entity) bool { return e.Id <= lastId })
+		employees = page(after, 0, limit)
+		return nil
+	})
+	return employees, err
+}
+
+// Search поиск подстроки query или translit без учёта регистра, совпадение в имени выше остальных полей
+func (r *MemoryRepository) Search(ctx context.Context, tenant common.Tenant, query, translit string, limit int64) (employees []SearchEntity, err error) {
+	variants := []string{strings.ToLower(query), strings.ToLower(translit)}
+	contains := func(text string) bool {
+		text = strings.ToLower(text)
+		return slices.ContainsFunc(variants, func(v string) bool { return v != "" && strings.Contains(text, v) })
+	}
+	err = r.store.Run(ctx, func() error {
+		for _, e := range r.employees.Select(func(e Entity) bool { return visible(tenant, e) }) {
+			fields := []string{e.Name}
+			for _, field := range []*string{e.Login, e.Email, e.Department} {
+				if field != nil {
+					fields = append(fields, *field)
+				}
+			}
+			text := strings.Join(fields, " ")
+			if !contains(text) {
+				continue
+			}
+			rank := 0.5
+			if contains(e.Name) {
+				rank = 1
+			}
+			employees = append(employees, SearchEntity{Entity: e, Rank: rank, Highlight: text})
+		}
+		return nil
+	})
+	// сортировка устойчивая: при равной релевантности сотрудники остаются по возрастанию id
+	slices.SortStableFunc(employees, func(a, b SearchEntity) int { return cmp.Compare(b.Rank, a.Rank) })
+	return page(employees, 0, limit), err
+}
+
+// Export в памяти назначений ролей нет, колонка ролей всегда пустая.
+// Строки копируются под блокировкой хранилища, а fn получает их уже без неё:
+// медленный клиент выгрузки не должен останавливать остальные запросы
+func (r *MemoryRepository) Export(ctx context.Context, tenant common.Tenant, name string, fn func(ExportEntity) error) error {
+	var employees []Entity
+	err := r.store.Run(ctx, func() error {
+		employees = r.filter(tenant, name)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, employee := range employees {
+		if err := fn(ExportEntity{Entity: employee}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *MemoryRepository) existsByName(tenantId, name string) bool {
+	return len(r.employees.Select(func(e Entity) bool {
+		return e.TenantId == tenantId && strings.EqualFold(e.Name, name)
+	})) > 0
+}
+
+// duplicate поле, нарушающее уникальные индексы employee_name_uidx, employee_login_uidx или employee_email_uidx.
+// Сам employee (с тем же Id) дубликатом не считается.
+func (r *MemoryRepository) duplicate(employee Entity) (field, value string, ok bool) {
+	same := func(a, b *string) bool { return a != nil && b != nil && strings.EqualFold(*a, *b) }
+	for _, existing := range r.employees.Select(func(e Entity) bool {
+		return e.TenantId == employee.TenantId && e.Id != employee.Id
+	}) {
+		if strings.EqualFold(existing.Name, employee.Name) {
+			return "name", employee.Name, true
+		}
+		if same(existing.Login, employee.Login) {
+			return "login", *employee.Login, true
+		}
+		if same(existing.Email, employee.Email) {
+			return "email", *employee.Email, true
+		}
+	}
+	return "", "", false
+}
+
+// filter аналог name ILIKE '%name%'
+func (r *MemoryRepository) filter(tenant common.Tenant, name string) []Entity {
+	name = strings.ToLower(name)
+	return r.employees.Select(func(e Entity) bool {
+		return visible(tenant, e) && strings.Contains(strings.ToLower(e.Name), name)
+	})
+}
+
+func visible(tenant common.Tenant, employee Entity) bool {
+	return tenant.All || employee.TenantId == tenant.Id
+}
+
+func page[T any](employees []T, offset, limit int64) []T {
+	if offset >= int64(len(employees)) {
+		return nil
+	}
+	return employees[offset:min(offset+limit, int64(len(employees)))]
+}
@@ -0,0 +1,178 @@
+package employee
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"idm/inner/common"
+	"idm/inner/database"
+	"idm/inner/validator"
+	"testing"
+	"time"
+)
+
+func TestMemoryRepository(t *testing.T) {
+	ctx := context.Background()
+	acme, globex := common.SingleTenant("acme"), common.SingleTenant("globex")
+	newService := func() *Service {
+		return NewService(NewMemoryRepository(database.NewMemoryStore()), validator.New())
+	}
+	t.Run("should add and find employee of tenant only", func(t *testing.T) {
+		svc := newService()
+		id, err := svc.Add(ctx, acme, NameRequest{Name: "John", Login: "john"})
+		require.NoError(t, err)
+		found, err := svc.FindById(ctx, acme, IdRequest{Id: id})
+		assert.NoError(t, err)
+		assert.Equal(t, "John", found.Name)
+		assert.Equal(t, "acme", found.TenantId)
+		_, err = svc.FindById(ctx, globex, IdRequest{Id: id})
+		var notFound *common.NotFoundError
+		assert.ErrorAs(t, err, &notFound)
+		all, err := svc.GetAll(ctx, common.AllTenants())
+		assert.NoError(t, err)
+		assert.Len(t, all, 1)
+	})
+	t.Run("should reject duplicate name and login within tenant", func(t *testing.T) {
+		svc := newService()
+		_, err := svc.Add(ctx, acme, NameRequest{Name: "John", Login: "john"})
+		require.NoError(t, err)
+		var existsErr *common.AlreadyExistsError
+		_, err = svc.Add(ctx, acme, NameRequest{Name: "JOHN"})
+		assert.ErrorAs(t, err, &existsErr)
+		_, err = svc.Add(ctx, acme, NameRequest{Name: "Johnny", Login: "John"})
+		assert.ErrorAs(t, err, &existsErr)
+		_, err = svc.Add(ctx, globex, NameRequest{Name: "John", Login: "john"})
+		assert.NoError(t, err)
+	})
+	t.Run("should page with filter", func(t *testing.T) {
+		svc := newService()
+		for _, name := range []string{"Anna", "Boris", "Annette", "Hanna"} {
+			_, err := svc.Add(ctx, acme, NameRequest{Name: name})
+			require.NoError(t, err)
+		}
+		page, err := svc.GetPage(ctx, acme, PageRequest{PageSize: 2, PageNumber: 1, TextFilter: "ann"})
+		assert.NoError(t, err)
+		assert.Equal(t, int64(3), page.Total)
+		require.Len(t, page.Result, 1)
+		assert.Equal(t, "Hanna", page.Result[0].Name)
+		keySet, err := svc.GetKeySetPage(ctx, acme, PageKeySetRequest{LastId: 2, PageSize: 10})
+		assert.NoError(t, err)
+		assert.Len(t, keySet.Result, 2)
+		assert.Equal(t, CountNone, keySet.Count)
+		assert.Zero(t, keySet.Total)
+		keySet, err = svc.GetKeySetPage(ctx, acme, PageKeySetRequest{PageSize: 1, TextFilter: "ann", Count: CountExact})
+		assert.NoError(t, err)
+		require.Len(t, keySet.Result, 1)
+		assert.Equal(t, "Anna", keySet.Result[0].Name)
+		assert.Equal(t, keySet.Result[0].Id, keySet.LastId)
+		assert.Equal(t, int64(3), keySet.Total)
+		keySet, err = svc.GetKeySetPage(ctx, acme, PageKeySetRequest{LastId: keySet.LastId, PageSize: 5, TextFilter: "ann"})
+		assert.NoError(t, err)
+		require.Len(t, keySet.Result, 2)
+		assert.Equal(t, "Hanna", keySet.Result[1].Name)
+		assert.Equal(t, keySet.Result[1].Id, keySet.LastId)
+		last := keySet.LastId
+		keySet, err = svc.GetKeySetPage(ctx, acme, PageKeySetRequest{LastId: last, PageSize: 5, TextFilter: "ann"})
+		assert.NoError(t, err)
+		assert.Empty(t, keySet.Result)
+		assert.Equal(t, last, keySet.LastId)
+		page, err = svc.GetPage(ctx, acme, PageRequest{PageSize: 2, TextFilter: "ann", Count: CountNone})
+		assert.NoError(t, err)
+		assert.Zero(t, page.Total)
+		_, err = svc.GetPage(ctx, acme, PageRequest{PageSize: 2, Count: "approx"})
+		var reqErr *common.RequestValidationError
+		assert.ErrorAs(t, err, &reqErr)
+	})
+	t.Run("should delete employees of tenant only", func(t *testing.T) {
+		svc := newService()
+		first, _ := svc.Add(ctx, acme, NameRequest{Name: "John"})
+		second, _ := svc.Add(ctx, globex, NameRequest{Name: "Jane"})
+		assert.NoError(t, svc.DeleteGroup(ctx, acme, IdsRequest{Ids: []int64{first, second}}))
+		all, err := svc.GetAll(ctx, common.AllTenants())
+		assert.NoError(t, err)
+		require.Len(t, all, 1)
+		assert.Equal(t, second, all[0].Id)
+	})
+	t.Run("should search transliterated name first", func(t *testing.T) {
+		svc := newService()
+		_, _ = svc.Add(ctx, acme, NameRequest{Name: "Anna", Department: "Ivanov team"})
+		ivanov, _ := svc.Add(ctx, acme, NameRequest{Name: "Иванов"})
+		_, _ = svc.Add(ctx, globex, NameRequest{Name: "Ivanova"})
+		found, err := svc.Search(ctx, acme, SearchRequest{Query: "ivanov", Limit: 10})
+		assert.NoError(t, err)
+		require.Len(t, found, 2)
+		assert.Equal(t, ivanov, found[0].Id)
+		assert.Equal(t, "Ivanov team", *found[1].Department)
+	})
+	t.Run("should import with upsert by login and report bad rows", func(t *testing.T) {
+		svc := newService()
+		existing, err := svc.Add(ctx, acme, NameRequest{Name: "Anna", Login: "anna", Department: "HR"})
+		require.NoError(t, err)
+		request := ImportRequest{Rows: []ImportRow{
+			{Line: 2, NameRequest: NameRequest{Name: "Anna Petrova", Login: "ANNA"}},
+			{Line: 3, NameRequest: NameRequest{Name: "Boris", Login: "boris", Email: "not-an-email"}},
+			{Line: 4, NameRequest: NameRequest{Name: "Boris", Login: "boris"}},
+			{Line: 5, NameRequest: NameRequest{Name: "Boris Jr", Login: "Boris"}},
+			{Line: 6, NameRequest: NameRequest{Name: "anna petrova"}},
+		}}
+		report, err := svc.Import(ctx, acme, request, nil)
+		require.NoError(t, err)
+		assert.Equal(t, 1, report.Created)
+		assert.Equal(t, 1, report.Updated)
+		assert.Equal(t, 3, report.Failed)
+		var lines []int
+		for _, importErr := range report.Errors {
+			lines = append(lines, importErr.Line)
+		}
+		assert.Equal(t, []int{3, 5, 6}, lines)
+		updated, err := svc.FindById(ctx, acme, IdRequest{Id: existing})
+		require.NoError(t, err)
+		assert.Equal(t, "Anna Petrova", updated.Name)
+		assert.Equal(t, "HR", *updated.Department, "empty cell should keep department")
+	})
+	t.Run("should roll back dry run", func(t *testing.T) {
+		svc := newService()
+		report, err := svc.Import(ctx, acme, ImportRequest{DryRun: true, Rows: []ImportRow{
+			{Line: 2, NameRequest: NameRequest{Name: "Anna"}},
+			{Line: 3, NameRequest: NameRequest{Name: "anna"}},
+		}}, nil)
+		require.NoError(t, err)
+		assert.Equal(t, 1, report.Created)
+		assert.Equal(t, 1, report.Failed, "dry run should see rows imported before")
+		all, err := svc.GetAll(ctx, acme)
+		assert.NoError(t, err)
+		assert.Empty(t, all)
+	})
+	t.Run("should run import job visible to its tenant only", func(t *testing.T) {
+		svc := newService()
+		started, err := svc.StartImport(ctx, acme, ImportRequest{Rows: []ImportRow{{Line: 2, NameRequest: NameRequest{Name: "Anna"}}}})
+		require.NoError(t, err)
+		assert.Equal(t, 1, started.Total)
+		require.Eventually(t, func() bool {
+			job, err := svc.FindImportJob(ctx, acme, started.Id)
+			return err == nil && job.Status == ImportDone && job.Processed == 1 && job.Report.Created == 1
+		}, time.Second, 10*time.Millisecond)
+		_, err = svc.FindImportJob(ctx, globex, started.Id)
+		var notFound *common.NotFoundError
+		assert.ErrorAs(t, err, &notFound)
+	})
+	t.Run("should not hold store lock while writing export", func(t *testing.T) {
+		svc := newService()
+		_, err := svc.Add(ctx, acme, NameRequest{Name: "Anna"})
+		require.NoError(t, err)
+		done := make(chan error, 1)
+		go func() {
+			done <- svc.Export(ctx, acme, ExportRequest{}, func(row ExportRow) error {
+				// другой запрос во время записи строки не должен ждать конца выгрузки
+				_, err := svc.GetAll(ctx, acme)
+				return err
+			})
+		}()
+		select {
+		case err := <-done:
+			assert.NoError(t, err)
+		case <-time.After(time.Second):
+			t.Fatal("export holds the store lock while writing rows")
+		}
+	})
+}
@@ -2,129 +2,282 @@ package employee
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"github.com/jmoiron/sqlx"
+	"idm/inner/common"
+	"idm/inner/database"
+	"math"
+	"strings"
 )
 
 type Repository struct {
-	db *sqlx.DB
+	db        *sqlx.DB
+	dialect   database.Dialect
+	txManager database.TxManager
 }
 
-func NewRepository(db *sqlx.DB) *Repository {
-	return &Repository{db: db}
+func NewRepository(db *sqlx.DB, txManager database.TxManager) *Repository {
+	return &Repository{db: db, dialect: database.DialectOf(db), txManager: txManager}
 }
 
-func (r *Repository) BeginTransaction() (tx *sqlx.Tx, err error) {
-	return r.db.Beginx()
+// WithTx выполняет fn в транзакции, в которой политики RLS пропускают только строки арендатора opts.Tenant
+func (r *Repository) WithTx(ctx context.Context, opts database.TxOptions, fn database.TxFunc) error {
+	return r.txManager.WithTx(ctx, opts, fn)
 }
 
-func (r *Repository) FindById(id int64) (employee Entity, err error) {
-	err = r.db.Get(&employee, "SELECT * FROM employee WHERE id=$1", id)
+// inTx выполняет fn в транзакции TxManager, внутри единицы работы WithTx - в её транзакции
+func (r *Repository) inTx(ctx context.Context, tenant common.Tenant, fn func(tx *sqlx.Tx) error) error {
+	return r.txManager.WithTx(ctx, database.TxOptions{Tenant: tenant}, func(_ context.Context, tx *sqlx.Tx) error {
+		return fn(tx)
+	})
+}
+
+// inReadTx выполняет fn в транзакции только для чтения, которая может уйти на реплику
+func (r *Repository) inReadTx(ctx context.Context, tenant common.Tenant, fn func(tx *sqlx.Tx) error) error {
+	opts := database.TxOptions{Tenant: tenant, ReadOnly: true}
+	return r.txManager.WithTx(ctx, opts, func(_ context.Context, tx *sqlx.Tx) error {
+		return fn(tx)
+	})
+}
+
+func (r *Repository) FindById(ctx context.Context, tenant common.Tenant, id int64) (employee Entity, err error) {
+	err = r.inReadTx(ctx, tenant, func(tx *sqlx.Tx) error {
+		return tx.GetContext(ctx, &employee, "SELECT * FROM employee WHERE id=$1 AND (tenant_id = $2 OR $3)", id, tenant.Id, tenant.All)
+	})
 	return employee, err
 }
 
-func (r *Repository) FindByNameTx(tx *sqlx.Tx, name string) (isExists bool, err error) {
-	err = tx.Get(
+func (r *Repository) FindByNameTx(ctx context.Context, tx *sqlx.Tx, tenantId string, name string) (isExists bool, err error) {
+	err = tx.GetContext(
+		ctx,
 		&isExists,
-		"select exists(select 1 from employee where name = $1)",
-		name,
+		"select exists(select 1 from employee where tenant_id = $1 and lower(name) = lower($2))",
+		tenantId, name,
 	)
 	return isExists, err
 }
 
-func (r *Repository) GetAll(ctx context.Context) ([]Entity, error) {
-	var employees []Entity
-	rows, err := r.db.QueryxContext(ctx, "SELECT * FROM employee;")
+func (r *Repository) GetAll(ctx context.Context, tenant common.Tenant) (employees []Entity, err error) {
+	err = r.inReadTx(ctx, tenant, func(tx *sqlx.Tx) error {
+		return tx.SelectContext(ctx, &employees, "SELECT * FROM employee WHERE tenant_id = $1 OR $2;", tenant.Id, tenant.All)
+	})
 	if err != nil {
-		return employees, err
-	}
-	defer func() {
-		err := rows.Close()
-		if err != nil {
-			return
-		}
-	}()
-	for rows.Next() {
-		var employee Entity
-		if err = rows.StructScan(&employee); err != nil {
-			return nil, err
-		}
-		employees = append(employees, employee)
+		return nil, err
 	}
 	return employees, nil
 }
 
-func (r *Repository) Add(tx *sqlx.Tx, employee Entity) (int64, error) {
+func (r *Repository) Add(ctx context.Context, tx *sqlx.Tx, employee Entity) (int64, error) {
 	var id int64
-	err := tx.QueryRow("INSERT INTO employee (name) VALUES ($1) RETURNING id",
-		employee.Name).Scan(&id)
+	err := tx.QueryRowContext(ctx, "INSERT INTO employee (tenant_id, name, login, email, department) VALUES ($1, $2, $3, $4, $5) RETURNING id",
+		employee.TenantId, employee.Name, employee.Login, employee.Email, employee.Department).Scan(&id)
 	if err != nil {
-		return -1, err
+		return -1, database.TranslateError(err)
 	}
 	return id, nil
 }
 
-func (r *Repository) GetGroupById(ids []int64) (employees []Entity, err error) {
-	q, args, err := sqlx.In("SELECT * FROM employee WHERE id IN (?)", ids)
+// FindByLoginTx сотрудник арендатора с логином login без учёта регистра, sql.ErrNoRows - такого нет
+func (r *Repository) FindByLoginTx(ctx context.Context, tx *sqlx.Tx, tenantId string, login string) (employee Entity, err error) {
+	err = tx.GetContext(ctx, &employee, "SELECT * FROM employee WHERE tenant_id = $1 AND lower(login) = lower($2)", tenantId, login)
+	return employee, err
+}
+
+// UpdateTx меняет имя сотрудника, а почту и отдел - только если они заданы
+func (r *Repository) UpdateTx(ctx context.Context, tx *sqlx.Tx, employee Entity) error {
+	_, err := tx.ExecContext(ctx, `UPDATE employee SET name = $1, email = coalesce($2, email), department = coalesce($3, department),
+		updated_at = CURRENT_TIMESTAMP WHERE tenant_id = $4 AND id = $5`,
+		employee.Name, employee.Email, employee.Department, employee.TenantId, employee.Id)
+	return database.TranslateError(err)
+}
+
+func (r *Repository) GetGroupById(ctx context.Context, tenant common.Tenant, ids []int64) (employees []Entity, err error) {
+	q, args, err := sqlx.In("SELECT * FROM employee WHERE id IN (?) AND (tenant_id = ? OR ?)", ids, tenant.Id, tenant.All)
 	if err != nil {
 		return nil, err
 	}
 	q = r.db.Rebind(q)
-	err = r.db.Select(&employees, q, args...)
+	err = r.inReadTx(ctx, tenant, func(tx *sqlx.Tx) error {
+		return tx.SelectContext(ctx, &employees, q, args...)
+	})
 	if err != nil {
 		return nil, err
 	}
 	return employees, nil
 }
 
-func (r *Repository) Delete(id int64) (err error) {
-	_, err = r.db.Exec("DELETE FROM employee WHERE id=$1", id)
-	if err != nil {
+func (r *Repository) Delete(ctx context.Context, tenant common.Tenant, id int64) (err error) {
+	err = r.inTx(ctx, tenant, func(tx *sqlx.Tx) error {
+		_, err := tx.ExecContext(ctx, "DELETE FROM employee WHERE id=$1 AND (tenant_id = $2 OR $3)", id, tenant.Id, tenant.All)
 		return err
-	}
-	return nil
+	})
+	return database.TranslateError(err)
 }
 
-func (r *Repository) DeleteGroup(ids []int64) error {
-	q, args, err := sqlx.In("DELETE FROM employee WHERE id IN (?)", ids)
+func (r *Repository) DeleteGroup(ctx context.Context, tenant common.Tenant, ids []int64) error {
+	q, args, err := sqlx.In("DELETE FROM employee WHERE id IN (?) AND (tenant_id = ? OR ?)", ids, tenant.Id, tenant.All)
 	if err != nil {
 		return err
 	}
 	q = r.db.Rebind(q)
-	_, err = r.db.Exec(q, args...)
-	if err != nil {
+	err = r.inTx(ctx, tenant, func(tx *sqlx.Tx) error {
+		_, err := tx.ExecContext(ctx, q, args...)
 		return err
-	}
-	return nil
+	})
+	return database.TranslateError(err)
 }
 
-func (r *Repository) FindPageWithFilter(tx *sqlx.Tx, offset, limit int64, name string) (employees []Entity, err error) {
-	query := "SELECT id, name, created_at, updated_at FROM employee WHERE 1 = 1"
-	args := []interface{}{}
-	if name != "" {
-		query += " AND name ILIKE ?"
-		args = append(args, "%"+name+"%")
-	}
-	query += " OFFSET ? LIMIT ?"
-	args = append(args, offset, limit)
+func (r *Repository) FindPageWithFilter(ctx context.Context, tx *sqlx.Tx, tenant common.Tenant, offset, limit int64, name string) (employees []Entity, err error) {
+	where, args := r.filter(tenant, name)
+	// LIMIT перед OFFSET понимают и Postgres, и SQLite
+	query := "SELECT id, tenant_id, name, login, email, department, created_at, updated_at" + where + " ORDER BY id LIMIT ? OFFSET ?"
+	args = append(args, limit, offset)
 	query = sqlx.Rebind(sqlx.DOLLAR, query)
-	err = tx.Select(&employees, query, args...)
+	err = tx.SelectContext(ctx, &employees, query, args...)
 	return employees, err
 }
 
-func (r *Repository) GetTotal(tx *sqlx.Tx, name string) (count int64, err error) {
-	query := `SELECT COUNT(*) FROM employee WHERE 1 = 1 `
-	args := []interface{}{}
+func (r *Repository) GetTotal(ctx context.Context, tx *sqlx.Tx, tenant common.Tenant, name string) (count int64, err error) {
+	where, args := r.filter(tenant, name)
+	query := sqlx.Rebind(sqlx.DOLLAR, "SELECT COUNT(*)"+where)
+	err = tx.GetContext(ctx, &count, query, args...)
+	return count, err
+}
+
+// EstimateTotal оценка GetTotal по статистике планировщика без чтения строк.
+// Без фильтров это pg_class.reltuples, иначе число строк в плане EXPLAIN, в котором учтены и политики RLS.
+// В SQLite статистики для оценки нет, поэтому считается точное количество.
+func (r *Repository) EstimateTotal(ctx context.Context, tx *sqlx.Tx, tenant common.Tenant, name string) (count int64, err error) {
+	if r.dialect.IsSQLite() {
+		return r.GetTotal(ctx, tx, tenant, name)
+	}
+	if tenant.All && name == "" {
+		// reltuples равно -1, пока таблицу ни разу не анализировали, тогда оценку даст EXPLAIN
+		err = tx.GetContext(ctx, &count, "SELECT reltuples::bigint FROM pg_class WHERE oid = 'employee'::regclass")
+		if err != nil || count >= 0 {
+			return count, err
+		}
+	}
+	where, args := r.filter(tenant, name)
+	var plan []byte
+	query := sqlx.Rebind(sqlx.DOLLAR, "EXPLAIN (FORMAT JSON) SELECT 1"+where)
+	if err = tx.GetContext(ctx, &plan, query, args...); err != nil {
+		return 0, err
+	}
+	return planRows(plan)
+}
+
+// Export читает сотрудников по фильтру name серверным курсором и передаёт их fn по одному
+func (r *Repository) Export(ctx context.Context, tenant common.Tenant, name string, fn func(ExportEntity) error) error {
+	where, args := r.filter(tenant, name)
+	query := sqlx.Rebind(sqlx.DOLLAR, `SELECT e.id, e.tenant_id, e.name, e.login, e.email, e.department, e.created_at, e.updated_at,
+			coalesce((SELECT `+r.dialect.StringAgg("r.name", ";")+` FROM employee_role er JOIN role r ON r.id = er.role_id
+				WHERE er.employee_id = e.id), '') AS roles
+		FROM (SELECT *`+where+`) e
+		ORDER BY e.id`)
+	// строки уходят клиенту по мере чтения, повтор после сбоя реплики записал бы их ещё раз
+	opts := database.TxOptions{Tenant: tenant, ReadOnly: true, SingleAttempt: true}
+	return r.txManager.WithTx(ctx, opts, func(_ context.Context, tx *sqlx.Tx) error {
+		return database.EachRow(ctx, tx, query, args, func(rows *sqlx.Rows) error {
+			var employee ExportEntity
+			if err := rows.StructScan(&employee); err != nil {
+				return err
+			}
+			return fn(employee)
+		})
+	})
+}
+
+// planRows оценка числа строк верхнего узла плана EXPLAIN (FORMAT JSON)
+func planRows(plan []byte) (int64, error) {
+	var explained []struct {
+		Plan struct {
+			Rows float64 `json:"Plan Rows"`
+		} `json:"Plan"`
+	}
+	if err := json.Unmarshal(plan, &explained); err != nil {
+		return 0, fmt.Errorf("parse query plan: %w", err)
+	}
+	if len(explained) == 0 {
+		return 0, errors.New("parse query plan: empty plan")
+	}
+	return int64(math.Round(explained[0].Plan.Rows)), nil
+}
+
+// filter FROM и WHERE страницы сотрудников арендатора с плейсхолдерами ?
+func (r *Repository) filter(tenant common.Tenant, name string) (string, []any) {
+	where := " FROM employee WHERE (tenant_id = ? OR ?)"
+	args := []any{tenant.Id, tenant.All}
 	if name != "" {
-		query += `AND name ILIKE ?`
+		where += " AND " + r.dialect.ILike("name")
 		args = append(args, "%"+name+"%")
 	}
-	query = sqlx.Rebind(sqlx.DOLLAR, query)
-	err = tx.Get(&count, query, args...)
-	return count, err
+	return where, args
+}
+
+// Выражения совпадают с индексами employee_search_fts_idx и employee_search_trgm_idx
+// из миграции 20261018190000_employee_search.sql
+const (
+	searchVector = `setweight(to_tsvector('simple', name), 'A') ||
+		setweight(to_tsvector('simple', coalesce(login, '') || ' ' || coalesce(email, '')), 'B') ||
+		setweight(to_tsvector('simple', coalesce(department, '')), 'C')`
+	searchText = `lower(name || ' ' || coalesce(login, '') || ' ' || coalesce(email, '') || ' ' || coalesce(department, ''))`
+)
+
+// Search ищет сотрудников по словам запроса query или его транслитерации translit и по сходству триграмм.
+// Релевантность складывается из ts_rank (имя весит больше логина, почты и отдела) и word_similarity,
+// фрагмент ts_headline отмечает совпавшие слова. В SQLite поиск сводится к LIKE по подстроке.
+func (r *Repository) Search(ctx context.Context, tenant common.Tenant, query, translit string, limit int64) (employees []SearchEntity, err error) {
+	if r.dialect.IsSQLite() {
+		return r.searchLike(ctx, tenant, query, translit, limit)
+	}
+	q := `WITH q AS (SELECT websearch_to_tsquery('simple', $1) || websearch_to_tsquery('simple', $2) AS ts)
+		SELECT found.*, ts_headline('simple', concat_ws(' ', found.name, found.login, found.email, found.department), q.ts,
+			$8) AS highlight
+		FROM (
+			SELECT employee.*, ts_rank(` + searchVector + `, q.ts) +
+				greatest(word_similarity($3, ` + searchText + `), word_similarity($4, ` + searchText + `)) AS rank
+			FROM employee, q
+			WHERE (tenant_id = $5 OR $6)
+				AND ((` + searchVector + `) @@ q.ts OR ` + searchText + ` %> $3 OR ` + searchText + ` %> $4)
+			ORDER BY rank DESC, id
+			LIMIT $7
+		) found, q
+		ORDER BY found.rank DESC, found.id`
+	err = r.inReadTx(ctx, tenant, func(tx *sqlx.Tx) error {
+		return tx.SelectContext(ctx, &employees, q, query, translit,
+			strings.ToLower(query), strings.ToLower(translit), tenant.Id, tenant.All, limit, headlineOptions)
+	})
+	return employees, err
+}
+
+// headlineOptions ts_headline выделяет совпадения границами highlightStart и highlightStop, а не тегами:
+// текст сотрудника экранируется уже после выделения, см. highlightHtml
+var headlineOptions = fmt.Sprintf(`StartSel="%s", StopSel="%s", HighlightAll=true`, highlightStart, highlightStop)
+
+// searchLike поиск для SQLite: lower и LIKE без учёта регистра работают там только для латиницы
+func (r *Repository) searchLike(ctx context.Context, tenant common.Tenant, query, translit string, limit int64) (employees []SearchEntity, err error) {
+	q := `SELECT *, CASE WHEN lower(name) LIKE $3 OR lower(name) LIKE $4 THEN 1.0 ELSE 0.5 END AS rank,
+			name || coalesce(' ' || login, '') || coalesce(' ' || email, '') || coalesce(' ' || department, '') AS highlight
+		FROM employee
+		WHERE (tenant_id = $1 OR $2) AND (` + searchText + ` LIKE $3 OR ` + searchText + ` LIKE $4)
+		ORDER BY rank DESC, id
+		LIMIT $5`
+	err = r.inReadTx(ctx, tenant, func(tx *sqlx.Tx) error {
+		return tx.SelectContext(ctx, &employees, q, tenant.Id, tenant.All,
+			"%"+strings.ToLower(query)+"%", "%"+strings.ToLower(translit)+"%", limit)
+	})
+	return employees, err
 }
 
-func (r *Repository) FindKeySetPagination(tx *sqlx.Tx, lastId, limit int64) (employees []Entity, err error) {
-	query := "select * from employee where id > $1 order by id limit $2;"
-	err = tx.Select(&employees, query, lastId, limit)
+// FindKeySetPagination страница сотрудников с id больше lastId, фильтр name тот же, что у FindPageWithFilter и GetTotal
+func (r *Repository) FindKeySetPagination(ctx context.Context, tx *sqlx.Tx, tenant common.Tenant, lastId, limit int64, name string) (employees []Entity, err error) {
+	where, args := r.filter(tenant, name)
+	query := "SELECT id, tenant_id, name, login, email, department, created_at, updated_at" + where + " AND id > ? ORDER BY id LIMIT ?"
+	args = append(args, lastId, limit)
+	query = sqlx.Rebind(sqlx.DOLLAR, query)
+	err = tx.SelectContext(ctx, &employees, query, args...)
 	return employees, err
 }
@@ -0,0 +1,55 @@
+package employee
+
+import (
+	"context"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"idm/inner/common"
+	"testing"
+)
+
+func TestRepository_EstimateTotal(t *testing.T) {
+	ctx := context.Background()
+	newTx := func(t *testing.T) (*Repository, *sqlx.Tx, sqlmock.Sqlmock) {
+		db, mock, err := sqlmock.New()
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = db.Close() })
+		mock.ExpectBegin()
+		sqlxDb := sqlx.NewDb(db, "postgres")
+		tx, err := sqlxDb.Beginx()
+		require.NoError(t, err)
+		return NewRepository(sqlxDb, nil), tx, mock
+	}
+	t.Run("should use table statistics without filter", func(t *testing.T) {
+		repo, tx, mock := newTx(t)
+		mock.ExpectQuery("SELECT reltuples::bigint FROM pg_class").
+			WillReturnRows(sqlmock.NewRows([]string{"reltuples"}).AddRow(1200000))
+		count, err := repo.EstimateTotal(ctx, tx, common.AllTenants(), "")
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1200000), count)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+	t.Run("should use query plan with filter", func(t *testing.T) {
+		repo, tx, mock := newTx(t)
+		mock.ExpectQuery(`EXPLAIN \(FORMAT JSON\) SELECT 1 FROM employee WHERE \(tenant_id = \$1 OR \$2\) AND name ILIKE \$3`).
+			WithArgs("acme", false, "%ann%").
+			WillReturnRows(sqlmock.NewRows([]string{"QUERY PLAN"}).AddRow(`[{"Plan": {"Node Type": "Seq Scan", "Plan Rows": 42.4}}]`))
+		count, err := repo.EstimateTotal(ctx, tx, common.SingleTenant("acme"), "ann")
+		assert.NoError(t, err)
+		assert.Equal(t, int64(42), count)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+	t.Run("should fall back to query plan for table never analyzed", func(t *testing.T) {
+		repo, tx, mock := newTx(t)
+		mock.ExpectQuery("SELECT reltuples::bigint FROM pg_class").
+			WillReturnRows(sqlmock.NewRows([]string{"reltuples"}).AddRow(-1))
+		mock.ExpectQuery(`EXPLAIN \(FORMAT JSON\)`).
+			WillReturnRows(sqlmock.NewRows([]string{"QUERY PLAN"}).AddRow(`[{"Plan": {"Plan Rows": 1530}}]`))
+		count, err := repo.EstimateTotal(ctx, tx, common.AllTenants(), "")
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1530), count)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
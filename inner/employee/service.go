@@ -1,31 +1,41 @@
 package employee
 
 import (
+	"cmp"
 	"context"
 	"database/sql"
 	"errors"
 	"fmt"
 	"github.com/jmoiron/sqlx"
 	"idm/inner/common"
+	"idm/inner/database"
+	"strings"
 )
 
 type Service struct {
 	repo      Repo
 	validator Validator
+	imports   *importJobs
 }
 
+// Repo все методы чтения и удаления ограничены арендатором, Add берёт арендатора из Entity.TenantId
 type Repo interface {
-	FindById(id int64) (Entity, error)
-	FindByNameTx(tx *sqlx.Tx, name string) (bool, error)
-	GetAll(ctx context.Context) ([]Entity, error)
-	Add(tx *sqlx.Tx, employee Entity) (int64, error)
-	GetGroupById(ids []int64) ([]Entity, error)
-	Delete(id int64) error
-	DeleteGroup(ids []int64) error
-	BeginTransaction() (*sqlx.Tx, error)
-	FindPageWithFilter(tx *sqlx.Tx, offset, limit int64, name string) (employees []Entity, err error)
-	GetTotal(tx *sqlx.Tx, name string) (count int64, err error)
-	FindKeySetPagination(tx *sqlx.Tx, lastId, limit int64) ([]Entity, error)
+	database.TxManager
+	FindById(ctx context.Context, tenant common.Tenant, id int64) (Entity, error)
+	FindByNameTx(ctx context.Context, tx *sqlx.Tx, tenantId string, name string) (bool, error)
+	GetAll(ctx context.Context, tenant common.Tenant) ([]Entity, error)
+	Add(ctx context.Context, tx *sqlx.Tx, employee Entity) (int64, error)
+	FindByLoginTx(ctx context.Context, tx *sqlx.Tx, tenantId string, login string) (Entity, error)
+	UpdateTx(ctx context.Context, tx *sqlx.Tx, employee Entity) error
+	GetGroupById(ctx context.Context, tenant common.Tenant, ids []int64) ([]Entity, error)
+	Delete(ctx context.Context, tenant common.Tenant, id int64) error
+	DeleteGroup(ctx context.Context, tenant common.Tenant, ids []int64) error
+	FindPageWithFilter(ctx context.Context, tx *sqlx.Tx, tenant common.Tenant, offset, limit int64, name string) (employees []Entity, err error)
+	GetTotal(ctx context.Context, tx *sqlx.Tx, tenant common.Tenant, name string) (count int64, err error)
+	EstimateTotal(ctx context.Context, tx *sqlx.Tx, tenant common.Tenant, name string) (count int64, err error)
+	FindKeySetPagination(ctx context.Context, tx *sqlx.Tx, tenant common.Tenant, lastId, limit int64, name string) ([]Entity, error)
+	Search(ctx context.Context, tenant common.Tenant, query, translit string, limit int64) ([]SearchEntity, error)
+	Export(ctx context.Context, tenant common.Tenant, name string, fn func(ExportEntity) error) error
 }
 
 type Validator interface {
@@ -33,28 +43,28 @@ type Validator interface {
 }
 
 func NewService(repo Repo, validator Validator) *Service {
-	return &Service{repo: repo, validator: validator}
+	return &Service{repo: repo, validator: validator, imports: newImportJobs()}
 }
 
-func (s *Service) FindById(req IdRequest) (employee Response, err error) {
+func (s *Service) FindById(ctx context.Context, tenant common.Tenant, req IdRequest) (employee Response, err error) {
 	if err = s.validator.Validate(req); err != nil {
 		return Response{}, &common.RequestValidationError{Massage: err.Error()}
 	}
-	entity, err := s.repo.FindById(req.Id)
+	entity, err := s.repo.FindById(ctx, tenant, req.Id)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return Response{}, &common.NotFoundError{Massage: fmt.Sprintf("employee service: find by id: "+
 				"employee not found: id=%d", req.Id)}
 		}
-		return Response{}, fmt.Errorf("employee service: find by id: error finding employee: id=%d", req.Id)
+		return Response{}, fmt.Errorf("employee service: find by id: error finding employee: id=%d: %w", req.Id, err)
 	}
 	return entity.toResponse(), nil
 }
 
-func (s *Service) GetAll(ctx context.Context) ([]Response, error) {
-	all, err := s.repo.GetAll(ctx)
+func (s *Service) GetAll(ctx context.Context, tenant common.Tenant) ([]Response, error) {
+	all, err := s.repo.GetAll(ctx, tenant)
 	if err != nil {
-		return []Response{}, fmt.Errorf("employee service: get all employees: error to retrieve all employees")
+		return []Response{}, fmt.Errorf("employee service: get all employees: error to retrieve all employees: %w", err)
 	}
 	var resp []Response
 	for _, entity := range all {
@@ -63,51 +73,47 @@ func (s *Service) GetAll(ctx context.Context) ([]Response, error) {
 	return resp, nil
 }
 
-func (s *Service) Add(request NameRequest) (id int64, err error) {
+func (s *Service) Add(ctx context.Context, tenant common.Tenant, request NameRequest) (id int64, err error) {
 	if err = s.validator.Validate(request); err != nil {
 		return 0, &common.RequestValidationError{Massage: err.Error()}
 	}
-	tx, err := s.repo.BeginTransaction()
+	tenantId, err := tenant.ForWrite()
 	if err != nil {
-		return 0, fmt.Errorf("employee service: add employee: error starting transaction")
+		return 0, err
 	}
-	defer func() {
-		if p := recover(); p != nil {
-			_ = tx.Rollback()
-			err = fmt.Errorf("employee service: add employee: panic add employee: %v", p)
-			return
+	// SERIALIZABLE: параллельное добавление сотрудника с тем же именем не пройдёт проверку на дубликат
+	opts := database.TxOptions{Tenant: common.SingleTenant(tenantId), Isolation: sql.LevelSerializable}
+	err = s.repo.WithTx(ctx, opts, func(ctx context.Context, tx *sqlx.Tx) error {
+		isExists, err := s.repo.FindByNameTx(ctx, tx, tenantId, request.Name)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("error checking exists employee: %w", err)
 		}
-		if err != nil {
-			if rbErr := tx.Rollback(); rbErr != nil {
-				err = fmt.Errorf("rollback failed: original error: %w", err)
-			}
-			return
+		if isExists {
+			return &common.AlreadyExistsError{Massage: fmt.Sprintf("employee with name %s already exists", request.Name)}
 		}
-		if commitErr := tx.Commit(); commitErr != nil {
-			err = fmt.Errorf("employee service: add employee: committing transaction failed: %w", commitErr)
+		id, err = s.repo.Add(ctx, tx, request.toEntity(tenantId))
+		if err != nil {
+			return fmt.Errorf("error adding employee: %w", err)
 		}
-	}()
-	isExists, err := s.repo.FindByNameTx(tx, request.Name)
-	if err != nil && !errors.Is(err, sql.ErrNoRows) {
-		return 0, fmt.Errorf("employee service: add employee: error checking exists employee")
-	}
-	if isExists {
-		return 0, &common.AlreadyExistsError{Massage: fmt.Sprintf("employee with name %s already exists", request.Name)}
-	}
-	id, err = s.repo.Add(tx, request.toEntity())
+		return nil
+	})
 	if err != nil {
-		return -1, fmt.Errorf("employee service: add employee: error adding employee")
+		if id > 0 {
+			// транзакция не зафиксирована
+			id = -1
+		}
+		return id, fmt.Errorf("employee service: add employee: %w", err)
 	}
 	return id, nil
 }
 
-func (s *Service) GetGroupById(req IdsRequest) ([]Response, error) {
+func (s *Service) GetGroupById(ctx context.Context, tenant common.Tenant, req IdsRequest) ([]Response, error) {
 	if err := s.validator.Validate(req); err != nil {
 		return []Response{}, &common.RequestValidationError{Massage: err.Error()}
 	}
-	employees, err := s.repo.GetGroupById(req.Ids)
+	employees, err := s.repo.GetGroupById(ctx, tenant, req.Ids)
 	if err != nil {
-		return nil, fmt.Errorf("employee service: get group by id: error getting employees with ids %v", req.Ids)
+		return nil, fmt.Errorf("employee service: get group by id: error getting employees with ids %v: %w", req.Ids, err)
 	}
 	var resp []Response
 	for _, emp := range employees {
@@ -116,112 +122,233 @@ func (s *Service) GetGroupById(req IdsRequest) ([]Response, error) {
 	return resp, nil
 }
 
-func (s *Service) Delete(req IdRequest) error {
+func (s *Service) Delete(ctx context.Context, tenant common.Tenant, req IdRequest) error {
 	if err := s.validator.Validate(req); err != nil {
 		return &common.RequestValidationError{Massage: err.Error()}
 	}
-	err := s.repo.Delete(req.Id)
+	err := s.repo.Delete(ctx, tenant, req.Id)
 	if err != nil {
-		return fmt.Errorf("employee service: delete: error deleting employee with id %d", req.Id)
+		return fmt.Errorf("employee service: delete: error deleting employee with id %d: %w", req.Id, err)
 	}
 	return nil
 }
 
-func (s *Service) DeleteGroup(req IdsRequest) error {
+func (s *Service) DeleteGroup(ctx context.Context, tenant common.Tenant, req IdsRequest) error {
 	if err := s.validator.Validate(req); err != nil {
 		return &common.RequestValidationError{Massage: err.Error()}
 	}
-	err := s.repo.DeleteGroup(req.Ids)
+	err := s.repo.DeleteGroup(ctx, tenant, req.Ids)
 	if err != nil {
-		return fmt.Errorf("employee service: delete group: error deleting group with id %v", req.Ids)
+		return fmt.Errorf("employee service: delete group: error deleting group with id %v: %w", req.Ids, err)
 	}
 	return nil
 }
 
-func (s *Service) GetPage(request PageRequest) (pageEmp PageResponse, err error) {
+func (s *Service) GetPage(ctx context.Context, tenant common.Tenant, request PageRequest) (pageEmp PageResponse, err error) {
 	if err = s.validator.Validate(request); err != nil {
 		return PageResponse{}, &common.RequestValidationError{Massage: err.Error()}
 	}
-	tx, err := s.repo.BeginTransaction()
-	if err != nil {
-		return PageResponse{}, fmt.Errorf("employee service: get page: error starting transaction")
-	}
-	defer func() {
-		if p := recover(); p != nil {
-			_ = tx.Rollback()
-			err = fmt.Errorf("employee service: get page: panic add employee: %v", p)
-			return
+	offset := request.PageNumber * request.PageSize
+	limit := request.PageSize
+	name := request.TextFilter
+	count := cmp.Or(request.Count, CountExact)
+	// страница и общее количество считаются по одному снимку данных
+	err = s.repo.WithTx(ctx, pageTxOptions(tenant), func(ctx context.Context, tx *sqlx.Tx) error {
+		page, err := s.repo.FindPageWithFilter(ctx, tx, tenant, offset, limit, name)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("employee service: get page: %w", err)
 		}
+		total, err := s.total(ctx, tx, tenant, name, count)
 		if err != nil {
-			if rbErr := tx.Rollback(); rbErr != nil {
-				err = fmt.Errorf("rollback failed: original error: %w", err)
-			}
-			return
+			return fmt.Errorf("employee service: get total count of page: %w", err)
 		}
-		if commitErr := tx.Commit(); commitErr != nil {
-			err = fmt.Errorf("employee service: get page: committing transaction failed: %w", commitErr)
+		pageEmp = PageResponse{
+			page,
+			request.PageSize,
+			request.PageNumber,
+			total,
+			count,
 		}
-	}()
-	offset := request.PageNumber * request.PageSize
+		return nil
+	})
+	if err != nil {
+		return PageResponse{}, err
+	}
+	return pageEmp, nil
+}
+
+func (s *Service) GetKeySetPage(ctx context.Context, tenant common.Tenant, request PageKeySetRequest) (pageEmp PageKeySetResponse, err error) {
+	if err = s.validator.Validate(request); err != nil {
+		return PageKeySetResponse{}, &common.RequestValidationError{Massage: err.Error()}
+	}
+	lastId := request.LastId
 	limit := request.PageSize
 	name := request.TextFilter
-	var page []Entity
-	page, err = s.repo.FindPageWithFilter(tx, offset, limit, name)
-	if err != nil && !errors.Is(err, sql.ErrNoRows) {
-		return PageResponse{}, fmt.Errorf("employee service: get page")
+	count := cmp.Or(request.Count, CountNone)
+	err = s.repo.WithTx(ctx, pageTxOptions(tenant), func(ctx context.Context, tx *sqlx.Tx) error {
+		page, err := s.repo.FindKeySetPagination(ctx, tx, tenant, lastId, limit, name)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("employee service: get page: %w", err)
+		}
+		// следующая страница начинается после последнего сотрудника этой, пустая страница оставляет курсор на месте
+		if len(page) > 0 {
+			lastId = page[len(page)-1].Id
+		}
+		total, err := s.total(ctx, tx, tenant, name, count)
+		if err != nil {
+			return fmt.Errorf("employee service: get total count of page: %w", err)
+		}
+		pageEmp = PageKeySetResponse{
+			Result: page,
+			LastId: lastId,
+			Total:  total,
+			Count:  count,
+		}
+		return nil
+	})
+	if err != nil {
+		return PageKeySetResponse{}, err
+	}
+	return pageEmp, nil
+}
+
+// Search ищет сотрудников по запросу и его транслитерации: "Иванов" находит Ivanov и наоборот
+func (s *Service) Search(ctx context.Context, tenant common.Tenant, request SearchRequest) ([]SearchResult, error) {
+	if err := s.validator.Validate(request); err != nil {
+		return nil, &common.RequestValidationError{Massage: err.Error()}
 	}
-	total, err := s.repo.GetTotal(tx, name)
+	found, err := s.repo.Search(ctx, tenant, request.Query, transliterate(request.Query), request.Limit)
 	if err != nil {
-		return PageResponse{}, fmt.Errorf("employee service: get total count of page")
+		return nil, fmt.Errorf("employee service: search: error searching employees by %q: %w", request.Query, err)
 	}
-	pageEmp = PageResponse{
-		page,
-		request.PageSize,
-		request.PageNumber,
-		total,
+	resp := make([]SearchResult, 0, len(found))
+	for _, entity := range found {
+		resp = append(resp, entity.toResult())
 	}
-	return pageEmp, nil
+	return resp, nil
 }
 
-func (s *Service) GetKeySetPage(request PageKeySetRequest) (pageEmp PageKeySetResponse, err error) {
-	if err = s.validator.Validate(request); err != nil {
-		return PageKeySetResponse{}, &common.RequestValidationError{Massage: err.Error()}
+// Export передаёт write сотрудников по одному в порядке id, не загружая всю таблицу
+func (s *Service) Export(ctx context.Context, tenant common.Tenant, request ExportRequest, write func(ExportRow) error) error {
+	err := s.repo.Export(ctx, tenant, request.TextFilter, func(entity ExportEntity) error {
+		return write(entity.toRow())
+	})
+	if err != nil {
+		return fmt.Errorf("employee service: export: %w", err)
 	}
-	tx, err := s.repo.BeginTransaction()
+	return nil
+}
+
+// errDryRun откатывает транзакцию пробного импорта
+var errDryRun = errors.New("dry run")
+
+// Import сохраняет строки по одной в общей транзакции: строка с ошибкой откатывается до своей точки сохранения
+// и попадает в отчёт, остальные строки импортируются. progress получает число обработанных строк.
+func (s *Service) Import(ctx context.Context, tenant common.Tenant, request ImportRequest, progress func(processed int)) (report ImportReport, err error) {
+	tenantId, err := tenant.ForWrite()
 	if err != nil {
-		return PageKeySetResponse{}, fmt.Errorf("employee service: get page: error starting transaction")
+		return ImportReport{}, err
 	}
-	defer func() {
-		if p := recover(); p != nil {
-			_ = tx.Rollback()
-			err = fmt.Errorf("employee service: get page: panic add employee: %v", p)
-			return
-		}
-		if err != nil {
-			if rbErr := tx.Rollback(); rbErr != nil {
-				err = fmt.Errorf("rollback failed: original error: %w", err)
+	opts := database.TxOptions{Tenant: common.SingleTenant(tenantId)}
+	err = s.repo.WithTx(ctx, opts, func(ctx context.Context, tx *sqlx.Tx) error {
+		// при повторе транзакции отчёт собирается заново
+		report = ImportReport{DryRun: request.DryRun, Total: len(request.Rows), Errors: []ImportError{}}
+		lines := make(map[string]int)
+		for i, row := range request.Rows {
+			created, err := s.importRow(ctx, opts, tenantId, row, lines)
+			var reqErr *common.RequestValidationError
+			var existsErr *common.AlreadyExistsError
+			var conflictErr *common.ConflictError
+			switch {
+			case errors.As(err, &reqErr) || errors.As(err, &existsErr) || errors.As(err, &conflictErr):
+				report.Failed++
+				report.Errors = append(report.Errors, ImportError{Line: row.Line, Login: row.Login, Message: err.Error()})
+			case err != nil:
+				return fmt.Errorf("line %d: %w", row.Line, err)
+			case created:
+				report.Created++
+			default:
+				report.Updated++
+			}
+			if progress != nil {
+				progress(i + 1)
 			}
-			return
 		}
-		if commitErr := tx.Commit(); commitErr != nil {
-			err = fmt.Errorf("employee service: get page: committing transaction failed: %w", commitErr)
+		if request.DryRun {
+			return errDryRun
 		}
-	}()
-	lastId := request.LastId
-	limit := request.PageSize
-	name := request.TextFilter
-	page, err := s.repo.FindKeySetPagination(tx, lastId, limit)
-	if err != nil && !errors.Is(err, sql.ErrNoRows) {
-		return PageKeySetResponse{}, fmt.Errorf("employee service: get page")
+		return nil
+	})
+	if err != nil && !errors.Is(err, errDryRun) {
+		return report, fmt.Errorf("employee service: import: %w", err)
+	}
+	return report, nil
+}
+
+// importRow добавляет сотрудника или обновляет сотрудника с тем же логином.
+// lines - строки файла с уже встреченными логинами: второй раз логин в файле считается ошибкой.
+func (s *Service) importRow(ctx context.Context, opts database.TxOptions, tenantId string, row ImportRow, lines map[string]int) (created bool, err error) {
+	if err = s.validator.Validate(row.NameRequest); err != nil {
+		return false, &common.RequestValidationError{Massage: err.Error()}
+	}
+	if row.Login != "" {
+		login := strings.ToLower(row.Login)
+		if line, ok := lines[login]; ok {
+			return false, &common.RequestValidationError{Massage: fmt.Sprintf("login %s is already used on line %d", row.Login, line)}
+		}
+		lines[login] = row.Line
 	}
-	total, err := s.repo.GetTotal(tx, name)
+	err = s.repo.WithTx(ctx, opts, func(ctx context.Context, tx *sqlx.Tx) error {
+		entity := row.toEntity(tenantId)
+		if row.Login != "" {
+			existing, err := s.repo.FindByLoginTx(ctx, tx, tenantId, row.Login)
+			if err == nil {
+				entity.Id = existing.Id
+				return s.repo.UpdateTx(ctx, tx, entity)
+			}
+			if !errors.Is(err, sql.ErrNoRows) {
+				return err
+			}
+		}
+		_, err := s.repo.Add(ctx, tx, entity)
+		created = err == nil
+		return err
+	})
+	return created, err
+}
+
+// StartImport выполняет Import в фоне. ctx не должен отменяться по завершении HTTP запроса.
+func (s *Service) StartImport(ctx context.Context, tenant common.Tenant, request ImportRequest) (ImportJob, error) {
+	tenantId, err := tenant.ForWrite()
 	if err != nil {
-		return PageKeySetResponse{}, fmt.Errorf("employee service: get total count of page")
+		return ImportJob{}, err
 	}
-	pageEmp = PageKeySetResponse{
-		Result: page,
-		LastId: lastId,
-		Total:  total,
+	return s.imports.start(ctx, tenantId, len(request.Rows), func(ctx context.Context, progress func(int)) (ImportReport, error) {
+		return s.Import(ctx, common.SingleTenant(tenantId), request, progress)
+	}), nil
+}
+
+// FindImportJob задача импорта, видимая арендатору
+func (s *Service) FindImportJob(_ context.Context, tenant common.Tenant, id string) (ImportJob, error) {
+	job, ok := s.imports.get(id)
+	if !ok || !tenant.All && job.TenantId != tenant.Id {
+		return ImportJob{}, &common.NotFoundError{Massage: fmt.Sprintf("employee service: find import job: job not found: id=%s", id)}
 	}
-	return pageEmp, nil
+	return job, nil
+}
+
+// total количество сотрудников по фильтру name способом count
+func (s *Service) total(ctx context.Context, tx *sqlx.Tx, tenant common.Tenant, name string, count CountMode) (int64, error) {
+	switch count {
+	case CountNone:
+		return 0, nil
+	case CountEstimate:
+		return s.repo.EstimateTotal(ctx, tx, tenant, name)
+	default:
+		return s.repo.GetTotal(ctx, tx, tenant, name)
+	}
+}
+
+func pageTxOptions(tenant common.Tenant) database.TxOptions {
+	return database.TxOptions{Tenant: tenant, Isolation: sql.LevelRepeatableRead, ReadOnly: true}
 }
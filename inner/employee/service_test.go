@@ -9,7 +9,9 @@ import (
 	"github.com/jmoiron/sqlx"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"go.uber.org/zap"
 	"idm/inner/common"
+	"idm/inner/database"
 	"idm/inner/validator"
 	"testing"
 	"time"
@@ -19,61 +21,98 @@ type MockRepo struct {
 	mock.Mock
 }
 
-func (m *MockRepo) FindWithPagination(tx *sqlx.Tx, offset, limit int64) ([]Entity, error) {
+func (m *MockRepo) FindWithPagination(ctx context.Context, tx *sqlx.Tx, offset, limit int64) ([]Entity, error) {
 	panic("implement me")
 }
 
-func (m *MockRepo) FindPageWithFilter(tx *sqlx.Tx, offset, limit int64, name string) (employees []Entity, err error) {
+func (m *MockRepo) FindPageWithFilter(ctx context.Context, tx *sqlx.Tx, tenant common.Tenant, offset, limit int64, name string) (employees []Entity, err error) {
 	panic("implement me")
 }
 
-func (m *MockRepo) FindKeySetPagination(tx *sqlx.Tx, lastId, limit int64) ([]Entity, error) {
+func (m *MockRepo) FindKeySetPagination(ctx context.Context, tx *sqlx.Tx, tenant common.Tenant, lastId, limit int64, name string) ([]Entity, error) {
 	panic("implement me")
 }
 
-func (m *MockRepo) GetTotal(tx *sqlx.Tx, name string) (count int64, err error) {
+func (m *MockRepo) GetTotal(ctx context.Context, tx *sqlx.Tx, tenant common.Tenant, name string) (count int64, err error) {
 	panic("implement me")
 }
 
-func (m *MockRepo) FindById(id int64) (Entity, error) {
+func (m *MockRepo) EstimateTotal(ctx context.Context, tx *sqlx.Tx, tenant common.Tenant, name string) (count int64, err error) {
+	panic("implement me")
+}
+
+func (m *MockRepo) Export(ctx context.Context, tenant common.Tenant, name string, fn func(ExportEntity) error) error {
+	args := m.Called(name)
+	for _, entity := range args.Get(0).([]ExportEntity) {
+		if err := fn(entity); err != nil {
+			return err
+		}
+	}
+	return args.Error(1)
+}
+
+func (m *MockRepo) FindByLoginTx(ctx context.Context, tx *sqlx.Tx, tenantId string, login string) (Entity, error) {
+	panic("implement me")
+}
+
+func (m *MockRepo) UpdateTx(ctx context.Context, tx *sqlx.Tx, employee Entity) error {
+	panic("implement me")
+}
+
+func (m *MockRepo) FindById(ctx context.Context, tenant common.Tenant, id int64) (Entity, error) {
 	args := m.Called(id)
 	return args.Get(0).(Entity), args.Error(1)
 }
 
-func (m *MockRepo) GetAll(context.Context) ([]Entity, error) {
+func (m *MockRepo) GetAll(ctx context.Context, tenant common.Tenant) ([]Entity, error) {
 	args := m.Called()
 	return args.Get(0).([]Entity), args.Error(1)
 }
 
-func (m *MockRepo) Add(tx *sqlx.Tx, employee Entity) (int64, error) {
+func (m *MockRepo) Add(ctx context.Context, tx *sqlx.Tx, employee Entity) (int64, error) {
 	args := m.Called(tx, employee)
 	return args.Get(0).(int64), args.Error(1)
 }
 
-func (m *MockRepo) GetGroupById(ids []int64) ([]Entity, error) {
+func (m *MockRepo) GetGroupById(ctx context.Context, tenant common.Tenant, ids []int64) ([]Entity, error) {
 	args := m.Called(ids)
 	return args.Get(0).([]Entity), args.Error(1)
 }
 
-func (m *MockRepo) Delete(id int64) error {
+func (m *MockRepo) Delete(ctx context.Context, tenant common.Tenant, id int64) error {
 	args := m.Called(id)
 	return args.Error(0)
 }
-func (m *MockRepo) DeleteGroup(ids []int64) error {
+func (m *MockRepo) DeleteGroup(ctx context.Context, tenant common.Tenant, ids []int64) error {
 	args := m.Called(ids)
 	return args.Error(0)
 }
 
-func (m *MockRepo) BeginTransaction() (tx *sqlx.Tx, err error) {
+func (m *MockRepo) WithTx(ctx context.Context, opts database.TxOptions, fn database.TxFunc) error {
 	args := m.Called()
-	return args.Get(0).(*sqlx.Tx), args.Error(1)
+	if err := args.Error(1); err != nil {
+		return err
+	}
+	tx := args.Get(0).(*sqlx.Tx)
+	if err := fn(ctx, tx); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return tx.Commit()
 }
 
-func (m *MockRepo) FindByNameTx(tx *sqlx.Tx, name string) (bool, error) {
+func (m *MockRepo) FindByNameTx(ctx context.Context, tx *sqlx.Tx, tenantId string, name string) (bool, error) {
 	args := m.Called(tx, name)
 	return args.Get(0).(bool), args.Error(1)
 }
 
+func (m *MockRepo) Search(ctx context.Context, tenant common.Tenant, query, translit string, limit int64) ([]SearchEntity, error) {
+	args := m.Called(query, translit, limit)
+	return args.Get(0).([]SearchEntity), args.Error(1)
+}
+
+var testTenant = common.SingleTenant("acme")
+
 func TestFindById(t *testing.T) {
 	a := assert.New(t)
 	t.Run("should return found employee", func(t *testing.T) {
@@ -87,7 +126,7 @@ func TestFindById(t *testing.T) {
 		}
 		want := entity.toResponse()
 		repo.On("FindById", int64(1)).Return(entity, nil)
-		got, err := srv.FindById(IdRequest{1})
+		got, err := srv.FindById(context.Background(), testTenant, IdRequest{1})
 		a.NoError(err)
 		a.Equal(want, got)
 		a.True(repo.AssertNumberOfCalls(t, "FindById", 1))
@@ -99,7 +138,7 @@ func TestFindById(t *testing.T) {
 		id := int64(1)
 		want := &common.NotFoundError{Massage: fmt.Sprintf("employee service: find by id: employee not found: id=%d", id)}
 		repo.On("FindById", id).Return(entity, sql.ErrNoRows)
-		response, got := srv.FindById(IdRequest{id})
+		response, got := srv.FindById(context.Background(), testTenant, IdRequest{id})
 		var notFoundErr *common.NotFoundError
 		a.True(errors.As(got, &notFoundErr))
 		a.Empty(response)
@@ -117,10 +156,12 @@ func TestAdd(t *testing.T) {
 		a.NoError(err)
 		m.ExpectBegin().WillReturnError(fmt.Errorf("error beginning transaction"))
 		sqlxDB := sqlx.NewDb(db, "postgres")
-		repo := NewRepository(sqlxDB)
-		_, err = repo.BeginTransaction()
+		repo := NewRepository(sqlxDB, database.NewTxManager(sqlxDB, &common.Logger{Logger: zap.NewNop()}, 1))
+		err = repo.WithTx(context.Background(), database.TxOptions{Tenant: testTenant}, func(ctx context.Context, tx *sqlx.Tx) error {
+			return nil
+		})
 		a.Error(err)
-		a.Equal("error beginning transaction", err.Error())
+		a.ErrorContains(err, "error beginning transaction")
 	})
 	t.Run("should return error finding employee by name", func(t *testing.T) {
 		a := assert.New(t)
@@ -152,15 +193,15 @@ func TestAdd(t *testing.T) {
 			CreatedAt: time.Now(),
 			UpdatedAt: time.Now(),
 		}
-		repo.On("BeginTransaction").Return(tx, nil)
+		repo.On("WithTx").Return(tx, nil)
 		want := fmt.Errorf("rollback failed: original error: employee service: add employee: error checking exists employee")
 		repo.On("FindByNameTx", tx, entity.Name).Return(false, want)
-		response, got := srv.Add(NameRequest{entity.Name})
+		response, got := srv.Add(context.Background(), testTenant, NameRequest{Name: entity.Name})
 		a.Empty(response)
 		a.NotNil(got)
 		a.ErrorContains(got, want.Error())
 		a.True(repo.AssertNumberOfCalls(t, "FindByNameTx", 1))
-		a.True(repo.AssertNumberOfCalls(t, "BeginTransaction", 1))
+		a.True(repo.AssertNumberOfCalls(t, "WithTx", 1))
 
 	})
 	t.Run("should return employee exists", func(t *testing.T) {
@@ -193,13 +234,13 @@ func TestAdd(t *testing.T) {
 			CreatedAt: time.Now(),
 			UpdatedAt: time.Now(),
 		}
-		repo.On("BeginTransaction").Return(tx, nil)
+		repo.On("WithTx").Return(tx, nil)
 		repo.On("FindByNameTx", tx, entity.Name).Return(true, nil)
-		id, err := srv.Add(NameRequest{entity.Name})
+		id, err := srv.Add(context.Background(), testTenant, NameRequest{Name: entity.Name})
 		assert.Error(t, err)
 		assert.Equal(t, int64(0), id)
 		a.True(repo.AssertNumberOfCalls(t, "FindByNameTx", 1))
-		a.True(repo.AssertNumberOfCalls(t, "BeginTransaction", 1))
+		a.True(repo.AssertNumberOfCalls(t, "WithTx", 1))
 	})
 	t.Run("employee not exists but fall while add", func(t *testing.T) {
 		a := assert.New(t)
@@ -233,12 +274,12 @@ func TestAdd(t *testing.T) {
 			UpdatedAt: time.Now(),
 		}
 		want := fmt.Errorf("employee service: add employee: error adding employee")
-		repo.On("BeginTransaction").Return(tx, nil)
+		repo.On("WithTx").Return(tx, nil)
 		repo.On("FindByNameTx", mock.Anything, entity.Name).Return(false, nil)
 		repo.On("Add", mock.Anything, mock.MatchedBy(func(e Entity) bool {
 			return e.Name == "John"
 		})).Return(int64(-1), want)
-		id, err := srv.Add(NameRequest{entity.Name})
+		id, err := srv.Add(context.Background(), testTenant, NameRequest{Name: entity.Name})
 		a.Error(err)
 		a.Contains(err.Error(), want.Error())
 		a.Equal(int64(-1), id)
@@ -272,16 +313,24 @@ func TestAdd(t *testing.T) {
 			Id: 1, Name: "John", CreatedAt: time.Now(), UpdatedAt: time.Now(),
 		}
 		want := int64(1)
-		repo.On("BeginTransaction").Return(tx, nil)
+		repo.On("WithTx").Return(tx, nil)
 		repo.On("FindByNameTx", mock.Anything, entity.Name).Return(false, nil)
 		repo.On("Add", mock.Anything, mock.MatchedBy(func(e Entity) bool {
-			return e.Name == "John"
+			return e.Name == "John" && e.TenantId == testTenant.Id
 		})).Return(want, nil)
-		got, err := srv.Add(NameRequest{entity.Name})
+		got, err := srv.Add(context.Background(), testTenant, NameRequest{Name: entity.Name})
 		a.NoError(err)
 		a.Equal(want, got)
 		a.True(repo.AssertNumberOfCalls(t, "Add", 1))
 	})
+	t.Run("should require single tenant", func(t *testing.T) {
+		a := assert.New(t)
+		repo := new(MockRepo)
+		srv := NewService(repo, validator.New())
+		_, err := srv.Add(context.Background(), common.AllTenants(), NameRequest{Name: "John"})
+		a.IsType(&common.RequestValidationError{}, err)
+		a.True(repo.AssertNumberOfCalls(t, "WithTx", 0))
+	})
 }
 func TestGetAll(t *testing.T) {
 	a := assert.New(t)
@@ -303,7 +352,7 @@ func TestGetAll(t *testing.T) {
 			want = append(want, e.toResponse())
 		}
 		repo.On("GetAll").Return(entities, nil)
-		got, err := srv.GetAll(context.Background())
+		got, err := srv.GetAll(context.Background(), testTenant)
 		a.NoError(err)
 		a.Equal(want, got)
 		a.True(repo.AssertNumberOfCalls(t, "GetAll", 1))
@@ -314,10 +363,10 @@ func TestGetAll(t *testing.T) {
 		entities := []Entity{}
 		want := fmt.Errorf("employee service: get all employees: error to retrieve all employees")
 		repo.On("GetAll").Return(entities, want)
-		response, got := srv.GetAll(context.Background())
+		response, got := srv.GetAll(context.Background(), testTenant)
 		a.Empty(response)
 		a.NotNil(got)
-		a.Equal(want, got)
+		a.ErrorIs(got, want)
 		a.True(repo.AssertNumberOfCalls(t, "GetAll", 1))
 	})
 }
@@ -343,7 +392,7 @@ func TestGetGroupById(t *testing.T) {
 		}
 		ids := []int64{1, 2}
 		repo.On("GetGroupById", ids).Return(entities, nil)
-		got, err := srv.GetGroupById(IdsRequest{ids})
+		got, err := srv.GetGroupById(context.Background(), testTenant, IdsRequest{ids})
 		a.NoError(err)
 		a.Equal(want, got)
 		a.True(repo.AssertNumberOfCalls(t, "GetGroupById", 1))
@@ -356,10 +405,11 @@ func TestGetGroupById(t *testing.T) {
 		ids := []int64{1, 2}
 		want := fmt.Errorf("employee service: get group by id: error getting employees with ids %v", ids)
 		repo.On("GetGroupById", ids).Return(entities, err)
-		response, got := srv.GetGroupById(IdsRequest{ids})
+		response, got := srv.GetGroupById(context.Background(), testTenant, IdsRequest{ids})
 		a.Empty(response)
 		a.NotNil(got)
-		a.Equal(want, got)
+		a.ErrorContains(got, want.Error())
+		a.ErrorIs(got, err)
 		a.True(repo.AssertNumberOfCalls(t, "GetGroupById", 1))
 	})
 }
@@ -369,7 +419,7 @@ func TestDelete(t *testing.T) {
 		repo := new(MockRepo)
 		srv := NewService(repo, validator.New())
 		repo.On("Delete", int64(1)).Return(nil)
-		err := srv.Delete(IdRequest{int64(1)})
+		err := srv.Delete(context.Background(), testTenant, IdRequest{int64(1)})
 		a.NoError(err)
 		a.True(repo.AssertNumberOfCalls(t, "Delete", 1))
 	})
@@ -380,9 +430,10 @@ func TestDelete(t *testing.T) {
 		id := int64(1)
 		want := fmt.Errorf("employee service: delete: error deleting employee with id %d", id)
 		repo.On("Delete", id).Return(err)
-		got := srv.Delete(IdRequest{id})
+		got := srv.Delete(context.Background(), testTenant, IdRequest{id})
 		a.NotNil(got)
-		a.Equal(want, got)
+		a.ErrorContains(got, want.Error())
+		a.ErrorIs(got, err)
 		a.True(repo.AssertNumberOfCalls(t, "Delete", 1))
 	})
 }
@@ -393,7 +444,7 @@ func TestDeleteGroup(t *testing.T) {
 		srv := NewService(repo, validator.New())
 		ids := []int64{1, 2}
 		repo.On("DeleteGroup", ids).Return(nil)
-		err := srv.DeleteGroup(IdsRequest{ids})
+		err := srv.DeleteGroup(context.Background(), testTenant, IdsRequest{ids})
 		a.NoError(err)
 		a.True(repo.AssertNumberOfCalls(t, "DeleteGroup", 1))
 	})
@@ -404,9 +455,10 @@ func TestDeleteGroup(t *testing.T) {
 		ids := []int64{1, 2}
 		want := fmt.Errorf("employee service: delete group: error deleting group with id %v", ids)
 		repo.On("DeleteGroup", ids).Return(err)
-		got := srv.DeleteGroup(IdsRequest{ids})
+		got := srv.DeleteGroup(context.Background(), testTenant, IdsRequest{ids})
 		a.NotNil(got)
-		a.Equal(want, got)
+		a.ErrorContains(got, want.Error())
+		a.ErrorIs(got, err)
 		a.True(repo.AssertNumberOfCalls(t, "DeleteGroup", 1))
 	})
 }
@@ -471,9 +523,9 @@ func TestValidator_NameRequest(t *testing.T) {
 		wantError bool
 		errorHint string
 	}{
-		{name: "correct name", input: NameRequest{"Ivan"}, wantError: false, errorHint: ""},
-		{name: "empty name", input: NameRequest{""}, wantError: true, errorHint: ""},
-		{name: "short name", input: NameRequest{"a"}, wantError: true, errorHint: ""},
+		{name: "correct name", input: NameRequest{Name: "Ivan"}, wantError: false, errorHint: ""},
+		{name: "empty name", input: NameRequest{Name: ""}, wantError: true, errorHint: ""},
+		{name: "short name", input: NameRequest{Name: "a"}, wantError: true, errorHint: ""},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -540,3 +592,61 @@ func TestPageRequestValidation(t *testing.T) {
 		})
 	}
 }
+
+func TestSearch(t *testing.T) {
+	a := assert.New(t)
+	t.Run("should search by query and its transliteration", func(t *testing.T) {
+		repo := new(MockRepo)
+		srv := NewService(repo, validator.New())
+		found := SearchEntity{Entity: Entity{Id: 1, Name: "Ivanov"}, Rank: 0.8, Highlight: highlightStart + "Ivanov" + highlightStop}
+		repo.On("Search", "Иванов", "ivanov", int64(20)).Return([]SearchEntity{found}, nil)
+		got, err := srv.Search(context.Background(), testTenant, SearchRequest{Query: "Иванов", Limit: 20})
+		a.NoError(err)
+		a.Equal([]SearchResult{found.toResult()}, got)
+		a.Equal("<mark>Ivanov</mark>", got[0].Highlight)
+	})
+	t.Run("should escape employee data in highlight", func(t *testing.T) {
+		repo := new(MockRepo)
+		srv := NewService(repo, validator.New())
+		found := SearchEntity{
+			Entity:    Entity{Id: 1, Name: `<img src=x onerror="alert(1)">`},
+			Highlight: `<img src=x onerror="alert(1)"> ` + highlightStart + "O'Brien" + highlightStop + " <mark>&",
+		}
+		repo.On("Search", "obrien", mock.Anything, int64(20)).Return([]SearchEntity{found}, nil)
+		got, err := srv.Search(context.Background(), testTenant, SearchRequest{Query: "obrien", Limit: 20})
+		a.NoError(err)
+		a.Equal(`&lt;img src=x onerror=&#34;alert(1)&#34;&gt; <mark>O&#39;Brien</mark> &lt;mark&gt;&amp;`, got[0].Highlight)
+		a.Equal(`<img src=x onerror="alert(1)">`, got[0].Name)
+	})
+	t.Run("should reject too short query", func(t *testing.T) {
+		repo := new(MockRepo)
+		srv := NewService(repo, validator.New())
+		_, err := srv.Search(context.Background(), testTenant, SearchRequest{Query: "a", Limit: 20})
+		var reqErr *common.RequestValidationError
+		a.ErrorAs(err, &reqErr)
+		repo.AssertNotCalled(t, "Search")
+	})
+	t.Run("should wrap repository error", func(t *testing.T) {
+		repo := new(MockRepo)
+		srv := NewService(repo, validator.New())
+		repo.On("Search", "ivanov", "иванов", int64(5)).Return([]SearchEntity{}, errors.New("database error"))
+		_, err := srv.Search(context.Background(), testTenant, SearchRequest{Query: "ivanov", Limit: 5})
+		a.ErrorContains(err, "employee service: search")
+	})
+}
+
+func TestTransliterate(t *testing.T) {
+	tests := map[string]string{
+		"Иванов":        "ivanov",
+		"Щукина Юлия":   "shchukina yuliya",
+		"zhukov":        "жуков",
+		"Shchukina":     "щукина",
+		"petrov@ex.com": "петров@екс.цом",
+		"42":            "42",
+	}
+	for text, want := range tests {
+		t.Run(text, func(t *testing.T) {
+			assert.Equal(t, want, transliterate(text))
+		})
+	}
+}
@@ -0,0 +1,59 @@
+package employee
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+var cyrillicToLatin = map[rune]string{
+	'а': "a", 'б': "b", 'в': "v", 'г': "g", 'д': "d", 'е': "e", 'ё': "e", 'ж': "zh", 'з': "z", 'и': "i",
+	'й': "y", 'к': "k", 'л': "l", 'м': "m", 'н': "n", 'о': "o", 'п': "p", 'р': "r", 'с': "s", 'т': "t",
+	'у': "u", 'ф': "f", 'х': "kh", 'ц': "ts", 'ч': "ch", 'ш': "sh", 'щ': "shch", 'ъ': "", 'ы': "y", 'ь': "",
+	'э': "e", 'ю': "yu", 'я': "ya",
+}
+
+// latinToCyrillic сочетания букв проверяются раньше одиночных: от самых длинных к коротким
+var latinToCyrillic = []struct{ latin, cyrillic string }{
+	{"shch", "щ"},
+	{"zh", "ж"}, {"kh", "х"}, {"ts", "ц"}, {"ch", "ч"}, {"sh", "ш"}, {"yu", "ю"}, {"ya", "я"}, {"yo", "ё"},
+	{"a", "а"}, {"b", "б"}, {"c", "ц"}, {"d", "д"}, {"e", "е"}, {"f", "ф"}, {"g", "г"}, {"h", "х"}, {"i", "и"},
+	{"j", "й"}, {"k", "к"}, {"l", "л"}, {"m", "м"}, {"n", "н"}, {"o", "о"}, {"p", "п"}, {"q", "к"}, {"r", "р"},
+	{"s", "с"}, {"t", "т"}, {"u", "у"}, {"v", "в"}, {"w", "в"}, {"x", "кс"}, {"y", "й"}, {"z", "з"},
+}
+
+// transliterate переводит строку в нижнем регистре в другой алфавит: кириллицу в латиницу
+// по упрощённой системе загранпаспортов, латиницу обратно в кириллицу.
+// Перевод приблизительный (Dmitry -> дмитрй), неточность добирает нечёткий поиск по триграммам.
+func transliterate(text string) string {
+	text = strings.ToLower(text)
+	if strings.ContainsFunc(text, func(r rune) bool { return unicode.Is(unicode.Cyrillic, r) }) {
+		var out strings.Builder
+		for _, r := range text {
+			if latin, ok := cyrillicToLatin[r]; ok {
+				out.WriteString(latin)
+			} else {
+				out.WriteRune(r)
+			}
+		}
+		return out.String()
+	}
+	var out strings.Builder
+	for rest := text; rest != ""; {
+		replaced := false
+		for _, pair := range latinToCyrillic {
+			if strings.HasPrefix(rest, pair.latin) {
+				out.WriteString(pair.cyrillic)
+				rest = rest[len(pair.latin):]
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			r, size := utf8.DecodeRuneInString(rest)
+			out.WriteRune(r)
+			rest = rest[size:]
+		}
+	}
+	return out.String()
+}
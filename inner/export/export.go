@@ -0,0 +1,124 @@
+package export
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/gofiber/fiber/v3"
+	"go.uber.org/zap"
+	"idm/inner/common"
+	"io"
+	"slices"
+	"time"
+)
+
+// Format формат выгрузки, он же расширение файла
+type Format string
+
+const (
+	Csv   Format = "csv"
+	Jsonl Format = "jsonl"
+)
+
+func ParseFormat(value string) (Format, error) {
+	format := Format(value)
+	if !slices.Contains([]Format{Csv, Jsonl}, format) {
+		return "", &common.RequestValidationError{Massage: fmt.Sprintf("unknown export format %q, want csv or jsonl", value)}
+	}
+	return format, nil
+}
+
+func (f Format) ContentType() string {
+	if f == Jsonl {
+		return "application/jsonl; charset=utf-8"
+	}
+	return "text/csv; charset=utf-8"
+}
+
+// Row строка выгрузки: в JSON Lines пишется как объект, в CSV - значениями Record
+type Row interface {
+	// Record значения колонок в порядке заголовка Writer
+	Record() []string
+}
+
+// Writer пишет строки по одной, не накапливая их: память не зависит от размера выгрузки
+type Writer struct {
+	out    io.Writer
+	csv    *csv.Writer
+	json   *json.Encoder
+	header []string
+}
+
+// NewWriter header - первая строка CSV, в JSON Lines заголовка нет
+func NewWriter(out io.Writer, format Format, header []string) *Writer {
+	w := &Writer{out: out, header: header}
+	if format == Jsonl {
+		w.json = json.NewEncoder(out)
+		w.json.SetEscapeHTML(false)
+	} else {
+		w.csv = csv.NewWriter(out)
+	}
+	return w
+}
+
+func (w *Writer) Write(row Row) error {
+	if w.json != nil {
+		return w.json.Encode(row)
+	}
+	if w.header != nil {
+		if err := w.csv.Write(w.header); err != nil {
+			return err
+		}
+		w.header = nil
+	}
+	return w.csv.Write(row.Record())
+}
+
+// Flush отправляет записанное дальше, в том числе из буфера out, если он есть
+func (w *Writer) Flush() error {
+	if w.csv != nil {
+		if w.header != nil {
+			// пустая выгрузка в CSV - это только заголовок
+			if err := w.csv.Write(w.header); err != nil {
+				return err
+			}
+			w.header = nil
+		}
+		w.csv.Flush()
+		if err := w.csv.Error(); err != nil {
+			return err
+		}
+	}
+	if flusher, ok := w.out.(interface{ Flush() error }); ok {
+		return flusher.Flush()
+	}
+	return nil
+}
+
+// exportTimeout предельная длительность выгрузки: вместо срока запроса, который истекает вместе с обработчиком
+const exportTimeout = 10 * time.Minute
+
+// Send отдаёт файл name.format потоком: produce пишет строки в Writer по мере чтения из базы.
+// produce выполняется после выхода из обработчика, когда TimeoutMiddleware уже отменил контекст запроса,
+// поэтому получает контекст без его отмены, но со своим сроком exportTimeout.
+// Отключение клиента контекст не отменяет: выгрузка прерывается на первой ошибке записи в соединение.
+// Статус 200 уходит до первой строки, ошибку produce клиент видит как оборванный файл, а сервер - в журнале.
+func Send(c fiber.Ctx, name string, format Format, header []string, logger *common.Logger,
+	produce func(ctx context.Context, w *Writer) error) error {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(c.Context()), exportTimeout)
+	c.Set(fiber.HeaderContentType, format.ContentType())
+	c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="%s.%s"`, name, format))
+	return c.SendStreamWriter(func(out *bufio.Writer) {
+		defer cancel()
+		w := NewWriter(out, format, header)
+		err := produce(ctx, w)
+		if err == nil {
+			err = w.Flush()
+		}
+		if err != nil {
+			logger.Error("export "+name, zap.Error(err))
+		}
+	})
+}
@@ -0,0 +1,76 @@
+package export
+
+import (
+	"bytes"
+	"context"
+	"github.com/gofiber/fiber/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"idm/inner/common"
+	"io"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type testRow struct {
+	Name string `json:"name"`
+}
+
+func (r testRow) Record() []string {
+	return []string{r.Name}
+}
+
+func TestWriter(t *testing.T) {
+	t.Run("should write csv header even without rows", func(t *testing.T) {
+		var out bytes.Buffer
+		w := NewWriter(&out, Csv, []string{"name"})
+		assert.NoError(t, w.Flush())
+		assert.Equal(t, "name\n", out.String())
+	})
+	t.Run("should write json lines without header", func(t *testing.T) {
+		var out bytes.Buffer
+		w := NewWriter(&out, Jsonl, []string{"name"})
+		assert.NoError(t, w.Write(testRow{Name: "<Anna>"}))
+		assert.NoError(t, w.Write(testRow{Name: "Boris"}))
+		assert.NoError(t, w.Flush())
+		assert.Equal(t, "{\"name\":\"<Anna>\"}\n{\"name\":\"Boris\"}\n", out.String())
+	})
+	t.Run("should reject unknown format", func(t *testing.T) {
+		_, err := ParseFormat("xlsx")
+		var reqErr *common.RequestValidationError
+		assert.ErrorAs(t, err, &reqErr)
+	})
+}
+
+func TestSend(t *testing.T) {
+	t.Run("should stream with own timeout after request context is cancelled", func(t *testing.T) {
+		var produceErr error
+		var deadline time.Time
+		app := fiber.New()
+		app.Get("/export", func(c fiber.Ctx) error {
+			// как TimeoutMiddleware: срок запроса короткий и отменяется после выхода из обработчика
+			ctx, cancel := context.WithTimeout(c.Context(), time.Millisecond)
+			defer cancel()
+			c.SetContext(ctx)
+			return Send(c, "rows", Csv, []string{"name"}, &common.Logger{Logger: zap.NewNop()},
+				func(ctx context.Context, w *Writer) error {
+					time.Sleep(5 * time.Millisecond)
+					deadline, _ = ctx.Deadline()
+					if produceErr = ctx.Err(); produceErr != nil {
+						return produceErr
+					}
+					return w.Write(testRow{Name: "Anna"})
+				})
+		})
+		start := time.Now()
+		resp, err := app.Test(httptest.NewRequest(fiber.MethodGet, "/export", nil))
+		require.NoError(t, err)
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		assert.Equal(t, "name\nAnna\n", string(body))
+		assert.NoError(t, produceErr)
+		assert.WithinRange(t, deadline, start.Add(exportTimeout), time.Now().Add(exportTimeout))
+	})
+}
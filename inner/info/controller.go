@@ -1,27 +1,34 @@
 package info
 
 import (
+	"database/sql"
 	"github.com/gofiber/fiber/v3"
 	"github.com/jmoiron/sqlx"
 	"go.uber.org/zap"
 	"idm/inner/common"
+	"idm/inner/database"
 	"idm/inner/web"
 )
 
 type Controller struct {
-	server *web.Server
-	cfg    common.Config
-	db     *sqlx.DB
-	logger *common.Logger
+	server   *web.Server
+	cfg      common.Config
+	db       *sqlx.DB
+	replicas []*sqlx.DB
+	logger   *common.Logger
 }
 
-func NewController(server *web.Server, cfg common.Config, db *sqlx.DB, logger *common.Logger) *Controller {
-	return &Controller{
+// NewController router nil, если приложение работает без базы (DB_DRIVER_NAME=memory)
+func NewController(server *web.Server, cfg common.Config, router *database.Router, logger *common.Logger) *Controller {
+	c := &Controller{
 		server: server,
 		cfg:    cfg,
-		db:     db,
 		logger: logger,
 	}
+	if router != nil {
+		c.db, c.replicas = router.Primary(), router.Replicas()
+	}
+	return c
 }
 
 type Response struct {
@@ -29,9 +36,31 @@ type Response struct {
 	Version string `json:"version"`
 }
 
+// PoolStats состояние пула соединений sql.DBStats
+type PoolStats struct {
+	MaxOpenConnections int   `json:"max_open_connections"`
+	OpenConnections    int   `json:"open_connections"`
+	InUse              int   `json:"in_use"`
+	Idle               int   `json:"idle"`
+	WaitCount          int64 `json:"wait_count"`
+	// WaitDurationMs суммарное время ожидания свободного соединения
+	WaitDurationMs    int64 `json:"wait_duration_ms"`
+	MaxIdleClosed     int64 `json:"max_idle_closed"`
+	MaxIdleTimeClosed int64 `json:"max_idle_time_closed"`
+	MaxLifetimeClosed int64 `json:"max_lifetime_closed"`
+}
+
+type DbStatsResponse struct {
+	Primary  PoolStats   `json:"primary"`
+	Replicas []PoolStats `json:"replicas"`
+}
+
 func (c *Controller) RegisterRoutes() {
 	c.server.GroupInternal.Get("/info", c.GetInfo)
 	c.server.GroupInternal.Get("/health", c.GetHealth)
+	if c.db != nil {
+		c.server.GroupInternal.Get("/db/stats", c.GetDbStats)
+	}
 }
 
 func (c *Controller) GetInfo(ctx fiber.Ctx) error {
@@ -47,9 +76,40 @@ func (c *Controller) GetInfo(ctx fiber.Ctx) error {
 }
 
 func (c *Controller) GetHealth(ctx fiber.Ctx) error {
+	if c.db == nil {
+		return ctx.Status(fiber.StatusOK).SendString("OK")
+	}
 	if err := c.db.Ping(); err != nil {
 		c.logger.Error("get health", zap.Error(err))
 		return ctx.Status(fiber.StatusServiceUnavailable).SendString("DOWN")
 	}
 	return ctx.Status(fiber.StatusOK).SendString("OK")
 }
+
+// GetDbStats пулы соединений основной базы и реплик: рост wait_count и wait_duration_ms
+// при in_use = max_open_connections означает, что пулу не хватает соединений
+func (c *Controller) GetDbStats(ctx fiber.Ctx) error {
+	resp := DbStatsResponse{Primary: toPoolStats(c.db.Stats()), Replicas: []PoolStats{}}
+	for _, replica := range c.replicas {
+		resp.Replicas = append(resp.Replicas, toPoolStats(replica.Stats()))
+	}
+	if err := ctx.Status(fiber.StatusOK).JSON(&resp); err != nil {
+		c.logger.Error("get db stats", zap.Error(err))
+		return common.ErrResponse(ctx, fiber.StatusInternalServerError, "error returning db stats")
+	}
+	return nil
+}
+
+func toPoolStats(stats sql.DBStats) PoolStats {
+	return PoolStats{
+		MaxOpenConnections: stats.MaxOpenConnections,
+		OpenConnections:    stats.OpenConnections,
+		InUse:              stats.InUse,
+		Idle:               stats.Idle,
+		WaitCount:          stats.WaitCount,
+		WaitDurationMs:     stats.WaitDuration.Milliseconds(),
+		MaxIdleClosed:      stats.MaxIdleClosed,
+		MaxIdleTimeClosed:  stats.MaxIdleTimeClosed,
+		MaxLifetimeClosed:  stats.MaxLifetimeClosed,
+	}
+}
@@ -2,6 +2,7 @@ package info
 
 import (
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/gofiber/fiber/v3"
@@ -9,6 +10,7 @@ import (
 	"github.com/stretchr/testify/assert"
 	"go.uber.org/zap"
 	"idm/inner/common"
+	"idm/inner/database"
 	"idm/inner/web"
 	"log"
 	"net/http/httptest"
@@ -25,8 +27,7 @@ func setupTestApp(db *sql.DB, cfg common.Config) *fiber.App {
 		GroupInternal: app.Group("/internal"),
 	}
 	newDb := sqlx.NewDb(db, "sqlmock")
-	ctrl := NewController(server, cfg, newDb, logger)
-	ctrl.db = newDb
+	ctrl := NewController(server, cfg, database.NewRouter(newDb, nil, logger), logger)
 	ctrl.RegisterRoutes()
 	return app
 }
@@ -79,3 +80,19 @@ func TestGetHealth_Down(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, 503, resp.StatusCode)
 }
+
+func TestGetDbStats(t *testing.T) {
+	db, _, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer func() { _ = db.Close() }()
+	db.SetMaxOpenConns(7)
+	app := setupTestApp(db, common.Config{})
+	req := httptest.NewRequest("GET", "/internal/db/stats", nil)
+	resp, err := app.Test(req)
+	assert.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+	var stats DbStatsResponse
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&stats))
+	assert.Equal(t, 7, stats.Primary.MaxOpenConnections)
+	assert.Empty(t, stats.Replicas)
+}
@@ -0,0 +1,119 @@
+package me
+
+import (
+	"context"
+	"errors"
+	"github.com/gofiber/fiber/v3"
+	"go.uber.org/zap"
+	"idm/inner/common"
+	"idm/inner/web"
+)
+
+type Controller struct {
+	server  *web.Server
+	service Svc
+	logger  *common.Logger
+}
+
+type Svc interface {
+	Me(ctx context.Context, claims *web.IdmClaims) (Response, error)
+	Roles(ctx context.Context, claims *web.IdmClaims) ([]RoleResponse, error)
+	AccessRequests(ctx context.Context, claims *web.IdmClaims) ([]AccessRequestResponse, error)
+}
+
+func NewController(server *web.Server, service Svc, logger *common.Logger) *Controller {
+	return &Controller{
+		server:  server,
+		service: service,
+		logger:  logger,
+	}
+}
+
+func (c *Controller) RegisterRoutes() {
+	c.server.GroupApiV1.Get("/me", c.Me)
+	c.server.GroupApiV1.Get("/me/roles", c.Roles)
+	c.server.GroupApiV1.Get("/me/access-requests", c.AccessRequests)
+}
+
+// Me godoc
+// @Summary      Get current employee
+// @Description  Возвращает сотрудника, связанного с пользователем токена
+// @Tags         me
+// @Success      200 {object} Response
+// @Failure      404 {object} Response
+// @Failure      500 {object} Response
+// @Router       /me [get]
+// @Security BearerAuth
+func (c *Controller) Me(ctx fiber.Ctx) error {
+	claims, ok := web.ClaimsFrom(ctx)
+	if !ok {
+		return common.ErrResponse(ctx, fiber.StatusUnauthorized, "Unauthorized")
+	}
+	me, err := c.service.Me(ctx.Context(), claims)
+	if err != nil {
+		return c.errResponse(ctx, "get me", err)
+	}
+	return common.OkResponse(ctx, me)
+}
+
+// Roles godoc
+// @Summary      Get my roles
+// @Description  Возвращает роли, назначенные текущему сотруднику
+// @Tags         me
+// @Success      200 {array} RoleResponse
+// @Failure      404 {object} Response
+// @Failure      500 {object} Response
+// @Router       /me/roles [get]
+// @Security BearerAuth
+func (c *Controller) Roles(ctx fiber.Ctx) error {
+	claims, ok := web.ClaimsFrom(ctx)
+	if !ok {
+		return common.ErrResponse(ctx, fiber.StatusUnauthorized, "Unauthorized")
+	}
+	roles, err := c.service.Roles(ctx.Context(), claims)
+	if err != nil {
+		return c.errResponse(ctx, "get my roles", err)
+	}
+	return common.OkResponse(ctx, roles)
+}
+
+// AccessRequests godoc
+// @Summary      Get my access requests
+// @Description  Возвращает заявки текущего сотрудника на роли, новые первыми
+// @Tags         me
+// @Success      200 {array} AccessRequestResponse
+// @Failure      404 {object} Response
+// @Failure      500 {object} Response
+// @Router       /me/access-requests [get]
+// @Security BearerAuth
+func (c *Controller) AccessRequests(ctx fiber.Ctx) error {
+	claims, ok := web.ClaimsFrom(ctx)
+	if !ok {
+		return common.ErrResponse(ctx, fiber.StatusUnauthorized, "Unauthorized")
+	}
+	requests, err := c.service.AccessRequests(ctx.Context(), claims)
+	if err != nil {
+		return c.errResponse(ctx, "get my access requests", err)
+	}
+	return common.OkResponse(ctx, requests)
+}
+
+func (c *Controller) errResponse(ctx fiber.Ctx, msg string, err error) error {
+	c.logger.Error(msg, zap.Error(err))
+	var reqErr *common.RequestValidationError
+	var existsErr *common.AlreadyExistsError
+	var conflictErr *common.ConflictError
+	var notFoundErr *common.NotFoundError
+	switch {
+	case errors.As(err, &notFoundErr):
+		return common.ErrResponse(ctx, fiber.StatusNotFound, err.Error())
+	case errors.As(err, &reqErr):
+		return common.ErrResponse(ctx, fiber.StatusBadRequest, err.Error())
+	case errors.As(err, &existsErr) || errors.As(err, &conflictErr):
+		return common.ErrResponse(ctx, fiber.StatusConflict, err.Error())
+	case errors.Is(err, context.DeadlineExceeded):
+		return common.ErrResponse(ctx, fiber.StatusGatewayTimeout, "timeout exceeded")
+	default:
+		return common.ErrResponse(ctx, fiber.StatusInternalServerError, err.Error())
+	}
+}
@@ -0,0 +1,104 @@
+package me
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/gofiber/fiber/v3"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go.uber.org/zap"
+	"idm/inner/common"
+	"idm/inner/web"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type MockService struct {
+	mock.Mock
+}
+
+func (svc *MockService) Me(ctx context.Context, claims *web.IdmClaims) (Response, error) {
+	args := svc.Called(claims.Subject)
+	return args.Get(0).(Response), args.Error(1)
+}
+
+func (svc *MockService) Roles(ctx context.Context, claims *web.IdmClaims) ([]RoleResponse, error) {
+	args := svc.Called(claims.Subject)
+	return args.Get(0).([]RoleResponse), args.Error(1)
+}
+
+func (svc *MockService) AccessRequests(ctx context.Context, claims *web.IdmClaims) ([]AccessRequestResponse, error) {
+	args := svc.Called(claims.Subject)
+	return args.Get(0).([]AccessRequestResponse), args.Error(1)
+}
+
+func newTestServer(svc Svc) *web.Server {
+	claims := &web.IdmClaims{
+		RegisteredClaims: jwt.RegisteredClaims{Subject: "f3a1c2d4"},
+	}
+	auth := func(c fiber.Ctx) error {
+		c.Locals(web.JwtKey, &jwt.Token{Claims: claims})
+		return c.Next()
+	}
+	server := web.NewServer()
+	server.GroupApiV1.Use(auth)
+	logger := &common.Logger{Logger: zap.NewNop()}
+	NewController(server, svc, logger).RegisterRoutes()
+	return server
+}
+
+func TestController_Me(t *testing.T) {
+	t.Run("should return current employee", func(t *testing.T) {
+		a := assert.New(t)
+		svc := new(MockService)
+		server := newTestServer(svc)
+		svc.On("Me", "f3a1c2d4").Return(Response{EmployeeId: 7, Name: "John Doe"}, nil)
+		resp, err := server.App.Test(httptest.NewRequest(fiber.MethodGet, "/api/v1/me", nil))
+		a.NoError(err)
+		a.Equal(http.StatusOK, resp.StatusCode)
+		data, err := io.ReadAll(resp.Body)
+		a.NoError(err)
+		var result common.Response[Response]
+		a.NoError(json.Unmarshal(data, &result))
+		a.Equal(int64(7), result.Data.EmployeeId)
+	})
+	t.Run("should return 404 if not linked", func(t *testing.T) {
+		a := assert.New(t)
+		svc := new(MockService)
+		server := newTestServer(svc)
+		svc.On("Me", "f3a1c2d4").Return(Response{}, &common.NotFoundError{Massage: "no employee is linked"})
+		resp, err := server.App.Test(httptest.NewRequest(fiber.MethodGet, "/api/v1/me", nil))
+		a.NoError(err)
+		a.Equal(http.StatusNotFound, resp.StatusCode)
+	})
+}
+
+func TestController_Roles(t *testing.T) {
+	a := assert.New(t)
+	svc := new(MockService)
+	server := newTestServer(svc)
+	svc.On("Roles", "f3a1c2d4").Return([]RoleResponse{{Id: 1, Name: "accountant"}}, nil)
+	resp, err := server.App.Test(httptest.NewRequest(fiber.MethodGet, "/api/v1/me/roles", nil))
+	a.NoError(err)
+	a.Equal(http.StatusOK, resp.StatusCode)
+	data, err := io.ReadAll(resp.Body)
+	a.NoError(err)
+	var result common.Response[[]RoleResponse]
+	a.NoError(json.Unmarshal(data, &result))
+	a.Equal("accountant", result.Data[0].Name)
+}
+
+func TestController_AccessRequests(t *testing.T) {
+	t.Run("should return access requests", func(t *testing.T) {
+		a := assert.New(t)
+		svc := new(MockService)
+		server := newTestServer(svc)
+		svc.On("AccessRequests", "f3a1c2d4").Return([]AccessRequestResponse{{Id: 1, Status: AccessRequestPending}}, nil)
+		resp, err := server.App.Test(httptest.NewRequest(fiber.MethodGet, "/api/v1/me/access-requests", nil))
+		a.NoError(err)
+		a.Equal(http.StatusOK, resp.StatusCode)
+	})
+}
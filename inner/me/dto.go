@@ -0,0 +1,92 @@
+package me
+
+import "time"
+
+// Способы привязки внешней учётной записи к сотруднику
+const (
+	LinkedByLogin = "login"
+	LinkedByEmail = "email"
+)
+
+const (
+	AccessRequestPending  = "pending"
+	AccessRequestApproved = "approved"
+	AccessRequestRejected = "rejected"
+)
+
+// IdentityEntity связывает пользователя токена (iss + sub) с сотрудником
+type IdentityEntity struct {
+	TenantId   string    `db:"tenant_id"`
+	Issuer     string    `db:"issuer"`
+	Subject    string    `db:"subject"`
+	EmployeeId int64     `db:"employee_id"`
+	LinkedBy   string    `db:"linked_by"`
+	CreatedAt  time.Time `db:"created_at"`
+}
+
+type EmployeeEntity struct {
+	Id        int64     `db:"id"`
+	Name      string    `db:"name"`
+	Login     *string   `db:"login"`
+	Email     *string   `db:"email"`
+	CreatedAt time.Time `db:"created_at"`
+	UpdatedAt time.Time `db:"updated_at"`
+}
+
+type RoleEntity struct {
+	Id         int64     `db:"id"`
+	Name       string    `db:"name"`
+	AssignedAt time.Time `db:"assigned_at"`
+}
+
+type AccessRequestEntity struct {
+	Id         int64     `db:"id"`
+	TenantId   string    `db:"tenant_id"`
+	EmployeeId int64     `db:"employee_id"`
+	RoleId     int64     `db:"role_id"`
+	RoleName   string    `db:"role_name"`
+	Status     string    `db:"status"`
+	Comment    string    `db:"comment"`
+	CreatedAt  time.Time `db:"created_at"`
+	UpdatedAt  time.Time `db:"updated_at"`
+}
+
+func (e AccessRequestEntity) toResponse() AccessRequestResponse {
+	return AccessRequestResponse{
+		Id:        e.Id,
+		RoleId:    e.RoleId,
+		RoleName:  e.RoleName,
+		Status:    e.Status,
+		Comment:   e.Comment,
+		CreatedAt: e.CreatedAt,
+		UpdatedAt: e.UpdatedAt,
+	}
+}
+
+type Response struct {
+	EmployeeId int64     `json:"employee_id"`
+	Name       string    `json:"name"`
+	Login      *string   `json:"login"`
+	Email      *string   `json:"email"`
+	Issuer     string    `json:"issuer"`
+	Subject    string    `json:"subject"`
+	LinkedBy   string    `json:"linked_by"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+type RoleResponse struct {
+	Id         int64     `json:"id"`
+	Name       string    `json:"name"`
+	AssignedAt time.Time `json:"assigned_at"`
+}
+
+type AccessRequestResponse struct {
+	Id        int64     `json:"id"`
+	RoleId    int64     `json:"role_id"`
+	RoleName  string    `json:"role_name"`
+	Status    string    `json:"status"`
+	Comment   string    `json:"comment"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
@@ -0,0 +1,80 @@
+package me
+
+import (
+	"context"
+	"github.com/jmoiron/sqlx"
+	"idm/inner/common"
+	"idm/inner/database"
+)
+
+type Repository struct {
+	db *sqlx.DB
+}
+
+func NewRepository(db *sqlx.DB) *Repository {
+	return &Repository{db: db}
+}
+
+func (r *Repository) FindIdentity(ctx context.Context, issuer, subject string) (identity IdentityEntity, err error) {
+	err = r.db.GetContext(ctx, &identity,
+		"SELECT * FROM employee_identity WHERE issuer = $1 AND subject = $2", issuer, subject)
+	return identity, err
+}
+
+// AddIdentity не перезаписывает существующую привязку: при гонке двух первых запросов выигрывает первый
+func (r *Repository) AddIdentity(ctx context.Context, identity IdentityEntity) error {
+	_, err := r.db.ExecContext(ctx,
+		`INSERT INTO employee_identity (tenant_id, issuer, subject, employee_id, linked_by) VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (issuer, subject) DO NOTHING`,
+		identity.TenantId, identity.Issuer, identity.Subject, identity.EmployeeId, identity.LinkedBy,
+	)
+	return err
+}
+
+func (r *Repository) FindEmployeeIdsByLogin(ctx context.Context, tenantId, login string) (ids []int64, err error) {
+	err = r.inTenant(ctx, tenantId, func(tx *sqlx.Tx) error {
+		return tx.SelectContext(ctx, &ids,
+			"SELECT id FROM employee WHERE tenant_id = $1 AND lower(login) = lower($2)", tenantId, login)
+	})
+	return ids, err
+}
+
+func (r *Repository) FindEmployeeIdsByEmail(ctx context.Context, tenantId, email string) (ids []int64, err error) {
+	err = r.inTenant(ctx, tenantId, func(tx *sqlx.Tx) error {
+		return tx.SelectContext(ctx, &ids,
+			"SELECT id FROM employee WHERE tenant_id = $1 AND lower(email) = lower($2)", tenantId, email)
+	})
+	return ids, err
+}
+
+func (r *Repository) FindEmployee(ctx context.Context, tenantId string, id int64) (employee EmployeeEntity, err error) {
+	err = r.inTenant(ctx, tenantId, func(tx *sqlx.Tx) error {
+		return tx.GetContext(ctx, &employee,
+			"SELECT id, name, login, email, created_at, updated_at FROM employee WHERE id = $1", id)
+	})
+	return employee, err
+}
+
+func (r *Repository) FindRoles(ctx context.Context, tenantId string, employeeId int64) (roles []RoleEntity, err error) {
+	err = r.inTenant(ctx, tenantId, func(tx *sqlx.Tx) error {
+		return tx.SelectContext(ctx, &roles,
+			`SELECT r.id, r.name, er.created_at AS assigned_at FROM employee_role er
+			JOIN role r ON r.id = er.role_id WHERE er.employee_id = $1 ORDER BY r.name`, employeeId)
+	})
+	return roles, err
+}
+
+func (r *Repository) FindAccessRequests(ctx context.Context, tenantId string, employeeId int64) (requests []AccessRequestEntity, err error) {
+	err = r.inTenant(ctx, tenantId, func(tx *sqlx.Tx) error {
+		return tx.SelectContext(ctx, &requests,
+			`SELECT ar.id, ar.tenant_id, ar.employee_id, ar.role_id, r.name AS role_name, ar.status, ar.comment, ar.created_at, ar.updated_at
+			FROM access_request ar JOIN role r ON r.id = ar.role_id WHERE ar.employee_id = $1 ORDER BY ar.id DESC`, employeeId)
+	})
+	return requests, err
+}
+
+// inTenant сотрудники, роли и заявки защищены политиками RLS, employee_identity - нет:
+// по ней арендатор пользователя только определяется
+func (r *Repository) inTenant(ctx context.Context, tenantId string, fn func(tx *sqlx.Tx) error) error {
+	return database.InTenantTx(ctx, r.db, common.SingleTenant(tenantId), fn)
+}
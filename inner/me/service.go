@@ -0,0 +1,161 @@
+package me
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"idm/inner/common"
+	"idm/inner/web"
+)
+
+type Service struct {
+	repo Repo
+	// autoLink привязывает пользователя к сотруднику по preferred_username или подтверждённому email при первом запросе
+	autoLink bool
+}
+
+type Repo interface {
+	FindIdentity(ctx context.Context, issuer, subject string) (IdentityEntity, error)
+	AddIdentity(ctx context.Context, identity IdentityEntity) error
+	FindEmployeeIdsByLogin(ctx context.Context, tenantId, login string) ([]int64, error)
+	FindEmployeeIdsByEmail(ctx context.Context, tenantId, email string) ([]int64, error)
+	FindEmployee(ctx context.Context, tenantId string, id int64) (EmployeeEntity, error)
+	FindRoles(ctx context.Context, tenantId string, employeeId int64) ([]RoleEntity, error)
+	FindAccessRequests(ctx context.Context, tenantId string, employeeId int64) ([]AccessRequestEntity, error)
+}
+
+func NewService(repo Repo, autoLink bool) *Service {
+	return &Service{repo: repo, autoLink: autoLink}
+}
+
+func (s *Service) Me(ctx context.Context, claims *web.IdmClaims) (Response, error) {
+	identity, err := s.identity(ctx, claims)
+	if err != nil {
+		return Response{}, err
+	}
+	employee, err := s.repo.FindEmployee(ctx, identity.TenantId, identity.EmployeeId)
+	if err != nil {
+		return Response{}, fmt.Errorf("me service: me: error finding employee: id=%d: %w", identity.EmployeeId, err)
+	}
+	return Response{
+		EmployeeId: employee.Id,
+		Name:       employee.Name,
+		Login:      employee.Login,
+		Email:      employee.Email,
+		Issuer:     identity.Issuer,
+		Subject:    identity.Subject,
+		LinkedBy:   identity.LinkedBy,
+		CreatedAt:  employee.CreatedAt,
+		UpdatedAt:  employee.UpdatedAt,
+	}, nil
+}
+
+func (s *Service) Roles(ctx context.Context, claims *web.IdmClaims) ([]RoleResponse, error) {
+	identity, err := s.identity(ctx, claims)
+	if err != nil {
+		return nil, err
+	}
+	roles, err := s.repo.FindRoles(ctx, identity.TenantId, identity.EmployeeId)
+	if err != nil {
+		return nil, fmt.Errorf("me service: roles: error finding roles: employee id=%d: %w", identity.EmployeeId, err)
+	}
+	resp := make([]RoleResponse, 0, len(roles))
+	for _, role := range roles {
+		resp = append(resp, RoleResponse(role))
+	}
+	return resp, nil
+}
+
+func (s *Service) AccessRequests(ctx context.Context, claims *web.IdmClaims) ([]AccessRequestResponse, error) {
+	identity, err := s.identity(ctx, claims)
+	if err != nil {
+		return nil, err
+	}
+	requests, err := s.repo.FindAccessRequests(ctx, identity.TenantId, identity.EmployeeId)
+	if err != nil {
+		return nil, fmt.Errorf("me service: access requests: error finding access requests: employee id=%d: %w",
+			identity.EmployeeId, err)
+	}
+	resp := make([]AccessRequestResponse, 0, len(requests))
+	for _, request := range requests {
+		resp = append(resp, request.toResponse())
+	}
+	return resp, nil
+}
+
+// identity находит сотрудника пользователя, при необходимости привязывая его автоматически
+func (s *Service) identity(ctx context.Context, claims *web.IdmClaims) (IdentityEntity, error) {
+	identity, err := s.repo.FindIdentity(ctx, claims.Issuer, claims.Subject)
+	if err == nil {
+		return identity, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return IdentityEntity{}, fmt.Errorf("me service: error finding identity: sub=%s: %w", claims.Subject, err)
+	}
+	if s.autoLink && canAutoLink(claims) {
+		linked, err := s.link(ctx, claims)
+		if err != nil {
+			return IdentityEntity{}, err
+		}
+		if linked {
+			identity, err = s.repo.FindIdentity(ctx, claims.Issuer, claims.Subject)
+			if err != nil {
+				return IdentityEntity{}, fmt.Errorf("me service: error finding linked identity: sub=%s: %w", claims.Subject, err)
+			}
+			return identity, nil
+		}
+	}
+	return IdentityEntity{}, &common.NotFoundError{Massage: fmt.Sprintf("me service: "+
+		"no employee is linked to subject %s", claims.Subject)}
+}
+
+// link привязывает пользователя к единственному сотруднику с тем же логином, иначе с тем же подтверждённым email.
+// Сотрудник ищется только в арендаторе пользователя
+func (s *Service) link(ctx context.Context, claims *web.IdmClaims) (bool, error) {
+	candidates := []struct {
+		linkedBy string
+		value    string
+		find     func(ctx context.Context, tenantId, value string) ([]int64, error)
+	}{
+		{LinkedByLogin, claims.PreferredUsername, s.repo.FindEmployeeIdsByLogin},
+		{LinkedByEmail, verifiedEmail(claims), s.repo.FindEmployeeIdsByEmail},
+	}
+	tenantId := claims.HomeTenant()
+	for _, candidate := range candidates {
+		if candidate.value == "" {
+			continue
+		}
+		ids, err := candidate.find(ctx, tenantId, candidate.value)
+		if err != nil {
+			return false, fmt.Errorf("me service: link: error finding employee by %s: %w", candidate.linkedBy, err)
+		}
+		if len(ids) != 1 {
+			continue
+		}
+		err = s.repo.AddIdentity(ctx, IdentityEntity{
+			TenantId:   tenantId,
+			Issuer:     claims.Issuer,
+			Subject:    claims.Subject,
+			EmployeeId: ids[0],
+			LinkedBy:   candidate.linkedBy,
+		})
+		if err != nil {
+			return false, fmt.Errorf("me service: link: error adding identity: sub=%s: %w", claims.Subject, err)
+		}
+		return true, nil
+	}
+	return false, nil
+}
+
+func verifiedEmail(claims *web.IdmClaims) string {
+	if !claims.EmailVerified {
+		return ""
+	}
+	return claims.Email
+}
+
+// canAutoLink имя сервисной учётной записи или сертификата не должно совпасть с логином сотрудника
+func canAutoLink(claims *web.IdmClaims) bool {
+	return claims.Subject != "" && claims.Issuer != web.ApiKeyIssuer && claims.Issuer != web.ClientCertIssuer
+}
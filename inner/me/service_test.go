@@ -0,0 +1,184 @@
+package me
+
+import (
+	"context"
+	"database/sql"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"idm/inner/common"
+	"idm/inner/web"
+	"testing"
+)
+
+type MockRepo struct {
+	mock.Mock
+}
+
+func (m *MockRepo) FindIdentity(ctx context.Context, issuer, subject string) (IdentityEntity, error) {
+	args := m.Called(issuer, subject)
+	return args.Get(0).(IdentityEntity), args.Error(1)
+}
+
+func (m *MockRepo) AddIdentity(ctx context.Context, identity IdentityEntity) error {
+	args := m.Called(identity)
+	return args.Error(0)
+}
+
+func (m *MockRepo) FindEmployeeIdsByLogin(ctx context.Context, tenantId, login string) ([]int64, error) {
+	args := m.Called(tenantId, login)
+	return args.Get(0).([]int64), args.Error(1)
+}
+
+func (m *MockRepo) FindEmployeeIdsByEmail(ctx context.Context, tenantId, email string) ([]int64, error) {
+	args := m.Called(tenantId, email)
+	return args.Get(0).([]int64), args.Error(1)
+}
+
+func (m *MockRepo) FindEmployee(ctx context.Context, tenantId string, id int64) (EmployeeEntity, error) {
+	args := m.Called(id)
+	return args.Get(0).(EmployeeEntity), args.Error(1)
+}
+
+func (m *MockRepo) FindRoles(ctx context.Context, tenantId string, employeeId int64) ([]RoleEntity, error) {
+	args := m.Called(employeeId)
+	return args.Get(0).([]RoleEntity), args.Error(1)
+}
+
+func (m *MockRepo) FindAccessRequests(ctx context.Context, tenantId string, employeeId int64) ([]AccessRequestEntity, error) {
+	args := m.Called(employeeId)
+	return args.Get(0).([]AccessRequestEntity), args.Error(1)
+}
+
+const testIssuer = "http://localhost:9990/realms/idm"
+
+func newClaims() *web.IdmClaims {
+	return &web.IdmClaims{
+		PreferredUsername: "jdoe",
+		Email:             "jdoe@example.com",
+		EmailVerified:     true,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:  testIssuer,
+			Subject: "f3a1c2d4",
+		},
+	}
+}
+
+func TestService_Me(t *testing.T) {
+	ctx := context.Background()
+	linked := IdentityEntity{Issuer: testIssuer, Subject: "f3a1c2d4", EmployeeId: 7, LinkedBy: LinkedByLogin}
+	t.Run("should return linked employee", func(t *testing.T) {
+		a := assert.New(t)
+		repo := new(MockRepo)
+		svc := NewService(repo, true)
+		repo.On("FindIdentity", testIssuer, "f3a1c2d4").Return(linked, nil)
+		repo.On("FindEmployee", int64(7)).Return(EmployeeEntity{Id: 7, Name: "John Doe"}, nil)
+		got, err := svc.Me(ctx, newClaims())
+		a.NoError(err)
+		a.Equal(int64(7), got.EmployeeId)
+		a.Equal("John Doe", got.Name)
+		repo.AssertNotCalled(t, "FindEmployeeIdsByLogin", mock.Anything, mock.Anything)
+	})
+	t.Run("should link by login on first request", func(t *testing.T) {
+		a := assert.New(t)
+		repo := new(MockRepo)
+		svc := NewService(repo, true)
+		repo.On("FindIdentity", testIssuer, "f3a1c2d4").Return(IdentityEntity{}, sql.ErrNoRows).Once()
+		repo.On("FindEmployeeIdsByLogin", common.DefaultTenant, "jdoe").Return([]int64{7}, nil)
+		repo.On("AddIdentity", IdentityEntity{TenantId: common.DefaultTenant, Issuer: testIssuer, Subject: "f3a1c2d4", EmployeeId: 7, LinkedBy: LinkedByLogin}).Return(nil)
+		repo.On("FindIdentity", testIssuer, "f3a1c2d4").Return(linked, nil).Once()
+		repo.On("FindEmployee", int64(7)).Return(EmployeeEntity{Id: 7, Name: "John Doe"}, nil)
+		got, err := svc.Me(ctx, newClaims())
+		a.NoError(err)
+		a.Equal(LinkedByLogin, got.LinkedBy)
+		repo.AssertNotCalled(t, "FindEmployeeIdsByEmail", mock.Anything, mock.Anything)
+	})
+	t.Run("should link by verified email when login is ambiguous", func(t *testing.T) {
+		a := assert.New(t)
+		repo := new(MockRepo)
+		svc := NewService(repo, true)
+		byEmail := IdentityEntity{TenantId: common.DefaultTenant, Issuer: testIssuer, Subject: "f3a1c2d4", EmployeeId: 8, LinkedBy: LinkedByEmail}
+		repo.On("FindIdentity", testIssuer, "f3a1c2d4").Return(IdentityEntity{}, sql.ErrNoRows).Once()
+		repo.On("FindEmployeeIdsByLogin", common.DefaultTenant, "jdoe").Return([]int64{}, nil)
+		repo.On("FindEmployeeIdsByEmail", common.DefaultTenant, "jdoe@example.com").Return([]int64{8}, nil)
+		repo.On("AddIdentity", byEmail).Return(nil)
+		repo.On("FindIdentity", testIssuer, "f3a1c2d4").Return(byEmail, nil).Once()
+		repo.On("FindEmployee", int64(8)).Return(EmployeeEntity{Id: 8}, nil)
+		got, err := svc.Me(ctx, newClaims())
+		a.NoError(err)
+		a.Equal(int64(8), got.EmployeeId)
+	})
+	t.Run("should link only within user's tenant", func(t *testing.T) {
+		a := assert.New(t)
+		repo := new(MockRepo)
+		svc := NewService(repo, true)
+		claims := newClaims()
+		claims.TenantId = "acme"
+		inTenant := IdentityEntity{TenantId: "acme", Issuer: testIssuer, Subject: "f3a1c2d4", EmployeeId: 9, LinkedBy: LinkedByLogin}
+		repo.On("FindIdentity", testIssuer, "f3a1c2d4").Return(IdentityEntity{}, sql.ErrNoRows).Once()
+		repo.On("FindEmployeeIdsByLogin", "acme", "jdoe").Return([]int64{9}, nil)
+		repo.On("AddIdentity", inTenant).Return(nil)
+		repo.On("FindIdentity", testIssuer, "f3a1c2d4").Return(inTenant, nil).Once()
+		repo.On("FindEmployee", int64(9)).Return(EmployeeEntity{Id: 9}, nil)
+		got, err := svc.Me(ctx, claims)
+		a.NoError(err)
+		a.Equal(int64(9), got.EmployeeId)
+	})
+	t.Run("should not link by unverified email", func(t *testing.T) {
+		a := assert.New(t)
+		repo := new(MockRepo)
+		svc := NewService(repo, true)
+		claims := newClaims()
+		claims.EmailVerified = false
+		repo.On("FindIdentity", testIssuer, "f3a1c2d4").Return(IdentityEntity{}, sql.ErrNoRows)
+		repo.On("FindEmployeeIdsByLogin", common.DefaultTenant, "jdoe").Return([]int64{}, nil)
+		_, err := svc.Me(ctx, claims)
+		a.ErrorAs(err, new(*common.NotFoundError))
+		repo.AssertNotCalled(t, "FindEmployeeIdsByEmail", mock.Anything, mock.Anything)
+	})
+	t.Run("should not link service accounts", func(t *testing.T) {
+		a := assert.New(t)
+		repo := new(MockRepo)
+		svc := NewService(repo, true)
+		claims := newClaims()
+		claims.Issuer = web.ApiKeyIssuer
+		repo.On("FindIdentity", web.ApiKeyIssuer, "f3a1c2d4").Return(IdentityEntity{}, sql.ErrNoRows)
+		_, err := svc.Me(ctx, claims)
+		a.ErrorAs(err, new(*common.NotFoundError))
+		repo.AssertNotCalled(t, "FindEmployeeIdsByLogin", mock.Anything, mock.Anything)
+	})
+	t.Run("should not link when auto link is disabled", func(t *testing.T) {
+		a := assert.New(t)
+		repo := new(MockRepo)
+		svc := NewService(repo, false)
+		repo.On("FindIdentity", testIssuer, "f3a1c2d4").Return(IdentityEntity{}, sql.ErrNoRows)
+		_, err := svc.Me(ctx, newClaims())
+		a.ErrorAs(err, new(*common.NotFoundError))
+		repo.AssertNotCalled(t, "FindEmployeeIdsByLogin", mock.Anything, mock.Anything)
+	})
+}
+
+func TestService_AccessRequests(t *testing.T) {
+	ctx := context.Background()
+	linked := IdentityEntity{TenantId: "acme", Issuer: testIssuer, Subject: "f3a1c2d4", EmployeeId: 7, LinkedBy: LinkedByLogin}
+	t.Run("should return access requests of current employee", func(t *testing.T) {
+		a := assert.New(t)
+		repo := new(MockRepo)
+		svc := NewService(repo, true)
+		repo.On("FindIdentity", testIssuer, "f3a1c2d4").Return(linked, nil)
+		repo.On("FindAccessRequests", int64(7)).
+			Return([]AccessRequestEntity{{Id: 11, RoleId: 3, RoleName: "accountant", Status: AccessRequestPending}}, nil)
+		got, err := svc.AccessRequests(ctx, newClaims())
+		a.NoError(err)
+		a.Equal([]AccessRequestResponse{{Id: 11, RoleId: 3, RoleName: "accountant", Status: AccessRequestPending}}, got)
+	})
+	t.Run("should return not found if not linked", func(t *testing.T) {
+		a := assert.New(t)
+		repo := new(MockRepo)
+		svc := NewService(repo, false)
+		repo.On("FindIdentity", testIssuer, "f3a1c2d4").Return(IdentityEntity{}, sql.ErrNoRows)
+		_, err := svc.AccessRequests(ctx, newClaims())
+		a.ErrorAs(err, new(*common.NotFoundError))
+		repo.AssertNotCalled(t, "FindAccessRequests", mock.Anything)
+	})
+}
@@ -0,0 +1,105 @@
+package revocation
+
+import (
+	"context"
+	"errors"
+	"github.com/gofiber/fiber/v3"
+	"go.uber.org/zap"
+	"idm/inner/common"
+	"idm/inner/web"
+)
+
+type Controller struct {
+	server  *web.Server
+	service Svc
+	logger  *common.Logger
+}
+
+type Svc interface {
+	Revoke(ctx context.Context, request RevokeRequest) ([]Response, error)
+	GetActive(ctx context.Context) ([]Response, error)
+}
+
+func NewController(server *web.Server, service Svc, logger *common.Logger) *Controller {
+	return &Controller{
+		server:  server,
+		service: service,
+		logger:  logger,
+	}
+}
+
+func (c *Controller) RegisterRoutes() {
+	c.server.GroupApiV1.Post("/revocations", c.Revoke)
+	c.server.GroupApiV1.Get("/revocations", c.GetActive)
+}
+
+// Revoke godoc
+// @Summary      Revoke tokens
+// @Description  Отзывает токены по jti, по сессии (sid) или все токены пользователя (sub), выпущенные до отзыва.
+// @Description  Доступно только супер-администратору
+// @Tags         revocations
+// @Accept       json
+// @Produce      json
+// @Param        request body RevokeRequest true "Revoked tokens"
+// @Success      200 {array} Response
+// @Failure      400 {object} Response
+// @Failure      403 {object} Response
+// @Failure      500 {object} Response
+// @Router       /revocations [post]
+// @Security BearerAuth
+func (c *Controller) Revoke(ctx fiber.Ctx) error {
+	if !web.Authorize(ctx, adminPolicy) {
+		return common.ErrResponse(ctx, fiber.StatusForbidden, "Permission denied")
+	}
+	var request RevokeRequest
+	if err := ctx.Bind().Body(&request); err != nil {
+		c.logger.Error("revoke tokens", zap.Error(err))
+		return common.ErrResponse(ctx, fiber.StatusBadRequest, err.Error())
+	}
+	revoked, err := c.service.Revoke(ctx.Context(), request)
+	var reqErr *common.RequestValidationError
+	if err != nil {
+		c.logger.Error("revoke tokens", zap.Error(err))
+		if errors.As(err, &reqErr) {
+			return common.ErrResponse(ctx, fiber.StatusBadRequest, err.Error())
+		}
+		if errors.Is(err, context.DeadlineExceeded) {
+			return common.ErrResponse(ctx, fiber.StatusGatewayTimeout, "timeout exceeded")
+		}
+		return common.ErrResponse(ctx, fiber.StatusInternalServerError, err.Error())
+	}
+	c.logger.Info("tokens revoked",
+		zap.String("jti", request.Jti), zap.String("sub", request.Subject), zap.String("sid", request.SessionId))
+	return common.OkResponse(ctx, revoked)
+}
+
+// GetActive godoc
+// @Summary      Get active revocations
+// @Description  Возвращает отзывы всех арендаторов, срок действия которых ещё не истёк. Доступно только супер-администратору
+// @Tags         revocations
+// @Success      200 {array} Response
+// @Failure      403 {object} Response
+// @Failure      500 {object} Response
+// @Router       /revocations [get]
+// @Security BearerAuth
+func (c *Controller) GetActive(ctx fiber.Ctx) error {
+	if !web.Authorize(ctx, adminPolicy) {
+		return common.ErrResponse(ctx, fiber.StatusForbidden, "Permission denied")
+	}
+	revocations, err := c.service.GetActive(ctx.Context())
+	if err != nil {
+		c.logger.Error("get active revocations", zap.Error(err))
+		if errors.Is(err, context.DeadlineExceeded) {
+			return common.ErrResponse(ctx, fiber.StatusGatewayTimeout, "timeout exceeded")
+		}
+		return common.ErrResponse(ctx, fiber.StatusInternalServerError, err.Error())
+	}
+	return common.OkResponse(ctx, revocations)
+}
+
+// adminPolicy отзывы не привязаны к арендатору: jti, sid и sub общие для всех арендаторов Keycloak,
+// поэтому отзывать токены и просматривать отзывы может только супер-администратор
+var adminPolicy = web.Policy{
+	Roles:  []string{web.IdmSuperAdmin},
+	Realms: []string{web.PrimaryRealm},
+}
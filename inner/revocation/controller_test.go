@@ -0,0 +1,123 @@
+package revocation
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/gofiber/fiber/v3"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go.uber.org/zap"
+	"idm/inner/common"
+	"idm/inner/web"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type MockService struct {
+	mock.Mock
+}
+
+func (svc *MockService) Revoke(ctx context.Context, request RevokeRequest) ([]Response, error) {
+	args := svc.Called(request)
+	return args.Get(0).([]Response), args.Error(1)
+}
+
+func (svc *MockService) GetActive(ctx context.Context) ([]Response, error) {
+	args := svc.Called()
+	return args.Get(0).([]Response), args.Error(1)
+}
+
+func newTestServer(svc Svc, roles ...string) *web.Server {
+	claims := &web.IdmClaims{
+		RealmAccess: web.RealmAccessClaims{Roles: roles},
+	}
+	auth := func(c fiber.Ctx) error {
+		c.Locals(web.JwtKey, &jwt.Token{Claims: claims})
+		return c.Next()
+	}
+	server := web.NewServer()
+	server.GroupApiV1.Use(auth)
+	logger := &common.Logger{Logger: zap.NewNop()}
+	NewController(server, svc, logger).RegisterRoutes()
+	return server
+}
+
+func TestController_Revoke(t *testing.T) {
+	t.Run("should revoke tokens", func(t *testing.T) {
+		a := assert.New(t)
+		svc := new(MockService)
+		server := newTestServer(svc, web.IdmSuperAdmin)
+		svc.On("Revoke", RevokeRequest{Subject: "user-1", Reason: "stolen laptop"}).
+			Return([]Response{{Kind: KindSubject, Value: "user-1"}}, nil)
+		body := strings.NewReader(`{"sub": "user-1", "reason": "stolen laptop"}`)
+		req := httptest.NewRequest(fiber.MethodPost, "/api/v1/revocations", body)
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := server.App.Test(req)
+		a.NoError(err)
+		a.Equal(http.StatusOK, resp.StatusCode)
+		data, err := io.ReadAll(resp.Body)
+		a.NoError(err)
+		var result common.Response[[]Response]
+		a.NoError(json.Unmarshal(data, &result))
+		a.Equal("user-1", result.Data[0].Value)
+	})
+	t.Run("should return 400 on validation error", func(t *testing.T) {
+		a := assert.New(t)
+		svc := new(MockService)
+		server := newTestServer(svc, web.IdmSuperAdmin)
+		svc.On("Revoke", mock.AnythingOfType("RevokeRequest")).
+			Return([]Response(nil), &common.RequestValidationError{Massage: "jti, sub or sid is required"})
+		req := httptest.NewRequest(fiber.MethodPost, "/api/v1/revocations", strings.NewReader(`{}`))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := server.App.Test(req)
+		a.NoError(err)
+		a.Equal(http.StatusBadRequest, resp.StatusCode)
+	})
+	t.Run("should return 403 for user", func(t *testing.T) {
+		a := assert.New(t)
+		svc := new(MockService)
+		server := newTestServer(svc, web.IdmUser)
+		req := httptest.NewRequest(fiber.MethodPost, "/api/v1/revocations", strings.NewReader(`{"jti": "token-1"}`))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := server.App.Test(req)
+		a.NoError(err)
+		a.Equal(http.StatusForbidden, resp.StatusCode)
+		svc.AssertNotCalled(t, "Revoke", mock.Anything)
+	})
+	t.Run("should return 403 for tenant admin", func(t *testing.T) {
+		a := assert.New(t)
+		svc := new(MockService)
+		server := newTestServer(svc, web.IdmAdmin, web.IdmUser)
+		req := httptest.NewRequest(fiber.MethodPost, "/api/v1/revocations", strings.NewReader(`{"sub": "user-of-another-tenant"}`))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := server.App.Test(req)
+		a.NoError(err)
+		a.Equal(http.StatusForbidden, resp.StatusCode)
+		svc.AssertNotCalled(t, "Revoke", mock.Anything)
+	})
+}
+
+func TestController_GetActive(t *testing.T) {
+	t.Run("should return active revocations", func(t *testing.T) {
+		a := assert.New(t)
+		svc := new(MockService)
+		server := newTestServer(svc, web.IdmSuperAdmin)
+		svc.On("GetActive").Return([]Response{{Kind: KindJti, Value: "token-1"}}, nil)
+		resp, err := server.App.Test(httptest.NewRequest(fiber.MethodGet, "/api/v1/revocations", nil))
+		a.NoError(err)
+		a.Equal(http.StatusOK, resp.StatusCode)
+	})
+	t.Run("should return 403 for tenant admin", func(t *testing.T) {
+		a := assert.New(t)
+		svc := new(MockService)
+		server := newTestServer(svc, web.IdmAdmin)
+		resp, err := server.App.Test(httptest.NewRequest(fiber.MethodGet, "/api/v1/revocations", nil))
+		a.NoError(err)
+		a.Equal(http.StatusForbidden, resp.StatusCode)
+		svc.AssertNotCalled(t, "GetActive")
+	})
+}
@@ -0,0 +1,57 @@
+package revocation
+
+import "time"
+
+// Виды отзыва: один токен, все токены сессии, все токены пользователя, выпущенные до отзыва
+const (
+	KindJti     = "jti"
+	KindSession = "sid"
+	KindSubject = "sub"
+)
+
+type Entity struct {
+	Kind      string    `db:"kind"`
+	Value     string    `db:"value"`
+	Reason    string    `db:"reason"`
+	RevokedAt time.Time `db:"revoked_at"`
+	// ExpiresAt после этого момента отозванные токены истекли сами, запись можно удалить
+	ExpiresAt time.Time `db:"expires_at"`
+}
+
+func (e Entity) toResponse() Response {
+	return Response{
+		Kind:      e.Kind,
+		Value:     e.Value,
+		Reason:    e.Reason,
+		RevokedAt: e.RevokedAt,
+		ExpiresAt: e.ExpiresAt,
+	}
+}
+
+type Response struct {
+	Kind      string    `json:"kind"`
+	Value     string    `json:"value"`
+	Reason    string    `json:"reason"`
+	RevokedAt time.Time `json:"revoked_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// RevokeRequest отзывает токены по любому сочетанию jti, sub и sid.
+// ExpiresAt - время истечения отзываемых токенов, по умолчанию now + REVOCATION_TTL
+type RevokeRequest struct {
+	Jti       string     `json:"jti" validate:"required_without_all=Subject SessionId,max=255"`
+	Subject   string     `json:"sub" validate:"max=255"`
+	SessionId string     `json:"sid" validate:"max=255"`
+	ExpiresAt *time.Time `json:"expires_at"`
+	Reason    string     `json:"reason" validate:"max=255"`
+}
+
+// Query признаки проверяемого токена
+type Query struct {
+	Jti       string
+	SessionId string
+	Subject   string
+	// IssuedAt время выпуска токена, нулевое если в токене нет iat
+	IssuedAt time.Time
+	Now      time.Time
+}
@@ -0,0 +1,78 @@
+package revocation
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"sync"
+	"time"
+)
+
+type memoryKey struct {
+	kind  string
+	value string
+}
+
+// MemoryRepository хранит отзывы в памяти процесса.
+// Подходит для одного экземпляра приложения: отзывы теряются при перезапуске.
+type MemoryRepository struct {
+	mu      sync.RWMutex
+	entries map[memoryKey]Entity
+}
+
+func NewMemoryRepository() *MemoryRepository {
+	return &MemoryRepository{entries: make(map[memoryKey]Entity)}
+}
+
+func (r *MemoryRepository) Add(_ context.Context, entity Entity) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for key, entry := range r.entries {
+		if !entry.ExpiresAt.After(entity.RevokedAt) {
+			delete(r.entries, key)
+		}
+	}
+	key := memoryKey{kind: entity.Kind, value: entity.Value}
+	if existing, ok := r.entries[key]; ok && existing.ExpiresAt.After(entity.ExpiresAt) {
+		entity.ExpiresAt = existing.ExpiresAt
+	}
+	r.entries[key] = entity
+	return nil
+}
+
+func (r *MemoryRepository) IsRevoked(_ context.Context, query Query) (bool, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	active := func(kind, value string) (Entity, bool) {
+		if value == "" {
+			return Entity{}, false
+		}
+		entry, ok := r.entries[memoryKey{kind: kind, value: value}]
+		return entry, ok && entry.ExpiresAt.After(query.Now)
+	}
+	if _, ok := active(KindJti, query.Jti); ok {
+		return true, nil
+	}
+	if _, ok := active(KindSession, query.SessionId); ok {
+		return true, nil
+	}
+	if entry, ok := active(KindSubject, query.Subject); ok && !entry.RevokedAt.Before(query.IssuedAt) {
+		return true, nil
+	}
+	return false, nil
+}
+
+func (r *MemoryRepository) GetActive(_ context.Context, now time.Time) ([]Entity, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	entities := make([]Entity, 0, len(r.entries))
+	for _, entry := range r.entries {
+		if entry.ExpiresAt.After(now) {
+			entities = append(entities, entry)
+		}
+	}
+	slices.SortFunc(entities, func(a, b Entity) int {
+		return cmp.Compare(b.RevokedAt.UnixNano(), a.RevokedAt.UnixNano())
+	})
+	return entities, nil
+}
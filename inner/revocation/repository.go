@@ -0,0 +1,48 @@
+package revocation
+
+import (
+	"context"
+	"github.com/jmoiron/sqlx"
+	"time"
+)
+
+// Repository хранит отзывы в Postgres, общий список для всех экземпляров приложения
+type Repository struct {
+	db *sqlx.DB
+}
+
+func NewRepository(db *sqlx.DB) *Repository {
+	return &Repository{db: db}
+}
+
+func (r *Repository) Add(ctx context.Context, entity Entity) error {
+	// истёкшие отзывы больше ничего не блокируют, удаляем их заодно
+	if _, err := r.db.ExecContext(ctx, "DELETE FROM token_revocation WHERE expires_at <= $1", entity.RevokedAt); err != nil {
+		return err
+	}
+	_, err := r.db.ExecContext(ctx,
+		`INSERT INTO token_revocation (kind, value, reason, revoked_at, expires_at) VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (kind, value) DO UPDATE SET reason = excluded.reason, revoked_at = excluded.revoked_at,
+		expires_at = CASE WHEN excluded.expires_at > token_revocation.expires_at
+			THEN excluded.expires_at ELSE token_revocation.expires_at END`,
+		entity.Kind, entity.Value, entity.Reason, entity.RevokedAt, entity.ExpiresAt,
+	)
+	return err
+}
+
+func (r *Repository) IsRevoked(ctx context.Context, query Query) (isRevoked bool, err error) {
+	err = r.db.GetContext(ctx, &isRevoked,
+		`SELECT exists(SELECT 1 FROM token_revocation WHERE expires_at > $1 AND (
+			(kind = 'jti' AND value = $2) OR
+			(kind = 'sid' AND value = $3) OR
+			(kind = 'sub' AND value = $4 AND revoked_at >= $5)))`,
+		query.Now, query.Jti, query.SessionId, query.Subject, query.IssuedAt,
+	)
+	return isRevoked, err
+}
+
+func (r *Repository) GetActive(ctx context.Context, now time.Time) (entities []Entity, err error) {
+	err = r.db.SelectContext(ctx, &entities,
+		"SELECT * FROM token_revocation WHERE expires_at > $1 ORDER BY revoked_at DESC", now)
+	return entities, err
+}
@@ -0,0 +1,98 @@
+package revocation
+
+import (
+	"context"
+	"fmt"
+	"idm/inner/common"
+	"idm/inner/web"
+	"time"
+)
+
+type Service struct {
+	repo      Repo
+	validator Validator
+	// ttl срок хранения отзыва, если время истечения токенов неизвестно; не меньше максимального срока жизни токена
+	ttl time.Duration
+	now func() time.Time
+}
+
+type Repo interface {
+	Add(ctx context.Context, entity Entity) error
+	IsRevoked(ctx context.Context, query Query) (bool, error)
+	GetActive(ctx context.Context, now time.Time) ([]Entity, error)
+}
+
+type Validator interface {
+	Validate(request any) error
+}
+
+func NewService(repo Repo, validator Validator, ttl time.Duration) *Service {
+	return &Service{repo: repo, validator: validator, ttl: ttl, now: time.Now}
+}
+
+func (s *Service) Revoke(ctx context.Context, request RevokeRequest) ([]Response, error) {
+	if err := s.validator.Validate(request); err != nil {
+		return nil, &common.RequestValidationError{Massage: err.Error()}
+	}
+	now := s.now()
+	expiresAt := now.Add(s.ttl)
+	if request.ExpiresAt != nil {
+		if !request.ExpiresAt.After(now) {
+			return nil, &common.RequestValidationError{Massage: "expires_at must be in the future"}
+		}
+		expiresAt = *request.ExpiresAt
+	}
+	values := []struct{ kind, value string }{
+		{KindJti, request.Jti},
+		{KindSession, request.SessionId},
+		{KindSubject, request.Subject},
+	}
+	resp := make([]Response, 0, len(values))
+	for _, v := range values {
+		if v.value == "" {
+			continue
+		}
+		entity := Entity{
+			Kind:      v.kind,
+			Value:     v.value,
+			Reason:    request.Reason,
+			RevokedAt: now,
+			ExpiresAt: expiresAt,
+		}
+		if err := s.repo.Add(ctx, entity); err != nil {
+			return nil, fmt.Errorf("revocation service: revoke: error adding revocation %s=%s: %w", v.kind, v.value, err)
+		}
+		resp = append(resp, entity.toResponse())
+	}
+	return resp, nil
+}
+
+func (s *Service) GetActive(ctx context.Context) ([]Response, error) {
+	entities, err := s.repo.GetActive(ctx, s.now())
+	if err != nil {
+		return nil, fmt.Errorf("revocation service: get active: error to retrieve revocations: %w", err)
+	}
+	resp := make([]Response, 0, len(entities))
+	for _, entity := range entities {
+		resp = append(resp, entity.toResponse())
+	}
+	return resp, nil
+}
+
+// IsRevoked реализует web.RevocationChecker
+func (s *Service) IsRevoked(ctx context.Context, claims *web.IdmClaims) (bool, error) {
+	query := Query{
+		Jti:       claims.ID,
+		SessionId: claims.SessionId,
+		Subject:   claims.Subject,
+		Now:       s.now(),
+	}
+	if claims.IssuedAt != nil {
+		query.IssuedAt = claims.IssuedAt.Time
+	}
+	isRevoked, err := s.repo.IsRevoked(ctx, query)
+	if err != nil {
+		return false, fmt.Errorf("revocation service: is revoked: %w", err)
+	}
+	return isRevoked, nil
+}
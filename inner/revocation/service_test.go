@@ -0,0 +1,111 @@
+package revocation
+
+import (
+	"context"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"idm/inner/common"
+	"idm/inner/validator"
+	"idm/inner/web"
+	"testing"
+	"time"
+)
+
+func newTestService(now time.Time) (*Service, *MemoryRepository) {
+	repo := NewMemoryRepository()
+	svc := NewService(repo, validator.New(), time.Hour)
+	svc.now = func() time.Time { return now }
+	return svc, repo
+}
+
+func newClaims(jti, sid, sub string, issuedAt time.Time) *web.IdmClaims {
+	return &web.IdmClaims{
+		SessionId: sid,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:       jti,
+			Subject:  sub,
+			IssuedAt: jwt.NewNumericDate(issuedAt),
+		},
+	}
+}
+
+func TestService_Revoke(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	t.Run("should revoke token by jti", func(t *testing.T) {
+		a := assert.New(t)
+		svc, _ := newTestService(now)
+		revoked, err := svc.Revoke(ctx, RevokeRequest{Jti: "token-1", Reason: "stolen laptop"})
+		a.NoError(err)
+		a.Len(revoked, 1)
+		a.Equal(KindJti, revoked[0].Kind)
+		a.Equal(now.Add(time.Hour), revoked[0].ExpiresAt)
+		isRevoked, err := svc.IsRevoked(ctx, newClaims("token-1", "", "user-1", now))
+		a.NoError(err)
+		a.True(isRevoked)
+		isRevoked, err = svc.IsRevoked(ctx, newClaims("token-2", "", "user-1", now))
+		a.NoError(err)
+		a.False(isRevoked)
+	})
+	t.Run("should revoke all tokens of session", func(t *testing.T) {
+		a := assert.New(t)
+		svc, _ := newTestService(now)
+		_, err := svc.Revoke(ctx, RevokeRequest{SessionId: "session-1"})
+		a.NoError(err)
+		isRevoked, err := svc.IsRevoked(ctx, newClaims("token-3", "session-1", "user-1", now))
+		a.NoError(err)
+		a.True(isRevoked)
+	})
+	t.Run("subject revocation keeps tokens issued later", func(t *testing.T) {
+		a := assert.New(t)
+		svc, _ := newTestService(now)
+		_, err := svc.Revoke(ctx, RevokeRequest{Subject: "user-1"})
+		a.NoError(err)
+		isRevoked, err := svc.IsRevoked(ctx, newClaims("", "", "user-1", now.Add(-time.Minute)))
+		a.NoError(err)
+		a.True(isRevoked)
+		isRevoked, err = svc.IsRevoked(ctx, newClaims("", "", "user-1", now.Add(time.Minute)))
+		a.NoError(err)
+		a.False(isRevoked)
+		isRevoked, err = svc.IsRevoked(ctx, newClaims("", "", "user-2", now.Add(-time.Minute)))
+		a.NoError(err)
+		a.False(isRevoked)
+	})
+	t.Run("revocation expires together with tokens", func(t *testing.T) {
+		a := assert.New(t)
+		svc, repo := newTestService(now)
+		expiresAt := now.Add(5 * time.Minute)
+		_, err := svc.Revoke(ctx, RevokeRequest{Jti: "token-4", ExpiresAt: &expiresAt})
+		a.NoError(err)
+		svc.now = func() time.Time { return expiresAt }
+		isRevoked, err := svc.IsRevoked(ctx, newClaims("token-4", "", "", now))
+		a.NoError(err)
+		a.False(isRevoked)
+		// следующий отзыв удаляет истёкшие записи
+		_, err = svc.Revoke(ctx, RevokeRequest{Jti: "token-5"})
+		a.NoError(err)
+		a.Len(repo.entries, 1)
+	})
+	t.Run("should return active revocations", func(t *testing.T) {
+		a := assert.New(t)
+		svc, _ := newTestService(now)
+		_, err := svc.Revoke(ctx, RevokeRequest{Jti: "token-6", Subject: "user-3", SessionId: "session-3"})
+		a.NoError(err)
+		active, err := svc.GetActive(ctx)
+		a.NoError(err)
+		a.Len(active, 3)
+	})
+	t.Run("should return validation error without target", func(t *testing.T) {
+		a := assert.New(t)
+		svc, _ := newTestService(now)
+		_, err := svc.Revoke(ctx, RevokeRequest{Reason: "nothing"})
+		a.ErrorAs(err, new(*common.RequestValidationError))
+	})
+	t.Run("should return validation error for past expires_at", func(t *testing.T) {
+		a := assert.New(t)
+		svc, _ := newTestService(now)
+		expiresAt := now.Add(-time.Minute)
+		_, err := svc.Revoke(ctx, RevokeRequest{Jti: "token-7", ExpiresAt: &expiresAt})
+		a.ErrorAs(err, new(*common.RequestValidationError))
+	})
+}
@@ -1,13 +1,13 @@
 package role
 
 import (
+	"context"
 	"errors"
 	"github.com/gofiber/fiber/v3"
-	"github.com/golang-jwt/jwt/v5"
 	"go.uber.org/zap"
 	"idm/inner/common"
+	"idm/inner/export"
 	"idm/inner/web"
-	"slices"
 	"strconv"
 )
 
@@ -17,13 +17,29 @@ type Controller struct {
 	logger  *common.Logger
 }
 
+var (
+	readPolicy = web.Policy{
+		Roles:       []string{web.IdmAdmin, web.IdmUser},
+		Scopes:      []string{web.ScopeRolesRead, web.ScopeRolesWrite},
+		ClientRoles: []string{web.IdmAdmin, web.IdmUser},
+	}
+	// writePolicy менять данные могут только пользователи основного realm
+	writePolicy = web.Policy{
+		Roles:       []string{web.IdmAdmin},
+		Scopes:      []string{web.ScopeRolesWrite},
+		ClientRoles: []string{web.IdmAdmin},
+		Realms:      []string{web.PrimaryRealm},
+	}
+)
+
 type Svc interface {
-	FindById(id IdRequest) (role Response, err error)
-	GetAll() ([]Response, error)
-	Add(request NameRequest) (id int64, err error)
-	GetGroupById(ids IdsRequest) ([]Response, error)
-	Delete(id IdRequest) error
-	DeleteGroup(ids IdsRequest) error
+	FindById(ctx context.Context, tenant common.Tenant, id IdRequest) (role Response, err error)
+	GetAll(ctx context.Context, tenant common.Tenant) ([]Response, error)
+	Add(ctx context.Context, tenant common.Tenant, request NameRequest) (id int64, err error)
+	GetGroupById(ctx context.Context, tenant common.Tenant, ids IdsRequest) ([]Response, error)
+	Delete(ctx context.Context, tenant common.Tenant, id IdRequest) error
+	DeleteGroup(ctx context.Context, tenant common.Tenant, ids IdsRequest) error
+	Export(ctx context.Context, tenant common.Tenant, request ExportRequest, write func(ExportRow) error) error
 }
 
 func NewController(server *web.Server, service Svc, logger *common.Logger) *Controller {
@@ -37,6 +53,7 @@ func NewController(server *web.Server, service Svc, logger *common.Logger) *Cont
 func (c *Controller) RegisterRoutes() {
 	c.server.GroupApiV1.Get("/roles", c.GetAll)
 	c.server.GroupApiV1.Post("/roles", c.CreateRole)
+	c.server.GroupApiV1.Get("/roles/export", c.Export)
 	c.server.GroupApiV1.Get("/roles/:id", c.FindById)
 	c.server.GroupApiV1.Post("/roles/search", c.GetGroupById)
 	c.server.GroupApiV1.Delete("/roles/batch-delete", c.DeleteGroup)
@@ -52,13 +69,12 @@ func (c *Controller) RegisterRoutes() {
 // @Param        request body NameRequest true "Role name"
 // @Success      200 {object} Response
 // @Failure      400 {object} Response
+// @Failure      409 {object} Response "Role already exists"
 // @Failure      500 {object} Response
 // @Router       /roles [post]
 // @Security BearerAuth
 func (c *Controller) CreateRole(ctx fiber.Ctx) error {
-	token := ctx.Locals(web.JwtKey).(*jwt.Token)
-	claims := token.Claims.(*web.IdmClaims)
-	if !slices.Contains(claims.RealmAccess.Roles, web.IdmAdmin) {
+	if !web.Authorize(ctx, writePolicy) {
 		return common.ErrResponse(ctx, fiber.StatusForbidden, "Permission denied")
 	}
 	var request NameRequest
@@ -67,14 +83,21 @@ func (c *Controller) CreateRole(ctx fiber.Ctx) error {
 		return common.ErrResponse(ctx, fiber.StatusBadRequest, err.Error())
 	}
 	c.logger.Debug("create role: received request", zap.Any("request", request))
-	newRoleId, err := c.service.Add(request)
+	newRoleId, err := c.service.Add(ctx.Context(), web.TenantFrom(ctx), request)
 	var reqErr *common.RequestValidationError
 	var existsErr *common.AlreadyExistsError
+	var conflictErr *common.ConflictError
 	if err != nil {
 		c.logger.Error("create role", zap.Error(err))
-		if errors.As(err, &reqErr) || errors.As(err, &existsErr) {
+		if errors.As(err, &reqErr) {
 			return common.ErrResponse(ctx, fiber.StatusBadRequest, err.Error())
 		}
+		if errors.As(err, &existsErr) || errors.As(err, &conflictErr) {
+			return common.ErrResponse(ctx, fiber.StatusConflict, err.Error())
+		}
+		if errors.Is(err, context.DeadlineExceeded) {
+			return common.ErrResponse(ctx, fiber.StatusGatewayTimeout, "timeout exceeded")
+		}
 		return common.ErrResponse(ctx, fiber.StatusInternalServerError, err.Error())
 	}
 	c.logger.Info("role created", zap.Int64("id", newRoleId))
@@ -94,9 +117,7 @@ func (c *Controller) CreateRole(ctx fiber.Ctx) error {
 // @Router       /roles/{id} [get]
 // @Security BearerAuth
 func (c *Controller) FindById(ctx fiber.Ctx) error {
-	token := ctx.Locals(web.JwtKey).(*jwt.Token)
-	claims := token.Claims.(*web.IdmClaims)
-	if !slices.Contains(claims.RealmAccess.Roles, web.IdmAdmin) || !slices.Contains(claims.RealmAccess.Roles, web.IdmUser) {
+	if !web.Authorize(ctx, readPolicy) {
 		return common.ErrResponse(ctx, fiber.StatusForbidden, "Permission denied")
 	}
 	param := ctx.Params("id")
@@ -107,7 +128,7 @@ func (c *Controller) FindById(ctx fiber.Ctx) error {
 		return common.ErrResponse(ctx, fiber.StatusBadRequest, err.Error())
 	}
 	id := IdRequest{Id: int64(request)}
-	role, err := c.service.FindById(id)
+	role, err := c.service.FindById(ctx.Context(), web.TenantFrom(ctx), id)
 	var reqErr *common.RequestValidationError
 	var notFoundErr *common.NotFoundError
 	if err != nil {
@@ -117,6 +138,8 @@ func (c *Controller) FindById(ctx fiber.Ctx) error {
 			return common.ErrResponse(ctx, fiber.StatusOK, err.Error())
 		case errors.As(err, &reqErr):
 			return common.ErrResponse(ctx, fiber.StatusBadRequest, err.Error())
+		case errors.Is(err, context.DeadlineExceeded):
+			return common.ErrResponse(ctx, fiber.StatusGatewayTimeout, "timeout exceeded")
 		default:
 			return common.ErrResponse(ctx, fiber.StatusInternalServerError, err.Error())
 		}
@@ -134,18 +157,18 @@ func (c *Controller) FindById(ctx fiber.Ctx) error {
 // @Router       /roles [get]
 // @Security BearerAuth
 func (c *Controller) GetAll(ctx fiber.Ctx) error {
-	token := ctx.Locals(web.JwtKey).(*jwt.Token)
-	claims := token.Claims.(*web.IdmClaims)
-	if !slices.Contains(claims.RealmAccess.Roles, web.IdmAdmin) || !slices.Contains(claims.RealmAccess.Roles, web.IdmUser) {
+	if !web.Authorize(ctx, readPolicy) {
 		return common.ErrResponse(ctx, fiber.StatusForbidden, "Permission denied")
 	}
-	roles, err := c.service.GetAll()
+	roles, err := c.service.GetAll(ctx.Context(), web.TenantFrom(ctx))
 	var notFoundErr *common.NotFoundError
 	if err != nil {
 		c.logger.Error("get all roles", zap.Error(err))
 		switch {
 		case errors.As(err, &notFoundErr):
 			return common.ErrResponse(ctx, fiber.StatusOK, err.Error())
+		case errors.Is(err, context.DeadlineExceeded):
+			return common.ErrResponse(ctx, fiber.StatusGatewayTimeout, "timeout exceeded")
 		default:
 			return common.ErrResponse(ctx, fiber.StatusInternalServerError, err.Error())
 		}
@@ -166,9 +189,7 @@ func (c *Controller) GetAll(ctx fiber.Ctx) error {
 // @Router       /roles/search [post]
 // @Security BearerAuth
 func (c *Controller) GetGroupById(ctx fiber.Ctx) error {
-	token := ctx.Locals(web.JwtKey).(*jwt.Token)
-	claims := token.Claims.(*web.IdmClaims)
-	if !slices.Contains(claims.RealmAccess.Roles, web.IdmAdmin) || !slices.Contains(claims.RealmAccess.Roles, web.IdmUser) {
+	if !web.Authorize(ctx, readPolicy) {
 		return common.ErrResponse(ctx, fiber.StatusForbidden, "Permission denied")
 	}
 	var request IdsRequest
@@ -176,7 +197,7 @@ func (c *Controller) GetGroupById(ctx fiber.Ctx) error {
 		c.logger.Error("get roles by ids", zap.Error(err))
 		return common.ErrResponse(ctx, fiber.StatusBadRequest, err.Error())
 	}
-	roles, err := c.service.GetGroupById(request)
+	roles, err := c.service.GetGroupById(ctx.Context(), web.TenantFrom(ctx), request)
 	var reqErr *common.RequestValidationError
 	var notFoundErr *common.NotFoundError
 	if err != nil {
@@ -186,6 +207,8 @@ func (c *Controller) GetGroupById(ctx fiber.Ctx) error {
 			return common.ErrResponse(ctx, fiber.StatusOK, err.Error())
 		case errors.As(err, &reqErr):
 			return common.ErrResponse(ctx, fiber.StatusBadRequest, err.Error())
+		case errors.Is(err, context.DeadlineExceeded):
+			return common.ErrResponse(ctx, fiber.StatusGatewayTimeout, "timeout exceeded")
 		default:
 			return common.ErrResponse(ctx, fiber.StatusInternalServerError, err.Error())
 		}
@@ -201,13 +224,12 @@ func (c *Controller) GetGroupById(ctx fiber.Ctx) error {
 // @Param        id path int true "Role ID"
 // @Success      200 {object} Response
 // @Failure      400 {object} Response
+// @Failure      409 {object} Response "Conflicts with related data"
 // @Failure      500 {object} Response
 // @Router       /roles/{id} [delete]
 // @Security BearerAuth
 func (c *Controller) Delete(ctx fiber.Ctx) error {
-	token := ctx.Locals(web.JwtKey).(*jwt.Token)
-	claims := token.Claims.(*web.IdmClaims)
-	if !slices.Contains(claims.RealmAccess.Roles, web.IdmAdmin) {
+	if !web.Authorize(ctx, writePolicy) {
 		return common.ErrResponse(ctx, fiber.StatusForbidden, "Permission denied")
 	}
 	param := ctx.Params("id")
@@ -218,13 +240,18 @@ func (c *Controller) Delete(ctx fiber.Ctx) error {
 		return common.ErrResponse(ctx, fiber.StatusBadRequest, err.Error())
 	}
 	id := IdRequest{Id: int64(request)}
-	err = c.service.Delete(id)
+	err = c.service.Delete(ctx.Context(), web.TenantFrom(ctx), id)
 	var reqErr *common.RequestValidationError
+	var conflictErr *common.ConflictError
 	if err != nil {
 		c.logger.Error("delete role", zap.Error(err))
 		switch {
 		case errors.As(err, &reqErr):
 			return common.ErrResponse(ctx, fiber.StatusBadRequest, err.Error())
+		case errors.As(err, &conflictErr):
+			return common.ErrResponse(ctx, fiber.StatusConflict, err.Error())
+		case errors.Is(err, context.DeadlineExceeded):
+			return common.ErrResponse(ctx, fiber.StatusGatewayTimeout, "timeout exceeded")
 		default:
 			return common.ErrResponse(ctx, fiber.StatusInternalServerError, err.Error())
 		}
@@ -242,13 +269,12 @@ func (c *Controller) Delete(ctx fiber.Ctx) error {
 // @Param        request body IdsRequest true "IDs"
 // @Success      200 {object} Response
 // @Failure      400 {object} Response
+// @Failure      409 {object} Response "Conflicts with related data"
 // @Failure      500 {object} Response
 // @Router       /roles/batch-delete [delete]
 // @Security BearerAuth
 func (c *Controller) DeleteGroup(ctx fiber.Ctx) error {
-	token := ctx.Locals(web.JwtKey).(*jwt.Token)
-	claims := token.Claims.(*web.IdmClaims)
-	if !slices.Contains(claims.RealmAccess.Roles, web.IdmAdmin) {
+	if !web.Authorize(ctx, writePolicy) {
 		return common.ErrResponse(ctx, fiber.StatusForbidden, "Permission denied")
 	}
 	var request IdsRequest
@@ -256,13 +282,18 @@ func (c *Controller) DeleteGroup(ctx fiber.Ctx) error {
 		c.logger.Error("delete group roles by ids", zap.Error(err))
 		return common.ErrResponse(ctx, fiber.StatusBadRequest, err.Error())
 	}
-	err := c.service.DeleteGroup(request)
+	err := c.service.DeleteGroup(ctx.Context(), web.TenantFrom(ctx), request)
 	var reqErr *common.RequestValidationError
+	var conflictErr *common.ConflictError
 	if err != nil {
 		c.logger.Error("delete group roles by ids", zap.Error(err))
 		switch {
 		case errors.As(err, &reqErr):
 			return common.ErrResponse(ctx, fiber.StatusBadRequest, err.Error())
+		case errors.As(err, &conflictErr):
+			return common.ErrResponse(ctx, fiber.StatusConflict, err.Error())
+		case errors.Is(err, context.DeadlineExceeded):
+			return common.ErrResponse(ctx, fiber.StatusGatewayTimeout, "timeout exceeded")
 		default:
 			return common.ErrResponse(ctx, fiber.StatusInternalServerError, err.Error())
 		}
@@ -270,3 +301,34 @@ func (c *Controller) DeleteGroup(ctx fiber.Ctx) error {
 	c.logger.Info("roles deleted")
 	return nil
 }
+
+// Export godoc
+// @Summary      Export roles
+// @Description  Выгружает роли с количеством назначенных сотрудников потоком, без загрузки всей таблицы в память.
+// @Description  При DB_DRIVER_NAME=memory назначений ролей нет и количество сотрудников всегда 0
+// @Tags         roles
+// @Produce      text/csv
+// @Produce      application/jsonl
+// @Param        format query string false "File format" Enums(csv, jsonl) default(csv)
+// @Param        textFilter query string false "Filter by name"
+// @Success      200 {array} ExportRow
+// @Failure      400 {object} Response
+// @Router       /roles/export [get]
+// @Security BearerAuth
+func (c *Controller) Export(ctx fiber.Ctx) error {
+	if !web.Authorize(ctx, readPolicy) {
+		return common.ErrResponse(ctx, fiber.StatusForbidden, "Permission denied")
+	}
+	format, err := export.ParseFormat(ctx.Query("format", string(export.Csv)))
+	if err != nil {
+		c.logger.Error("export roles", zap.Error(err))
+		return common.ErrResponse(ctx, fiber.StatusBadRequest, err.Error())
+	}
+	tenant := web.TenantFrom(ctx)
+	request := ExportRequest{TextFilter: ctx.Query("textFilter")}
+	return export.Send(ctx, "roles", format, ExportHeader, c.logger, func(reqCtx context.Context, w *export.Writer) error {
+		return c.service.Export(reqCtx, tenant, request, func(row ExportRow) error {
+			return w.Write(row)
+		})
+	})
+}
@@ -2,6 +2,7 @@ package role
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"github.com/gofiber/fiber/v3"
 	"github.com/golang-jwt/jwt/v5"
@@ -21,34 +22,52 @@ import (
 
 type MockService struct {
 	mock.Mock
+	tenant common.Tenant
 }
 
-func (svc *MockService) FindById(id IdRequest) (Response, error) {
+func (svc *MockService) FindById(ctx context.Context, tenant common.Tenant, id IdRequest) (Response, error) {
+	svc.tenant = tenant
 	args := svc.Called(id)
 	return args.Get(0).(Response), args.Error(1)
 }
 
-func (svc *MockService) Add(request NameRequest) (int64, error) {
+func (svc *MockService) Add(ctx context.Context, tenant common.Tenant, request NameRequest) (int64, error) {
+	svc.tenant = tenant
 	args := svc.Called(request)
 	return args.Get(0).(int64), args.Error(1)
 }
 
-func (svc *MockService) GetAll() ([]Response, error) {
+func (svc *MockService) Export(ctx context.Context, tenant common.Tenant, request ExportRequest, write func(ExportRow) error) error {
+	svc.tenant = tenant
+	args := svc.Called(request)
+	for _, row := range args.Get(0).([]ExportRow) {
+		if err := write(row); err != nil {
+			return err
+		}
+	}
+	return args.Error(1)
+}
+
+func (svc *MockService) GetAll(ctx context.Context, tenant common.Tenant) ([]Response, error) {
+	svc.tenant = tenant
 	args := svc.Called()
 	return args.Get(0).([]Response), args.Error(1)
 }
 
-func (svc *MockService) GetGroupById(ids IdsRequest) ([]Response, error) {
+func (svc *MockService) GetGroupById(ctx context.Context, tenant common.Tenant, ids IdsRequest) ([]Response, error) {
+	svc.tenant = tenant
 	args := svc.Called(ids)
 	return args.Get(0).([]Response), args.Error(1)
 }
 
-func (svc *MockService) Delete(id IdRequest) error {
+func (svc *MockService) Delete(ctx context.Context, tenant common.Tenant, id IdRequest) error {
+	svc.tenant = tenant
 	args := svc.Called(id)
 	return args.Error(0)
 }
 
-func (svc *MockService) DeleteGroup(ids IdsRequest) error {
+func (svc *MockService) DeleteGroup(ctx context.Context, tenant common.Tenant, ids IdsRequest) error {
+	svc.tenant = tenant
 	args := svc.Called(ids)
 	return args.Error(0)
 }
@@ -111,6 +130,28 @@ func TestController_Add(t *testing.T) {
 		a.Nil(err)
 		a.Equal(http.StatusBadRequest, resp.StatusCode)
 	})
+	t.Run("should return 409 if role already exists (AlreadyExistsError)", func(t *testing.T) {
+		a := assert.New(t)
+		claims := &web.IdmClaims{
+			RealmAccess: web.RealmAccessClaims{Roles: []string{web.IdmAdmin}},
+		}
+		auth := func(c fiber.Ctx) error {
+			c.Locals(web.JwtKey, &jwt.Token{Claims: claims})
+			return c.Next()
+		}
+		server := web.NewServer()
+		server.GroupApiV1.Use(auth)
+		svc := new(MockService)
+		controller := NewController(server, svc, logger)
+		controller.RegisterRoutes()
+		body := strings.NewReader(`{"name": "Admin"}`)
+		req := httptest.NewRequest(fiber.MethodPost, "/api/v1/roles", body)
+		req.Header.Set("Content-Type", "application/json")
+		svc.On("Add", mock.AnythingOfType("NameRequest")).Return(int64(-1), &common.AlreadyExistsError{Massage: "role already exists"})
+		resp, err := server.App.Test(req)
+		a.Nil(err)
+		a.Equal(http.StatusConflict, resp.StatusCode)
+	})
 	t.Run("invalid token returns 401", func(t *testing.T) {
 		fakeAuth := func(c fiber.Ctx) error {
 			return c.SendStatus(fiber.StatusUnauthorized)
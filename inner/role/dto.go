@@ -1,9 +1,13 @@
 package role
 
-import "time"
+import (
+	"strconv"
+	"time"
+)
 
 type Entity struct {
 	Id       int64     `db:"id"`
+	TenantId string    `db:"tenant_id"`
 	Name     string    `db:"name"`
 	CreateAt time.Time `db:"created_at"`
 	UpdateAt time.Time `db:"updated_at"`
@@ -15,6 +19,7 @@ func (e Entity) toResponse() Response {
 
 type Response struct {
 	Id       int64     `json:"id"`
+	TenantId string    `json:"tenant_id"`
 	Name     string    `json:"name"`
 	CreateAt time.Time `json:"created_at"`
 	UpdateAt time.Time `json:"updated_at"`
@@ -23,8 +28,38 @@ type NameRequest struct {
 	Name string `json:"name" validate:"required,min=2,max=155"`
 }
 
-func (req *NameRequest) toEntity() Entity {
-	return Entity{Name: req.Name}
+func (req *NameRequest) toEntity(tenantId string) Entity {
+	return Entity{TenantId: tenantId, Name: req.Name}
+}
+
+// ExportRequest TextFilter оставляет роли, название которых его содержит
+type ExportRequest struct {
+	TextFilter string
+}
+
+// ExportEntity роль с количеством сотрудников, которым она назначена
+type ExportEntity struct {
+	Entity
+	EmployeeCount int64 `db:"employee_count"`
+}
+
+func (e ExportEntity) toRow() ExportRow {
+	return ExportRow{Response: e.toResponse(), EmployeeCount: e.EmployeeCount}
+}
+
+// ExportHeader колонки CSV в порядке ExportRow.Record
+var ExportHeader = []string{"id", "tenant_id", "name", "created_at", "updated_at", "employee_count"}
+
+type ExportRow struct {
+	Response
+	EmployeeCount int64 `json:"employee_count"`
+}
+
+func (r ExportRow) Record() []string {
+	return []string{
+		strconv.FormatInt(r.Id, 10), r.TenantId, r.Name,
+		r.CreateAt.Format(time.RFC3339), r.UpdateAt.Format(time.RFC3339), strconv.FormatInt(r.EmployeeCount, 10),
+	}
 }
 
 type IdRequest struct {
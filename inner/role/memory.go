@@ -0,0 +1,131 @@
+package role
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"idm/inner/common"
+	"idm/inner/database"
+	"slices"
+	"strings"
+	"time"
+)
+
+// MemoryRepository хранит роли в памяти процесса (DB_DRIVER_NAME=memory).
+// Транзакции обеспечивает database.MemoryStore.
+type MemoryRepository struct {
+	store *database.MemoryStore
+	roles *database.MemoryTable[Entity]
+}
+
+func NewMemoryRepository(store *database.MemoryStore) *MemoryRepository {
+	return &MemoryRepository{store: store, roles: database.NewMemoryTable[Entity](store)}
+}
+
+func (r *MemoryRepository) WithTx(ctx context.Context, opts database.TxOptions, fn database.TxFunc) error {
+	return r.store.WithTx(ctx, opts, fn)
+}
+
+func (r *MemoryRepository) FindById(ctx context.Context, tenant common.Tenant, id int64) (role Entity, err error) {
+	err = r.store.Run(ctx, func() error {
+		found, ok := r.roles.Get(id)
+		if !ok || !visible(tenant, found) {
+			return sql.ErrNoRows
+		}
+		role = found
+		return nil
+	})
+	return role, err
+}
+
+func (r *MemoryRepository) GetAll(ctx context.Context, tenant common.Tenant) (roles []Entity, err error) {
+	err = r.store.Run(ctx, func() error {
+		roles = r.roles.Select(func(e Entity) bool { return visible(tenant, e) })
+		return nil
+	})
+	return roles, err
+}
+
+func (r *MemoryRepository) ExistsByName(ctx context.Context, tenantId string, name string) (isExists bool, err error) {
+	err = r.store.Run(ctx, func() error {
+		isExists = r.existsByName(tenantId, name)
+		return nil
+	})
+	return isExists, err
+}
+
+func (r *MemoryRepository) Add(ctx context.Context, role Entity) (id int64, err error) {
+	err = r.store.Run(ctx, func() error {
+		// то же ограничение, что role_name_uidx
+		if r.existsByName(role.TenantId, role.Name) {
+			return &common.AlreadyExistsError{Massage: fmt.Sprintf("already exists: role name %q in tenant %s",
+				role.Name, role.TenantId)}
+		}
+		now := time.Now()
+		id = r.roles.Insert(func(id int64) Entity {
+			role.Id, role.CreateAt, role.UpdateAt = id, now, now
+			return role
+		})
+		return nil
+	})
+	if err != nil {
+		return -1, err
+	}
+	return id, nil
+}
+
+func (r *MemoryRepository) GetGroupById(ctx context.Context, tenant common.Tenant, ids []int64) (roles []Entity, err error) {
+	err = r.store.Run(ctx, func() error {
+		roles = r.roles.Select(func(e Entity) bool { return visible(tenant, e) && slices.Contains(ids, e.Id) })
+		return nil
+	})
+	return roles, err
+}
+
+func (r *MemoryRepository) Delete(ctx context.Context, tenant common.Tenant, id int64) error {
+	return r.DeleteGroup(ctx, tenant, []int64{id})
+}
+
+func (r *MemoryRepository) DeleteGroup(ctx context.Context, tenant common.Tenant, ids []int64) error {
+	return r.store.Run(ctx, func() error {
+		for _, id := range ids {
+			if found, ok := r.roles.Get(id); ok && visible(tenant, found) {
+				r.roles.Delete(id)
+			}
+		}
+		return nil
+	})
+}
+
+// Export в памяти назначений ролей нет, количество сотрудников всегда 0.
+// Строки копируются под блокировкой хранилища, а fn получает их уже без неё:
+// медленный клиент выгрузки не должен останавливать остальные запросы
+func (r *MemoryRepository) Export(ctx context.Context, tenant common.Tenant, name string, fn func(ExportEntity) error) error {
+	name = strings.ToLower(name)
+	var roles []Entity
+	err := r.store.Run(ctx, func() error {
+		roles = r.roles.Select(func(e Entity) bool {
+			return visible(tenant, e) && strings.Contains(strings.ToLower(e.Name), name)
+		})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, role := range roles {
+		if err := fn(ExportEntity{Entity: role}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *MemoryRepository) existsByName(tenantId, name string) bool {
+	return len(r.roles.Select(func(e Entity) bool {
+		return e.TenantId == tenantId && strings.EqualFold(e.Name, name)
+	})) > 0
+}
+
+func visible(tenant common.Tenant, role Entity) bool {
+	return tenant.All || role.TenantId == tenant.Id
+}
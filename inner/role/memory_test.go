@@ -0,0 +1,53 @@
+package role
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"idm/inner/common"
+	"idm/inner/database"
+	"idm/inner/validator"
+	"testing"
+)
+
+func TestMemoryRepository(t *testing.T) {
+	ctx := context.Background()
+	acme := common.SingleTenant("acme")
+	svc := NewService(NewMemoryRepository(database.NewMemoryStore()), validator.New())
+	id, err := svc.Add(ctx, acme, NameRequest{Name: "Admin"})
+	require.NoError(t, err)
+	t.Run("should find role of tenant only", func(t *testing.T) {
+		found, err := svc.FindById(ctx, acme, IdRequest{Id: id})
+		assert.NoError(t, err)
+		assert.Equal(t, "Admin", found.Name)
+		_, err = svc.FindById(ctx, common.SingleTenant("globex"), IdRequest{Id: id})
+		assert.Error(t, err)
+	})
+	t.Run("should reject duplicate name ignoring case", func(t *testing.T) {
+		_, err := svc.Add(ctx, acme, NameRequest{Name: "admin"})
+		var existsErr *common.AlreadyExistsError
+		assert.ErrorAs(t, err, &existsErr)
+	})
+	t.Run("should export filtered roles of tenant", func(t *testing.T) {
+		svc := NewService(NewMemoryRepository(database.NewMemoryStore()), validator.New())
+		_, err := svc.Add(ctx, acme, NameRequest{Name: "Admin"})
+		require.NoError(t, err)
+		_, err = svc.Add(ctx, acme, NameRequest{Name: "Developer"})
+		require.NoError(t, err)
+		_, err = svc.Add(ctx, common.SingleTenant("globex"), NameRequest{Name: "Administrator"})
+		require.NoError(t, err)
+		var names []string
+		err = svc.Export(ctx, acme, ExportRequest{TextFilter: "ADM"}, func(row ExportRow) error {
+			names = append(names, row.Name)
+			return nil
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"Admin"}, names)
+	})
+	t.Run("should delete role", func(t *testing.T) {
+		assert.NoError(t, svc.Delete(ctx, acme, IdRequest{Id: id}))
+		all, err := svc.GetAll(ctx, acme)
+		assert.NoError(t, err)
+		assert.Empty(t, all)
+	})
+}
@@ -1,84 +1,135 @@
 package role
 
 import (
+	"context"
 	"github.com/jmoiron/sqlx"
+	"idm/inner/common"
+	"idm/inner/database"
 )
 
 type Repository struct {
-	db *sqlx.DB
+	db        *sqlx.DB
+	dialect   database.Dialect
+	txManager database.TxManager
 }
 
-func NewRepository(db *sqlx.DB) *Repository {
-	return &Repository{db: db}
+func NewRepository(db *sqlx.DB, txManager database.TxManager) *Repository {
+	return &Repository{db: db, dialect: database.DialectOf(db), txManager: txManager}
 }
 
-func (r *Repository) FindById(id int64) (role Entity, err error) {
-	err = r.db.Get(&role, "SELECT * FROM role WHERE id=$1", id)
+// WithTx выполняет fn в транзакции, в которой политики RLS пропускают только строки арендатора opts.Tenant
+func (r *Repository) WithTx(ctx context.Context, opts database.TxOptions, fn database.TxFunc) error {
+	return r.txManager.WithTx(ctx, opts, fn)
+}
+
+// inTx выполняет fn в транзакции TxManager, внутри единицы работы WithTx - в её транзакции
+func (r *Repository) inTx(ctx context.Context, tenant common.Tenant, fn func(tx *sqlx.Tx) error) error {
+	return r.txManager.WithTx(ctx, database.TxOptions{Tenant: tenant}, func(_ context.Context, tx *sqlx.Tx) error {
+		return fn(tx)
+	})
+}
+
+// inReadTx выполняет fn в транзакции только для чтения, которая может уйти на реплику
+func (r *Repository) inReadTx(ctx context.Context, tenant common.Tenant, fn func(tx *sqlx.Tx) error) error {
+	opts := database.TxOptions{Tenant: tenant, ReadOnly: true}
+	return r.txManager.WithTx(ctx, opts, func(_ context.Context, tx *sqlx.Tx) error {
+		return fn(tx)
+	})
+}
+
+func (r *Repository) FindById(ctx context.Context, tenant common.Tenant, id int64) (role Entity, err error) {
+	err = r.inReadTx(ctx, tenant, func(tx *sqlx.Tx) error {
+		return tx.GetContext(ctx, &role, "SELECT * FROM role WHERE id=$1 AND (tenant_id = $2 OR $3)", id, tenant.Id, tenant.All)
+	})
 	return role, err
 }
 
-func (r *Repository) GetAll() ([]Entity, error) {
-	var roles []Entity
-	rows, err := r.db.Queryx("SELECT * FROM role")
+func (r *Repository) GetAll(ctx context.Context, tenant common.Tenant) (roles []Entity, err error) {
+	err = r.inReadTx(ctx, tenant, func(tx *sqlx.Tx) error {
+		return tx.SelectContext(ctx, &roles, "SELECT * FROM role WHERE tenant_id = $1 OR $2", tenant.Id, tenant.All)
+	})
 	if err != nil {
 		return nil, err
 	}
-	defer func() {
-		err := rows.Close()
-		if err != nil {
-			return
-		}
-	}()
-	for rows.Next() {
-		var role Entity
-		if err = rows.StructScan(&role); err != nil {
-			return nil, err
-		}
-		roles = append(roles, role)
-	}
 	return roles, nil
 }
 
-func (r *Repository) Add(role Entity) (int64, error) {
+// Export читает роли, название которых содержит name, серверным курсором и передаёт их fn по одной
+func (r *Repository) Export(ctx context.Context, tenant common.Tenant, name string, fn func(ExportEntity) error) error {
+	query := "SELECT * FROM role WHERE (tenant_id = ? OR ?)"
+	args := []any{tenant.Id, tenant.All}
+	if name != "" {
+		query += " AND " + r.dialect.ILike("name")
+		args = append(args, "%"+name+"%")
+	}
+	query = sqlx.Rebind(sqlx.DOLLAR, `SELECT r.id, r.tenant_id, r.name, r.created_at, r.updated_at,
+			(SELECT COUNT(*) FROM employee_role er WHERE er.role_id = r.id) AS employee_count
+		FROM (`+query+`) r
+		ORDER BY r.id`)
+	// строки уходят клиенту по мере чтения, повтор после сбоя реплики записал бы их ещё раз
+	opts := database.TxOptions{Tenant: tenant, ReadOnly: true, SingleAttempt: true}
+	return r.txManager.WithTx(ctx, opts, func(_ context.Context, tx *sqlx.Tx) error {
+		return database.EachRow(ctx, tx, query, args, func(rows *sqlx.Rows) error {
+			var role ExportEntity
+			if err := rows.StructScan(&role); err != nil {
+				return err
+			}
+			return fn(role)
+		})
+	})
+}
+
+func (r *Repository) ExistsByName(ctx context.Context, tenantId string, name string) (isExists bool, err error) {
+	err = r.inTx(ctx, common.SingleTenant(tenantId), func(tx *sqlx.Tx) error {
+		return tx.GetContext(ctx, &isExists, "SELECT exists(SELECT 1 FROM role WHERE tenant_id = $1 AND lower(name) = lower($2))", tenantId, name)
+	})
+	return isExists, err
+}
+
+func (r *Repository) Add(ctx context.Context, role Entity) (int64, error) {
 	var id int64
-	err := r.db.QueryRow("INSERT INTO Role (name) VALUES ($1) RETURNING id",
-		role.Name).Scan(&id)
+	err := r.inTx(ctx, common.SingleTenant(role.TenantId), func(tx *sqlx.Tx) error {
+		return tx.QueryRowContext(ctx, "INSERT INTO Role (tenant_id, name) VALUES ($1, $2) RETURNING id",
+			role.TenantId, role.Name).Scan(&id)
+	})
 	if err != nil {
-		return -1, err
+		return -1, database.TranslateError(err)
 	}
 	return id, nil
 }
 
-func (r *Repository) GetGroupById(ids []int64) (roles []Entity, err error) {
-	q, args, err := sqlx.In("SELECT * FROM role WHERE id IN (?)", ids)
+func (r *Repository) GetGroupById(ctx context.Context, tenant common.Tenant, ids []int64) (roles []Entity, err error) {
+	q, args, err := sqlx.In("SELECT * FROM role WHERE id IN (?) AND (tenant_id = ? OR ?)", ids, tenant.Id, tenant.All)
 	if err != nil {
 		return nil, err
 	}
 	q = r.db.Rebind(q)
-	err = r.db.Select(&roles, q, args...)
+	err = r.inReadTx(ctx, tenant, func(tx *sqlx.Tx) error {
+		return tx.SelectContext(ctx, &roles, q, args...)
+	})
 	if err != nil {
 		return nil, err
 	}
 	return roles, nil
 }
 
-func (r *Repository) Delete(id int64) (err error) {
-	_, err = r.db.Exec("DELETE FROM role WHERE id=$1", id)
-	if err != nil {
+func (r *Repository) Delete(ctx context.Context, tenant common.Tenant, id int64) (err error) {
+	err = r.inTx(ctx, tenant, func(tx *sqlx.Tx) error {
+		_, err := tx.ExecContext(ctx, "DELETE FROM role WHERE id=$1 AND (tenant_id = $2 OR $3)", id, tenant.Id, tenant.All)
 		return err
-	}
-	return nil
+	})
+	return database.TranslateError(err)
 }
 
-func (r *Repository) DeleteGroup(ids []int64) error {
-	q, args, err := sqlx.In("DELETE FROM role WHERE id IN (?)", ids)
+func (r *Repository) DeleteGroup(ctx context.Context, tenant common.Tenant, ids []int64) error {
+	q, args, err := sqlx.In("DELETE FROM role WHERE id IN (?) AND (tenant_id = ? OR ?)", ids, tenant.Id, tenant.All)
 	if err != nil {
 		return err
 	}
 	q = r.db.Rebind(q)
-	_, err = r.db.Exec(q, args...)
-	if err != nil {
+	err = r.inTx(ctx, tenant, func(tx *sqlx.Tx) error {
+		_, err := tx.ExecContext(ctx, q, args...)
 		return err
-	}
-	return nil
+	})
+	return database.TranslateError(err)
 }
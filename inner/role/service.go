@@ -1,10 +1,13 @@
 package role
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
+	"github.com/jmoiron/sqlx"
 	"idm/inner/common"
+	"idm/inner/database"
 )
 
 type Service struct {
@@ -12,13 +15,17 @@ type Service struct {
 	validator Validator
 }
 
+// Repo все методы чтения и удаления ограничены арендатором, Add берёт арендатора из Entity.TenantId
 type Repo interface {
-	FindById(id int64) (Entity, error)
-	GetAll() ([]Entity, error)
-	Add(role Entity) (int64, error)
-	GetGroupById(ids []int64) ([]Entity, error)
-	Delete(id int64) error
-	DeleteGroup(ids []int64) error
+	database.TxManager
+	FindById(ctx context.Context, tenant common.Tenant, id int64) (Entity, error)
+	GetAll(ctx context.Context, tenant common.Tenant) ([]Entity, error)
+	ExistsByName(ctx context.Context, tenantId string, name string) (bool, error)
+	Add(ctx context.Context, role Entity) (int64, error)
+	GetGroupById(ctx context.Context, tenant common.Tenant, ids []int64) ([]Entity, error)
+	Delete(ctx context.Context, tenant common.Tenant, id int64) error
+	DeleteGroup(ctx context.Context, tenant common.Tenant, ids []int64) error
+	Export(ctx context.Context, tenant common.Tenant, name string, fn func(ExportEntity) error) error
 }
 
 type Validator interface {
@@ -37,25 +44,25 @@ func (e *NotFoundError) Error() string {
 	return e.Message
 }
 
-func (s *Service) FindById(req IdRequest) (role Response, err error) {
+func (s *Service) FindById(ctx context.Context, tenant common.Tenant, req IdRequest) (role Response, err error) {
 	if err = s.validator.Validate(req); err != nil {
 		return Response{}, &common.RequestValidationError{Massage: err.Error()}
 	}
-	entity, err := s.repo.FindById(req.Id)
+	entity, err := s.repo.FindById(ctx, tenant, req.Id)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return Response{}, &common.NotFoundError{Massage: fmt.Sprintf("service repository: find by id: "+
 				"role not found: id=%d", req.Id)}
 		}
-		return Response{}, fmt.Errorf("service repository: find by id: error finding role: id=%d", req.Id)
+		return Response{}, fmt.Errorf("service repository: find by id: error finding role: id=%d: %w", req.Id, err)
 	}
 	return entity.toResponse(), nil
 }
 
-func (s *Service) GetAll() ([]Response, error) {
-	all, err := s.repo.GetAll()
+func (s *Service) GetAll(ctx context.Context, tenant common.Tenant) ([]Response, error) {
+	all, err := s.repo.GetAll(ctx, tenant)
 	if err != nil {
-		return []Response{}, fmt.Errorf("role service: get all roles: error to retrieve all roles")
+		return []Response{}, fmt.Errorf("role service: get all roles: error to retrieve all roles: %w", err)
 	}
 	var resp []Response
 	for _, entity := range all {
@@ -64,24 +71,44 @@ func (s *Service) GetAll() ([]Response, error) {
 	return resp, nil
 }
 
-func (s *Service) Add(request NameRequest) (id int64, err error) {
+func (s *Service) Add(ctx context.Context, tenant common.Tenant, request NameRequest) (id int64, err error) {
 	if err = s.validator.Validate(request); err != nil {
 		return 0, &common.RequestValidationError{Massage: err.Error()}
 	}
-	id, err = s.repo.Add(request.toEntity())
+	tenantId, err := tenant.ForWrite()
 	if err != nil {
-		return -1, fmt.Errorf("role service: add employee: error adding role")
+		return 0, err
+	}
+	// SERIALIZABLE: параллельное добавление роли с тем же именем не пройдёт проверку на дубликат.
+	// методы репозитория выполняются в транзакции WithTx: она передаётся через ctx
+	opts := database.TxOptions{Tenant: common.SingleTenant(tenantId), Isolation: sql.LevelSerializable}
+	err = s.repo.WithTx(ctx, opts, func(ctx context.Context, _ *sqlx.Tx) error {
+		isExists, err := s.repo.ExistsByName(ctx, tenantId, request.Name)
+		if err != nil {
+			return fmt.Errorf("error checking exists role: %w", err)
+		}
+		if isExists {
+			return &common.AlreadyExistsError{Massage: fmt.Sprintf("role with name %s already exists", request.Name)}
+		}
+		id, err = s.repo.Add(ctx, request.toEntity(tenantId))
+		if err != nil {
+			return fmt.Errorf("error adding role: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return -1, fmt.Errorf("role service: add role: %w", err)
 	}
 	return id, nil
 }
 
-func (s *Service) GetGroupById(req IdsRequest) ([]Response, error) {
+func (s *Service) GetGroupById(ctx context.Context, tenant common.Tenant, req IdsRequest) ([]Response, error) {
 	if err := s.validator.Validate(req); err != nil {
 		return []Response{}, &common.RequestValidationError{Massage: err.Error()}
 	}
-	roles, err := s.repo.GetGroupById(req.Ids)
+	roles, err := s.repo.GetGroupById(ctx, tenant, req.Ids)
 	if err != nil {
-		return nil, fmt.Errorf("role service: get group by id: error getting roles with ids %v", req.Ids)
+		return nil, fmt.Errorf("role service: get group by id: error getting roles with ids %v: %w", req.Ids, err)
 	}
 	var resp []Response
 	for _, role := range roles {
@@ -90,24 +117,35 @@ func (s *Service) GetGroupById(req IdsRequest) ([]Response, error) {
 	return resp, nil
 }
 
-func (s *Service) Delete(req IdRequest) error {
+func (s *Service) Delete(ctx context.Context, tenant common.Tenant, req IdRequest) error {
 	if err := s.validator.Validate(req); err != nil {
 		return &common.RequestValidationError{Massage: err.Error()}
 	}
-	err := s.repo.Delete(req.Id)
+	err := s.repo.Delete(ctx, tenant, req.Id)
 	if err != nil {
-		return fmt.Errorf("role service: delete: error deleting role with id %d", req.Id)
+		return fmt.Errorf("role service: delete: error deleting role with id %d: %w", req.Id, err)
 	}
 	return nil
 }
 
-func (s *Service) DeleteGroup(req IdsRequest) error {
+func (s *Service) DeleteGroup(ctx context.Context, tenant common.Tenant, req IdsRequest) error {
 	if err := s.validator.Validate(req); err != nil {
 		return &common.RequestValidationError{Massage: err.Error()}
 	}
-	err := s.repo.DeleteGroup(req.Ids)
+	err := s.repo.DeleteGroup(ctx, tenant, req.Ids)
+	if err != nil {
+		return fmt.Errorf("role service: delete group: error deleting group with id %v: %w", req.Ids, err)
+	}
+	return nil
+}
+
+// Export передаёт write роли по одной в порядке id, не загружая всю таблицу
+func (s *Service) Export(ctx context.Context, tenant common.Tenant, request ExportRequest, write func(ExportRow) error) error {
+	err := s.repo.Export(ctx, tenant, request.TextFilter, func(entity ExportEntity) error {
+		return write(entity.toRow())
+	})
 	if err != nil {
-		return fmt.Errorf("role service: delete group: error deleting group with id %v", req.Ids)
+		return fmt.Errorf("role service: export: %w", err)
 	}
 	return nil
 }
@@ -1,12 +1,17 @@
 package role
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"go.uber.org/zap"
 	"idm/inner/common"
+	"idm/inner/database"
 	"idm/inner/validator"
 	"testing"
 	"time"
@@ -14,34 +19,49 @@ import (
 
 type MockRepo struct {
 	mock.Mock
+	txOpts database.TxOptions
 }
 
-func (m *MockRepo) FindById(id int64) (Entity, error) {
+func (m *MockRepo) WithTx(ctx context.Context, opts database.TxOptions, fn database.TxFunc) error {
+	m.txOpts = opts
+	return fn(ctx, nil)
+}
+
+func (m *MockRepo) ExistsByName(ctx context.Context, tenantId string, name string) (bool, error) {
+	args := m.Called(name)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockRepo) FindById(ctx context.Context, tenant common.Tenant, id int64) (Entity, error) {
 	args := m.Called(id)
 	return args.Get(0).(Entity), args.Error(1)
 }
 
-func (m *MockRepo) GetAll() ([]Entity, error) {
+func (m *MockRepo) Export(ctx context.Context, tenant common.Tenant, name string, fn func(ExportEntity) error) error {
+	panic("implement me")
+}
+
+func (m *MockRepo) GetAll(ctx context.Context, tenant common.Tenant) ([]Entity, error) {
 	args := m.Called()
 	return args.Get(0).([]Entity), args.Error(1)
 }
 
-func (m *MockRepo) Add(role Entity) (int64, error) {
+func (m *MockRepo) Add(ctx context.Context, role Entity) (int64, error) {
 	args := m.Called(role)
 	return args.Get(0).(int64), args.Error(1)
 }
 
-func (m *MockRepo) GetGroupById(ids []int64) ([]Entity, error) {
+func (m *MockRepo) GetGroupById(ctx context.Context, tenant common.Tenant, ids []int64) ([]Entity, error) {
 	args := m.Called(ids)
 	return args.Get(0).([]Entity), args.Error(1)
 }
 
-func (m *MockRepo) Delete(id int64) error {
+func (m *MockRepo) Delete(ctx context.Context, tenant common.Tenant, id int64) error {
 	args := m.Called(id)
 	return args.Error(0)
 }
 
-func (m *MockRepo) DeleteGroup(ids []int64) error {
+func (m *MockRepo) DeleteGroup(ctx context.Context, tenant common.Tenant, ids []int64) error {
 	args := m.Called(ids)
 	return args.Error(0)
 }
@@ -53,47 +73,65 @@ type Stub struct {
 
 //goland:noinspection GoUnusedExportedType
 type StubRepo interface {
-	FindById(id int64) (Entity, error)
-	GetAll() ([]Entity, error)
-	Add(role Entity) (int64, error)
-	GetGroupById(ids []int64) ([]Entity, error)
-	Delete(id int64) error
-	DeleteGroup(ids []int64) error
+	database.TxManager
+	FindById(ctx context.Context, tenant common.Tenant, id int64) (Entity, error)
+	GetAll(ctx context.Context, tenant common.Tenant) ([]Entity, error)
+	ExistsByName(ctx context.Context, tenantId string, name string) (bool, error)
+	Add(ctx context.Context, role Entity) (int64, error)
+	GetGroupById(ctx context.Context, tenant common.Tenant, ids []int64) ([]Entity, error)
+	Delete(ctx context.Context, tenant common.Tenant, id int64) error
+	DeleteGroup(ctx context.Context, tenant common.Tenant, ids []int64) error
 }
 
 func _() *Stub {
 	return &Stub{}
 }
 
-func (s *Stub) FindById(_ int64) (Entity, error) {
+func (s *Stub) WithTx(ctx context.Context, _ database.TxOptions, fn database.TxFunc) error {
+	return fn(ctx, nil)
+}
+
+func (s *Stub) ExistsByName(ctx context.Context, _ string, _ string) (bool, error) {
+	//TODO implement me
+	panic("implement me")
+}
+
+func (s *Stub) FindById(ctx context.Context, _ common.Tenant, _ int64) (Entity, error) {
 	return s.Entity, s.Err
 }
 
-func (s *Stub) GetAll() ([]Entity, error) {
+func (s *Stub) GetAll(ctx context.Context, _ common.Tenant) ([]Entity, error) {
 	//TODO implement me
 	panic("implement me")
 }
 
-func (s *Stub) Add(_ Entity) (int64, error) {
+func (s *Stub) Add(ctx context.Context, _ Entity) (int64, error) {
 	//TODO implement me
 	panic("implement me")
 }
 
-func (s *Stub) GetGroupById(_ []int64) ([]Entity, error) {
+func (s *Stub) GetGroupById(ctx context.Context, _ common.Tenant, _ []int64) ([]Entity, error) {
 	//TODO implement me
 	panic("implement me")
 }
 
-func (s *Stub) Delete(_ int64) error {
+func (s *Stub) Delete(ctx context.Context, _ common.Tenant, _ int64) error {
 	//TODO implement me
 	panic("implement me")
 }
 
-func (s *Stub) DeleteGroup(_ []int64) error {
+func (s *Stub) DeleteGroup(ctx context.Context, _ common.Tenant, _ []int64) error {
 	//TODO implement me
 	panic("implement me")
 }
 
+func (s *Stub) Export(ctx context.Context, _ common.Tenant, _ string, _ func(ExportEntity) error) error {
+	//TODO implement me
+	panic("implement me")
+}
+
+var testTenant = common.SingleTenant("acme")
+
 func TestFindById(t *testing.T) {
 	a := assert.New(t)
 	t.Run("should return found role", func(t *testing.T) {
@@ -109,7 +147,7 @@ func TestFindById(t *testing.T) {
 		}
 		srv := NewService(repo, validator.New())
 		want := entity.toResponse()
-		got, err := srv.FindById(IdRequest{1})
+		got, err := srv.FindById(context.Background(), testTenant, IdRequest{1})
 		a.NoError(err)
 		a.Equal(want, got)
 	})
@@ -124,7 +162,7 @@ func TestFindById(t *testing.T) {
 		}
 		want := entity.toResponse()
 		repo.On("FindById", int64(1)).Return(entity, nil)
-		got, err := srv.FindById(IdRequest{1})
+		got, err := srv.FindById(context.Background(), testTenant, IdRequest{1})
 		a.NoError(err)
 		a.Equal(want, got)
 		a.True(repo.AssertNumberOfCalls(t, "FindById", 1))
@@ -137,7 +175,7 @@ func TestFindById(t *testing.T) {
 		want := &common.NotFoundError{Massage: fmt.Sprintf("service repository: find by id: "+
 			"role not found: id=%d", id)}
 		repo.On("FindById", id).Return(entity, sql.ErrNoRows)
-		response, got := srv.FindById(IdRequest{1})
+		response, got := srv.FindById(context.Background(), testTenant, IdRequest{1})
 		var notFoundErr *common.NotFoundError
 		a.True(errors.As(got, &notFoundErr))
 		a.Empty(response)
@@ -156,23 +194,72 @@ func TestAdd(t *testing.T) {
 			Id: 1, Name: "Admin", CreateAt: time.Now(), UpdateAt: time.Now(),
 		}
 		want := int64(1)
+		repo.On("ExistsByName", entity.Name).Return(false, nil)
 		repo.On("Add", mock.MatchedBy(func(e Entity) bool {
-			return e.Name == entity.Name
+			return e.Name == entity.Name && e.TenantId == testTenant.Id
 		})).Return(want, nil)
-		got, err := srv.Add(NameRequest{entity.Name})
+		got, err := srv.Add(context.Background(), testTenant, NameRequest{entity.Name})
 		a.NoError(err)
 		a.Equal(want, got)
 		a.True(repo.AssertNumberOfCalls(t, "Add", 1))
+		a.Equal(testTenant, repo.txOpts.Tenant)
+		a.Equal(sql.LevelSerializable, repo.txOpts.Isolation)
+	})
+	t.Run("should return error if role already exists", func(t *testing.T) {
+		repo := new(MockRepo)
+		srv := NewService(repo, validator.New())
+		repo.On("ExistsByName", "Admin").Return(true, nil)
+		id, got := srv.Add(context.Background(), testTenant, NameRequest{"Admin"})
+		var existsErr *common.AlreadyExistsError
+		a.ErrorAs(got, &existsErr)
+		a.Equal(int64(-1), id)
+		a.True(repo.AssertNumberOfCalls(t, "Add", 0))
+	})
+	t.Run("should return wrapped error of exists check", func(t *testing.T) {
+		repo := new(MockRepo)
+		srv := NewService(repo, validator.New())
+		want := errors.New("database error")
+		repo.On("ExistsByName", "Admin").Return(false, want)
+		_, got := srv.Add(context.Background(), testTenant, NameRequest{"Admin"})
+		a.ErrorIs(got, want)
+		a.True(repo.AssertNumberOfCalls(t, "Add", 0))
 	})
 	t.Run("should return wrapped error", func(t *testing.T) {
 		repo := new(MockRepo)
 		srv := NewService(repo, validator.New())
-		_, got := srv.Add(NameRequest{}) // Пустое имя
+		_, got := srv.Add(context.Background(), testTenant, NameRequest{}) // Пустое имя
 		a.NotNil(got)
 		a.IsType(&common.RequestValidationError{}, got)
 		a.Contains(got.Error(), "validation")
 		a.True(repo.AssertNumberOfCalls(t, "Add", 0))
 	})
+	t.Run("should require single tenant", func(t *testing.T) {
+		repo := new(MockRepo)
+		srv := NewService(repo, validator.New())
+		_, got := srv.Add(context.Background(), common.AllTenants(), NameRequest{"Admin"})
+		a.IsType(&common.RequestValidationError{}, got)
+		a.True(repo.AssertNumberOfCalls(t, "Add", 0))
+	})
+	t.Run("should check name and insert in one serializable transaction", func(t *testing.T) {
+		db, m, err := sqlmock.New()
+		a.NoError(err)
+		defer func() { _ = db.Close() }()
+		sqlxDB := sqlx.NewDb(db, "postgres")
+		repo := NewRepository(sqlxDB, database.NewTxManager(sqlxDB, &common.Logger{Logger: zap.NewNop()}, 1))
+		m.ExpectBegin()
+		m.ExpectExec("SET LOCAL app.tenant_id").WillReturnResult(sqlmock.NewResult(0, 0))
+		m.ExpectExec("SAVEPOINT sp_1").WillReturnResult(sqlmock.NewResult(0, 0))
+		m.ExpectQuery("SELECT exists").WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+		m.ExpectExec("RELEASE SAVEPOINT sp_1").WillReturnResult(sqlmock.NewResult(0, 0))
+		m.ExpectExec("SAVEPOINT sp_1").WillReturnResult(sqlmock.NewResult(0, 0))
+		m.ExpectQuery("INSERT INTO Role").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(7))
+		m.ExpectExec("RELEASE SAVEPOINT sp_1").WillReturnResult(sqlmock.NewResult(0, 0))
+		m.ExpectCommit()
+		id, err := NewService(repo, validator.New()).Add(context.Background(), testTenant, NameRequest{"Admin"})
+		a.NoError(err)
+		a.Equal(int64(7), id)
+		a.NoError(m.ExpectationsWereMet())
+	})
 }
 func TestGetAll(t *testing.T) {
 	a := assert.New(t)
@@ -194,7 +281,7 @@ func TestGetAll(t *testing.T) {
 			want = append(want, e.toResponse())
 		}
 		repo.On("GetAll").Return(entities, nil)
-		got, err := srv.GetAll()
+		got, err := srv.GetAll(context.Background(), testTenant)
 		a.NoError(err)
 		a.Equal(want, got)
 		a.True(repo.AssertNumberOfCalls(t, "GetAll", 1))
@@ -205,10 +292,10 @@ func TestGetAll(t *testing.T) {
 		entities := []Entity{}
 		want := fmt.Errorf("role service: get all roles: error to retrieve all roles")
 		repo.On("GetAll").Return(entities, want)
-		response, got := srv.GetAll()
+		response, got := srv.GetAll(context.Background(), testTenant)
 		a.Empty(response)
 		a.NotNil(got)
-		a.Equal(want, got)
+		a.ErrorIs(got, want)
 		a.True(repo.AssertNumberOfCalls(t, "GetAll", 1))
 	})
 }
@@ -234,7 +321,7 @@ func TestGetGroupById(t *testing.T) {
 		}
 		ids := []int64{1, 2}
 		repo.On("GetGroupById", ids).Return(entities, nil)
-		got, err := srv.GetGroupById(IdsRequest{ids})
+		got, err := srv.GetGroupById(context.Background(), testTenant, IdsRequest{ids})
 		a.NoError(err)
 		a.Equal(want, got)
 		a.True(repo.AssertNumberOfCalls(t, "GetGroupById", 1))
@@ -246,10 +333,10 @@ func TestGetGroupById(t *testing.T) {
 		ids := []int64{1, 2}
 		want := fmt.Errorf("role service: get group by id: error getting roles with ids %v", ids)
 		repo.On("GetGroupById", ids).Return(entities, want)
-		response, got := srv.GetGroupById(IdsRequest{ids})
+		response, got := srv.GetGroupById(context.Background(), testTenant, IdsRequest{ids})
 		a.Empty(response)
 		a.NotNil(got)
-		a.Equal(want, got)
+		a.ErrorIs(got, want)
 		a.True(repo.AssertNumberOfCalls(t, "GetGroupById", 1))
 	})
 }
@@ -259,7 +346,7 @@ func TestDelete(t *testing.T) {
 		repo := new(MockRepo)
 		srv := NewService(repo, validator.New())
 		repo.On("Delete", int64(1)).Return(nil)
-		err := srv.Delete(IdRequest{int64(1)})
+		err := srv.Delete(context.Background(), testTenant, IdRequest{int64(1)})
 		a.NoError(err)
 		a.True(repo.AssertNumberOfCalls(t, "Delete", 1))
 	})
@@ -269,9 +356,9 @@ func TestDelete(t *testing.T) {
 		id := int64(1)
 		want := fmt.Errorf("role service: delete: error deleting role with id %d", id)
 		repo.On("Delete", id).Return(want)
-		got := srv.Delete(IdRequest{id})
+		got := srv.Delete(context.Background(), testTenant, IdRequest{id})
 		a.NotNil(got)
-		a.Equal(want, got)
+		a.ErrorIs(got, want)
 		a.True(repo.AssertNumberOfCalls(t, "Delete", 1))
 	})
 }
@@ -282,7 +369,7 @@ func TestDeleteGroup(t *testing.T) {
 		srv := NewService(repo, validator.New())
 		ids := []int64{1, 2}
 		repo.On("DeleteGroup", ids).Return(nil)
-		err := srv.DeleteGroup(IdsRequest{ids})
+		err := srv.DeleteGroup(context.Background(), testTenant, IdsRequest{ids})
 		a.NoError(err)
 		a.True(repo.AssertNumberOfCalls(t, "DeleteGroup", 1))
 	})
@@ -292,9 +379,9 @@ func TestDeleteGroup(t *testing.T) {
 		ids := []int64{1, 2}
 		want := fmt.Errorf("role service: delete group: error deleting group with id %v", ids)
 		repo.On("DeleteGroup", ids).Return(want)
-		got := srv.DeleteGroup(IdsRequest{ids})
+		got := srv.DeleteGroup(context.Background(), testTenant, IdsRequest{ids})
 		a.NotNil(got)
-		a.Equal(want, got)
+		a.ErrorIs(got, want)
 		a.True(repo.AssertNumberOfCalls(t, "DeleteGroup", 1))
 	})
 }
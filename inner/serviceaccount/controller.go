@@ -0,0 +1,187 @@
+package serviceaccount
+
+import (
+	"context"
+	"errors"
+	"github.com/gofiber/fiber/v3"
+	"go.uber.org/zap"
+	"idm/inner/common"
+	"idm/inner/web"
+	"strconv"
+)
+
+type Controller struct {
+	server  *web.Server
+	service Svc
+	logger  *common.Logger
+}
+
+type Svc interface {
+	Create(ctx context.Context, tenant common.Tenant, request CreateRequest) (KeyResponse, error)
+	GetAll(ctx context.Context, tenant common.Tenant) ([]Response, error)
+	RotateKey(ctx context.Context, tenant common.Tenant, req IdRequest) (KeyResponse, error)
+	Delete(ctx context.Context, tenant common.Tenant, req IdRequest) error
+}
+
+func NewController(server *web.Server, service Svc, logger *common.Logger) *Controller {
+	return &Controller{
+		server:  server,
+		service: service,
+		logger:  logger,
+	}
+}
+
+func (c *Controller) RegisterRoutes() {
+	c.server.GroupApiV1.Post("/service-accounts", c.Create)
+	c.server.GroupApiV1.Get("/service-accounts", c.GetAll)
+	c.server.GroupApiV1.Post("/service-accounts/:id/rotate", c.RotateKey)
+	c.server.GroupApiV1.Delete("/service-accounts/:id", c.Delete)
+}
+
+// Create godoc
+// @Summary      Create service account
+// @Description  Создаёт сервисную учётную запись и возвращает API ключ. Ключ показывается только один раз
+// @Tags         service-accounts
+// @Accept       json
+// @Produce      json
+// @Param        request body CreateRequest true "Service account"
+// @Success      200 {object} KeyResponse
+// @Failure      400 {object} Response
+// @Failure      409 {object} Response "Service account already exists"
+// @Failure      500 {object} Response
+// @Router       /service-accounts [post]
+// @Security BearerAuth
+func (c *Controller) Create(ctx fiber.Ctx) error {
+	if !web.Authorize(ctx, adminPolicy) {
+		return common.ErrResponse(ctx, fiber.StatusForbidden, "Permission denied")
+	}
+	var request CreateRequest
+	if err := ctx.Bind().Body(&request); err != nil {
+		c.logger.Error("create service account", zap.Error(err))
+		return common.ErrResponse(ctx, fiber.StatusBadRequest, err.Error())
+	}
+	key, err := c.service.Create(ctx.Context(), web.TenantFrom(ctx), request)
+	var reqErr *common.RequestValidationError
+	var existsErr *common.AlreadyExistsError
+	var conflictErr *common.ConflictError
+	if err != nil {
+		c.logger.Error("create service account", zap.Error(err))
+		if errors.As(err, &reqErr) {
+			return common.ErrResponse(ctx, fiber.StatusBadRequest, err.Error())
+		}
+		if errors.As(err, &existsErr) || errors.As(err, &conflictErr) {
+			return common.ErrResponse(ctx, fiber.StatusConflict, err.Error())
+		}
+		if errors.Is(err, context.DeadlineExceeded) {
+			return common.ErrResponse(ctx, fiber.StatusGatewayTimeout, "timeout exceeded")
+		}
+		return common.ErrResponse(ctx, fiber.StatusInternalServerError, err.Error())
+	}
+	c.logger.Info("service account created", zap.Int64("id", key.Id))
+	return common.OkResponse(ctx, key)
+}
+
+// GetAll godoc
+// @Summary      Get all service accounts
+// @Description  Возвращает список сервисных учётных записей без ключей
+// @Tags         service-accounts
+// @Success      200 {array} Response
+// @Failure      500 {object} Response
+// @Router       /service-accounts [get]
+// @Security BearerAuth
+func (c *Controller) GetAll(ctx fiber.Ctx) error {
+	if !web.Authorize(ctx, adminPolicy) {
+		return common.ErrResponse(ctx, fiber.StatusForbidden, "Permission denied")
+	}
+	accounts, err := c.service.GetAll(ctx.Context(), web.TenantFrom(ctx))
+	if err != nil {
+		c.logger.Error("get all service accounts", zap.Error(err))
+		if errors.Is(err, context.DeadlineExceeded) {
+			return common.ErrResponse(ctx, fiber.StatusGatewayTimeout, "timeout exceeded")
+		}
+		return common.ErrResponse(ctx, fiber.StatusInternalServerError, err.Error())
+	}
+	return common.OkResponse(ctx, accounts)
+}
+
+// RotateKey godoc
+// @Summary      Rotate API key
+// @Description  Выпускает новый API ключ, старый перестаёт действовать
+// @Tags         service-accounts
+// @Param        id path int true "Service account ID"
+// @Success      200 {object} KeyResponse
+// @Failure      400 {object} Response
+// @Failure      404 {object} Response
+// @Failure      500 {object} Response
+// @Router       /service-accounts/{id}/rotate [post]
+// @Security BearerAuth
+func (c *Controller) RotateKey(ctx fiber.Ctx) error {
+	if !web.Authorize(ctx, adminPolicy) {
+		return common.ErrResponse(ctx, fiber.StatusForbidden, "Permission denied")
+	}
+	id, err := strconv.ParseInt(ctx.Params("id"), 10, 64)
+	if err != nil {
+		c.logger.Error("rotate service account key", zap.Error(err))
+		return common.ErrResponse(ctx, fiber.StatusBadRequest, err.Error())
+	}
+	key, err := c.service.RotateKey(ctx.Context(), web.TenantFrom(ctx), IdRequest{Id: id})
+	var reqErr *common.RequestValidationError
+	var notFoundErr *common.NotFoundError
+	if err != nil {
+		c.logger.Error("rotate service account key", zap.Error(err))
+		switch {
+		case errors.As(err, &notFoundErr):
+			return common.ErrResponse(ctx, fiber.StatusNotFound, err.Error())
+		case errors.As(err, &reqErr):
+			return common.ErrResponse(ctx, fiber.StatusBadRequest, err.Error())
+		case errors.Is(err, context.DeadlineExceeded):
+			return common.ErrResponse(ctx, fiber.StatusGatewayTimeout, "timeout exceeded")
+		default:
+			return common.ErrResponse(ctx, fiber.StatusInternalServerError, err.Error())
+		}
+	}
+	c.logger.Info("service account key rotated", zap.Int64("id", id))
+	return common.OkResponse(ctx, key)
+}
+
+// Delete godoc
+// @Summary      Delete service account
+// @Description  Удаляет сервисную учётную запись, её ключ перестаёт действовать
+// @Tags         service-accounts
+// @Param        id path int true "Service account ID"
+// @Success      200 "Deleted"
+// @Failure      400 {object} Response
+// @Failure      500 {object} Response
+// @Router       /service-accounts/{id} [delete]
+// @Security BearerAuth
+func (c *Controller) Delete(ctx fiber.Ctx) error {
+	if !web.Authorize(ctx, adminPolicy) {
+		return common.ErrResponse(ctx, fiber.StatusForbidden, "Permission denied")
+	}
+	id, err := strconv.ParseInt(ctx.Params("id"), 10, 64)
+	if err != nil {
+		c.logger.Error("delete service account", zap.Error(err))
+		return common.ErrResponse(ctx, fiber.StatusBadRequest, err.Error())
+	}
+	err = c.service.Delete(ctx.Context(), web.TenantFrom(ctx), IdRequest{Id: id})
+	var reqErr *common.RequestValidationError
+	if err != nil {
+		c.logger.Error("delete service account", zap.Error(err))
+		if errors.As(err, &reqErr) {
+			return common.ErrResponse(ctx, fiber.StatusBadRequest, err.Error())
+		}
+		if errors.Is(err, context.DeadlineExceeded) {
+			return common.ErrResponse(ctx, fiber.StatusGatewayTimeout, "timeout exceeded")
+		}
+		return common.ErrResponse(ctx, fiber.StatusInternalServerError, err.Error())
+	}
+	c.logger.Info("service account deleted", zap.Int64("id", id))
+	return ctx.SendStatus(fiber.StatusOK)
+}
+
+// adminPolicy сервисными учётными записями управляют только пользователи основного realm
+var adminPolicy = web.Policy{
+	Roles:       []string{web.IdmAdmin},
+	ClientRoles: []string{web.IdmAdmin},
+	Realms:      []string{web.PrimaryRealm},
+}
@@ -0,0 +1,136 @@
+package serviceaccount
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/gofiber/fiber/v3"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go.uber.org/zap"
+	"idm/inner/common"
+	"idm/inner/web"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type MockService struct {
+	mock.Mock
+}
+
+func (svc *MockService) Create(ctx context.Context, tenant common.Tenant, request CreateRequest) (KeyResponse, error) {
+	args := svc.Called(request)
+	return args.Get(0).(KeyResponse), args.Error(1)
+}
+
+func (svc *MockService) GetAll(ctx context.Context, tenant common.Tenant) ([]Response, error) {
+	args := svc.Called()
+	return args.Get(0).([]Response), args.Error(1)
+}
+
+func (svc *MockService) RotateKey(ctx context.Context, tenant common.Tenant, req IdRequest) (KeyResponse, error) {
+	args := svc.Called(req)
+	return args.Get(0).(KeyResponse), args.Error(1)
+}
+
+func (svc *MockService) Delete(ctx context.Context, tenant common.Tenant, req IdRequest) error {
+	args := svc.Called(req)
+	return args.Error(0)
+}
+
+func newTestServer(svc Svc, roles ...string) *web.Server {
+	claims := &web.IdmClaims{
+		RealmAccess: web.RealmAccessClaims{Roles: roles},
+	}
+	auth := func(c fiber.Ctx) error {
+		c.Locals(web.JwtKey, &jwt.Token{Claims: claims})
+		return c.Next()
+	}
+	server := web.NewServer()
+	server.GroupApiV1.Use(auth)
+	logger := &common.Logger{Logger: zap.NewNop()}
+	NewController(server, svc, logger).RegisterRoutes()
+	return server
+}
+
+func TestController_Create(t *testing.T) {
+	t.Run("should return api key", func(t *testing.T) {
+		a := assert.New(t)
+		svc := new(MockService)
+		server := newTestServer(svc, web.IdmAdmin)
+		svc.On("Create", mock.AnythingOfType("CreateRequest")).Return(KeyResponse{Id: 1, ApiKey: "idm_secret"}, nil)
+		body := strings.NewReader(`{"name": "hr-feed", "roles": ["IDM_USER"]}`)
+		req := httptest.NewRequest(fiber.MethodPost, "/api/v1/service-accounts", body)
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := server.App.Test(req)
+		a.NoError(err)
+		a.Equal(http.StatusOK, resp.StatusCode)
+		data, err := io.ReadAll(resp.Body)
+		a.NoError(err)
+		var result common.Response[KeyResponse]
+		a.NoError(json.Unmarshal(data, &result))
+		a.Equal("idm_secret", result.Data.ApiKey)
+	})
+	t.Run("should return 409 if already exists", func(t *testing.T) {
+		a := assert.New(t)
+		svc := new(MockService)
+		server := newTestServer(svc, web.IdmAdmin)
+		svc.On("Create", mock.AnythingOfType("CreateRequest")).Return(KeyResponse{}, &common.AlreadyExistsError{Massage: "exists"})
+		body := strings.NewReader(`{"name": "hr-feed"}`)
+		req := httptest.NewRequest(fiber.MethodPost, "/api/v1/service-accounts", body)
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := server.App.Test(req)
+		a.NoError(err)
+		a.Equal(http.StatusConflict, resp.StatusCode)
+	})
+	t.Run("should return 403 for non admin", func(t *testing.T) {
+		a := assert.New(t)
+		svc := new(MockService)
+		server := newTestServer(svc, web.IdmUser)
+		body := strings.NewReader(`{"name": "hr-feed"}`)
+		req := httptest.NewRequest(fiber.MethodPost, "/api/v1/service-accounts", body)
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := server.App.Test(req)
+		a.NoError(err)
+		a.Equal(http.StatusForbidden, resp.StatusCode)
+		svc.AssertNotCalled(t, "Create", mock.Anything)
+	})
+}
+
+func TestController_RotateKey(t *testing.T) {
+	t.Run("should return new key", func(t *testing.T) {
+		a := assert.New(t)
+		svc := new(MockService)
+		server := newTestServer(svc, web.IdmAdmin)
+		svc.On("RotateKey", IdRequest{Id: 5}).Return(KeyResponse{Id: 5, ApiKey: "idm_new"}, nil)
+		req := httptest.NewRequest(fiber.MethodPost, "/api/v1/service-accounts/5/rotate", nil)
+		resp, err := server.App.Test(req)
+		a.NoError(err)
+		a.Equal(http.StatusOK, resp.StatusCode)
+	})
+	t.Run("should return 404 if not found", func(t *testing.T) {
+		a := assert.New(t)
+		svc := new(MockService)
+		server := newTestServer(svc, web.IdmAdmin)
+		svc.On("RotateKey", IdRequest{Id: 5}).Return(KeyResponse{}, &common.NotFoundError{Massage: "not found"})
+		req := httptest.NewRequest(fiber.MethodPost, "/api/v1/service-accounts/5/rotate", nil)
+		resp, err := server.App.Test(req)
+		a.NoError(err)
+		a.Equal(http.StatusNotFound, resp.StatusCode)
+	})
+}
+
+func TestController_Delete(t *testing.T) {
+	a := assert.New(t)
+	svc := new(MockService)
+	server := newTestServer(svc, web.IdmAdmin)
+	svc.On("Delete", IdRequest{Id: 5}).Return(nil)
+	req := httptest.NewRequest(fiber.MethodDelete, "/api/v1/service-accounts/5", nil)
+	resp, err := server.App.Test(req)
+	a.NoError(err)
+	a.Equal(http.StatusOK, resp.StatusCode)
+	svc.AssertCalled(t, "Delete", IdRequest{Id: 5})
+}
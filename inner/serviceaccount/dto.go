@@ -0,0 +1,76 @@
+package serviceaccount
+
+import (
+	"github.com/lib/pq"
+	"time"
+)
+
+type Entity struct {
+	Id        int64          `db:"id"`
+	TenantId  string         `db:"tenant_id"`
+	Name      string         `db:"name"`
+	KeyPrefix string         `db:"key_prefix"`
+	KeyHash   string         `db:"key_hash"`
+	Roles     pq.StringArray `db:"roles"`
+	Scopes    pq.StringArray `db:"scopes"`
+	ExpiresAt *time.Time     `db:"expires_at"`
+	CreatedAt time.Time      `db:"created_at"`
+	UpdatedAt time.Time      `db:"updated_at"`
+}
+
+func (e Entity) toResponse() Response {
+	return Response{
+		Id:        e.Id,
+		TenantId:  e.TenantId,
+		Name:      e.Name,
+		KeyPrefix: e.KeyPrefix,
+		Roles:     e.Roles,
+		Scopes:    e.Scopes,
+		ExpiresAt: e.ExpiresAt,
+		CreatedAt: e.CreatedAt,
+		UpdatedAt: e.UpdatedAt,
+	}
+}
+
+func (e Entity) isExpired(now time.Time) bool {
+	return e.ExpiresAt != nil && !now.Before(*e.ExpiresAt)
+}
+
+type Response struct {
+	Id        int64      `json:"id"`
+	TenantId  string     `json:"tenant_id"`
+	Name      string     `json:"name"`
+	KeyPrefix string     `json:"key_prefix"`
+	Roles     []string   `json:"roles"`
+	Scopes    []string   `json:"scopes"`
+	ExpiresAt *time.Time `json:"expires_at"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
+// KeyResponse содержит API ключ в открытом виде, он возвращается только один раз
+type KeyResponse struct {
+	Id     int64  `json:"id"`
+	ApiKey string `json:"api_key"`
+}
+
+type CreateRequest struct {
+	Name      string     `json:"name" validate:"required,min=2,max=155"`
+	Roles     []string   `json:"roles" validate:"dive,oneof=IDM_ADMIN IDM_USER"`
+	Scopes    []string   `json:"scopes" validate:"dive,required,max=255"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+func (req *CreateRequest) toEntity(tenantId string) Entity {
+	return Entity{
+		TenantId:  tenantId,
+		Name:      req.Name,
+		Roles:     append(pq.StringArray{}, req.Roles...),
+		Scopes:    append(pq.StringArray{}, req.Scopes...),
+		ExpiresAt: req.ExpiresAt,
+	}
+}
+
+type IdRequest struct {
+	Id int64 `param:"id" validate:"gt=0"`
+}
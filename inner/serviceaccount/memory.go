@@ -0,0 +1,111 @@
+package serviceaccount
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"idm/inner/common"
+	"idm/inner/database"
+	"time"
+)
+
+// MemoryRepository хранит сервисные аккаунты в памяти процесса (DB_DRIVER_NAME=memory)
+type MemoryRepository struct {
+	store    *database.MemoryStore
+	accounts *database.MemoryTable[Entity]
+}
+
+func NewMemoryRepository(store *database.MemoryStore) *MemoryRepository {
+	return &MemoryRepository{store: store, accounts: database.NewMemoryTable[Entity](store)}
+}
+
+func (r *MemoryRepository) Add(ctx context.Context, account Entity) (id int64, err error) {
+	err = r.store.Run(ctx, func() error {
+		// то же ограничение, что service_account_name_uidx
+		if r.existsByName(account.TenantId, account.Name) {
+			return &common.AlreadyExistsError{Massage: fmt.Sprintf("already exists: service account name %q in tenant %s",
+				account.Name, account.TenantId)}
+		}
+		now := time.Now()
+		id = r.accounts.Insert(func(id int64) Entity {
+			account.Id, account.CreatedAt, account.UpdatedAt = id, now, now
+			return account
+		})
+		return nil
+	})
+	if err != nil {
+		return -1, err
+	}
+	return id, nil
+}
+
+func (r *MemoryRepository) FindById(ctx context.Context, tenant common.Tenant, id int64) (account Entity, err error) {
+	err = r.store.Run(ctx, func() error {
+		found, ok := r.accounts.Get(id)
+		if !ok || !visible(tenant, found) {
+			return sql.ErrNoRows
+		}
+		account = found
+		return nil
+	})
+	return account, err
+}
+
+func (r *MemoryRepository) FindByKeyHash(ctx context.Context, keyHash string) (account Entity, err error) {
+	err = r.store.Run(ctx, func() error {
+		found := r.accounts.Select(func(e Entity) bool { return e.KeyHash == keyHash })
+		if len(found) == 0 {
+			return sql.ErrNoRows
+		}
+		account = found[0]
+		return nil
+	})
+	return account, err
+}
+
+func (r *MemoryRepository) FindByName(ctx context.Context, tenantId, name string) (isExists bool, err error) {
+	err = r.store.Run(ctx, func() error {
+		isExists = r.existsByName(tenantId, name)
+		return nil
+	})
+	return isExists, err
+}
+
+func (r *MemoryRepository) GetAll(ctx context.Context, tenant common.Tenant) (accounts []Entity, err error) {
+	err = r.store.Run(ctx, func() error {
+		accounts = r.accounts.Select(func(e Entity) bool { return visible(tenant, e) })
+		return nil
+	})
+	return accounts, err
+}
+
+func (r *MemoryRepository) UpdateKey(ctx context.Context, tenant common.Tenant, id int64, keyPrefix, keyHash string) (isUpdated bool, err error) {
+	err = r.store.Run(ctx, func() error {
+		account, ok := r.accounts.Get(id)
+		if !ok || !visible(tenant, account) {
+			return nil
+		}
+		account.KeyPrefix, account.KeyHash, account.UpdatedAt = keyPrefix, keyHash, time.Now()
+		r.accounts.Put(id, account)
+		isUpdated = true
+		return nil
+	})
+	return isUpdated, err
+}
+
+func (r *MemoryRepository) Delete(ctx context.Context, tenant common.Tenant, id int64) error {
+	return r.store.Run(ctx, func() error {
+		if account, ok := r.accounts.Get(id); ok && visible(tenant, account) {
+			r.accounts.Delete(id)
+		}
+		return nil
+	})
+}
+
+func (r *MemoryRepository) existsByName(tenantId, name string) bool {
+	return len(r.accounts.Select(func(e Entity) bool { return e.TenantId == tenantId && e.Name == name })) > 0
+}
+
+func visible(tenant common.Tenant, account Entity) bool {
+	return tenant.All || account.TenantId == tenant.Id
+}
@@ -0,0 +1,90 @@
+package serviceaccount
+
+import (
+	"context"
+	"github.com/jmoiron/sqlx"
+	"idm/inner/common"
+	"idm/inner/database"
+)
+
+type Repository struct {
+	db *sqlx.DB
+}
+
+func NewRepository(db *sqlx.DB) *Repository {
+	return &Repository{db: db}
+}
+
+func (r *Repository) Add(ctx context.Context, account Entity) (id int64, err error) {
+	err = database.InTenantTx(ctx, r.db, common.SingleTenant(account.TenantId), func(tx *sqlx.Tx) error {
+		return tx.QueryRowxContext(ctx,
+			`INSERT INTO service_account (tenant_id, name, key_prefix, key_hash, roles, scopes, expires_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id`,
+			account.TenantId, account.Name, account.KeyPrefix, account.KeyHash, account.Roles, account.Scopes, account.ExpiresAt,
+		).Scan(&id)
+	})
+	if err != nil {
+		return -1, database.TranslateError(err)
+	}
+	return id, nil
+}
+
+func (r *Repository) FindById(ctx context.Context, tenant common.Tenant, id int64) (account Entity, err error) {
+	err = database.InTenantTx(ctx, r.db, tenant, func(tx *sqlx.Tx) error {
+		return tx.GetContext(ctx, &account,
+			"SELECT * FROM service_account WHERE id = $1 AND (tenant_id = $2 OR $3)", id, tenant.Id, tenant.All)
+	})
+	return account, err
+}
+
+// FindByKeyHash ищет аккаунт среди всех арендаторов: арендатор становится известен только по найденному ключу.
+// В Postgres запрос выполняет функция service_account_by_key_hash, которая обходит политику RLS только на время вызова.
+func (r *Repository) FindByKeyHash(ctx context.Context, keyHash string) (account Entity, err error) {
+	query := "SELECT * FROM service_account_by_key_hash($1)"
+	if !database.DialectOf(r.db).RowLevelSecurity() {
+		query = "SELECT * FROM service_account WHERE key_hash = $1"
+	}
+	err = r.db.GetContext(ctx, &account, query, keyHash)
+	return account, err
+}
+
+func (r *Repository) FindByName(ctx context.Context, tenantId, name string) (isExists bool, err error) {
+	err = database.InTenantTx(ctx, r.db, common.SingleTenant(tenantId), func(tx *sqlx.Tx) error {
+		return tx.GetContext(ctx, &isExists,
+			"SELECT exists(SELECT 1 FROM service_account WHERE tenant_id = $1 AND name = $2)", tenantId, name)
+	})
+	return isExists, err
+}
+
+func (r *Repository) GetAll(ctx context.Context, tenant common.Tenant) (accounts []Entity, err error) {
+	err = database.InTenantTx(ctx, r.db, tenant, func(tx *sqlx.Tx) error {
+		return tx.SelectContext(ctx, &accounts,
+			"SELECT * FROM service_account WHERE tenant_id = $1 OR $2 ORDER BY id", tenant.Id, tenant.All)
+	})
+	return accounts, err
+}
+
+func (r *Repository) UpdateKey(ctx context.Context, tenant common.Tenant, id int64, keyPrefix, keyHash string) (isUpdated bool, err error) {
+	var rows int64
+	err = database.InTenantTx(ctx, r.db, tenant, func(tx *sqlx.Tx) error {
+		result, err := tx.ExecContext(ctx,
+			`UPDATE service_account SET key_prefix = $1, key_hash = $2, updated_at = CURRENT_TIMESTAMP
+			WHERE id = $3 AND (tenant_id = $4 OR $5)`,
+			keyPrefix, keyHash, id, tenant.Id, tenant.All,
+		)
+		if err != nil {
+			return err
+		}
+		rows, err = result.RowsAffected()
+		return err
+	})
+	return rows > 0, err
+}
+
+func (r *Repository) Delete(ctx context.Context, tenant common.Tenant, id int64) error {
+	return database.InTenantTx(ctx, r.db, tenant, func(tx *sqlx.Tx) error {
+		_, err := tx.ExecContext(ctx,
+			"DELETE FROM service_account WHERE id = $1 AND (tenant_id = $2 OR $3)", id, tenant.Id, tenant.All)
+		return err
+	})
+}
@@ -0,0 +1,168 @@
+package serviceaccount
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt/v5"
+	"idm/inner/common"
+	"idm/inner/web"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	keyPrefix       = "idm_"
+	keyPrefixLength = len(keyPrefix) + 8
+)
+
+type Service struct {
+	repo      Repo
+	validator Validator
+	now       func() time.Time
+}
+
+type Repo interface {
+	Add(ctx context.Context, account Entity) (int64, error)
+	FindById(ctx context.Context, tenant common.Tenant, id int64) (Entity, error)
+	FindByKeyHash(ctx context.Context, keyHash string) (Entity, error)
+	FindByName(ctx context.Context, tenantId, name string) (bool, error)
+	GetAll(ctx context.Context, tenant common.Tenant) ([]Entity, error)
+	UpdateKey(ctx context.Context, tenant common.Tenant, id int64, keyPrefix, keyHash string) (bool, error)
+	Delete(ctx context.Context, tenant common.Tenant, id int64) error
+}
+
+type Validator interface {
+	Validate(request any) error
+}
+
+func NewService(repo Repo, validator Validator) *Service {
+	return &Service{repo: repo, validator: validator, now: time.Now}
+}
+
+func (s *Service) Create(ctx context.Context, tenant common.Tenant, request CreateRequest) (KeyResponse, error) {
+	if err := s.validator.Validate(request); err != nil {
+		return KeyResponse{}, &common.RequestValidationError{Massage: err.Error()}
+	}
+	tenantId, err := tenant.ForWrite()
+	if err != nil {
+		return KeyResponse{}, err
+	}
+	if request.ExpiresAt != nil && !request.ExpiresAt.After(s.now()) {
+		return KeyResponse{}, &common.RequestValidationError{Massage: "expires_at must be in the future"}
+	}
+	isExists, err := s.repo.FindByName(ctx, tenantId, request.Name)
+	if err != nil {
+		return KeyResponse{}, fmt.Errorf("service account service: create: error checking exists service account: %w", err)
+	}
+	if isExists {
+		return KeyResponse{}, &common.AlreadyExistsError{Massage: fmt.Sprintf("service account with name %s already exists", request.Name)}
+	}
+	apiKey, err := generateKey()
+	if err != nil {
+		return KeyResponse{}, fmt.Errorf("service account service: create: %w", err)
+	}
+	entity := request.toEntity(tenantId)
+	entity.KeyPrefix = apiKey[:keyPrefixLength]
+	entity.KeyHash = hashKey(apiKey)
+	id, err := s.repo.Add(ctx, entity)
+	if err != nil {
+		return KeyResponse{}, fmt.Errorf("service account service: create: error adding service account: %w", err)
+	}
+	return KeyResponse{Id: id, ApiKey: apiKey}, nil
+}
+
+func (s *Service) GetAll(ctx context.Context, tenant common.Tenant) ([]Response, error) {
+	all, err := s.repo.GetAll(ctx, tenant)
+	if err != nil {
+		return nil, fmt.Errorf("service account service: get all: error to retrieve service accounts: %w", err)
+	}
+	resp := make([]Response, 0, len(all))
+	for _, entity := range all {
+		resp = append(resp, entity.toResponse())
+	}
+	return resp, nil
+}
+
+// RotateKey выпускает новый ключ, старый перестаёт действовать сразу
+func (s *Service) RotateKey(ctx context.Context, tenant common.Tenant, req IdRequest) (KeyResponse, error) {
+	if err := s.validator.Validate(req); err != nil {
+		return KeyResponse{}, &common.RequestValidationError{Massage: err.Error()}
+	}
+	apiKey, err := generateKey()
+	if err != nil {
+		return KeyResponse{}, fmt.Errorf("service account service: rotate key: %w", err)
+	}
+	isUpdated, err := s.repo.UpdateKey(ctx, tenant, req.Id, apiKey[:keyPrefixLength], hashKey(apiKey))
+	if err != nil {
+		return KeyResponse{}, fmt.Errorf("service account service: rotate key: error updating key: id=%d: %w", req.Id, err)
+	}
+	if !isUpdated {
+		return KeyResponse{}, &common.NotFoundError{Massage: fmt.Sprintf("service account service: rotate key: "+
+			"service account not found: id=%d", req.Id)}
+	}
+	return KeyResponse{Id: req.Id, ApiKey: apiKey}, nil
+}
+
+func (s *Service) Delete(ctx context.Context, tenant common.Tenant, req IdRequest) error {
+	if err := s.validator.Validate(req); err != nil {
+		return &common.RequestValidationError{Massage: err.Error()}
+	}
+	if err := s.repo.Delete(ctx, tenant, req.Id); err != nil {
+		return fmt.Errorf("service account service: delete: error deleting service account with id %d: %w", req.Id, err)
+	}
+	return nil
+}
+
+// Authenticate реализует web.ApiKeyAuthenticator
+func (s *Service) Authenticate(ctx context.Context, apiKey string) (*web.IdmClaims, error) {
+	if !strings.HasPrefix(apiKey, keyPrefix) || len(apiKey) <= keyPrefixLength {
+		return nil, web.ErrApiKeyInvalid
+	}
+	account, err := s.repo.FindByKeyHash(ctx, hashKey(apiKey))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, web.ErrApiKeyInvalid
+		}
+		return nil, fmt.Errorf("service account service: authenticate: %w", err)
+	}
+	if account.isExpired(s.now()) {
+		return nil, web.ErrApiKeyExpired
+	}
+	claims := &web.IdmClaims{
+		RealmAccess:       web.RealmAccessClaims{Roles: account.Roles},
+		Scope:             strings.Join(account.Scopes, " "),
+		PreferredUsername: account.Name,
+		TenantId:          account.TenantId,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:   web.ApiKeyIssuer,
+			Subject:  "service-account:" + strconv.FormatInt(account.Id, 10),
+			IssuedAt: jwt.NewNumericDate(account.UpdatedAt),
+		},
+	}
+	if account.ExpiresAt != nil {
+		claims.ExpiresAt = jwt.NewNumericDate(*account.ExpiresAt)
+	}
+	return claims, nil
+}
+
+// generateKey возвращает ключ вида idm_<43 символа base64url>, 256 бит случайных данных
+func generateKey() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", fmt.Errorf("error generating api key: %w", err)
+	}
+	return keyPrefix + base64.RawURLEncoding.EncodeToString(secret), nil
+}
+
+// hashKey хранить соль не нужно: ключ содержит 256 бит энтропии, перебор по хешу невозможен
+func hashKey(apiKey string) string {
+	sum := sha256.Sum256([]byte(apiKey))
+	return hex.EncodeToString(sum[:])
+}
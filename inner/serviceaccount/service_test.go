@@ -0,0 +1,190 @@
+package serviceaccount
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"idm/inner/common"
+	"idm/inner/validator"
+	"idm/inner/web"
+	"strings"
+	"testing"
+	"time"
+)
+
+type MockRepo struct {
+	mock.Mock
+}
+
+func (m *MockRepo) Add(ctx context.Context, account Entity) (int64, error) {
+	args := m.Called(account)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockRepo) FindById(ctx context.Context, tenant common.Tenant, id int64) (Entity, error) {
+	args := m.Called(id)
+	return args.Get(0).(Entity), args.Error(1)
+}
+
+func (m *MockRepo) FindByKeyHash(ctx context.Context, keyHash string) (Entity, error) {
+	args := m.Called(keyHash)
+	return args.Get(0).(Entity), args.Error(1)
+}
+
+func (m *MockRepo) FindByName(ctx context.Context, tenantId, name string) (bool, error) {
+	args := m.Called(tenantId, name)
+	return args.Get(0).(bool), args.Error(1)
+}
+
+func (m *MockRepo) GetAll(ctx context.Context, tenant common.Tenant) ([]Entity, error) {
+	args := m.Called(tenant)
+	return args.Get(0).([]Entity), args.Error(1)
+}
+
+func (m *MockRepo) UpdateKey(ctx context.Context, tenant common.Tenant, id int64, keyPrefix, keyHash string) (bool, error) {
+	args := m.Called(id, keyPrefix, keyHash)
+	return args.Get(0).(bool), args.Error(1)
+}
+
+func (m *MockRepo) Delete(ctx context.Context, tenant common.Tenant, id int64) error {
+	args := m.Called(id)
+	return args.Error(0)
+}
+
+var testTenant = common.SingleTenant("acme")
+
+func TestCreate(t *testing.T) {
+	ctx := context.Background()
+	t.Run("should store only hash of generated key", func(t *testing.T) {
+		a := assert.New(t)
+		repo := new(MockRepo)
+		srv := NewService(repo, validator.New())
+		repo.On("FindByName", "acme", "hr-feed").Return(false, nil)
+		var stored Entity
+		repo.On("Add", mock.AnythingOfType("Entity")).Run(func(args mock.Arguments) {
+			stored = args.Get(0).(Entity)
+		}).Return(int64(7), nil)
+		got, err := srv.Create(ctx, testTenant, CreateRequest{Name: "hr-feed", Roles: []string{web.IdmUser}, Scopes: []string{"idm.employees.write"}})
+		a.NoError(err)
+		a.Equal(int64(7), got.Id)
+		a.True(strings.HasPrefix(got.ApiKey, "idm_"))
+		a.Equal(hashKey(got.ApiKey), stored.KeyHash)
+		a.NotContains(stored.KeyHash, got.ApiKey)
+		a.Equal(got.ApiKey[:keyPrefixLength], stored.KeyPrefix)
+		a.Equal([]string{"idm.employees.write"}, []string(stored.Scopes))
+		a.Equal("acme", stored.TenantId)
+	})
+	t.Run("should require single tenant", func(t *testing.T) {
+		a := assert.New(t)
+		repo := new(MockRepo)
+		srv := NewService(repo, validator.New())
+		_, err := srv.Create(ctx, common.AllTenants(), CreateRequest{Name: "hr-feed"})
+		var reqErr *common.RequestValidationError
+		a.True(errors.As(err, &reqErr))
+		repo.AssertNotCalled(t, "Add", mock.Anything)
+	})
+	t.Run("should return already exists", func(t *testing.T) {
+		a := assert.New(t)
+		repo := new(MockRepo)
+		srv := NewService(repo, validator.New())
+		repo.On("FindByName", "acme", "hr-feed").Return(true, nil)
+		_, err := srv.Create(ctx, testTenant, CreateRequest{Name: "hr-feed"})
+		var existsErr *common.AlreadyExistsError
+		a.True(errors.As(err, &existsErr))
+		repo.AssertNotCalled(t, "Add", mock.Anything)
+	})
+	t.Run("should reject unknown role", func(t *testing.T) {
+		a := assert.New(t)
+		srv := NewService(new(MockRepo), validator.New())
+		_, err := srv.Create(ctx, testTenant, CreateRequest{Name: "hr-feed", Roles: []string{"ROOT"}})
+		var reqErr *common.RequestValidationError
+		a.True(errors.As(err, &reqErr))
+	})
+	t.Run("should reject expiry in the past", func(t *testing.T) {
+		a := assert.New(t)
+		srv := NewService(new(MockRepo), validator.New())
+		past := time.Now().Add(-time.Hour)
+		_, err := srv.Create(ctx, testTenant, CreateRequest{Name: "hr-feed", ExpiresAt: &past})
+		var reqErr *common.RequestValidationError
+		a.True(errors.As(err, &reqErr))
+	})
+}
+
+func TestRotateKey(t *testing.T) {
+	ctx := context.Background()
+	t.Run("should return new key", func(t *testing.T) {
+		a := assert.New(t)
+		repo := new(MockRepo)
+		srv := NewService(repo, validator.New())
+		repo.On("UpdateKey", int64(1), mock.Anything, mock.Anything).Return(true, nil)
+		got, err := srv.RotateKey(ctx, testTenant, IdRequest{Id: 1})
+		a.NoError(err)
+		a.True(strings.HasPrefix(got.ApiKey, "idm_"))
+		call := repo.Calls[0]
+		a.Equal(hashKey(got.ApiKey), call.Arguments.Get(2))
+	})
+	t.Run("should return not found", func(t *testing.T) {
+		a := assert.New(t)
+		repo := new(MockRepo)
+		srv := NewService(repo, validator.New())
+		repo.On("UpdateKey", int64(1), mock.Anything, mock.Anything).Return(false, nil)
+		_, err := srv.RotateKey(ctx, testTenant, IdRequest{Id: 1})
+		var notFoundErr *common.NotFoundError
+		a.True(errors.As(err, &notFoundErr))
+	})
+}
+
+func TestAuthenticate(t *testing.T) {
+	ctx := context.Background()
+	apiKey, err := generateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Run("should map account to claims", func(t *testing.T) {
+		a := assert.New(t)
+		repo := new(MockRepo)
+		srv := NewService(repo, validator.New())
+		expires := time.Now().Add(time.Hour)
+		repo.On("FindByKeyHash", hashKey(apiKey)).Return(Entity{
+			Id:        3,
+			TenantId:  "acme",
+			Name:      "hr-feed",
+			Roles:     []string{web.IdmAdmin},
+			ExpiresAt: &expires,
+		}, nil)
+		claims, err := srv.Authenticate(ctx, apiKey)
+		a.NoError(err)
+		a.Equal([]string{web.IdmAdmin}, claims.RealmAccess.Roles)
+		a.Equal("service-account:3", claims.Subject)
+		a.Equal(web.ApiKeyIssuer, claims.Issuer)
+		a.Equal("hr-feed", claims.PreferredUsername)
+		a.Equal("acme", claims.TenantId)
+	})
+	t.Run("should reject unknown key", func(t *testing.T) {
+		a := assert.New(t)
+		repo := new(MockRepo)
+		srv := NewService(repo, validator.New())
+		repo.On("FindByKeyHash", hashKey(apiKey)).Return(Entity{}, sql.ErrNoRows)
+		_, err := srv.Authenticate(ctx, apiKey)
+		a.ErrorIs(err, web.ErrApiKeyInvalid)
+	})
+	t.Run("should reject malformed key without lookup", func(t *testing.T) {
+		a := assert.New(t)
+		repo := new(MockRepo)
+		srv := NewService(repo, validator.New())
+		_, err := srv.Authenticate(ctx, "not-a-key")
+		a.ErrorIs(err, web.ErrApiKeyInvalid)
+		repo.AssertNotCalled(t, "FindByKeyHash", mock.Anything)
+	})
+	t.Run("should reject expired key", func(t *testing.T) {
+		a := assert.New(t)
+		repo := new(MockRepo)
+		srv := NewService(repo, validator.New())
+		expired := time.Now().Add(-time.Minute)
+		repo.On("FindByKeyHash", hashKey(apiKey)).Return(Entity{Id: 3, ExpiresAt: &expired}, nil)
+		_, err := srv.Authenticate(ctx, apiKey)
+		a.ErrorIs(err, web.ErrApiKeyExpired)
+	})
+}
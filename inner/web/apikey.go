@@ -0,0 +1,54 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"github.com/gofiber/fiber/v3"
+	"github.com/golang-jwt/jwt/v5"
+	"go.uber.org/zap"
+	"idm/inner/common"
+)
+
+const (
+	ApiKeyHeader = "X-API-Key"
+	// ApiKeyIssuer значение "iss" в claims сервисных учётных записей
+	ApiKeyIssuer = "idm:service-account"
+)
+
+var (
+	ErrApiKeyInvalid = errors.New("invalid API key")
+	ErrApiKeyExpired = errors.New("API key expired")
+)
+
+// ApiKeyAuthenticator проверяет API ключ сервисной учётной записи и возвращает claims того же вида,
+// что и у пользователей Keycloak, чтобы обработчики не различали способы аутентификации.
+type ApiKeyAuthenticator interface {
+	Authenticate(ctx context.Context, apiKey string) (*IdmClaims, error)
+}
+
+// ApiKeyMiddleware аутентифицирует запросы с заголовком X-API-Key.
+// Запросы без заголовка передаются дальше, в AuthMiddleware.
+func ApiKeyMiddleware(authenticator ApiKeyAuthenticator, logger *common.Logger) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		apiKey := c.Get(ApiKeyHeader)
+		if apiKey == "" {
+			return c.Next()
+		}
+		claims, err := authenticator.Authenticate(c.Context(), apiKey)
+		if err != nil {
+			logger.ErrorCtx(c.Context(), "failed api key autentication", zap.Error(err))
+			if errors.Is(err, ErrApiKeyInvalid) || errors.Is(err, ErrApiKeyExpired) {
+				return common.ErrResponse(c, fiber.StatusUnauthorized, err.Error())
+			}
+			return common.ErrResponse(c, fiber.StatusInternalServerError, "error checking API key")
+		}
+		c.Locals(JwtKey, &jwt.Token{Claims: claims, Valid: true})
+		return c.Next()
+	}
+}
+
+// isAuthenticated сообщает, что запрос уже аутентифицирован предыдущим звеном цепочки
+func isAuthenticated(c fiber.Ctx) bool {
+	token, ok := c.Locals(JwtKey).(*jwt.Token)
+	return ok && token.Valid
+}
@@ -0,0 +1,76 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"github.com/gofiber/fiber/v3"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"idm/inner/common"
+	"net/http/httptest"
+	"testing"
+)
+
+type stubApiKeyAuthenticator map[string]*IdmClaims
+
+func (s stubApiKeyAuthenticator) Authenticate(_ context.Context, apiKey string) (*IdmClaims, error) {
+	if apiKey == "broken" {
+		return nil, errors.New("db is down")
+	}
+	claims, ok := s[apiKey]
+	if !ok {
+		return nil, ErrApiKeyInvalid
+	}
+	return claims, nil
+}
+
+func TestApiKeyMiddleware(t *testing.T) {
+	logger := &common.Logger{Logger: zap.NewNop()}
+	cfg := newAuthTestConfig()
+	cfg.JwtSigningMode = SigningModeHmac
+	cfg.JwtHmacSecret = testHmacSecret
+	authenticator := stubApiKeyAuthenticator{
+		"idm_valid": {
+			RealmAccess:      RealmAccessClaims{Roles: []string{IdmUser}},
+			RegisteredClaims: jwt.RegisteredClaims{Issuer: ApiKeyIssuer, Subject: "service-account:1"},
+		},
+	}
+	app := fiber.New()
+	app.Use(ApiKeyMiddleware(authenticator, logger))
+	app.Use(AuthMiddleware(cfg, logger))
+	app.Get("/", func(c fiber.Ctx) error {
+		claims := c.Locals(JwtKey).(*jwt.Token).Claims.(*IdmClaims)
+		return c.SendString(claims.Subject)
+	})
+	tests := []struct {
+		name   string
+		apiKey string
+		bearer bool
+		status int
+	}{
+		{name: "valid api key", apiKey: "idm_valid", status: fiber.StatusOK},
+		{name: "invalid api key", apiKey: "idm_invalid", status: fiber.StatusUnauthorized},
+		{name: "invalid api key is not rescued by jwt", apiKey: "idm_invalid", bearer: true, status: fiber.StatusUnauthorized},
+		{name: "authenticator failure", apiKey: "broken", status: fiber.StatusInternalServerError},
+		{name: "no api key falls through to jwt", bearer: true, status: fiber.StatusOK},
+		{name: "no credentials", status: fiber.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := assert.New(t)
+			req := httptest.NewRequest(fiber.MethodGet, "/", nil)
+			if tt.apiKey != "" {
+				req.Header.Set(ApiKeyHeader, tt.apiKey)
+			}
+			if tt.bearer {
+				token, err := NewHmacTokenMinter(testHmacSecret, "").Mint(newTestClaims())
+				a.NoError(err)
+				req.Header.Set(fiber.HeaderAuthorization, "Bearer "+token)
+			}
+			resp, err := app.Test(req)
+			a.NoError(err)
+			a.Equal(tt.status, resp.StatusCode)
+		})
+	}
+}
@@ -1,10 +1,13 @@
 package web
 
 import (
+	"fmt"
 	"github.com/gofiber/fiber/v3"
 	"github.com/golang-jwt/jwt/v5"
 	"go.uber.org/zap"
 	"idm/inner/common"
+	"sync"
+	"time"
 )
 
 const (
@@ -14,22 +17,134 @@ const (
 )
 
 type IdmClaims struct {
-	RealmAccess RealmAccessClaims `json:"realm_access"`
+	RealmAccess       RealmAccessClaims `json:"realm_access"`
+	AuthorizedParty   string            `json:"azp,omitempty"`
+	PreferredUsername string            `json:"preferred_username,omitempty"`
+	Email             string            `json:"email,omitempty"`
+	EmailVerified     bool              `json:"email_verified,omitempty"`
+	Scope             string            `json:"scope,omitempty"`
+	// TenantId арендатор пользователя, см. TenantMiddleware
+	TenantId string `json:"tenant_id,omitempty"`
+	// SessionId сессия Keycloak, общая для всех токенов одного входа
+	SessionId string `json:"sid,omitempty"`
+	// ResourceAccess роли клиентов Keycloak: resource_access.<client>.roles
+	ResourceAccess map[string]RealmAccessClaims `json:"resource_access,omitempty"`
+	// ClientRoles роли клиента Config.ResourceClient, заполняются при аутентификации
+	ClientRoles []string `json:"-"`
+	// Realm имя издателя токена (Config.IssuerName или TrustedIssuer.Name), заполняется при аутентификации
+	Realm string `json:"-"`
+	// External токен выпущен дополнительным издателем TrustedIssuer, заполняется при аутентификации
+	External bool `json:"-"`
 	jwt.RegisteredClaims
 }
 
+func (c *IdmClaims) GetAuthorizedParty() string {
+	return c.AuthorizedParty
+}
+
 type RealmAccessClaims struct {
 	Roles []string `json:"roles"`
 }
 
-var AuthMiddleware = func(logger *common.Logger) fiber.Handler {
+var AuthMiddleware = func(cfg common.Config, logger *common.Logger) fiber.Handler {
+	handler, err := newAuthHandler(cfg, logger)
+	if err != nil {
+		panic(err.Error())
+	}
+	return handler
+}
+
+// newAuthHandler собирает AuthMiddleware, возвращая ошибку загрузки ключей вместо паники.
+func newAuthHandler(cfg common.Config, logger *common.Logger) (fiber.Handler, error) {
 	config := Config{
-		ContextKey:   JwtKey,
-		ErrorHandler: createJwtErrorHandler(logger),
-		JWKSetURLs:   []string{"http://localhost:9990/realms/idm/protocol/openid-connect/certs"},
-		Claims:       &IdmClaims{},
+		ContextKey:      JwtKey,
+		Filter:          isAuthenticated,
+		ErrorHandler:    createJwtErrorHandler(logger),
+		Claims:          &IdmClaims{},
+		Issuer:          cfg.KeycloakIssuer,
+		Audience:        cfg.KeycloakAudience,
+		AuthorizedParty: cfg.KeycloakClientId,
+		ResourceClient:  cfg.KeycloakResourceClient,
+		Leeway:          cfg.JwtLeeway,
+		IssuerName:      RealmName(cfg.KeycloakIssuer),
+	}
+	if err := setSigningKeys(&config, cfg); err != nil {
+		return nil, err
+	}
+	if cfg.TrustedIssuersFile != "" {
+		issuers, err := LoadTrustedIssuers(cfg.TrustedIssuersFile)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to load trusted issuers: %w", err)
+		}
+		config.Issuers = issuers
+	}
+	if cfg.IntrospectionUrl != "" {
+		config.Introspector = NewIntrospector(IntrospectionConfig{
+			Endpoint:     cfg.IntrospectionUrl,
+			ClientId:     cfg.IntrospectionClientId,
+			ClientSecret: cfg.IntrospectionClientSecret,
+		})
+	}
+	return Build(config)
+}
+
+// lazyAuthRetryInterval минимальный интервал между попытками собрать LazyAuthMiddleware после ошибки
+var lazyAuthRetryInterval = time.Second
+
+// LazyAuthMiddleware создаёт AuthMiddleware при первом запросе, а не при старте.
+// Нужен, когда JWKS публикует само приложение (см. devtoken) и на момент сборки маршрутов он ещё недоступен.
+// Пока ключи недоступны, отвечает 503 и повторяет сборку не чаще раза в lazyAuthRetryInterval.
+func LazyAuthMiddleware(cfg common.Config, logger *common.Logger) fiber.Handler {
+	var mu sync.Mutex
+	var handler fiber.Handler
+	var failedAt time.Time
+	get := func() fiber.Handler {
+		mu.Lock()
+		defer mu.Unlock()
+		if handler != nil || time.Since(failedAt) < lazyAuthRetryInterval {
+			return handler
+		}
+		built, err := newAuthHandler(cfg, logger)
+		if err != nil {
+			logger.Error("auth middleware init failed", zap.Error(err))
+			failedAt = time.Now()
+			return nil
+		}
+		handler = built
+		return handler
+	}
+	return func(c fiber.Ctx) error {
+		h := get()
+		if h == nil {
+			return common.ErrResponse(c, fiber.StatusServiceUnavailable, "authentication keys are unavailable")
+		}
+		return h(c)
+	}
+}
+
+// setSigningKeys выбирает источник ключей проверки подписи по режиму из конфигурации.
+// Режимы pem и hmac не требуют доступа к Keycloak и используются для локальной разработки и тестов.
+func setSigningKeys(config *Config, cfg common.Config) error {
+	var key SigningKey
+	switch cfg.JwtSigningMode {
+	case SigningModePem:
+		var err error
+		key, _, err = LoadPemKey(cfg.JwtKeyFile)
+		if err != nil {
+			return fmt.Errorf("Failed to load JWT signing key: %w", err)
+		}
+	case SigningModeHmac:
+		key = HmacKey(cfg.JwtHmacSecret)
+	default:
+		config.JWKSetURLs = []string{cfg.KeycloakJwkUrl}
+		return nil
+	}
+	if cfg.JwtKeyId != "" {
+		config.SigningKeys = map[string]SigningKey{cfg.JwtKeyId: key}
+		return nil
 	}
-	return New(config)
+	config.SigningKey = key
+	return nil
 }
 
 func createJwtErrorHandler(logger *common.Logger) fiber.ErrorHandler {
@@ -0,0 +1,166 @@
+package web
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"github.com/gofiber/fiber/v3"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"idm/inner/common"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const testHmacSecret = "0123456789abcdef0123456789abcdef"
+
+func newAuthTestApp(cfg common.Config) *fiber.App {
+	logger := &common.Logger{Logger: zap.NewNop()}
+	app := fiber.New()
+	app.Use(AuthMiddleware(cfg, logger))
+	app.Get("/", func(c fiber.Ctx) error {
+		claims := c.Locals(JwtKey).(*jwt.Token).Claims.(*IdmClaims)
+		return c.SendString(claims.RealmAccess.Roles[0])
+	})
+	return app
+}
+
+func newAuthTestConfig() common.Config {
+	return common.Config{
+		KeycloakIssuer:   "http://localhost:9990/realms/idm",
+		KeycloakAudience: "account",
+	}
+}
+
+func writePem(t *testing.T, blockType string, der []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "key.pem")
+	data := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func doAuthRequest(t *testing.T, app *fiber.App, token string) int {
+	t.Helper()
+	req := httptest.NewRequest(fiber.MethodGet, "/", nil)
+	req.Header.Set(fiber.HeaderAuthorization, "Bearer "+token)
+	resp, err := app.Test(req)
+	assert.NoError(t, err)
+	return resp.StatusCode
+}
+
+func TestAuthMiddleware_SigningModes(t *testing.T) {
+	t.Run("hmac mode accepts minted token", func(t *testing.T) {
+		a := assert.New(t)
+		cfg := newAuthTestConfig()
+		cfg.JwtSigningMode = SigningModeHmac
+		cfg.JwtHmacSecret = testHmacSecret
+		token, err := NewHmacTokenMinter(testHmacSecret, "").Mint(newTestClaims())
+		a.NoError(err)
+		a.Equal(fiber.StatusOK, doAuthRequest(t, newAuthTestApp(cfg), token))
+	})
+	t.Run("hmac mode rejects token signed with another secret", func(t *testing.T) {
+		a := assert.New(t)
+		cfg := newAuthTestConfig()
+		cfg.JwtSigningMode = SigningModeHmac
+		cfg.JwtHmacSecret = testHmacSecret
+		token, err := NewHmacTokenMinter("another-secret-another-secret-00", "").Mint(newTestClaims())
+		a.NoError(err)
+		a.Equal(fiber.StatusUnauthorized, doAuthRequest(t, newAuthTestApp(cfg), token))
+	})
+	t.Run("hmac mode with key id rejects token without kid", func(t *testing.T) {
+		a := assert.New(t)
+		cfg := newAuthTestConfig()
+		cfg.JwtSigningMode = SigningModeHmac
+		cfg.JwtHmacSecret = testHmacSecret
+		cfg.JwtKeyId = "dev"
+		app := newAuthTestApp(cfg)
+		withKid, err := NewHmacTokenMinter(testHmacSecret, "dev").Mint(newTestClaims())
+		a.NoError(err)
+		withoutKid, err := NewHmacTokenMinter(testHmacSecret, "").Mint(newTestClaims())
+		a.NoError(err)
+		a.Equal(fiber.StatusOK, doAuthRequest(t, app, withKid))
+		a.Equal(fiber.StatusUnauthorized, doAuthRequest(t, app, withoutKid))
+	})
+	t.Run("pem mode with rsa private key", func(t *testing.T) {
+		a := assert.New(t)
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		a.NoError(err)
+		cfg := newAuthTestConfig()
+		cfg.JwtSigningMode = SigningModePem
+		cfg.JwtKeyFile = writePem(t, "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(key))
+		minter, err := NewPemTokenMinter(cfg.JwtKeyFile, "")
+		a.NoError(err)
+		token, err := minter.Mint(newTestClaims())
+		a.NoError(err)
+		a.Equal(fiber.StatusOK, doAuthRequest(t, newAuthTestApp(cfg), token))
+	})
+	t.Run("pem mode with ec public key", func(t *testing.T) {
+		a := assert.New(t)
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		a.NoError(err)
+		der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+		a.NoError(err)
+		cfg := newAuthTestConfig()
+		cfg.JwtSigningMode = SigningModePem
+		cfg.JwtKeyFile = writePem(t, "PUBLIC KEY", der)
+		token, err := NewSignerTokenMinter(key, jwt.SigningMethodES256.Name, "").Mint(newTestClaims())
+		a.NoError(err)
+		a.Equal(fiber.StatusOK, doAuthRequest(t, newAuthTestApp(cfg), token))
+	})
+	t.Run("pem minter requires private key", func(t *testing.T) {
+		a := assert.New(t)
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		a.NoError(err)
+		path := writePem(t, "RSA PUBLIC KEY", x509.MarshalPKCS1PublicKey(&key.PublicKey))
+		_, err = NewPemTokenMinter(path, "")
+		a.ErrorIs(err, ErrNoPrivateKey)
+	})
+	t.Run("pem mode with missing file panics", func(t *testing.T) {
+		cfg := newAuthTestConfig()
+		cfg.JwtSigningMode = SigningModePem
+		cfg.JwtKeyFile = filepath.Join(t.TempDir(), "missing.pem")
+		assert.Panics(t, func() { newAuthTestApp(cfg) })
+	})
+}
+
+func TestLazyAuthMiddleware(t *testing.T) {
+	a := assert.New(t)
+	interval := lazyAuthRetryInterval
+	lazyAuthRetryInterval = 0
+	t.Cleanup(func() { lazyAuthRetryInterval = interval })
+
+	cfg := newAuthTestConfig()
+	cfg.JwtSigningMode = SigningModePem
+	cfg.JwtKeyFile = filepath.Join(t.TempDir(), "key.pem")
+	app := fiber.New()
+	app.Use(LazyAuthMiddleware(cfg, &common.Logger{Logger: zap.NewNop()}))
+	app.Get("/", func(c fiber.Ctx) error {
+		return c.SendString("ok")
+	})
+
+	// пока ключа нет, middleware не паникует и отвечает 503 на каждый запрос
+	a.Equal(fiber.StatusServiceUnavailable, doAuthRequest(t, app, "token"))
+	a.Equal(fiber.StatusServiceUnavailable, doAuthRequest(t, app, "token"))
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	a.NoError(err)
+	data := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	a.NoError(os.WriteFile(cfg.JwtKeyFile, data, 0o600))
+	minter, err := NewPemTokenMinter(cfg.JwtKeyFile, "")
+	a.NoError(err)
+	token, err := minter.Mint(newTestClaims())
+	a.NoError(err)
+
+	// после появления ключа сборка повторяется и токены проверяются
+	a.Equal(fiber.StatusOK, doAuthRequest(t, app, token))
+	a.Equal(fiber.StatusUnauthorized, doAuthRequest(t, app, "token"))
+}
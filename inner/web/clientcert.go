@@ -0,0 +1,124 @@
+package web
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gofiber/fiber/v3"
+	"github.com/golang-jwt/jwt/v5"
+	"go.uber.org/zap"
+	"idm/inner/common"
+	"net/url"
+	"os"
+	"slices"
+)
+
+// ClientCertIssuer значение "iss" в claims клиентов, аутентифицированных сертификатом
+const ClientCertIssuer = "idm:client-certificate"
+
+var ErrClientCertNotVerified = errors.New("client certificate is not verified")
+
+// CertPrincipal сопоставляет клиентский сертификат с внутренним пользователем.
+// Заданные поля сравниваются с сертификатом, все они должны совпасть.
+type CertPrincipal struct {
+	// Name имя пользователя, попадает в claim "sub"
+	Name string `json:"name"`
+	// Subject полный DN сертификата, например "CN=hr-feed,O=Acme"
+	Subject    string   `json:"subject"`
+	CommonName string   `json:"common_name"`
+	DnsName    string   `json:"dns_name"`
+	Email      string   `json:"email"`
+	Uri        string   `json:"uri"`
+	Roles      []string `json:"roles"`
+}
+
+func (p *CertPrincipal) matches(cert *x509.Certificate) bool {
+	if p.Subject == "" && p.CommonName == "" && p.DnsName == "" && p.Email == "" && p.Uri == "" {
+		return false
+	}
+	if p.Subject != "" && p.Subject != cert.Subject.String() {
+		return false
+	}
+	if p.CommonName != "" && p.CommonName != cert.Subject.CommonName {
+		return false
+	}
+	if p.DnsName != "" && !slices.Contains(cert.DNSNames, p.DnsName) {
+		return false
+	}
+	if p.Email != "" && !slices.Contains(cert.EmailAddresses, p.Email) {
+		return false
+	}
+	if p.Uri != "" && !slices.ContainsFunc(cert.URIs, func(uri *url.URL) bool { return uri.String() == p.Uri }) {
+		return false
+	}
+	return true
+}
+
+func (p *CertPrincipal) toClaims(cert *x509.Certificate) *IdmClaims {
+	return &IdmClaims{
+		RealmAccess:       RealmAccessClaims{Roles: p.Roles},
+		PreferredUsername: p.Name,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    ClientCertIssuer,
+			Subject:   "client-certificate:" + p.Name,
+			NotBefore: jwt.NewNumericDate(cert.NotBefore),
+			ExpiresAt: jwt.NewNumericDate(cert.NotAfter),
+		},
+	}
+}
+
+// LoadCertPrincipals читает JSON массив CertPrincipal
+func LoadCertPrincipals(path string) ([]CertPrincipal, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read certificate principals %s: %w", path, err)
+	}
+	var principals []CertPrincipal
+	if err = json.Unmarshal(data, &principals); err != nil {
+		return nil, fmt.Errorf("parse certificate principals %s: %w", path, err)
+	}
+	for i, principal := range principals {
+		if principal.Name == "" {
+			return nil, fmt.Errorf("certificate principal #%d: name is required", i)
+		}
+	}
+	return principals, nil
+}
+
+// LoadCertPool читает PEM файл с сертификатами удостоверяющих центров клиентов
+func LoadCertPool(path string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read CA bundle %s: %w", path, err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("read CA bundle %s: no certificates found", path)
+	}
+	return pool, nil
+}
+
+// ClientCertMiddleware аутентифицирует запросы по клиентскому сертификату, проверенному при TLS рукопожатии.
+// Запросы без сертификата или с сертификатом, для которого нет CertPrincipal, передаются дальше.
+func ClientCertMiddleware(principals []CertPrincipal, logger *common.Logger) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		state := c.RequestCtx().TLSConnectionState()
+		if state == nil || len(state.PeerCertificates) == 0 {
+			return c.Next()
+		}
+		if len(state.VerifiedChains) == 0 {
+			logger.ErrorCtx(c.Context(), "failed client certificate autentication", zap.Error(ErrClientCertNotVerified))
+			return common.ErrResponse(c, fiber.StatusUnauthorized, ErrClientCertNotVerified.Error())
+		}
+		cert := state.PeerCertificates[0]
+		for i := range principals {
+			if principals[i].matches(cert) {
+				c.Locals(JwtKey, &jwt.Token{Claims: principals[i].toClaims(cert), Valid: true})
+				return c.Next()
+			}
+		}
+		logger.Debug("client certificate is not mapped to a principal", zap.String("subject", cert.Subject.String()))
+		return c.Next()
+	}
+}
@@ -0,0 +1,193 @@
+package web
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"github.com/gofiber/fiber/v3"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"idm/inner/common"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func (c testCert) tlsCertificate() tls.Certificate {
+	return tls.Certificate{Certificate: [][]byte{c.cert.Raw}, PrivateKey: c.key}
+}
+
+func issueTestCert(t *testing.T, template *x509.Certificate, parent *testCert) testCert {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template.SerialNumber = big.NewInt(time.Now().UnixNano())
+	template.NotBefore = time.Now().Add(-time.Minute)
+	template.NotAfter = time.Now().Add(time.Hour)
+	parentCert, parentKey := template, key
+	if parent != nil {
+		parentCert, parentKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parentCert, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return testCert{cert: cert, key: key}
+}
+
+func newTestCA(t *testing.T, name string) testCert {
+	return issueTestCert(t, &x509.Certificate{
+		Subject:               pkix.Name{CommonName: name},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}, nil)
+}
+
+func newClientCert(t *testing.T, ca testCert, cn string, dnsNames ...string) testCert {
+	return issueTestCert(t, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: cn, Organization: []string{"Acme"}},
+		DNSNames:    dnsNames,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, &ca)
+}
+
+func TestCertPrincipal_Matches(t *testing.T) {
+	uri, _ := url.Parse("spiffe://acme/hr-feed")
+	cert := &x509.Certificate{
+		Subject:        pkix.Name{CommonName: "hr-feed", Organization: []string{"Acme"}},
+		DNSNames:       []string{"hr-feed.acme.local"},
+		EmailAddresses: []string{"hr@acme.local"},
+		URIs:           []*url.URL{uri},
+	}
+	tests := []struct {
+		name      string
+		principal CertPrincipal
+		want      bool
+	}{
+		{name: "common name", principal: CertPrincipal{CommonName: "hr-feed"}, want: true},
+		{name: "full subject", principal: CertPrincipal{Subject: "CN=hr-feed,O=Acme"}, want: true},
+		{name: "dns san", principal: CertPrincipal{DnsName: "hr-feed.acme.local"}, want: true},
+		{name: "email san", principal: CertPrincipal{Email: "hr@acme.local"}, want: true},
+		{name: "uri san", principal: CertPrincipal{Uri: "spiffe://acme/hr-feed"}, want: true},
+		{name: "all fields must match", principal: CertPrincipal{CommonName: "hr-feed", DnsName: "other.acme.local"}, want: false},
+		{name: "other common name", principal: CertPrincipal{CommonName: "payroll"}, want: false},
+		{name: "empty rule matches nothing", principal: CertPrincipal{Name: "any"}, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.principal.matches(cert))
+		})
+	}
+}
+
+func TestLoadCertPrincipals(t *testing.T) {
+	a := assert.New(t)
+	path := filepath.Join(t.TempDir(), "principals.json")
+	a.NoError(os.WriteFile(path, []byte(`[{"name": "hr-feed", "common_name": "hr-feed", "roles": ["IDM_USER"]}]`), 0o600))
+	principals, err := LoadCertPrincipals(path)
+	a.NoError(err)
+	a.Equal([]CertPrincipal{{Name: "hr-feed", CommonName: "hr-feed", Roles: []string{IdmUser}}}, principals)
+	a.NoError(os.WriteFile(path, []byte(`[{"common_name": "hr-feed"}]`), 0o600))
+	_, err = LoadCertPrincipals(path)
+	a.ErrorContains(err, "name is required")
+}
+
+func TestClientCertMiddleware(t *testing.T) {
+	ca := newTestCA(t, "clients CA")
+	serverCert := issueTestCert(t, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "idm"},
+		IPAddresses: []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}, &ca)
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	err := os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.cert.Raw}), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientCAs, err := LoadCertPool(caFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	logger := &common.Logger{Logger: zap.NewNop()}
+	cfg := newAuthTestConfig()
+	cfg.JwtSigningMode = SigningModeHmac
+	cfg.JwtHmacSecret = testHmacSecret
+	principals := []CertPrincipal{{Name: "hr-feed", DnsName: "hr-feed.acme.local", Roles: []string{IdmAdmin}}}
+	app := fiber.New()
+	app.Use(ClientCertMiddleware(principals, logger))
+	app.Use(AuthMiddleware(cfg, logger))
+	app.Get("/", func(c fiber.Ctx) error {
+		return c.SendString(c.Locals(JwtKey).(*jwt.Token).Claims.(*IdmClaims).Subject)
+	})
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{serverCert.tlsCertificate()},
+		ClientAuth:   tls.VerifyClientCertIfGiven,
+		ClientCAs:    clientCAs,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() { _ = app.Listener(ln, fiber.ListenConfig{DisableStartupMessage: true}) }()
+	t.Cleanup(func() { _ = app.Shutdown() })
+
+	call := func(t *testing.T, clientCert *testCert) (int, string) {
+		t.Helper()
+		tlsConfig := &tls.Config{RootCAs: clientCAs}
+		if clientCert != nil {
+			tlsConfig.Certificates = []tls.Certificate{clientCert.tlsCertificate()}
+		}
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}}
+		resp, err := client.Get("https://" + ln.Addr().String() + "/")
+		if err != nil {
+			return 0, err.Error()
+		}
+		defer func() { _ = resp.Body.Close() }()
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(body)
+	}
+
+	t.Run("mapped certificate", func(t *testing.T) {
+		cert := newClientCert(t, ca, "hr-feed", "hr-feed.acme.local")
+		status, body := call(t, &cert)
+		assert.Equal(t, fiber.StatusOK, status)
+		assert.Equal(t, "client-certificate:hr-feed", body)
+	})
+	t.Run("unmapped certificate falls through to jwt", func(t *testing.T) {
+		cert := newClientCert(t, ca, "payroll", "payroll.acme.local")
+		status, _ := call(t, &cert)
+		assert.Equal(t, fiber.StatusUnauthorized, status)
+	})
+	t.Run("no certificate falls through to jwt", func(t *testing.T) {
+		status, _ := call(t, nil)
+		assert.Equal(t, fiber.StatusUnauthorized, status)
+	})
+	t.Run("certificate from unknown CA is not accepted", func(t *testing.T) {
+		cert := newClientCert(t, newTestCA(t, "rogue CA"), "hr-feed", "hr-feed.acme.local")
+		status, _ := call(t, &cert)
+		assert.Equal(t, fiber.StatusUnauthorized, status)
+	})
+}
@@ -8,19 +8,38 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 	"log"
 	"reflect"
+	"slices"
 	"strings"
 	"time"
 )
 
 var (
-	ErrJWTMissingOrMalformed = errors.New("missing or malformed JWT")
-	defaultTokenLookup       = "header:" + fiber.HeaderAuthorization
+	ErrJWTMissingOrMalformed     = errors.New("missing or malformed JWT")
+	ErrJWTInvalidIssuer          = errors.New("token has invalid issuer")
+	ErrJWTInvalidAudience        = errors.New("token has invalid audience")
+	ErrJWTInvalidAuthorizedParty = errors.New("token has invalid authorized party")
+	ErrJWTTenantNotAllowed       = errors.New("token tenant is not allowed for its issuer")
+	defaultTokenLookup           = "header:" + fiber.HeaderAuthorization
 )
 
 func New(config ...Config) fiber.Handler {
-	cfg := makeCfg(config)
+	handler, err := Build(config...)
+	if err != nil {
+		panic(err.Error())
+	}
+	return handler
+}
+
+// Build function will create the middleware like New, but will return configuration
+// and key loading errors instead of panicking
+func Build(config ...Config) (fiber.Handler, error) {
+	cfg, err := makeCfg(config)
+	if err != nil {
+		return nil, err
+	}
 
 	extractors := cfg.getExtractors()
+	parserOptions := cfg.parserOptions()
 
 	// Return middleware handler
 	return func(c fiber.Ctx) error {
@@ -48,22 +67,35 @@ func New(config ...Config) fiber.Handler {
 			}
 		}
 
+		if cfg.Introspector != nil && (!cfg.hasKeys() || !looksLikeJwt(auth)) {
+			return cfg.introspect(c, auth)
+		}
+
+		if issuer := cfg.trustedIssuerFor(auth); issuer != nil {
+			return cfg.verifyTrusted(c, issuer, auth)
+		}
+
 		var token *jwt.Token
 
 		if _, ok := cfg.Claims.(jwt.MapClaims); ok {
-			token, err = jwt.Parse(auth, cfg.KeyFunc)
+			token, err = jwt.Parse(auth, cfg.KeyFunc, parserOptions...)
 		} else {
 			t := reflect.ValueOf(cfg.Claims).Type().Elem()
 			claims := reflect.New(t).Interface().(jwt.Claims)
-			token, err = jwt.ParseWithClaims(auth, claims, cfg.KeyFunc)
+			token, err = jwt.ParseWithClaims(auth, claims, cfg.KeyFunc, parserOptions...)
+		}
+		if err == nil && token.Valid {
+			err = checkAuthorizedParty(token.Claims, cfg.AuthorizedParty)
 		}
 		if err == nil && token.Valid {
+			resolveClientRoles(token.Claims, cfg.ResourceClient)
+			setRealm(token.Claims, cfg.IssuerName)
 			// Store user information from token into context.
 			c.Locals(cfg.ContextKey, token)
 			return cfg.SuccessHandler(c)
 		}
-		return cfg.ErrorHandler(c, err)
-	}
+		return cfg.ErrorHandler(c, claimsError(err))
+	}, nil
 }
 
 // Config defines the config for JWT middleware
@@ -131,6 +163,41 @@ type Config struct {
 	// - Timeout refreshes after 10 seconds.
 	// At least one of the following is required: KeyFunc, JWKSetURLs, SigningKeys, or SigningKey.
 	JWKSetURLs []string
+
+	// Issuer is the expected value of the "iss" claim.
+	// Optional. Default: "" (not checked)
+	Issuer string
+
+	// Audience is the value that must be present in the "aud" claim.
+	// Optional. Default: "" (not checked)
+	Audience string
+
+	// AuthorizedParty is the expected value of the "azp" claim.
+	// Optional. Default: "" (not checked)
+	AuthorizedParty string
+
+	// Leeway is the allowed clock skew for the "exp", "nbf" and "iat" checks.
+	// Optional. Default: 0
+	Leeway time.Duration
+
+	// ResourceClient is the client whose roles are taken from the "resource_access" claim.
+	// Optional. Default: "" (client roles are not resolved)
+	ResourceClient string
+
+	// IssuerName is the realm name of the primary issuer, see IdmClaims.Realm.
+	// Optional. Default: ""
+	IssuerName string
+
+	// Issuers are additional trusted issuers with their own JWKS, audience and roles claim.
+	// A token is matched by its "iss" claim, tokens of other issuers are validated with the settings above.
+	// Their tokens are always parsed into IdmClaims.
+	// Optional. Default: nil
+	Issuers []TrustedIssuer
+
+	// Introspector validates opaque (non-JWT) tokens, see RFC 7662.
+	// If no signing keys are configured, all tokens are introspected.
+	// Optional. Default: nil
+	Introspector TokenIntrospector
 }
 
 // SigningKey holds information about the recognized cryptographic keys used to sign JWTs by this program.
@@ -147,7 +214,7 @@ type SigningKey struct {
 
 // makeCfg function will check correctness of supplied configuration
 // and will complement it with default values instead of missing ones
-func makeCfg(config []Config) (cfg Config) {
+func makeCfg(config []Config) (cfg Config, err error) {
 	if len(config) > 0 {
 		cfg = config[0]
 	}
@@ -164,8 +231,8 @@ func makeCfg(config []Config) (cfg Config) {
 			return c.Status(fiber.StatusUnauthorized).SendString("Invalid or expired JWT")
 		}
 	}
-	if cfg.SigningKey.Key == nil && len(cfg.SigningKeys) == 0 && len(cfg.JWKSetURLs) == 0 && cfg.KeyFunc == nil {
-		panic("Fiber: JWT middleware configuration: At least one of the following is required: KeyFunc, JWKSetURLs, SigningKeys, or SigningKey.")
+	if !cfg.hasKeys() && cfg.Introspector == nil && len(cfg.Issuers) == 0 {
+		return cfg, errors.New("Fiber: JWT middleware configuration: At least one of the following is required: KeyFunc, JWKSetURLs, SigningKeys, SigningKey, Issuers or Introspector.")
 	}
 	if cfg.ContextKey == "" {
 		cfg.ContextKey = "user"
@@ -181,7 +248,7 @@ func makeCfg(config []Config) (cfg Config) {
 		}
 	}
 
-	if cfg.KeyFunc == nil {
+	if cfg.KeyFunc == nil && cfg.hasKeys() {
 		if len(cfg.SigningKeys) > 0 || len(cfg.JWKSetURLs) > 0 {
 			var givenKeys map[string]keyfunc.GivenKey
 			if cfg.SigningKeys != nil {
@@ -193,10 +260,9 @@ func makeCfg(config []Config) (cfg Config) {
 				}
 			}
 			if len(cfg.JWKSetURLs) > 0 {
-				var err error
 				cfg.KeyFunc, err = multiKeyfunc(givenKeys, cfg.JWKSetURLs)
 				if err != nil {
-					panic("Failed to create keyfunc from JWK Set URL: " + err.Error())
+					return cfg, fmt.Errorf("Failed to create keyfunc from JWK Set URL: %w", err)
 				}
 			} else {
 				cfg.KeyFunc = keyfunc.NewGiven(givenKeys).Keyfunc
@@ -205,8 +271,12 @@ func makeCfg(config []Config) (cfg Config) {
 			cfg.KeyFunc = signingKeyFunc(cfg.SigningKey)
 		}
 	}
+	cfg.Issuers = slices.Clone(cfg.Issuers)
+	if err = cfg.initTrustedIssuers(); err != nil {
+		return cfg, err
+	}
 
-	return cfg
+	return cfg, nil
 }
 
 func multiKeyfunc(givenKeys map[string]keyfunc.GivenKey, jwkSetURLs []string) (jwt.Keyfunc, error) {
@@ -238,6 +308,107 @@ func keyfuncOptions(givenKeys map[string]keyfunc.GivenKey) keyfunc.Options {
 	}
 }
 
+// hasKeys function will report whether any source of signing keys is configured
+func (cfg *Config) hasKeys() bool {
+	return cfg.SigningKey.Key != nil || len(cfg.SigningKeys) > 0 || len(cfg.JWKSetURLs) > 0 || cfg.KeyFunc != nil
+}
+
+// introspect function will validate an opaque token with the introspection endpoint
+// and store the result in the same form as a parsed JWT.
+// The configured issuer, audience and authorized party are required like in a JWT.
+func (cfg *Config) introspect(c fiber.Ctx, auth string) error {
+	claims, err := cfg.Introspector.Introspect(c.Context(), auth)
+	if err != nil {
+		return cfg.ErrorHandler(c, err)
+	}
+	issuer, audience, authorizedParty := cfg.Issuer, cfg.Audience, cfg.AuthorizedParty
+	resourceClient, realm := cfg.ResourceClient, cfg.IssuerName
+	var trusted *TrustedIssuer
+	for i := range cfg.Issuers {
+		if cfg.Issuers[i].Issuer == claims.Issuer {
+			trusted = &cfg.Issuers[i]
+			issuer, audience, authorizedParty = trusted.Issuer, trusted.Audience, trusted.AuthorizedParty
+			resourceClient, realm = trusted.ResourceClient, trusted.Name
+			break
+		}
+	}
+	if issuer != "" && claims.Issuer != issuer {
+		return cfg.ErrorHandler(c, ErrJWTInvalidIssuer)
+	}
+	if audience != "" && !slices.Contains(claims.Audience, audience) {
+		return cfg.ErrorHandler(c, ErrJWTInvalidAudience)
+	}
+	if err = checkAuthorizedParty(claims, authorizedParty); err != nil {
+		return cfg.ErrorHandler(c, err)
+	}
+	claims.Realm = realm
+	if trusted != nil {
+		if err = trusted.restrict(claims); err != nil {
+			return cfg.ErrorHandler(c, err)
+		}
+	}
+	claims.ResolveClientRoles(resourceClient)
+	c.Locals(cfg.ContextKey, &jwt.Token{Claims: claims, Valid: true})
+	return cfg.SuccessHandler(c)
+}
+
+// resolveClientRoles function will extract roles of the resource client from the claims
+func resolveClientRoles(claims jwt.Claims, client string) {
+	if resolver, ok := claims.(interface{ ResolveClientRoles(client string) }); ok {
+		resolver.ResolveClientRoles(client)
+	}
+}
+
+// setRealm function will store the realm name of the matched issuer in the claims
+func setRealm(claims jwt.Claims, realm string) {
+	if c, ok := claims.(*IdmClaims); ok {
+		c.Realm = realm
+	}
+}
+
+// parserOptions function will build options of the jwt parser
+// from the issuer, audience and leeway settings
+func (cfg *Config) parserOptions() []jwt.ParserOption {
+	options := []jwt.ParserOption{jwt.WithLeeway(cfg.Leeway)}
+	if cfg.Issuer != "" {
+		options = append(options, jwt.WithIssuer(cfg.Issuer))
+	}
+	if cfg.Audience != "" {
+		options = append(options, jwt.WithAudience(cfg.Audience))
+	}
+	return options
+}
+
+// checkAuthorizedParty function will compare the "azp" claim with the expected one
+func checkAuthorizedParty(claims jwt.Claims, expected string) error {
+	if expected == "" {
+		return nil
+	}
+	var azp string
+	switch c := claims.(type) {
+	case jwt.MapClaims:
+		azp, _ = c["azp"].(string)
+	case interface{ GetAuthorizedParty() string }:
+		azp = c.GetAuthorizedParty()
+	}
+	if azp != expected {
+		return ErrJWTInvalidAuthorizedParty
+	}
+	return nil
+}
+
+// claimsError function will replace errors of the claims checks with the distinct ones
+func claimsError(err error) error {
+	switch {
+	case errors.Is(err, jwt.ErrTokenInvalidIssuer):
+		return ErrJWTInvalidIssuer
+	case errors.Is(err, jwt.ErrTokenInvalidAudience):
+		return ErrJWTInvalidAudience
+	default:
+		return err
+	}
+}
+
 type jwtExtractor func(c fiber.Ctx) (string, error)
 
 // getExtractors function will create a slice of functions which will be used
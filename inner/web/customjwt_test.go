@@ -0,0 +1,118 @@
+package web
+
+import (
+	"github.com/gofiber/fiber/v3"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+var testSecret = []byte(testHmacSecret)
+
+func signTestToken(t *testing.T, claims jwt.Claims) string {
+	t.Helper()
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(testSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func newTestClaims() *IdmClaims {
+	return &IdmClaims{
+		RealmAccess:     RealmAccessClaims{Roles: []string{IdmAdmin}},
+		AuthorizedParty: "idm-api",
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    "http://localhost:9990/realms/idm",
+			Audience:  jwt.ClaimStrings{"account"},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+		},
+	}
+}
+
+func newTestJwtApp() *fiber.App {
+	app := fiber.New()
+	app.Use(New(Config{
+		ContextKey: JwtKey,
+		SigningKey: SigningKey{JWTAlg: jwt.SigningMethodHS256.Name, Key: testSecret},
+		Claims:     &IdmClaims{},
+		ErrorHandler: func(c fiber.Ctx, err error) error {
+			return c.Status(fiber.StatusUnauthorized).SendString(err.Error())
+		},
+		Issuer:          "http://localhost:9990/realms/idm",
+		Audience:        "account",
+		AuthorizedParty: "idm-api",
+		Leeway:          time.Minute,
+	}))
+	app.Get("/", func(c fiber.Ctx) error {
+		return c.SendStatus(fiber.StatusOK)
+	})
+	return app
+}
+
+func TestNew_ClaimsValidation(t *testing.T) {
+	tests := []struct {
+		name    string
+		modify  func(claims *IdmClaims)
+		status  int
+		message string
+	}{
+		{
+			name:   "valid token",
+			modify: func(claims *IdmClaims) {},
+			status: fiber.StatusOK,
+		},
+		{
+			name:    "wrong issuer",
+			modify:  func(claims *IdmClaims) { claims.Issuer = "http://evil/realms/idm" },
+			status:  fiber.StatusUnauthorized,
+			message: ErrJWTInvalidIssuer.Error(),
+		},
+		{
+			name:    "wrong audience",
+			modify:  func(claims *IdmClaims) { claims.Audience = jwt.ClaimStrings{"other"} },
+			status:  fiber.StatusUnauthorized,
+			message: ErrJWTInvalidAudience.Error(),
+		},
+		{
+			name:    "wrong authorized party",
+			modify:  func(claims *IdmClaims) { claims.AuthorizedParty = "other-client" },
+			status:  fiber.StatusUnauthorized,
+			message: ErrJWTInvalidAuthorizedParty.Error(),
+		},
+		{
+			name: "expired within leeway",
+			modify: func(claims *IdmClaims) {
+				claims.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-30 * time.Second))
+			},
+			status: fiber.StatusOK,
+		},
+		{
+			name: "expired beyond leeway",
+			modify: func(claims *IdmClaims) {
+				claims.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-2 * time.Minute))
+			},
+			status: fiber.StatusUnauthorized,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := assert.New(t)
+			claims := newTestClaims()
+			tt.modify(claims)
+			req := httptest.NewRequest(fiber.MethodGet, "/", nil)
+			req.Header.Set(fiber.HeaderAuthorization, "Bearer "+signTestToken(t, claims))
+			resp, err := newTestJwtApp().Test(req)
+			a.NoError(err)
+			a.Equal(tt.status, resp.StatusCode)
+			if tt.message != "" {
+				body, err := io.ReadAll(resp.Body)
+				a.NoError(err)
+				a.Equal(tt.message, string(body))
+			}
+		})
+	}
+}
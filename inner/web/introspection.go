@@ -0,0 +1,229 @@
+package web
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt/v5"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrTokenInactive = errors.New("token is not active")
+
+// TokenIntrospector проверяет непрозрачные (не JWT) токены
+type TokenIntrospector interface {
+	Introspect(ctx context.Context, token string) (*IdmClaims, error)
+}
+
+// IntrospectionResponse ответ endpoint'а интроспекции, RFC 7662 section 2.2.
+// realm_access и azp дополнительно возвращает Keycloak.
+type IntrospectionResponse struct {
+	Active            bool                         `json:"active"`
+	Scope             string                       `json:"scope"`
+	ClientId          string                       `json:"client_id"`
+	Username          string                       `json:"username"`
+	PreferredUsername string                       `json:"preferred_username"`
+	Email             string                       `json:"email"`
+	EmailVerified     bool                         `json:"email_verified"`
+	Exp               int64                        `json:"exp"`
+	Iat               int64                        `json:"iat"`
+	Nbf               int64                        `json:"nbf"`
+	Sub               string                       `json:"sub"`
+	Aud               jwt.ClaimStrings             `json:"aud"`
+	Iss               string                       `json:"iss"`
+	Jti               string                       `json:"jti"`
+	Sid               string                       `json:"sid"`
+	Azp               string                       `json:"azp"`
+	RealmAccess       RealmAccessClaims            `json:"realm_access"`
+	ResourceAccess    map[string]RealmAccessClaims `json:"resource_access"`
+}
+
+func (r *IntrospectionResponse) toClaims() *IdmClaims {
+	claims := &IdmClaims{
+		RealmAccess:       r.RealmAccess,
+		ResourceAccess:    r.ResourceAccess,
+		Scope:             r.Scope,
+		AuthorizedParty:   r.Azp,
+		PreferredUsername: r.PreferredUsername,
+		Email:             r.Email,
+		EmailVerified:     r.EmailVerified,
+		SessionId:         r.Sid,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:   r.Iss,
+			Subject:  r.Sub,
+			Audience: r.Aud,
+			ID:       r.Jti,
+		},
+	}
+	if claims.AuthorizedParty == "" {
+		claims.AuthorizedParty = r.ClientId
+	}
+	if claims.PreferredUsername == "" {
+		claims.PreferredUsername = r.Username
+	}
+	if r.Exp > 0 {
+		claims.ExpiresAt = jwt.NewNumericDate(time.Unix(r.Exp, 0))
+	}
+	if r.Iat > 0 {
+		claims.IssuedAt = jwt.NewNumericDate(time.Unix(r.Iat, 0))
+	}
+	if r.Nbf > 0 {
+		claims.NotBefore = jwt.NewNumericDate(time.Unix(r.Nbf, 0))
+	}
+	return claims
+}
+
+type IntrospectionConfig struct {
+	// Endpoint адрес endpoint'а интроспекции, например .../protocol/openid-connect/token/introspect
+	Endpoint     string
+	ClientId     string
+	ClientSecret string
+	// Client http клиент. Optional. Default: клиент с таймаутом 5 секунд
+	Client *http.Client
+}
+
+type cachedIntrospection struct {
+	claims    *IdmClaims
+	expiresAt time.Time
+}
+
+// Introspector вызывает endpoint интроспекции и кэширует активные токены до истечения их срока жизни.
+// Неактивные токены и токены без exp не кэшируются. Кэш хранит собственную копию claims
+// и на каждый вызов отдаёт новую: middleware дополняет claims данными запроса (ClientRoles, Realm).
+type Introspector struct {
+	cfg       IntrospectionConfig
+	mu        sync.Mutex
+	cache     map[[sha256.Size]byte]cachedIntrospection
+	nextSweep time.Time
+	now       func() time.Time
+}
+
+const introspectionSweepInterval = time.Minute
+
+func NewIntrospector(cfg IntrospectionConfig) *Introspector {
+	if cfg.Client == nil {
+		cfg.Client = &http.Client{Timeout: 5 * time.Second}
+	}
+	return &Introspector{
+		cfg:   cfg,
+		cache: make(map[[sha256.Size]byte]cachedIntrospection),
+		now:   time.Now,
+	}
+}
+
+func (i *Introspector) Introspect(ctx context.Context, token string) (*IdmClaims, error) {
+	key := sha256.Sum256([]byte(token))
+	if claims, ok := i.cached(key); ok {
+		return claims.clone(), nil
+	}
+	response, err := i.call(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	if !response.Active {
+		return nil, ErrTokenInactive
+	}
+	claims := response.toClaims()
+	if claims.ExpiresAt != nil {
+		if !claims.ExpiresAt.After(i.now()) {
+			return nil, ErrTokenInactive
+		}
+		i.store(key, claims.clone())
+	}
+	return claims, nil
+}
+
+func (i *Introspector) call(ctx context.Context, token string) (*IntrospectionResponse, error) {
+	form := url.Values{}
+	form.Set("token", token)
+	form.Set("token_type_hint", "access_token")
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, i.cfg.Endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("token introspection: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if i.cfg.ClientId != "" {
+		req.SetBasicAuth(url.QueryEscape(i.cfg.ClientId), url.QueryEscape(i.cfg.ClientSecret))
+	}
+	resp, err := i.cfg.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("token introspection: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("token introspection: unexpected status %d", resp.StatusCode)
+	}
+	var response IntrospectionResponse
+	if err = json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("token introspection: decode response: %w", err)
+	}
+	return &response, nil
+}
+
+func (i *Introspector) cached(key [sha256.Size]byte) (*IdmClaims, bool) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	entry, ok := i.cache[key]
+	if !ok {
+		return nil, false
+	}
+	if !i.now().Before(entry.expiresAt) {
+		delete(i.cache, key)
+		return nil, false
+	}
+	return entry.claims, true
+}
+
+func (i *Introspector) store(key [sha256.Size]byte, claims *IdmClaims) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	now := i.now()
+	if !now.Before(i.nextSweep) {
+		for k, entry := range i.cache {
+			if !now.Before(entry.expiresAt) {
+				delete(i.cache, k)
+			}
+		}
+		i.nextSweep = now.Add(introspectionSweepInterval)
+	}
+	i.cache[key] = cachedIntrospection{claims: claims, expiresAt: claims.ExpiresAt.Time}
+}
+
+// clone глубокая копия claims: срезы, карты и даты не разделяются с оригиналом
+func (c *IdmClaims) clone() *IdmClaims {
+	copied := *c
+	copied.RealmAccess.Roles = slices.Clone(c.RealmAccess.Roles)
+	copied.ClientRoles = slices.Clone(c.ClientRoles)
+	copied.Audience = slices.Clone(c.Audience)
+	if c.ResourceAccess != nil {
+		copied.ResourceAccess = make(map[string]RealmAccessClaims, len(c.ResourceAccess))
+		for client, access := range c.ResourceAccess {
+			copied.ResourceAccess[client] = RealmAccessClaims{Roles: slices.Clone(access.Roles)}
+		}
+	}
+	copied.ExpiresAt = cloneDate(c.ExpiresAt)
+	copied.IssuedAt = cloneDate(c.IssuedAt)
+	copied.NotBefore = cloneDate(c.NotBefore)
+	return &copied
+}
+
+func cloneDate(date *jwt.NumericDate) *jwt.NumericDate {
+	if date == nil {
+		return nil
+	}
+	copied := *date
+	return &copied
+}
+
+// looksLikeJwt отличает JWT (три сегмента через точку) от непрозрачного токена
+func looksLikeJwt(token string) bool {
+	return strings.Count(token, ".") == 2
+}
@@ -0,0 +1,252 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/gofiber/fiber/v3"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newIntrospectionStub эмулирует endpoint интроспекции Keycloak
+func newIntrospectionStub(t *testing.T, responses map[string]IntrospectionResponse) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	calls := &atomic.Int32{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		clientId, secret, ok := r.BasicAuth()
+		if !ok || clientId != "idm-api" || secret != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		token := r.PostForm.Get("token")
+		if token == "broken" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(responses[token])
+	}))
+	t.Cleanup(server.Close)
+	return server, calls
+}
+
+func TestIntrospector(t *testing.T) {
+	exp := time.Now().Add(time.Hour).Unix()
+	stub, calls := newIntrospectionStub(t, map[string]IntrospectionResponse{
+		"opaque-active": {
+			Active:      true,
+			Sub:         "user-1",
+			ClientId:    "hr-feed",
+			Username:    "hr",
+			Iss:         "http://localhost:9990/realms/idm",
+			Aud:         jwt.ClaimStrings{"account"},
+			Exp:         exp,
+			RealmAccess: RealmAccessClaims{Roles: []string{IdmAdmin}},
+			ResourceAccess: map[string]RealmAccessClaims{
+				"idm-api": {Roles: []string{"employee:read"}},
+				"hr-app":  {Roles: []string{"employee:write"}},
+			},
+		},
+		"opaque-no-exp": {Active: true, Sub: "user-2"},
+		"opaque-other-audience": {
+			Active: true,
+			Iss:    "http://localhost:9990/realms/idm",
+			Aud:    jwt.ClaimStrings{"other"},
+			Exp:    exp,
+		},
+		"opaque-no-issuer": {
+			Active: true,
+			Aud:    jwt.ClaimStrings{"account"},
+			Exp:    exp,
+		},
+		"opaque-no-audience": {
+			Active: true,
+			Iss:    "http://localhost:9990/realms/idm",
+			Exp:    exp,
+		},
+		"opaque-idm-api": {
+			Active:      true,
+			ClientId:    "idm-api",
+			Iss:         "http://localhost:9990/realms/idm",
+			Aud:         jwt.ClaimStrings{"account"},
+			Exp:         exp,
+			RealmAccess: RealmAccessClaims{Roles: []string{IdmUser}},
+		},
+	})
+	newIntrospector := func() *Introspector {
+		return NewIntrospector(IntrospectionConfig{Endpoint: stub.URL, ClientId: "idm-api", ClientSecret: "secret"})
+	}
+	t.Run("maps response into claims", func(t *testing.T) {
+		a := assert.New(t)
+		claims, err := newIntrospector().Introspect(context.Background(), "opaque-active")
+		a.NoError(err)
+		a.Equal("user-1", claims.Subject)
+		a.Equal("hr-feed", claims.AuthorizedParty)
+		a.Equal("hr", claims.PreferredUsername)
+		a.Equal([]string{IdmAdmin}, claims.RealmAccess.Roles)
+		a.Equal(exp, claims.ExpiresAt.Unix())
+	})
+	t.Run("caches active token until expiry", func(t *testing.T) {
+		a := assert.New(t)
+		introspector := newIntrospector()
+		calls.Store(0)
+		for range 3 {
+			_, err := introspector.Introspect(context.Background(), "opaque-active")
+			a.NoError(err)
+		}
+		a.Equal(int32(1), calls.Load())
+		introspector.now = func() time.Time { return time.Unix(exp, 0) }
+		_, err := introspector.Introspect(context.Background(), "opaque-active")
+		a.ErrorIs(err, ErrTokenInactive)
+		a.Equal(int32(2), calls.Load())
+	})
+	t.Run("cached claims are copied for every call", func(t *testing.T) {
+		a := assert.New(t)
+		introspector := newIntrospector()
+		first, err := introspector.Introspect(context.Background(), "opaque-active")
+		a.NoError(err)
+		first.ResolveClientRoles("hr-app")
+		first.Realm = "hr"
+		first.RealmAccess.Roles[0] = IdmUser
+		second, err := introspector.Introspect(context.Background(), "opaque-active")
+		a.NoError(err)
+		a.NotSame(first, second)
+		a.Empty(second.ClientRoles)
+		a.Empty(second.Realm)
+		a.Equal([]string{IdmAdmin}, second.RealmAccess.Roles)
+	})
+	t.Run("concurrent requests with cached token", func(t *testing.T) {
+		introspector := newIntrospector()
+		// токен уже в кэше: все запросы получают claims из одной записи
+		_, err := introspector.Introspect(context.Background(), "opaque-active")
+		assert.NoError(t, err)
+		newApp := func(client, realm string) *fiber.App {
+			app := fiber.New()
+			app.Use(New(Config{
+				ContextKey:     JwtKey,
+				Claims:         &IdmClaims{},
+				Introspector:   introspector,
+				ResourceClient: client,
+				IssuerName:     realm,
+			}))
+			app.Get("/", func(c fiber.Ctx) error {
+				claims := c.Locals(JwtKey).(*jwt.Token).Claims.(*IdmClaims)
+				return c.SendString(claims.Realm + ":" + strings.Join(claims.ClientRoles, ","))
+			})
+			return app
+		}
+		apps := map[string]*fiber.App{
+			"idm:employee:read": newApp("idm-api", "idm"),
+			"hr:employee:write": newApp("hr-app", "hr"),
+		}
+		var wg sync.WaitGroup
+		for want, app := range apps {
+			for range 20 {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					req := httptest.NewRequest(fiber.MethodGet, "/", nil)
+					req.Header.Set(fiber.HeaderAuthorization, "Bearer opaque-active")
+					resp, err := app.Test(req)
+					if !assert.NoError(t, err) {
+						return
+					}
+					body, err := io.ReadAll(resp.Body)
+					assert.NoError(t, err)
+					assert.Equal(t, want, string(body))
+				}()
+			}
+		}
+		wg.Wait()
+	})
+	t.Run("does not cache token without expiry", func(t *testing.T) {
+		a := assert.New(t)
+		introspector := newIntrospector()
+		calls.Store(0)
+		for range 2 {
+			_, err := introspector.Introspect(context.Background(), "opaque-no-exp")
+			a.NoError(err)
+		}
+		a.Equal(int32(2), calls.Load())
+	})
+	t.Run("inactive token", func(t *testing.T) {
+		_, err := newIntrospector().Introspect(context.Background(), "unknown")
+		assert.ErrorIs(t, err, ErrTokenInactive)
+	})
+	t.Run("endpoint failure", func(t *testing.T) {
+		_, err := newIntrospector().Introspect(context.Background(), "broken")
+		assert.ErrorContains(t, err, "unexpected status 500")
+	})
+
+	t.Run("middleware", func(t *testing.T) {
+		cfg := newAuthTestConfig()
+		cfg.JwtSigningMode = SigningModeHmac
+		cfg.JwtHmacSecret = testHmacSecret
+		cfg.IntrospectionUrl = stub.URL
+		cfg.IntrospectionClientId = "idm-api"
+		cfg.IntrospectionClientSecret = "secret"
+		app := newAuthTestApp(cfg)
+		jwtToken, err := NewHmacTokenMinter(testHmacSecret, "").Mint(newTestClaims())
+		assert.NoError(t, err)
+		tests := []struct {
+			name   string
+			token  string
+			status int
+			calls  int32
+		}{
+			{name: "active opaque token", token: "opaque-active", status: fiber.StatusOK, calls: 1},
+			{name: "inactive opaque token", token: "unknown", status: fiber.StatusUnauthorized, calls: 1},
+			{name: "opaque token for other audience", token: "opaque-other-audience", status: fiber.StatusUnauthorized, calls: 1},
+			{name: "opaque token without issuer", token: "opaque-no-issuer", status: fiber.StatusUnauthorized, calls: 1},
+			{name: "opaque token without audience", token: "opaque-no-audience", status: fiber.StatusUnauthorized, calls: 1},
+			{name: "jwt is validated locally", token: jwtToken, status: fiber.StatusOK, calls: 0},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				calls.Store(0)
+				assert.Equal(t, tt.status, doAuthRequest(t, app, tt.token))
+				assert.Equal(t, tt.calls, calls.Load())
+			})
+		}
+	})
+	t.Run("authorized party is checked", func(t *testing.T) {
+		a := assert.New(t)
+		cfg := newAuthTestConfig()
+		cfg.JwtSigningMode = SigningModeHmac
+		cfg.JwtHmacSecret = testHmacSecret
+		cfg.KeycloakClientId = "idm-api"
+		cfg.IntrospectionUrl = stub.URL
+		cfg.IntrospectionClientId = "idm-api"
+		cfg.IntrospectionClientSecret = "secret"
+		app := newAuthTestApp(cfg)
+		a.Equal(fiber.StatusOK, doAuthRequest(t, app, "opaque-idm-api"))
+		a.Equal(fiber.StatusUnauthorized, doAuthRequest(t, app, "opaque-active"))
+	})
+	t.Run("introspection only mode", func(t *testing.T) {
+		a := assert.New(t)
+		app := fiber.New()
+		app.Use(New(Config{
+			ContextKey:   JwtKey,
+			Claims:       &IdmClaims{},
+			Introspector: newIntrospector(),
+		}))
+		app.Get("/", func(c fiber.Ctx) error {
+			return c.SendString(c.Locals(JwtKey).(*jwt.Token).Claims.(*IdmClaims).Subject)
+		})
+		a.Equal(fiber.StatusOK, doAuthRequest(t, app, "opaque-active"))
+		a.Equal(fiber.StatusUnauthorized, doAuthRequest(t, app, "unknown"))
+	})
+}
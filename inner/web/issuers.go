@@ -0,0 +1,179 @@
+package web
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/gofiber/fiber/v3"
+	"github.com/golang-jwt/jwt/v5"
+	"os"
+	"slices"
+	"strings"
+)
+
+// DefaultRolesClaim путь к ролям в токенах Keycloak
+const DefaultRolesClaim = "realm_access.roles"
+
+// TrustedIssuer дополнительный издатель токенов, например отдельный realm Keycloak для партнёров.
+// Токены выбираются по claim "iss" и проверяются ключами, аудиторией и azp своего издателя.
+// Издателю доверяются только роли из Roles и арендаторы из Tenants.
+type TrustedIssuer struct {
+	// Name имя realm, доступно обработчикам как IdmClaims.Realm. По умолчанию последний сегмент Issuer
+	Name            string `json:"name"`
+	Issuer          string `json:"issuer"`
+	JwksUrl         string `json:"jwks_url"`
+	Audience        string `json:"audience"`
+	AuthorizedParty string `json:"authorized_party"`
+	// ResourceClient клиент, роли которого читаются из resource_access
+	ResourceClient string `json:"resource_client"`
+	// RolesClaim путь к массиву ролей через точку. По умолчанию realm_access.roles
+	RolesClaim string `json:"roles_claim"`
+	// Roles realm роли, которые принимаются от издателя, остальные роли токена отбрасываются.
+	// IdmSuperAdmin от дополнительного издателя не принимается
+	Roles []string `json:"roles"`
+	// Tenants арендаторы, которые может указать claim "tenant_id" токена издателя
+	Tenants []string `json:"tenants"`
+
+	keyFunc jwt.Keyfunc
+	options []jwt.ParserOption
+}
+
+// LoadTrustedIssuers читает JSON массив TrustedIssuer
+func LoadTrustedIssuers(path string) ([]TrustedIssuer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read trusted issuers %s: %w", path, err)
+	}
+	var issuers []TrustedIssuer
+	if err = json.Unmarshal(data, &issuers); err != nil {
+		return nil, fmt.Errorf("parse trusted issuers %s: %w", path, err)
+	}
+	for i := range issuers {
+		issuer := &issuers[i]
+		if issuer.Issuer == "" || issuer.JwksUrl == "" || issuer.Audience == "" || len(issuer.Tenants) == 0 {
+			return nil, fmt.Errorf("trusted issuer #%d: issuer, jwks_url, audience and tenants are required", i)
+		}
+		if slices.Contains(issuer.Roles, IdmSuperAdmin) {
+			return nil, fmt.Errorf("trusted issuer #%d: role %s is not allowed", i, IdmSuperAdmin)
+		}
+		if issuer.Name == "" {
+			issuer.Name = RealmName(issuer.Issuer)
+		}
+	}
+	return issuers, nil
+}
+
+// RealmName возвращает имя realm из адреса издателя: http://host/realms/staff -> staff
+func RealmName(issuer string) string {
+	issuer = strings.TrimRight(issuer, "/")
+	return issuer[strings.LastIndex(issuer, "/")+1:]
+}
+
+// trustedIssuerFor function will find the trusted issuer by the unverified "iss" claim.
+// The signature is verified later with the keys of the found issuer.
+func (cfg *Config) trustedIssuerFor(auth string) *TrustedIssuer {
+	if len(cfg.Issuers) == 0 {
+		return nil
+	}
+	var claims jwt.RegisteredClaims
+	if _, _, err := jwt.NewParser().ParseUnverified(auth, &claims); err != nil {
+		return nil
+	}
+	for i := range cfg.Issuers {
+		if cfg.Issuers[i].Issuer == claims.Issuer {
+			return &cfg.Issuers[i]
+		}
+	}
+	return nil
+}
+
+// verifyTrusted function will validate the token of the trusted issuer
+// with its own keys, audience and authorized party
+func (cfg *Config) verifyTrusted(c fiber.Ctx, issuer *TrustedIssuer, auth string) error {
+	claims := &IdmClaims{}
+	token, err := jwt.ParseWithClaims(auth, claims, issuer.keyFunc, issuer.options...)
+	if err == nil && token.Valid {
+		err = checkAuthorizedParty(claims, issuer.AuthorizedParty)
+	}
+	if err == nil && token.Valid && issuer.RolesClaim != DefaultRolesClaim {
+		claims.RealmAccess.Roles, err = rolesFromClaim(auth, issuer.RolesClaim)
+	}
+	if err == nil && token.Valid {
+		err = issuer.restrict(claims)
+	}
+	if err != nil || !token.Valid {
+		return cfg.ErrorHandler(c, claimsError(err))
+	}
+	claims.ResolveClientRoles(issuer.ResourceClient)
+	c.Locals(cfg.ContextKey, token)
+	return cfg.SuccessHandler(c)
+}
+
+// restrict function will check the tenant of the token against the allowed tenants
+// and drop the realm roles the issuer is not trusted with
+func (issuer *TrustedIssuer) restrict(claims *IdmClaims) error {
+	if !slices.Contains(issuer.Tenants, claims.HomeTenant()) {
+		return ErrJWTTenantNotAllowed
+	}
+	claims.RealmAccess.Roles = slices.DeleteFunc(claims.RealmAccess.Roles, func(role string) bool {
+		return role == IdmSuperAdmin || !slices.Contains(issuer.Roles, role)
+	})
+	claims.Realm = issuer.Name
+	claims.External = true
+	return nil
+}
+
+// initTrustedIssuers function will create key functions and parser options of the trusted issuers
+func (cfg *Config) initTrustedIssuers() error {
+	for i := range cfg.Issuers {
+		issuer := &cfg.Issuers[i]
+		keyFunc, err := multiKeyfunc(nil, []string{issuer.JwksUrl})
+		if err != nil {
+			return fmt.Errorf("Failed to create keyfunc for trusted issuer %s: %w", issuer.Issuer, err)
+		}
+		issuer.keyFunc = keyFunc
+		issuer.options = []jwt.ParserOption{
+			jwt.WithLeeway(cfg.Leeway),
+			jwt.WithIssuer(issuer.Issuer),
+			jwt.WithAudience(issuer.Audience),
+		}
+		if issuer.RolesClaim == "" {
+			issuer.RolesClaim = DefaultRolesClaim
+		}
+	}
+	return nil
+}
+
+// rolesFromClaim function will read roles by the dotted path from the token payload
+func rolesFromClaim(auth, path string) ([]string, error) {
+	parts := strings.Split(auth, ".")
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("roles claim %s: %w", path, err)
+	}
+	var value any
+	if err = json.Unmarshal(payload, &value); err != nil {
+		return nil, fmt.Errorf("roles claim %s: %w", path, err)
+	}
+	for _, key := range strings.Split(path, ".") {
+		object, ok := value.(map[string]any)
+		if !ok {
+			return nil, nil
+		}
+		value = object[key]
+	}
+	switch v := value.(type) {
+	case string:
+		return strings.Fields(v), nil
+	case []any:
+		roles := make([]string, 0, len(v))
+		for _, role := range v {
+			if s, ok := role.(string); ok {
+				roles = append(roles, s)
+			}
+		}
+		return roles, nil
+	default:
+		return nil, nil
+	}
+}
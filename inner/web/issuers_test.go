@@ -0,0 +1,205 @@
+package web
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/gofiber/fiber/v3"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"idm/inner/common"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const partnersIssuer = "http://localhost:9990/realms/partners"
+
+// newJwksServer публикует открытый RSA ключ в формате JWKS
+func newJwksServer(t *testing.T, key *rsa.PrivateKey, kid string) *httptest.Server {
+	t.Helper()
+	jwks := map[string]any{"keys": []map[string]string{{
+		"kty": "RSA",
+		"kid": kid,
+		"use": "sig",
+		"alg": jwt.SigningMethodRS256.Name,
+		"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}}}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(jwks)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func newPartnerClaims() jwt.MapClaims {
+	return jwt.MapClaims{
+		"iss":       partnersIssuer,
+		"aud":       "idm-partners",
+		"sub":       "partner-1",
+		"exp":       time.Now().Add(time.Minute).Unix(),
+		"groups":    []string{IdmUser},
+		"tenant_id": "partners",
+	}
+}
+
+func TestAuthMiddleware_TrustedIssuers(t *testing.T) {
+	partnerKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	jwks := newJwksServer(t, partnerKey, "partners-key")
+	issuersFile := filepath.Join(t.TempDir(), "issuers.json")
+	require.NoError(t, os.WriteFile(issuersFile, []byte(`[{
+		"issuer": "`+partnersIssuer+`",
+		"jwks_url": "`+jwks.URL+`",
+		"audience": "idm-partners",
+		"roles_claim": "groups",
+		"roles": ["`+IdmUser+`"],
+		"tenants": ["partners"]
+	}]`), 0o600))
+
+	cfg := newAuthTestConfig()
+	cfg.JwtSigningMode = SigningModeHmac
+	cfg.JwtHmacSecret = testHmacSecret
+	cfg.TrustedIssuersFile = issuersFile
+	logger := &common.Logger{Logger: zap.NewNop()}
+	app := fiber.New()
+	app.Use(AuthMiddleware(cfg, logger))
+	app.Get("/", func(c fiber.Ctx) error {
+		claims, _ := ClaimsFrom(c)
+		return c.SendString(claims.Realm + ":" + strings.Join(claims.RealmAccess.Roles, ","))
+	})
+	app.Get("/staff-only", func(c fiber.Ctx) error {
+		if !Authorize(c, Policy{AnyRoles: []string{IdmAdmin, IdmUser}, Realms: []string{"idm"}}) {
+			return c.SendStatus(fiber.StatusForbidden)
+		}
+		return c.SendStatus(fiber.StatusOK)
+	})
+	app.Get("/primary-only", func(c fiber.Ctx) error {
+		if !Authorize(c, Policy{AnyRoles: []string{IdmAdmin, IdmUser}, Realms: []string{PrimaryRealm}}) {
+			return c.SendStatus(fiber.StatusForbidden)
+		}
+		return c.SendStatus(fiber.StatusOK)
+	})
+	partnerMinter := NewSignerTokenMinter(partnerKey, jwt.SigningMethodRS256.Name, "partners-key")
+	request := func(path, token string) (int, string) {
+		req := httptest.NewRequest(fiber.MethodGet, path, nil)
+		req.Header.Set(fiber.HeaderAuthorization, "Bearer "+token)
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		body := make([]byte, 256)
+		n, _ := resp.Body.Read(body)
+		return resp.StatusCode, string(body[:n])
+	}
+
+	t.Run("primary issuer keeps working", func(t *testing.T) {
+		token, err := NewHmacTokenMinter(testHmacSecret, "").Mint(newTestClaims())
+		require.NoError(t, err)
+		status, body := request("/", token)
+		assert.Equal(t, fiber.StatusOK, status)
+		assert.Equal(t, "idm:"+IdmAdmin, body)
+	})
+	t.Run("trusted issuer with own roles claim", func(t *testing.T) {
+		token, err := partnerMinter.Mint(newPartnerClaims())
+		require.NoError(t, err)
+		status, body := request("/", token)
+		assert.Equal(t, fiber.StatusOK, status)
+		assert.Equal(t, "partners:"+IdmUser, body)
+	})
+	t.Run("trusted issuer roles outside allow-list are dropped", func(t *testing.T) {
+		claims := newPartnerClaims()
+		claims["groups"] = []string{IdmSuperAdmin, IdmAdmin, IdmUser}
+		token, err := partnerMinter.Mint(claims)
+		require.NoError(t, err)
+		status, body := request("/", token)
+		assert.Equal(t, fiber.StatusOK, status)
+		assert.Equal(t, "partners:"+IdmUser, body)
+	})
+	t.Run("trusted issuer tenant outside allow-list is rejected", func(t *testing.T) {
+		for _, tenant := range []any{"acme", nil} {
+			claims := newPartnerClaims()
+			if tenant == nil {
+				delete(claims, "tenant_id")
+			} else {
+				claims["tenant_id"] = tenant
+			}
+			token, err := partnerMinter.Mint(claims)
+			require.NoError(t, err)
+			status, body := request("/", token)
+			assert.Equal(t, fiber.StatusUnauthorized, status)
+			assert.Contains(t, body, ErrJWTTenantNotAllowed.Error())
+		}
+	})
+	t.Run("trusted issuer audience is checked", func(t *testing.T) {
+		claims := newPartnerClaims()
+		claims["aud"] = "account"
+		token, err := partnerMinter.Mint(claims)
+		require.NoError(t, err)
+		status, body := request("/", token)
+		assert.Equal(t, fiber.StatusUnauthorized, status)
+		assert.Contains(t, body, ErrJWTInvalidAudience.Error())
+	})
+	t.Run("trusted issuer rejects token signed by primary key", func(t *testing.T) {
+		token, err := NewHmacTokenMinter(testHmacSecret, "").Mint(newPartnerClaims())
+		require.NoError(t, err)
+		status, _ := request("/", token)
+		assert.Equal(t, fiber.StatusUnauthorized, status)
+	})
+	t.Run("policy restricts realms", func(t *testing.T) {
+		token, err := partnerMinter.Mint(newPartnerClaims())
+		require.NoError(t, err)
+		status, _ := request("/staff-only", token)
+		assert.Equal(t, fiber.StatusForbidden, status)
+		token, err = NewHmacTokenMinter(testHmacSecret, "").Mint(newTestClaims())
+		require.NoError(t, err)
+		status, _ = request("/staff-only", token)
+		assert.Equal(t, fiber.StatusOK, status)
+	})
+	t.Run("primary realm policy rejects trusted issuers", func(t *testing.T) {
+		token, err := partnerMinter.Mint(newPartnerClaims())
+		require.NoError(t, err)
+		status, _ := request("/primary-only", token)
+		assert.Equal(t, fiber.StatusForbidden, status)
+		token, err = NewHmacTokenMinter(testHmacSecret, "").Mint(newTestClaims())
+		require.NoError(t, err)
+		status, _ = request("/primary-only", token)
+		assert.Equal(t, fiber.StatusOK, status)
+	})
+}
+
+func TestLoadTrustedIssuers(t *testing.T) {
+	write := func(t *testing.T, data string) string {
+		path := filepath.Join(t.TempDir(), "issuers.json")
+		require.NoError(t, os.WriteFile(path, []byte(data), 0o600))
+		return path
+	}
+	t.Run("name defaults to realm", func(t *testing.T) {
+		issuers, err := LoadTrustedIssuers(write(t,
+			`[{"issuer": "https://sso.example.com/realms/partners/", "jwks_url": "https://sso.example.com/certs", "audience": "idm", "tenants": ["partners"]}]`))
+		require.NoError(t, err)
+		assert.Equal(t, "partners", issuers[0].Name)
+	})
+	t.Run("audience is required", func(t *testing.T) {
+		_, err := LoadTrustedIssuers(write(t, `[{"issuer": "https://sso.example.com/realms/partners", "jwks_url": "https://sso.example.com/certs"}]`))
+		assert.Error(t, err)
+	})
+	t.Run("tenants are required", func(t *testing.T) {
+		_, err := LoadTrustedIssuers(write(t,
+			`[{"issuer": "https://sso.example.com/realms/partners", "jwks_url": "https://sso.example.com/certs", "audience": "idm"}]`))
+		assert.ErrorContains(t, err, "tenants")
+	})
+	t.Run("super admin role is not allowed", func(t *testing.T) {
+		_, err := LoadTrustedIssuers(write(t, `[{"issuer": "https://sso.example.com/realms/partners", "jwks_url": "https://sso.example.com/certs",
+			"audience": "idm", "tenants": ["partners"], "roles": ["`+IdmSuperAdmin+`"]}]`))
+		assert.ErrorContains(t, err, IdmSuperAdmin)
+	})
+}
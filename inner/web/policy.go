@@ -0,0 +1,104 @@
+package web
+
+import (
+	"github.com/gofiber/fiber/v3"
+	"github.com/golang-jwt/jwt/v5"
+	"slices"
+	"strings"
+)
+
+const (
+	ScopeEmployeesRead  = "idm.employees.read"
+	ScopeEmployeesWrite = "idm.employees.write"
+	ScopeRolesRead      = "idm.roles.read"
+	ScopeRolesWrite     = "idm.roles.write"
+)
+
+// PrimaryRealm в Policy.Realms обозначает основной realm вместе с ключами API и клиентскими сертификатами,
+// то есть всех, кроме дополнительных издателей TrustedIssuer
+const PrimaryRealm = "@primary"
+
+// Policy требования к доступу к маршруту. Доступ разрешён, если у пользователя есть
+// все realm роли из Roles, хотя бы одна realm роль из AnyRoles, scope из Scopes или роль клиента из ClientRoles.
+// Если задан Realms, токен должен быть выпущен одним из этих издателей.
+// Супер-администратору (IdmSuperAdmin) разрешён любой маршрут.
+type Policy struct {
+	// Roles realm роли, которые требуются одновременно
+	Roles []string
+	// AnyRoles realm роли, достаточно любой из них
+	AnyRoles    []string
+	Scopes      []string
+	ClientRoles []string
+	Realms      []string
+}
+
+func (p Policy) Allows(claims *IdmClaims) bool {
+	if len(p.Realms) > 0 && !slices.ContainsFunc(p.Realms, claims.InRealm) {
+		return false
+	}
+	return claims.HasRealmRole(IdmSuperAdmin) ||
+		len(p.Roles) > 0 && claims.HasRealmRoles(p.Roles...) ||
+		slices.ContainsFunc(p.AnyRoles, claims.HasRealmRole) ||
+		slices.ContainsFunc(p.Scopes, claims.HasScope) ||
+		slices.ContainsFunc(p.ClientRoles, claims.HasClientRole)
+}
+
+// Authorize проверяет политику для пользователя, аутентифицированного AuthMiddleware
+func Authorize(ctx fiber.Ctx, policy Policy) bool {
+	claims, ok := ClaimsFrom(ctx)
+	if !ok {
+		return false
+	}
+	return policy.Allows(claims)
+}
+
+// ClaimsFrom возвращает claims пользователя, аутентифицированного любым из middleware
+func ClaimsFrom(ctx fiber.Ctx) (*IdmClaims, bool) {
+	token, ok := ctx.Locals(JwtKey).(*jwt.Token)
+	if !ok {
+		return nil, false
+	}
+	claims, ok := token.Claims.(*IdmClaims)
+	return claims, ok
+}
+
+// InRealm проверяет издателя токена по имени realm или PrimaryRealm
+func (c *IdmClaims) InRealm(realm string) bool {
+	return realm == c.Realm || realm == PrimaryRealm && !c.External
+}
+
+func (c *IdmClaims) HasRealmRole(role string) bool {
+	return slices.Contains(c.RealmAccess.Roles, role)
+}
+
+// HasRealmRoles проверяет, что у пользователя есть все перечисленные realm роли
+func (c *IdmClaims) HasRealmRoles(roles ...string) bool {
+	for _, role := range roles {
+		if !c.HasRealmRole(role) {
+			return false
+		}
+	}
+	return true
+}
+
+// Scopes разбирает claim "scope", RFC 8693 section 4.2
+func (c *IdmClaims) Scopes() []string {
+	return strings.Fields(c.Scope)
+}
+
+func (c *IdmClaims) HasScope(scope string) bool {
+	return slices.Contains(c.Scopes(), scope)
+}
+
+// HasClientRole проверяет роль клиента, выбранного при аутентификации (см. Config.ResourceClient)
+func (c *IdmClaims) HasClientRole(role string) bool {
+	return slices.Contains(c.ClientRoles, role)
+}
+
+// ResolveClientRoles копирует роли клиента из resource_access в ClientRoles
+func (c *IdmClaims) ResolveClientRoles(client string) {
+	if client == "" {
+		return
+	}
+	c.ClientRoles = c.ResourceAccess[client].Roles
+}
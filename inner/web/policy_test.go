@@ -0,0 +1,120 @@
+package web
+
+import (
+	"github.com/gofiber/fiber/v3"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"idm/inner/common"
+	"testing"
+)
+
+func TestPolicy_Allows(t *testing.T) {
+	policy := Policy{
+		Roles:       []string{IdmAdmin},
+		Scopes:      []string{ScopeEmployeesWrite},
+		ClientRoles: []string{IdmAdmin},
+	}
+	tests := []struct {
+		name   string
+		claims *IdmClaims
+		want   bool
+	}{
+		{"realm role", &IdmClaims{RealmAccess: RealmAccessClaims{Roles: []string{IdmAdmin}}}, true},
+		{"scope", &IdmClaims{Scope: "profile " + ScopeEmployeesWrite}, true},
+		{"client role", &IdmClaims{ClientRoles: []string{IdmAdmin}}, true},
+		{"scope is matched exactly", &IdmClaims{Scope: ScopeEmployeesRead + " idm.employees"}, false},
+		{"unresolved client role", &IdmClaims{ResourceAccess: map[string]RealmAccessClaims{"idm-api": {Roles: []string{IdmAdmin}}}}, false},
+		{"super admin", &IdmClaims{RealmAccess: RealmAccessClaims{Roles: []string{IdmSuperAdmin}}}, true},
+		{"no grants", &IdmClaims{RealmAccess: RealmAccessClaims{Roles: []string{IdmUser}}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, policy.Allows(tt.claims))
+		})
+	}
+}
+
+func TestPolicy_RealmRoles(t *testing.T) {
+	// Roles требует все realm роли сразу, как проверки маршрутов до появления политик;
+	// scope и роли клиента - альтернативные способы получить доступ
+	readPolicy := Policy{
+		Roles:       []string{IdmAdmin, IdmUser},
+		Scopes:      []string{ScopeEmployeesRead},
+		ClientRoles: []string{IdmUser},
+	}
+	anyPolicy := Policy{AnyRoles: []string{IdmAdmin, IdmUser}}
+	realm := func(roles ...string) *IdmClaims {
+		return &IdmClaims{RealmAccess: RealmAccessClaims{Roles: roles}}
+	}
+	tests := []struct {
+		name   string
+		policy Policy
+		claims *IdmClaims
+		want   bool
+	}{
+		{"all realm roles", readPolicy, realm(IdmAdmin, IdmUser), true},
+		{"only admin realm role", readPolicy, realm(IdmAdmin), false},
+		{"only user realm role", readPolicy, realm(IdmUser), false},
+		{"scope without realm roles", readPolicy, &IdmClaims{Scope: ScopeEmployeesRead}, true},
+		{"client role without realm roles", readPolicy, &IdmClaims{ClientRoles: []string{IdmUser}}, true},
+		{"any realm role", anyPolicy, realm(IdmUser), true},
+		{"no listed realm role", anyPolicy, realm("offline_access"), false},
+		{"empty policy", Policy{}, realm(IdmAdmin), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.policy.Allows(tt.claims))
+		})
+	}
+}
+
+func TestAuthMiddleware_ScopesAndClientRoles(t *testing.T) {
+	cfg := newAuthTestConfig()
+	cfg.JwtSigningMode = SigningModeHmac
+	cfg.JwtHmacSecret = testHmacSecret
+	cfg.KeycloakResourceClient = "idm-api"
+	logger := &common.Logger{Logger: zap.NewNop()}
+	app := fiber.New()
+	app.Use(AuthMiddleware(cfg, logger))
+	app.Get("/", func(c fiber.Ctx) error {
+		if !Authorize(c, Policy{Scopes: []string{ScopeRolesWrite}, ClientRoles: []string{IdmAdmin}}) {
+			return c.SendStatus(fiber.StatusForbidden)
+		}
+		return c.SendStatus(fiber.StatusOK)
+	})
+	minter := NewHmacTokenMinter(testHmacSecret, "")
+	mint := func(claims *IdmClaims) string {
+		token, err := minter.Mint(claims)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+	t.Run("client credentials token with scope", func(t *testing.T) {
+		claims := newTestClaims()
+		claims.RealmAccess = RealmAccessClaims{}
+		claims.Scope = "profile " + ScopeRolesWrite
+		assert.Equal(t, fiber.StatusOK, doAuthRequest(t, app, mint(claims)))
+	})
+	t.Run("client role of resource client", func(t *testing.T) {
+		claims := newTestClaims()
+		claims.RealmAccess = RealmAccessClaims{}
+		claims.ResourceAccess = map[string]RealmAccessClaims{"idm-api": {Roles: []string{IdmAdmin}}}
+		assert.Equal(t, fiber.StatusOK, doAuthRequest(t, app, mint(claims)))
+	})
+	t.Run("client role of another client is ignored", func(t *testing.T) {
+		claims := newTestClaims()
+		claims.RealmAccess = RealmAccessClaims{}
+		claims.ResourceAccess = map[string]RealmAccessClaims{"account": {Roles: []string{IdmAdmin}}}
+		assert.Equal(t, fiber.StatusForbidden, doAuthRequest(t, app, mint(claims)))
+	})
+	t.Run("client roles are not read from token body", func(t *testing.T) {
+		claims := newTestClaims()
+		claims.RealmAccess = RealmAccessClaims{}
+		claims.ClientRoles = []string{IdmAdmin}
+		assert.Equal(t, fiber.StatusForbidden, doAuthRequest(t, app, mint(claims)))
+	})
+	t.Run("realm role alone is not enough", func(t *testing.T) {
+		assert.Equal(t, fiber.StatusForbidden, doAuthRequest(t, app, mint(newTestClaims())))
+	})
+}
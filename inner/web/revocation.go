@@ -0,0 +1,39 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"github.com/gofiber/fiber/v3"
+	"go.uber.org/zap"
+	"idm/inner/common"
+)
+
+var ErrTokenRevoked = errors.New("token has been revoked")
+
+// RevocationChecker проверяет, не отозван ли токен по jti, сессии (sid) или пользователю (sub)
+type RevocationChecker interface {
+	IsRevoked(ctx context.Context, claims *IdmClaims) (bool, error)
+}
+
+// RevocationMiddleware отклоняет запросы с отозванными токенами.
+// Ставится после всех middleware аутентификации; запросы без пользователя передаются дальше.
+func RevocationMiddleware(checker RevocationChecker, logger *common.Logger) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		claims, ok := ClaimsFrom(c)
+		if !ok {
+			return c.Next()
+		}
+		revoked, err := checker.IsRevoked(c.Context(), claims)
+		if err != nil {
+			// без хранилища отзыва нельзя доверять токену
+			logger.ErrorCtx(c.Context(), "failed revocation check", zap.Error(err))
+			return common.ErrResponse(c, fiber.StatusServiceUnavailable, "revocation check failed")
+		}
+		if revoked {
+			logger.ErrorCtx(c.Context(), "failed autentication", zap.Error(ErrTokenRevoked),
+				zap.String("sub", claims.Subject), zap.String("jti", claims.ID))
+			return common.ErrResponse(c, fiber.StatusUnauthorized, ErrTokenRevoked.Error())
+		}
+		return c.Next()
+	}
+}
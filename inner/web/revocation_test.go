@@ -0,0 +1,62 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"github.com/gofiber/fiber/v3"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"idm/inner/common"
+	"net/http/httptest"
+	"testing"
+)
+
+type stubRevocationChecker struct {
+	revoked map[string]bool
+	err     error
+}
+
+func (s *stubRevocationChecker) IsRevoked(_ context.Context, claims *IdmClaims) (bool, error) {
+	return s.revoked[claims.ID], s.err
+}
+
+func newRevocationTestApp(checker RevocationChecker, claims *IdmClaims) *fiber.App {
+	logger := &common.Logger{Logger: zap.NewNop()}
+	app := fiber.New()
+	app.Use(func(c fiber.Ctx) error {
+		if claims != nil {
+			c.Locals(JwtKey, &jwt.Token{Claims: claims, Valid: true})
+		}
+		return c.Next()
+	})
+	app.Use(RevocationMiddleware(checker, logger))
+	app.Get("/", func(c fiber.Ctx) error {
+		return c.SendStatus(fiber.StatusOK)
+	})
+	return app
+}
+
+func TestRevocationMiddleware(t *testing.T) {
+	checker := &stubRevocationChecker{revoked: map[string]bool{"revoked": true}}
+	tests := []struct {
+		name    string
+		checker RevocationChecker
+		claims  *IdmClaims
+		status  int
+	}{
+		{"active token", checker, &IdmClaims{RegisteredClaims: jwt.RegisteredClaims{ID: "active"}}, fiber.StatusOK},
+		{"revoked token", checker, &IdmClaims{RegisteredClaims: jwt.RegisteredClaims{ID: "revoked"}}, fiber.StatusUnauthorized},
+		{"anonymous request", checker, nil, fiber.StatusOK},
+		{"store failure", &stubRevocationChecker{err: errors.New("connection refused")},
+			&IdmClaims{RegisteredClaims: jwt.RegisteredClaims{ID: "active"}}, fiber.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newRevocationTestApp(tt.checker, tt.claims)
+			resp, err := app.Test(httptest.NewRequest(fiber.MethodGet, "/", nil))
+			assert.NoError(t, err)
+			assert.Equal(t, tt.status, resp.StatusCode)
+		})
+	}
+}
@@ -0,0 +1,139 @@
+package web
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt/v5"
+	"os"
+)
+
+const (
+	SigningModeJwks = "jwks"
+	SigningModePem  = "pem"
+	SigningModeHmac = "hmac"
+)
+
+var ErrNoPrivateKey = errors.New("signing key has no private part")
+
+// LoadPemKey читает PEM файл с открытым ключом, сертификатом или закрытым ключом (RSA, EC, Ed25519).
+// Возвращает ключ для проверки подписи и, если в файле закрытый ключ, ключ для подписи токенов.
+func LoadPemKey(path string) (verify SigningKey, private crypto.Signer, err error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return SigningKey{}, nil, fmt.Errorf("read pem key %s: %w", path, err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return SigningKey{}, nil, fmt.Errorf("read pem key %s: no PEM block found", path)
+	}
+	var key any
+	switch block.Type {
+	case "CERTIFICATE":
+		cert, certErr := x509.ParseCertificate(block.Bytes)
+		if certErr != nil {
+			return SigningKey{}, nil, fmt.Errorf("parse certificate %s: %w", path, certErr)
+		}
+		key = cert.PublicKey
+	case "PUBLIC KEY":
+		key, err = x509.ParsePKIXPublicKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		key, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	default:
+		return SigningKey{}, nil, fmt.Errorf("read pem key %s: unsupported PEM block %q", path, block.Type)
+	}
+	if err != nil {
+		return SigningKey{}, nil, fmt.Errorf("parse pem key %s: %w", path, err)
+	}
+	if signer, ok := key.(crypto.Signer); ok {
+		private = signer
+		key = signer.Public()
+	}
+	alg, err := algorithmFor(key)
+	if err != nil {
+		return SigningKey{}, nil, fmt.Errorf("read pem key %s: %w", path, err)
+	}
+	return SigningKey{JWTAlg: alg, Key: key}, private, nil
+}
+
+// HmacKey возвращает ключ HS256 для общего секрета.
+func HmacKey(secret string) SigningKey {
+	return SigningKey{JWTAlg: jwt.SigningMethodHS256.Name, Key: []byte(secret)}
+}
+
+func algorithmFor(publicKey any) (string, error) {
+	switch key := publicKey.(type) {
+	case *rsa.PublicKey:
+		return jwt.SigningMethodRS256.Name, nil
+	case *ecdsa.PublicKey:
+		switch key.Curve {
+		case elliptic.P256():
+			return jwt.SigningMethodES256.Name, nil
+		case elliptic.P384():
+			return jwt.SigningMethodES384.Name, nil
+		case elliptic.P521():
+			return jwt.SigningMethodES512.Name, nil
+		}
+		return "", fmt.Errorf("unsupported elliptic curve %s", key.Curve.Params().Name)
+	case ed25519.PublicKey:
+		return jwt.SigningMethodEdDSA.Alg(), nil
+	default:
+		return "", fmt.Errorf("unsupported key type %T", publicKey)
+	}
+}
+
+// TokenMinter подписывает токены тем же ключом, которым их проверяет AuthMiddleware в режимах pem и hmac.
+// Предназначен для локальной разработки и тестов без Keycloak.
+type TokenMinter struct {
+	method jwt.SigningMethod
+	key    any
+	kid    string
+}
+
+func NewHmacTokenMinter(secret, kid string) *TokenMinter {
+	return &TokenMinter{
+		method: jwt.SigningMethodHS256,
+		key:    []byte(secret),
+		kid:    kid,
+	}
+}
+
+func NewPemTokenMinter(path, kid string) (*TokenMinter, error) {
+	verify, private, err := LoadPemKey(path)
+	if err != nil {
+		return nil, err
+	}
+	if private == nil {
+		return nil, fmt.Errorf("token minter %s: %w", path, ErrNoPrivateKey)
+	}
+	return NewSignerTokenMinter(private, verify.JWTAlg, kid), nil
+}
+
+func NewSignerTokenMinter(private crypto.Signer, alg, kid string) *TokenMinter {
+	return &TokenMinter{
+		method: jwt.GetSigningMethod(alg),
+		key:    private,
+		kid:    kid,
+	}
+}
+
+// Mint подписывает claims и возвращает компактный JWT.
+func (m *TokenMinter) Mint(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(m.method, claims)
+	if m.kid != "" {
+		token.Header["kid"] = m.kid
+	}
+	return token.SignedString(m.key)
+}
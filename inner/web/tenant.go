@@ -0,0 +1,60 @@
+package web
+
+import (
+	"github.com/gofiber/fiber/v3"
+	"go.uber.org/zap"
+	"idm/inner/common"
+)
+
+const (
+	// IdmSuperAdmin может работать с данными всех арендаторов
+	IdmSuperAdmin = "IDM_SUPER_ADMIN"
+	TenantHeader  = "X-Tenant-ID"
+	TenantKey     = "tenant"
+)
+
+// TenantMiddleware определяет арендатора запроса. Обычные пользователи работают только в арендаторе
+// из claim "tenant_id" (или common.DefaultTenant), заголовок X-Tenant-ID может лишь совпадать с ним.
+// Супер-администратор выбирает арендатора заголовком, без заголовка видит всех арендаторов.
+// Супер-администратором может быть только пользователь основного realm, см. TrustedIssuer.Roles.
+func TenantMiddleware(logger *common.Logger) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		claims, ok := ClaimsFrom(c)
+		if !ok {
+			return c.Next()
+		}
+		header := c.Get(TenantHeader)
+		if claims.HasRealmRole(IdmSuperAdmin) && !claims.External {
+			tenant := common.AllTenants()
+			if header != "" {
+				tenant = common.SingleTenant(header)
+			}
+			c.Locals(TenantKey, tenant)
+			return c.Next()
+		}
+		tenantId := claims.HomeTenant()
+		if header != "" && header != tenantId {
+			logger.ErrorCtx(c.Context(), "tenant mismatch",
+				zap.String("sub", claims.Subject), zap.String("tenant", tenantId), zap.String("requested", header))
+			return common.ErrResponse(c, fiber.StatusForbidden, "access to tenant "+header+" is denied")
+		}
+		c.Locals(TenantKey, common.SingleTenant(tenantId))
+		return c.Next()
+	}
+}
+
+// HomeTenant арендатор пользователя токена: claim "tenant_id", по умолчанию common.DefaultTenant
+func (c *IdmClaims) HomeTenant() string {
+	if c.TenantId == "" {
+		return common.DefaultTenant
+	}
+	return c.TenantId
+}
+
+// TenantFrom возвращает арендатора запроса, определённого TenantMiddleware, по умолчанию common.DefaultTenant
+func TenantFrom(c fiber.Ctx) common.Tenant {
+	if tenant, ok := c.Locals(TenantKey).(common.Tenant); ok {
+		return tenant
+	}
+	return common.SingleTenant(common.DefaultTenant)
+}
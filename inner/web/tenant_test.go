@@ -0,0 +1,68 @@
+package web
+
+import (
+	"github.com/gofiber/fiber/v3"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"idm/inner/common"
+	"io"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+func newTenantTestApp(claims *IdmClaims) *fiber.App {
+	logger := &common.Logger{Logger: zap.NewNop()}
+	app := fiber.New()
+	app.Use(func(c fiber.Ctx) error {
+		if claims != nil {
+			c.Locals(JwtKey, &jwt.Token{Claims: claims, Valid: true})
+		}
+		return c.Next()
+	})
+	app.Use(TenantMiddleware(logger))
+	app.Get("/", func(c fiber.Ctx) error {
+		tenant := TenantFrom(c)
+		return c.SendString(tenant.Id + ":" + strconv.FormatBool(tenant.All))
+	})
+	return app
+}
+
+func TestTenantMiddleware(t *testing.T) {
+	superAdmin := &IdmClaims{RealmAccess: RealmAccessClaims{Roles: []string{IdmSuperAdmin}}}
+	tests := []struct {
+		name   string
+		claims *IdmClaims
+		header string
+		status int
+		tenant string
+	}{
+		{"tenant from claim", &IdmClaims{TenantId: "acme"}, "", fiber.StatusOK, "acme:false"},
+		{"default tenant without claim", &IdmClaims{}, "", fiber.StatusOK, common.DefaultTenant + ":false"},
+		{"header matches claim", &IdmClaims{TenantId: "acme"}, "acme", fiber.StatusOK, "acme:false"},
+		{"header of another tenant", &IdmClaims{TenantId: "acme"}, "globex", fiber.StatusForbidden, ""},
+		{"super admin selects tenant", superAdmin, "globex", fiber.StatusOK, "globex:false"},
+		{"super admin sees all tenants", superAdmin, "", fiber.StatusOK, ":true"},
+		{"super admin of trusted issuer stays in own tenant", &IdmClaims{TenantId: "partners", External: true,
+			RealmAccess: RealmAccessClaims{Roles: []string{IdmSuperAdmin}}}, "", fiber.StatusOK, "partners:false"},
+		{"super admin of trusted issuer cannot select tenant", &IdmClaims{TenantId: "partners", External: true,
+			RealmAccess: RealmAccessClaims{Roles: []string{IdmSuperAdmin}}}, "globex", fiber.StatusForbidden, ""},
+		{"anonymous request", nil, "globex", fiber.StatusOK, common.DefaultTenant + ":false"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(fiber.MethodGet, "/", nil)
+			if tt.header != "" {
+				req.Header.Set(TenantHeader, tt.header)
+			}
+			resp, err := newTenantTestApp(tt.claims).Test(req)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.status, resp.StatusCode)
+			if tt.status == fiber.StatusOK {
+				body, _ := io.ReadAll(resp.Body)
+				assert.Equal(t, tt.tenant, string(body))
+			}
+		})
+	}
+}
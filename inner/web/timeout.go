@@ -0,0 +1,18 @@
+package web
+
+import (
+	"context"
+	"github.com/gofiber/fiber/v3"
+	"time"
+)
+
+// TimeoutMiddleware задаёт срок для контекста запроса (c.Context()). Сервисы и репозитории получают
+// этот контекст, поэтому запросы к базе прерываются по истечении timeout, а контроллеры отвечают 504.
+func TimeoutMiddleware(timeout time.Duration) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		ctx, cancel := context.WithTimeout(c.Context(), timeout)
+		defer cancel()
+		c.SetContext(ctx)
+		return c.Next()
+	}
+}
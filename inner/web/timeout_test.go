@@ -0,0 +1,28 @@
+package web
+
+import (
+	"github.com/gofiber/fiber/v3"
+	"github.com/stretchr/testify/assert"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestTimeoutMiddleware(t *testing.T) {
+	app := fiber.New()
+	app.Use(TimeoutMiddleware(20 * time.Millisecond))
+	app.Get("/", func(c fiber.Ctx) error {
+		deadline, ok := c.Context().Deadline()
+		assert.True(t, ok)
+		assert.WithinDuration(t, time.Now().Add(20*time.Millisecond), deadline, 20*time.Millisecond)
+		select {
+		case <-c.Context().Done():
+			return c.SendStatus(fiber.StatusGatewayTimeout)
+		case <-time.After(time.Second):
+			return c.SendStatus(fiber.StatusOK)
+		}
+	})
+	resp, err := app.Test(httptest.NewRequest(fiber.MethodGet, "/", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, fiber.StatusGatewayTimeout, resp.StatusCode)
+}
@@ -0,0 +1,16 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS service_account
+(
+    id         BIGINT GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+    name       TEXT        NOT NULL UNIQUE,
+    key_prefix TEXT        NOT NULL,
+    key_hash   TEXT        NOT NULL UNIQUE,
+    roles      TEXT[]      NOT NULL DEFAULT '{}',
+    scopes     TEXT[]      NOT NULL DEFAULT '{}',
+    expires_at timestamptz,
+    created_at timestamptz NOT NULL DEFAULT now(),
+    updated_at timestamptz          DEFAULT now()
+    );
+
+-- +goose Down
+DROP TABLE IF EXISTS service_account;
@@ -0,0 +1,14 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS token_revocation
+(
+    kind       TEXT        NOT NULL,
+    value      TEXT        NOT NULL,
+    reason     TEXT        NOT NULL DEFAULT '',
+    revoked_at timestamptz NOT NULL DEFAULT now(),
+    expires_at timestamptz NOT NULL,
+    PRIMARY KEY (kind, value)
+    );
+CREATE INDEX IF NOT EXISTS token_revocation_expires_at_idx ON token_revocation (expires_at);
+
+-- +goose Down
+DROP TABLE IF EXISTS token_revocation;
@@ -0,0 +1,44 @@
+-- +goose Up
+ALTER TABLE employee ADD COLUMN IF NOT EXISTS login TEXT;
+ALTER TABLE employee ADD COLUMN IF NOT EXISTS email TEXT;
+CREATE UNIQUE INDEX IF NOT EXISTS employee_login_uidx ON employee (lower(login));
+CREATE UNIQUE INDEX IF NOT EXISTS employee_email_uidx ON employee (lower(email));
+CREATE TABLE IF NOT EXISTS employee_role
+(
+    employee_id BIGINT      NOT NULL REFERENCES employee (id) ON DELETE CASCADE,
+    role_id     BIGINT      NOT NULL REFERENCES role (id) ON DELETE CASCADE,
+    created_at  timestamptz NOT NULL DEFAULT now(),
+    PRIMARY KEY (employee_id, role_id)
+    );
+CREATE INDEX IF NOT EXISTS employee_role_role_id_idx ON employee_role (role_id);
+-- внешняя учётная запись (iss + sub токена) -> сотрудник
+CREATE TABLE IF NOT EXISTS employee_identity
+(
+    issuer      TEXT        NOT NULL,
+    subject     TEXT        NOT NULL,
+    employee_id BIGINT      NOT NULL REFERENCES employee (id) ON DELETE CASCADE,
+    linked_by   TEXT        NOT NULL,
+    created_at  timestamptz NOT NULL DEFAULT now(),
+    PRIMARY KEY (issuer, subject)
+    );
+CREATE INDEX IF NOT EXISTS employee_identity_employee_id_idx ON employee_identity (employee_id);
+CREATE TABLE IF NOT EXISTS access_request
+(
+    id          BIGINT GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+    employee_id BIGINT      NOT NULL REFERENCES employee (id) ON DELETE CASCADE,
+    role_id     BIGINT      NOT NULL REFERENCES role (id) ON DELETE CASCADE,
+    status      TEXT        NOT NULL DEFAULT 'pending',
+    comment     TEXT        NOT NULL DEFAULT '',
+    created_at  timestamptz NOT NULL DEFAULT now(),
+    updated_at  timestamptz          DEFAULT now()
+    );
+CREATE UNIQUE INDEX IF NOT EXISTS access_request_pending_uidx ON access_request (employee_id, role_id) WHERE status = 'pending';
+
+-- +goose Down
+DROP TABLE IF EXISTS access_request;
+DROP TABLE IF EXISTS employee_identity;
+DROP TABLE IF EXISTS employee_role;
+DROP INDEX IF EXISTS employee_email_uidx;
+DROP INDEX IF EXISTS employee_login_uidx;
+ALTER TABLE employee DROP COLUMN IF EXISTS email;
+ALTER TABLE employee DROP COLUMN IF EXISTS login;
@@ -0,0 +1,51 @@
+-- +goose Up
+ALTER TABLE employee ADD COLUMN IF NOT EXISTS tenant_id TEXT NOT NULL DEFAULT 'default';
+ALTER TABLE role ADD COLUMN IF NOT EXISTS tenant_id TEXT NOT NULL DEFAULT 'default';
+ALTER TABLE employee_role ADD COLUMN IF NOT EXISTS tenant_id TEXT NOT NULL DEFAULT 'default';
+ALTER TABLE employee_identity ADD COLUMN IF NOT EXISTS tenant_id TEXT NOT NULL DEFAULT 'default';
+ALTER TABLE access_request ADD COLUMN IF NOT EXISTS tenant_id TEXT NOT NULL DEFAULT 'default';
+ALTER TABLE service_account ADD COLUMN IF NOT EXISTS tenant_id TEXT NOT NULL DEFAULT 'default';
+CREATE INDEX IF NOT EXISTS employee_tenant_id_idx ON employee (tenant_id);
+CREATE INDEX IF NOT EXISTS role_tenant_id_idx ON role (tenant_id);
+CREATE INDEX IF NOT EXISTS service_account_tenant_id_idx ON service_account (tenant_id);
+-- сотрудник и роль в назначениях и заявках должны принадлежать одному арендатору
+ALTER TABLE employee ADD CONSTRAINT employee_tenant_id_id_key UNIQUE (tenant_id, id);
+ALTER TABLE role ADD CONSTRAINT role_tenant_id_id_key UNIQUE (tenant_id, id);
+ALTER TABLE employee_role ADD CONSTRAINT employee_role_employee_tenant_fkey
+    FOREIGN KEY (tenant_id, employee_id) REFERENCES employee (tenant_id, id) ON DELETE CASCADE;
+ALTER TABLE employee_role ADD CONSTRAINT employee_role_role_tenant_fkey
+    FOREIGN KEY (tenant_id, role_id) REFERENCES role (tenant_id, id) ON DELETE CASCADE;
+ALTER TABLE access_request ADD CONSTRAINT access_request_employee_tenant_fkey
+    FOREIGN KEY (tenant_id, employee_id) REFERENCES employee (tenant_id, id) ON DELETE CASCADE;
+ALTER TABLE access_request ADD CONSTRAINT access_request_role_tenant_fkey
+    FOREIGN KEY (tenant_id, role_id) REFERENCES role (tenant_id, id) ON DELETE CASCADE;
+-- логин, email и имя сервисной учётной записи уникальны в пределах арендатора
+DROP INDEX IF EXISTS employee_login_uidx;
+DROP INDEX IF EXISTS employee_email_uidx;
+CREATE UNIQUE INDEX IF NOT EXISTS employee_login_uidx ON employee (tenant_id, lower(login));
+CREATE UNIQUE INDEX IF NOT EXISTS employee_email_uidx ON employee (tenant_id, lower(email));
+ALTER TABLE service_account DROP CONSTRAINT IF EXISTS service_account_name_key;
+CREATE UNIQUE INDEX IF NOT EXISTS service_account_name_uidx ON service_account (tenant_id, name);
+
+-- +goose Down
+DROP INDEX IF EXISTS service_account_name_uidx;
+ALTER TABLE service_account ADD CONSTRAINT service_account_name_key UNIQUE (name);
+DROP INDEX IF EXISTS employee_email_uidx;
+DROP INDEX IF EXISTS employee_login_uidx;
+CREATE UNIQUE INDEX IF NOT EXISTS employee_login_uidx ON employee (lower(login));
+CREATE UNIQUE INDEX IF NOT EXISTS employee_email_uidx ON employee (lower(email));
+ALTER TABLE access_request DROP CONSTRAINT IF EXISTS access_request_role_tenant_fkey;
+ALTER TABLE access_request DROP CONSTRAINT IF EXISTS access_request_employee_tenant_fkey;
+ALTER TABLE employee_role DROP CONSTRAINT IF EXISTS employee_role_role_tenant_fkey;
+ALTER TABLE employee_role DROP CONSTRAINT IF EXISTS employee_role_employee_tenant_fkey;
+ALTER TABLE role DROP CONSTRAINT IF EXISTS role_tenant_id_id_key;
+ALTER TABLE employee DROP CONSTRAINT IF EXISTS employee_tenant_id_id_key;
+DROP INDEX IF EXISTS service_account_tenant_id_idx;
+DROP INDEX IF EXISTS role_tenant_id_idx;
+DROP INDEX IF EXISTS employee_tenant_id_idx;
+ALTER TABLE service_account DROP COLUMN IF EXISTS tenant_id;
+ALTER TABLE access_request DROP COLUMN IF EXISTS tenant_id;
+ALTER TABLE employee_identity DROP COLUMN IF EXISTS tenant_id;
+ALTER TABLE employee_role DROP COLUMN IF EXISTS tenant_id;
+ALTER TABLE role DROP COLUMN IF EXISTS tenant_id;
+ALTER TABLE employee DROP COLUMN IF EXISTS tenant_id;
@@ -0,0 +1,42 @@
+-- +goose Up
+-- Политики RLS дублируют фильтры по tenant_id в запросах приложения.
+-- Арендатор задаётся в транзакции: SET LOCAL app.tenant_id = '<tenant>', '*' - все арендаторы.
+-- Без настройки строки не видны. Суперпользователи и роли с BYPASSRLS политики не проверяют,
+-- поэтому приложение должно подключаться обычной ролью.
+ALTER TABLE employee ENABLE ROW LEVEL SECURITY;
+ALTER TABLE employee FORCE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS employee_tenant_isolation ON employee;
+CREATE POLICY employee_tenant_isolation ON employee
+    USING (tenant_id = current_setting('app.tenant_id', true) OR current_setting('app.tenant_id', true) = '*');
+
+ALTER TABLE role ENABLE ROW LEVEL SECURITY;
+ALTER TABLE role FORCE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS role_tenant_isolation ON role;
+CREATE POLICY role_tenant_isolation ON role
+    USING (tenant_id = current_setting('app.tenant_id', true) OR current_setting('app.tenant_id', true) = '*');
+
+ALTER TABLE employee_role ENABLE ROW LEVEL SECURITY;
+ALTER TABLE employee_role FORCE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS employee_role_tenant_isolation ON employee_role;
+CREATE POLICY employee_role_tenant_isolation ON employee_role
+    USING (tenant_id = current_setting('app.tenant_id', true) OR current_setting('app.tenant_id', true) = '*');
+
+ALTER TABLE access_request ENABLE ROW LEVEL SECURITY;
+ALTER TABLE access_request FORCE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS access_request_tenant_isolation ON access_request;
+CREATE POLICY access_request_tenant_isolation ON access_request
+    USING (tenant_id = current_setting('app.tenant_id', true) OR current_setting('app.tenant_id', true) = '*');
+
+-- +goose Down
+DROP POLICY IF EXISTS access_request_tenant_isolation ON access_request;
+ALTER TABLE access_request NO FORCE ROW LEVEL SECURITY;
+ALTER TABLE access_request DISABLE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS employee_role_tenant_isolation ON employee_role;
+ALTER TABLE employee_role NO FORCE ROW LEVEL SECURITY;
+ALTER TABLE employee_role DISABLE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS role_tenant_isolation ON role;
+ALTER TABLE role NO FORCE ROW LEVEL SECURITY;
+ALTER TABLE role DISABLE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS employee_tenant_isolation ON employee;
+ALTER TABLE employee NO FORCE ROW LEVEL SECURITY;
+ALTER TABLE employee DISABLE ROW LEVEL SECURITY;
@@ -0,0 +1,41 @@
+-- +goose Up
+-- Имена сотрудников и ролей уникальны в пределах арендатора без учёта регистра.
+-- Проверка в сервисе даёт понятную ошибку, индекс закрывает гонку параллельных вставок:
+-- нарушение (23505) приложение возвращает как 409.
+--
+-- Если в базе уже есть имена, различающиеся только регистром, миграция останавливается
+-- и перечисляет их, ничего не меняя. Автоматически их не объединить: у дублей свои роли и связи.
+-- Найти конфликты до обновления:
+--   SELECT tenant_id, lower(name), array_agg(id ORDER BY id) FROM employee GROUP BY 1, 2 HAVING count(*) > 1;
+--   SELECT tenant_id, lower(name), array_agg(id ORDER BY id) FROM role GROUP BY 1, 2 HAVING count(*) > 1;
+-- Затем удалить лишние записи (DELETE /api/v1/employees/{id}) или переименовать их,
+-- например UPDATE employee SET name = name || ' (' || id || ')' WHERE id IN (...), и повторить миграцию.
+-- +goose StatementBegin
+DO $$
+DECLARE
+    conflicts TEXT;
+BEGIN
+    SELECT string_agg(format('%s %s: %s', kind, tenant_id, names), '; ')
+    INTO conflicts
+    FROM (SELECT 'employee' AS kind, tenant_id, string_agg(format('%s (id=%s)', name, id), ', ' ORDER BY id) AS names
+          FROM employee
+          GROUP BY tenant_id, lower(name)
+          HAVING count(*) > 1
+          UNION ALL
+          SELECT 'role', tenant_id, string_agg(format('%s (id=%s)', name, id), ', ' ORDER BY id)
+          FROM role
+          GROUP BY tenant_id, lower(name)
+          HAVING count(*) > 1) duplicates;
+    IF conflicts IS NOT NULL THEN
+        RAISE EXCEPTION 'names differing only by case: %', conflicts
+            USING HINT = 'rename or delete duplicates, see comments in migration 20261018170000_unique_names.sql';
+    END IF;
+END
+$$;
+-- +goose StatementEnd
+CREATE UNIQUE INDEX IF NOT EXISTS employee_name_uidx ON employee (tenant_id, lower(name));
+CREATE UNIQUE INDEX IF NOT EXISTS role_name_uidx ON role (tenant_id, lower(name));
+
+-- +goose Down
+DROP INDEX IF EXISTS role_name_uidx;
+DROP INDEX IF EXISTS employee_name_uidx;
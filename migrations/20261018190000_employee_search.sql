@@ -0,0 +1,22 @@
+-- +goose Up
+-- Поиск сотрудников: полнотекстовый по словам и нечёткий по триграммам (опечатки, части слов).
+-- Выражения индексов должны совпадать с выражениями в employee.Repository.Search, иначе индексы не используются.
+-- Конфигурация 'simple' не стеммит слова и одинаково обрабатывает кириллицу и латиницу.
+-- pg_trgm разбирает кириллицу только при LC_CTYPE базы, отличном от C.
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+ALTER TABLE employee ADD COLUMN IF NOT EXISTS department TEXT;
+
+CREATE INDEX IF NOT EXISTS employee_search_fts_idx ON employee USING GIN ((
+    setweight(to_tsvector('simple', name), 'A') ||
+    setweight(to_tsvector('simple', coalesce(login, '') || ' ' || coalesce(email, '')), 'B') ||
+    setweight(to_tsvector('simple', coalesce(department, '')), 'C')
+));
+CREATE INDEX IF NOT EXISTS employee_search_trgm_idx ON employee USING GIN ((
+    lower(name || ' ' || coalesce(login, '') || ' ' || coalesce(email, '') || ' ' || coalesce(department, ''))
+) gin_trgm_ops);
+
+-- +goose Down
+DROP INDEX IF EXISTS employee_search_trgm_idx;
+DROP INDEX IF EXISTS employee_search_fts_idx;
+ALTER TABLE employee DROP COLUMN IF EXISTS department;
@@ -0,0 +1,23 @@
+-- +goose Up
+-- Сервисные аккаунты защищены политикой RLS так же, как сотрудники и роли.
+-- Ключ API проверяется до того, как известен арендатор, поэтому поиск по хешу ключа
+-- выполняет отдельная функция: SET в её определении открывает строки всех арендаторов
+-- только на время вызова, настройка транзакции после вызова восстанавливается.
+ALTER TABLE service_account ENABLE ROW LEVEL SECURITY;
+ALTER TABLE service_account FORCE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS service_account_tenant_isolation ON service_account;
+CREATE POLICY service_account_tenant_isolation ON service_account
+    USING (tenant_id = current_setting('app.tenant_id', true) OR current_setting('app.tenant_id', true) = '*');
+
+CREATE OR REPLACE FUNCTION service_account_by_key_hash(hash TEXT)
+    RETURNS SETOF service_account
+    LANGUAGE sql
+    STABLE
+    SET app.tenant_id = '*'
+AS 'SELECT * FROM service_account WHERE key_hash = hash';
+
+-- +goose Down
+DROP FUNCTION IF EXISTS service_account_by_key_hash(TEXT);
+DROP POLICY IF EXISTS service_account_tenant_isolation ON service_account;
+ALTER TABLE service_account NO FORCE ROW LEVEL SECURITY;
+ALTER TABLE service_account DISABLE ROW LEVEL SECURITY;
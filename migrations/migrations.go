@@ -0,0 +1,14 @@
+// Package migrations встраивает SQL миграции goose в бинарный файл приложения
+package migrations
+
+import "embed"
+
+// FS миграции Postgres
+//
+//go:embed *.sql
+var FS embed.FS
+
+// SQLite миграции встроенной базы в каталоге sqlite: схема та же, без RLS и расширений Postgres
+//
+//go:embed sqlite/*.sql
+var SQLite embed.FS
@@ -0,0 +1,107 @@
+-- +goose Up
+-- Схема SQLite соответствует миграциям Postgres до 20261018170000_unique_names включительно.
+-- Политик RLS нет: арендатора ограничивают условия tenant_id в запросах приложения.
+-- Массивы ролей и областей сервисных учётных записей хранятся текстом в формате массива Postgres ({a,b}).
+CREATE TABLE IF NOT EXISTS employee
+(
+    id         INTEGER PRIMARY KEY AUTOINCREMENT,
+    tenant_id  TEXT      NOT NULL DEFAULT 'default',
+    name       TEXT      NOT NULL,
+    login      TEXT,
+    email      TEXT,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP          DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (tenant_id, id)
+);
+CREATE INDEX IF NOT EXISTS employee_tenant_id_idx ON employee (tenant_id);
+CREATE UNIQUE INDEX IF NOT EXISTS employee_name_uidx ON employee (tenant_id, lower(name));
+CREATE UNIQUE INDEX IF NOT EXISTS employee_login_uidx ON employee (tenant_id, lower(login));
+CREATE UNIQUE INDEX IF NOT EXISTS employee_email_uidx ON employee (tenant_id, lower(email));
+
+CREATE TABLE IF NOT EXISTS role
+(
+    id         INTEGER PRIMARY KEY AUTOINCREMENT,
+    tenant_id  TEXT      NOT NULL DEFAULT 'default',
+    name       TEXT      NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP          DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (tenant_id, id)
+);
+CREATE INDEX IF NOT EXISTS role_tenant_id_idx ON role (tenant_id);
+CREATE UNIQUE INDEX IF NOT EXISTS role_name_uidx ON role (tenant_id, lower(name));
+
+CREATE TABLE IF NOT EXISTS employee_role
+(
+    tenant_id   TEXT      NOT NULL DEFAULT 'default',
+    employee_id INTEGER   NOT NULL,
+    role_id     INTEGER   NOT NULL,
+    created_at  TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (employee_id, role_id),
+    FOREIGN KEY (tenant_id, employee_id) REFERENCES employee (tenant_id, id) ON DELETE CASCADE,
+    FOREIGN KEY (tenant_id, role_id) REFERENCES role (tenant_id, id) ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS employee_role_role_id_idx ON employee_role (role_id);
+
+-- внешняя учётная запись (iss + sub токена) -> сотрудник
+CREATE TABLE IF NOT EXISTS employee_identity
+(
+    tenant_id   TEXT      NOT NULL DEFAULT 'default',
+    issuer      TEXT      NOT NULL,
+    subject     TEXT      NOT NULL,
+    employee_id INTEGER   NOT NULL REFERENCES employee (id) ON DELETE CASCADE,
+    linked_by   TEXT      NOT NULL,
+    created_at  TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (issuer, subject)
+);
+CREATE INDEX IF NOT EXISTS employee_identity_employee_id_idx ON employee_identity (employee_id);
+
+CREATE TABLE IF NOT EXISTS access_request
+(
+    id          INTEGER PRIMARY KEY AUTOINCREMENT,
+    tenant_id   TEXT      NOT NULL DEFAULT 'default',
+    employee_id INTEGER   NOT NULL,
+    role_id     INTEGER   NOT NULL,
+    status      TEXT      NOT NULL DEFAULT 'pending',
+    comment     TEXT      NOT NULL DEFAULT '',
+    created_at  TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at  TIMESTAMP          DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (tenant_id, employee_id) REFERENCES employee (tenant_id, id) ON DELETE CASCADE,
+    FOREIGN KEY (tenant_id, role_id) REFERENCES role (tenant_id, id) ON DELETE CASCADE
+);
+CREATE UNIQUE INDEX IF NOT EXISTS access_request_pending_uidx ON access_request (employee_id, role_id) WHERE status = 'pending';
+
+CREATE TABLE IF NOT EXISTS service_account
+(
+    id         INTEGER PRIMARY KEY AUTOINCREMENT,
+    tenant_id  TEXT      NOT NULL DEFAULT 'default',
+    name       TEXT      NOT NULL,
+    key_prefix TEXT      NOT NULL,
+    key_hash   TEXT      NOT NULL UNIQUE,
+    roles      TEXT      NOT NULL DEFAULT '{}',
+    scopes     TEXT      NOT NULL DEFAULT '{}',
+    expires_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP          DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS service_account_tenant_id_idx ON service_account (tenant_id);
+CREATE UNIQUE INDEX IF NOT EXISTS service_account_name_uidx ON service_account (tenant_id, name);
+
+CREATE TABLE IF NOT EXISTS token_revocation
+(
+    kind       TEXT      NOT NULL,
+    value      TEXT      NOT NULL,
+    reason     TEXT      NOT NULL DEFAULT '',
+    revoked_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (kind, value)
+);
+CREATE INDEX IF NOT EXISTS token_revocation_expires_at_idx ON token_revocation (expires_at);
+
+-- +goose Down
+DROP TABLE IF EXISTS token_revocation;
+DROP TABLE IF EXISTS service_account;
+DROP TABLE IF EXISTS access_request;
+DROP TABLE IF EXISTS employee_identity;
+DROP TABLE IF EXISTS employee_role;
+DROP TABLE IF EXISTS role;
+DROP TABLE IF EXISTS employee;
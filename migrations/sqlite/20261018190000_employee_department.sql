@@ -0,0 +1,6 @@
+-- +goose Up
+-- Поиск в SQLite идёт через LIKE без индексов, см. employee.Repository.Search
+ALTER TABLE employee ADD COLUMN department TEXT;
+
+-- +goose Down
+ALTER TABLE employee DROP COLUMN department;
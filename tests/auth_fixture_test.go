@@ -0,0 +1,47 @@
+package tests
+
+import (
+	"github.com/gofiber/fiber/v3"
+	"github.com/golang-jwt/jwt/v5"
+	"idm/inner/common"
+	"idm/inner/web"
+	"time"
+)
+
+const testHmacSecret = "integration-tests-secret-0123456789abcdef"
+
+// withOfflineAuth переключает проверку токенов на общий секрет, чтобы интеграционные тесты не зависели от Keycloak
+func withOfflineAuth(cfg common.Config) common.Config {
+	cfg.JwtSigningMode = web.SigningModeHmac
+	cfg.JwtHmacSecret = testHmacSecret
+	cfg.JwtKeyId = ""
+	return cfg
+}
+
+// signRequests добавляет каждому запросу к серверу токен пользователя с ролями roles.
+// Вызывается до подключения AuthMiddleware, чтобы заголовок был установлен к проверке токена
+func signRequests(server *web.Server, cfg common.Config, roles ...string) {
+	token := "Bearer " + mintToken(cfg, roles...)
+	server.App.Use(func(c fiber.Ctx) error {
+		c.Request().Header.Set(fiber.HeaderAuthorization, token)
+		return c.Next()
+	})
+}
+
+func mintToken(cfg common.Config, roles ...string) string {
+	claims := &web.IdmClaims{
+		RealmAccess:     web.RealmAccessClaims{Roles: roles},
+		AuthorizedParty: cfg.KeycloakClientId,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   "integration-test",
+			Issuer:    cfg.KeycloakIssuer,
+			Audience:  jwt.ClaimStrings{cfg.KeycloakAudience},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		},
+	}
+	token, err := web.NewHmacTokenMinter(testHmacSecret, "").Mint(claims)
+	if err != nil {
+		panic(err)
+	}
+	return token
+}
@@ -1,6 +1,7 @@
 package tests
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"github.com/stretchr/testify/assert"
@@ -18,19 +19,21 @@ import (
 )
 
 func TestPaginationIntegration(t *testing.T) {
-	cfg := common.GetConfig(".env")
+	cfg := withOfflineAuth(common.GetConfig(".env"))
 	logger := common.NewLogger(cfg)
 	defer func() { _ = logger.Sync() }()
 	db := database.ConnectDbWithCfg(cfg)
 	db.MustExec("DELETE FROM employee;")
 	app := web.NewServer()
+	signRequests(app, cfg, web.IdmAdmin, web.IdmUser)
+	app.GroupApiV1.Use(web.AuthMiddleware(cfg, logger))
 	vld := validator.New()
-	employeeRepo := employee.NewRepository(db)
+	employeeRepo := employee.NewRepository(db, database.NewTxManager(db, logger, cfg.DbTxMaxAttempts))
 	employeeService := employee.NewService(employeeRepo, vld)
 	employeeController := employee.NewController(app, employeeService, logger)
 	employeeController.RegisterRoutes()
 	for i := 1; i <= 5; i++ {
-		_, err := employeeService.Add(employee.NameRequest{Name: "name" + strconv.Itoa(i)})
+		_, err := employeeService.Add(context.Background(), testTenant, employee.NameRequest{Name: "name" + strconv.Itoa(i)})
 		if err != nil {
 			logger.Error("error adding in test employee controller: %v", zap.Error(err))
 		}
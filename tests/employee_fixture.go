@@ -11,6 +11,9 @@ import (
 
 const env = ".env"
 
+// testTenant арендатор, в котором работают интеграционные тесты
+var testTenant = common.SingleTenant(common.DefaultTenant)
+
 type Fixture struct {
 	db        *sqlx.DB
 	employees *employee.Repository
@@ -19,25 +22,22 @@ type Fixture struct {
 func NewFixture() *Fixture {
 	cfg := common.GetConfig(env)
 	db := database.ConnectDbWithCfg(cfg)
-	repo := employee.NewRepository(db)
+	repo := employee.NewRepository(db, database.NewTxManager(db, common.NewLogger(cfg), cfg.DbTxMaxAttempts))
 	initSchema(db)
 	return &Fixture{db: db, employees: repo}
 }
 
-func (f *Fixture) Employee(name string) (int64, error) {
-	tx, err := f.db.BeginTxx(context.Background(), nil)
+func (f *Fixture) Employee(name string) (id int64, err error) {
+	ctx := context.Background()
+	err = f.employees.WithTx(ctx, database.TxOptions{Tenant: testTenant}, func(ctx context.Context, tx *sqlx.Tx) error {
+		entity := employee.Entity{TenantId: common.DefaultTenant, Name: name}
+		id, err = f.employees.Add(ctx, tx, entity)
+		return err
+	})
 	if err != nil {
 		return -1, err
 	}
-	defer func() {
-		if err != nil {
-			_ = tx.Rollback()
-		} else {
-			_ = tx.Commit()
-		}
-	}()
-	entity := employee.Entity{Name: name}
-	return f.employees.Add(tx, entity)
+	return id, nil
 }
 
 func (f *Fixture) Close() {
@@ -59,7 +59,10 @@ func initSchema(db *sqlx.DB) {
 		name       TEXT        NOT NULL,
 		created_at timestamptz NOT NULL DEFAULT now(),
 		updated_at timestamptz          DEFAULT now()
-	);`
+	);
+	ALTER TABLE employee ADD COLUMN IF NOT EXISTS login TEXT;
+	ALTER TABLE employee ADD COLUMN IF NOT EXISTS email TEXT;
+	ALTER TABLE employee ADD COLUMN IF NOT EXISTS tenant_id TEXT NOT NULL DEFAULT 'default';`
 	_, err := db.Exec(schema)
 	if err != nil {
 		log.Fatal("create temp table employee %w", err)
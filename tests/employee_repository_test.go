@@ -2,17 +2,20 @@ package tests
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/jmoiron/sqlx"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"idm/inner/common"
+	"idm/inner/database"
 	"idm/inner/employee"
-	"log"
 	"testing"
 	"time"
 )
 
 func TestEmployeeRepository(t *testing.T) {
+	ctx := context.Background()
 	a := assert.New(t)
 	fx := NewFixture()
 	defer fx.Close()
@@ -20,7 +23,7 @@ func TestEmployeeRepository(t *testing.T) {
 		repo := fx.employees
 		fx.ClearTable()
 		newEmpId := mustEmployee(t, fx, "Test name")
-		got, err := repo.FindById(newEmpId)
+		got, err := repo.FindById(ctx, testTenant, newEmpId)
 		a.Nil(err)
 		a.NotEmpty(got)
 		a.NotEmpty(got.Id)
@@ -35,8 +38,7 @@ func TestEmployeeRepository(t *testing.T) {
 		mustEmployee(t, fx, "name 1")
 		mustEmployee(t, fx, "name 2")
 		mustEmployee(t, fx, "name 3")
-		ctx := context.Background()
-		got, err := repo.GetAll(ctx)
+		got, err := repo.GetAll(ctx, testTenant)
 		a.Nil(err)
 		a.NotEmpty(got)
 		a.Len(got, 3)
@@ -55,7 +57,7 @@ func TestEmployeeRepository(t *testing.T) {
 		id3 := mustEmployee(t, fx, "name 3")
 		id4 := mustEmployee(t, fx, "name 4")
 		mustEmployee(t, fx, "name 5")
-		got, err := repo.GetGroupById([]int64{id2, id3, id4})
+		got, err := repo.GetGroupById(ctx, testTenant, []int64{id2, id3, id4})
 		a.Nil(err)
 		a.NotEmpty(got)
 		a.Len(got, 3)
@@ -70,9 +72,9 @@ func TestEmployeeRepository(t *testing.T) {
 		repo := fx.employees
 		fx.ClearTable()
 		id := mustEmployee(t, fx, "name 1")
-		err := repo.Delete(id)
+		err := repo.Delete(ctx, testTenant, id)
 		a.Nil(err)
-		got, err := repo.FindById(id)
+		got, err := repo.FindById(ctx, testTenant, id)
 		a.NotNil(err)
 		a.Empty(got)
 	})
@@ -85,93 +87,85 @@ func TestEmployeeRepository(t *testing.T) {
 		id4 := mustEmployee(t, fx, "name 4")
 		mustEmployee(t, fx, "name 5")
 		ids := []int64{id2, id3, id4}
-		err := repo.DeleteGroup(ids)
+		err := repo.DeleteGroup(ctx, testTenant, ids)
 		a.Nil(err)
-		got, err := repo.GetGroupById(ids)
+		got, err := repo.GetGroupById(ctx, testTenant, ids)
 		a.NoError(err)
 		a.Len(got, 0)
 	})
 	t.Run("find employee and insert in one tx", func(t *testing.T) {
 		repo := fx.employees
 		fx.ClearTable()
-		tx, err := repo.BeginTransaction()
-		a.NoError(err)
-		defer func(tx *sqlx.Tx) {
-			err := tx.Rollback()
-			if err != nil {
-				log.Fatal("rollback error")
-			}
-		}(tx)
 		entity := employee.Entity{
 			Id:        1,
+			TenantId:  common.DefaultTenant,
 			Name:      "name1",
 			CreatedAt: time.Now(),
 			UpdatedAt: time.Now(),
 		}
-		isExist, err := repo.FindByNameTx(tx, entity.Name)
-		a.NoError(err)
-		a.False(isExist, "should be now employee before add")
-		got, err := repo.Add(tx, entity)
-		a.NoError(err)
-		a.NoError(err)
-		a.NotEmpty(got)
-		found, err := repo.FindByNameTx(tx, entity.Name)
-		a.NoError(err)
-		a.True(found)
+		err := repo.WithTx(ctx, database.TxOptions{Tenant: testTenant}, func(ctx context.Context, tx *sqlx.Tx) error {
+			isExist, err := repo.FindByNameTx(ctx, tx, testTenant.Id, entity.Name)
+			a.NoError(err)
+			a.False(isExist, "should be now employee before add")
+			got, err := repo.Add(ctx, tx, entity)
+			a.NoError(err)
+			a.NotEmpty(got)
+			found, err := repo.FindByNameTx(ctx, tx, testTenant.Id, entity.Name)
+			a.NoError(err)
+			a.True(found)
+			return errRollback
+		})
+		a.ErrorIs(err, errRollback)
 	})
 	t.Run("get page of employees", func(t *testing.T) {
 		repo := fx.employees
 		fx.ClearTable()
-		tx, err := repo.BeginTransaction()
-		a.NoError(err)
-		defer func(tx *sqlx.Tx) {
-			err := tx.Rollback()
-			if err != nil {
-				log.Fatal("rollback error")
-			}
-		}(tx)
 		entity1 := employee.Entity{
 			Id:        1,
+			TenantId:  common.DefaultTenant,
 			Name:      "name1",
 			CreatedAt: time.Now(),
 			UpdatedAt: time.Now(),
 		}
 		entity2 := employee.Entity{
 			Id:        2,
+			TenantId:  common.DefaultTenant,
 			Name:      "name2",
 			CreatedAt: time.Now(),
 			UpdatedAt: time.Now(),
 		}
 		entity3 := employee.Entity{
 			Id:        3,
+			TenantId:  common.DefaultTenant,
 			Name:      "name3",
 			CreatedAt: time.Now(),
 			UpdatedAt: time.Now(),
 		}
-		_, err = repo.Add(tx, entity1)
-		if err != nil {
-			fmt.Println("error add employee at test")
-		}
-		_, err = repo.Add(tx, entity2)
-		if err != nil {
-			fmt.Println("error add employee at test")
-		}
-		_, err = repo.Add(tx, entity3)
-		if err != nil {
-			fmt.Println("error add employee at test")
-		}
-		got, err := repo.FindPageWithFilter(tx, 0, 3, "nam")
-		a.Nil(err)
-		a.NotEmpty(got)
-		a.Len(got, 3)
-		for _, v := range got {
-			a.NotEmpty(v.Id)
-			a.NotEmpty(v.Name)
-			a.NotEmpty(v.CreatedAt)
-			a.NotEmpty(v.UpdatedAt)
-		}
+		err := repo.WithTx(ctx, database.TxOptions{Tenant: testTenant}, func(ctx context.Context, tx *sqlx.Tx) error {
+			for _, entity := range []employee.Entity{entity1, entity2, entity3} {
+				if _, err := repo.Add(ctx, tx, entity); err != nil {
+					fmt.Println("error add employee at test")
+				}
+			}
+			got, err := repo.FindPageWithFilter(ctx, tx, testTenant, 0, 3, "nam")
+			a.Nil(err)
+			a.NotEmpty(got)
+			a.Len(got, 3)
+			for _, v := range got {
+				a.NotEmpty(v.Id)
+				a.NotEmpty(v.Name)
+				a.NotEmpty(v.CreatedAt)
+				a.NotEmpty(v.UpdatedAt)
+			}
+			return errRollback
+		})
+		a.ErrorIs(err, errRollback)
 	})
 }
+
+// errRollback откатывает транзакцию теста после проверок
+var errRollback = errors.New("rollback test transaction")
+
 func mustEmployee(t *testing.T, f *Fixture, name string) int64 {
 	t.Helper()
 	id, err := f.Employee(name)
@@ -1,6 +1,7 @@
 package tests
 
 import (
+	"context"
 	"fmt"
 	"github.com/jmoiron/sqlx"
 	"idm/inner/common"
@@ -17,14 +18,14 @@ type RoleFixture struct {
 func NewRoleFixture() *RoleFixture {
 	cfg := common.GetConfig(env)
 	db := database.ConnectDbWithCfg(cfg)
-	repo := Role.NewRepository(db)
+	repo := Role.NewRepository(db, database.NewTxManager(db, common.NewLogger(cfg), cfg.DbTxMaxAttempts))
 	initRoleSchema(db)
 	return &RoleFixture{db, repo}
 }
 
 func (f *RoleFixture) Role(name string) (int64, error) {
-	entity := Role.Entity{Name: name}
-	newId, err := f.repo.Add(entity)
+	entity := Role.Entity{TenantId: common.DefaultTenant, Name: name}
+	newId, err := f.repo.Add(context.Background(), entity)
 	if err != nil {
 		return -1, fmt.Errorf("fall while add role: %w", err)
 	}
@@ -50,7 +51,8 @@ func initRoleSchema(db *sqlx.DB) {
 		name       TEXT        NOT NULL,
 		created_at timestamptz NOT NULL DEFAULT now(),
 		updated_at timestamptz          DEFAULT now()
-	);`
+	);
+	ALTER TABLE role ADD COLUMN IF NOT EXISTS tenant_id TEXT NOT NULL DEFAULT 'default';`
 	_, err := db.Exec(schema)
 	if err != nil {
 		log.Fatal("create temp table role: %w", err)
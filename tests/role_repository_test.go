@@ -1,12 +1,14 @@
 package tests
 
 import (
+	"context"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"testing"
 )
 
 func TestRoleRepository(t *testing.T) {
+	ctx := context.Background()
 	a := assert.New(t)
 	fx := NewRoleFixture()
 	defer fx.Close()
@@ -14,7 +16,7 @@ func TestRoleRepository(t *testing.T) {
 		repo := fx.repo
 		fx.ClearTable()
 		newEmpId := mustRole(t, fx, "Test name")
-		got, err := repo.FindById(newEmpId)
+		got, err := repo.FindById(ctx, testTenant, newEmpId)
 		a.Nil(err)
 		a.NotEmpty(got)
 		a.NotEmpty(got.Id)
@@ -29,7 +31,7 @@ func TestRoleRepository(t *testing.T) {
 		mustRole(t, fx, "name 1")
 		mustRole(t, fx, "name 1")
 		mustRole(t, fx, "name 1")
-		got, err := repo.GetAll()
+		got, err := repo.GetAll(ctx, testTenant)
 		a.Nil(err)
 		a.NotEmpty(got)
 		a.Len(got, 3)
@@ -48,7 +50,7 @@ func TestRoleRepository(t *testing.T) {
 		id3 := mustRole(t, fx, "name 3")
 		id4 := mustRole(t, fx, "name 4")
 		mustRole(t, fx, "name 5")
-		got, err := repo.GetGroupById([]int64{id2, id3, id4})
+		got, err := repo.GetGroupById(ctx, testTenant, []int64{id2, id3, id4})
 		a.Nil(err)
 		a.NotEmpty(got)
 		a.Len(got, 3)
@@ -63,9 +65,9 @@ func TestRoleRepository(t *testing.T) {
 		repo := fx.repo
 		fx.ClearTable()
 		id := mustRole(t, fx, "name 1")
-		err := repo.Delete(id)
+		err := repo.Delete(ctx, testTenant, id)
 		a.Nil(err)
-		got, err := repo.FindById(id)
+		got, err := repo.FindById(ctx, testTenant, id)
 		a.NotNil(err)
 		a.Empty(got)
 	})
@@ -78,9 +80,9 @@ func TestRoleRepository(t *testing.T) {
 		id4 := mustRole(t, fx, "name 4")
 		mustRole(t, fx, "name 5")
 		ids := []int64{id2, id3, id4}
-		err := repo.DeleteGroup(ids)
+		err := repo.DeleteGroup(ctx, testTenant, ids)
 		a.Nil(err)
-		got, err := repo.GetGroupById(ids)
+		got, err := repo.GetGroupById(ctx, testTenant, ids)
 		a.NoError(err)
 		a.Len(got, 0)
 	})
@@ -0,0 +1,148 @@
+package tests
+
+import (
+	"context"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"idm/inner/common"
+	"idm/inner/database"
+	"idm/inner/employee"
+	"idm/inner/revocation"
+	Role "idm/inner/role"
+	"idm/inner/serviceaccount"
+	"idm/inner/validator"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestSQLite репозитории на встроенной базе: Postgres для этих тестов не нужен
+func TestSQLite(t *testing.T) {
+	ctx := context.Background()
+	logger := &common.Logger{Logger: zap.NewNop()}
+	dsn := "file:" + filepath.Join(t.TempDir(), "idm.db") + "?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)"
+	db := sqlx.MustConnect(database.SQLiteDriver, dsn)
+	defer func() { _ = db.Close() }()
+	require.NoError(t, database.Migrate(ctx, db, "up", logger))
+	txManager := database.NewTxManager(db, logger, 3)
+	vld := validator.New()
+	acme := common.SingleTenant("acme")
+
+	t.Run("employees", func(t *testing.T) {
+		svc := employee.NewService(employee.NewRepository(db, txManager), vld)
+		id, err := svc.Add(ctx, acme, employee.NameRequest{Name: "Anna", Login: "anna", Email: "anna@example.com"})
+		require.NoError(t, err)
+		_, err = svc.Add(ctx, acme, employee.NameRequest{Name: "Annette"})
+		require.NoError(t, err)
+		found, err := svc.FindById(ctx, acme, employee.IdRequest{Id: id})
+		assert.NoError(t, err)
+		assert.Equal(t, "anna", *found.Login)
+		assert.False(t, found.CreatedAt.IsZero())
+		_, err = svc.FindById(ctx, common.SingleTenant("globex"), employee.IdRequest{Id: id})
+		assert.Error(t, err)
+		_, err = svc.Add(ctx, acme, employee.NameRequest{Name: "ANNA"})
+		var existsErr *common.AlreadyExistsError
+		assert.ErrorAs(t, err, &existsErr)
+		page, err := svc.GetPage(ctx, acme, employee.PageRequest{PageSize: 1, TextFilter: "ANN"})
+		assert.NoError(t, err)
+		assert.Equal(t, int64(2), page.Total)
+		assert.Len(t, page.Result, 1)
+		keySet, err := svc.GetKeySetPage(ctx, acme, employee.PageKeySetRequest{PageSize: 1, TextFilter: "ANN", Count: employee.CountExact})
+		assert.NoError(t, err)
+		require.Len(t, keySet.Result, 1)
+		assert.Equal(t, keySet.Result[0].Id, keySet.LastId)
+		assert.Equal(t, int64(2), keySet.Total)
+		matches, err := svc.Search(ctx, acme, employee.SearchRequest{Query: "ANNA@example", Limit: 10})
+		assert.NoError(t, err)
+		require.Len(t, matches, 1)
+		assert.Equal(t, id, matches[0].Id)
+		assert.NoError(t, svc.Delete(ctx, acme, employee.IdRequest{Id: id}))
+	})
+	t.Run("database unique index is translated", func(t *testing.T) {
+		repo := employee.NewRepository(db, txManager)
+		err := repo.WithTx(ctx, database.TxOptions{Tenant: acme}, func(ctx context.Context, tx *sqlx.Tx) error {
+			if _, err := repo.Add(ctx, tx, employee.Entity{TenantId: "acme", Name: "Boris"}); err != nil {
+				return err
+			}
+			_, err := repo.Add(ctx, tx, employee.Entity{TenantId: "acme", Name: "boris"})
+			return err
+		})
+		var existsErr *common.AlreadyExistsError
+		assert.ErrorAs(t, err, &existsErr)
+	})
+	t.Run("roles", func(t *testing.T) {
+		svc := Role.NewService(Role.NewRepository(db, txManager), vld)
+		id, err := svc.Add(ctx, acme, Role.NameRequest{Name: "Admin"})
+		require.NoError(t, err)
+		all, err := svc.GetAll(ctx, acme)
+		assert.NoError(t, err)
+		assert.Len(t, all, 1)
+		assert.NoError(t, svc.DeleteGroup(ctx, acme, Role.IdsRequest{Ids: []int64{id}}))
+	})
+	t.Run("export with roles", func(t *testing.T) {
+		employees := employee.NewService(employee.NewRepository(db, txManager), vld)
+		roles := Role.NewService(Role.NewRepository(db, txManager), vld)
+		employeeId, err := employees.Add(ctx, acme, employee.NameRequest{Name: "Exported"})
+		require.NoError(t, err)
+		roleId, err := roles.Add(ctx, acme, Role.NameRequest{Name: "Auditor"})
+		require.NoError(t, err)
+		db.MustExec("INSERT INTO employee_role (tenant_id, employee_id, role_id) VALUES ('acme', $1, $2)", employeeId, roleId)
+		var rows []employee.ExportRow
+		err = employees.Export(ctx, acme, employee.ExportRequest{TextFilter: "export"}, func(row employee.ExportRow) error {
+			rows = append(rows, row)
+			return nil
+		})
+		assert.NoError(t, err)
+		require.Len(t, rows, 1)
+		assert.Equal(t, []string{"Auditor"}, rows[0].Roles)
+		var counts []int64
+		err = roles.Export(ctx, acme, Role.ExportRequest{TextFilter: "audit"}, func(row Role.ExportRow) error {
+			counts = append(counts, row.EmployeeCount)
+			return nil
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, []int64{1}, counts)
+	})
+	t.Run("import", func(t *testing.T) {
+		svc := employee.NewService(employee.NewRepository(db, txManager), vld)
+		_, err := svc.Add(ctx, acme, employee.NameRequest{Name: "Imported", Login: "imported"})
+		require.NoError(t, err)
+		rows, err := employee.ParseImport("hr.csv", []byte("name,login,department\nImported Twice,IMPORTED,QA\nNew Hire,new.hire,QA\nnew hire,,QA\n"), nil)
+		require.NoError(t, err)
+		report, err := svc.Import(ctx, acme, employee.ImportRequest{Rows: rows}, nil)
+		require.NoError(t, err)
+		assert.Equal(t, 1, report.Updated)
+		assert.Equal(t, 1, report.Created)
+		require.Len(t, report.Errors, 1)
+		assert.Equal(t, 4, report.Errors[0].Line)
+		page, err := svc.GetPage(ctx, acme, employee.PageRequest{PageSize: 10, TextFilter: "Imported Twice"})
+		assert.NoError(t, err)
+		require.Len(t, page.Result, 1)
+		assert.Equal(t, "QA", *page.Result[0].Department)
+	})
+	t.Run("service accounts", func(t *testing.T) {
+		svc := serviceaccount.NewService(serviceaccount.NewRepository(db), vld)
+		key, err := svc.Create(ctx, acme, serviceaccount.CreateRequest{Name: "ci", Roles: []string{"IDM_USER"}, Scopes: []string{"employee:read"}})
+		require.NoError(t, err)
+		claims, err := svc.Authenticate(ctx, key.ApiKey)
+		require.NoError(t, err)
+		assert.Equal(t, "acme", claims.TenantId)
+	})
+	t.Run("revocations", func(t *testing.T) {
+		repo := revocation.NewRepository(db)
+		now := time.Now().UTC()
+		entity := revocation.Entity{Kind: revocation.KindJti, Value: "jti-1", RevokedAt: now, ExpiresAt: now.Add(time.Hour)}
+		require.NoError(t, repo.Add(ctx, entity))
+		entity.ExpiresAt = now.Add(time.Minute)
+		require.NoError(t, repo.Add(ctx, entity))
+		active, err := repo.GetActive(ctx, now)
+		assert.NoError(t, err)
+		require.Len(t, active, 1)
+		assert.WithinDuration(t, now.Add(time.Hour), active[0].ExpiresAt, time.Second, "later expiry should be kept")
+		isRevoked, err := repo.IsRevoked(ctx, revocation.Query{Jti: "jti-1", Now: now})
+		assert.NoError(t, err)
+		assert.True(t, isRevoked)
+	})
+}
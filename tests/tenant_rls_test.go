@@ -0,0 +1,163 @@
+package tests
+
+import (
+	"context"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"idm/inner/common"
+	"idm/inner/database"
+	"os"
+	"strings"
+	"testing"
+)
+
+// rlsTestRole обычная роль: суперпользователь admin политики RLS не проверяет
+const rlsTestRole = "idm_rls_test"
+
+func initRlsSchema(t *testing.T, db *sqlx.DB) {
+	t.Helper()
+	initSchema(db)
+	initRoleSchema(db)
+	db.MustExec(`
+	CREATE TABLE IF NOT EXISTS employee_role
+	(
+		tenant_id   TEXT        NOT NULL DEFAULT 'default',
+		employee_id BIGINT      NOT NULL REFERENCES employee (id) ON DELETE CASCADE,
+		role_id     BIGINT      NOT NULL REFERENCES role (id) ON DELETE CASCADE,
+		created_at  timestamptz NOT NULL DEFAULT now(),
+		PRIMARY KEY (employee_id, role_id)
+	);
+	CREATE TABLE IF NOT EXISTS access_request
+	(
+		id          BIGINT GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+		tenant_id   TEXT        NOT NULL DEFAULT 'default',
+		employee_id BIGINT      NOT NULL REFERENCES employee (id) ON DELETE CASCADE,
+		role_id     BIGINT      NOT NULL REFERENCES role (id) ON DELETE CASCADE,
+		status      TEXT        NOT NULL DEFAULT 'pending',
+		comment     TEXT        NOT NULL DEFAULT '',
+		created_at  timestamptz NOT NULL DEFAULT now(),
+		updated_at  timestamptz          DEFAULT now()
+	);
+	CREATE TABLE IF NOT EXISTS service_account
+	(
+		id         BIGINT GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+		tenant_id  TEXT        NOT NULL DEFAULT 'default',
+		name       TEXT        NOT NULL,
+		key_prefix TEXT        NOT NULL,
+		key_hash   TEXT        NOT NULL UNIQUE,
+		roles      TEXT[]      NOT NULL DEFAULT '{}',
+		scopes     TEXT[]      NOT NULL DEFAULT '{}',
+		expires_at timestamptz,
+		created_at timestamptz NOT NULL DEFAULT now(),
+		updated_at timestamptz          DEFAULT now()
+	);`)
+	applyMigrationUp(t, db, "20261018160000_tenant_rls.sql")
+	applyMigrationUp(t, db, "20261018200000_service_account_rls.sql")
+	db.MustExec(`DO $$
+	BEGIN
+		IF NOT EXISTS (SELECT 1 FROM pg_roles WHERE rolname = '` + rlsTestRole + `') THEN
+			CREATE ROLE ` + rlsTestRole + ` NOLOGIN;
+		END IF;
+	END $$;`)
+	db.MustExec("GRANT SELECT, INSERT, UPDATE, DELETE ON employee, role, employee_role, access_request, service_account TO " + rlsTestRole)
+	db.MustExec("GRANT USAGE ON ALL SEQUENCES IN SCHEMA public TO " + rlsTestRole)
+}
+
+// applyMigrationUp выполняет секцию Up файла миграции
+func applyMigrationUp(t *testing.T, db *sqlx.DB, name string) {
+	t.Helper()
+	migration, err := os.ReadFile("../migrations/" + name)
+	require.NoError(t, err)
+	up, _, _ := strings.Cut(string(migration), "-- +goose Down")
+	db.MustExec(up)
+}
+
+// asTenant выполняет fn от имени обычной роли в транзакции арендатора, изменения откатываются
+func asTenant(t *testing.T, db *sqlx.DB, tenant *common.Tenant, fn func(tx *sqlx.Tx)) {
+	t.Helper()
+	tx, err := db.Beginx()
+	require.NoError(t, err)
+	defer func() { _ = tx.Rollback() }()
+	tx.MustExec("SET LOCAL ROLE " + rlsTestRole)
+	if tenant != nil {
+		require.NoError(t, database.SetTenant(context.Background(), tx, *tenant))
+	}
+	fn(tx)
+}
+
+func TestTenantRowLevelSecurity(t *testing.T) {
+	fx := NewFixture()
+	defer fx.Close()
+	db := fx.db
+	initRlsSchema(t, db)
+	fx.ClearTable()
+	db.MustExec("DELETE FROM role;")
+	db.MustExec("DELETE FROM service_account;")
+	db.MustExec("INSERT INTO employee (tenant_id, name) VALUES ('acme', 'acme-1'), ('acme', 'acme-2'), ('globex', 'globex-1')")
+	db.MustExec("INSERT INTO role (tenant_id, name) VALUES ('acme', 'acme-admin'), ('globex', 'globex-admin')")
+	db.MustExec(`INSERT INTO employee_role (tenant_id, employee_id, role_id)
+		SELECT e.tenant_id, e.id, r.id FROM employee e JOIN role r ON r.tenant_id = e.tenant_id`)
+	db.MustExec(`INSERT INTO service_account (tenant_id, name, key_prefix, key_hash)
+		VALUES ('acme', 'acme-ci', 'idm_acme', 'acme-hash'), ('globex', 'globex-ci', 'idm_glob', 'globex-hash')`)
+	acme := common.SingleTenant("acme")
+	all := common.AllTenants()
+	names := func(t *testing.T, tx *sqlx.Tx, query string) []string {
+		var got []string
+		require.NoError(t, tx.Select(&got, query))
+		return got
+	}
+
+	t.Run("query without tenant filter returns only own rows", func(t *testing.T) {
+		asTenant(t, db, &acme, func(tx *sqlx.Tx) {
+			assert.ElementsMatch(t, []string{"acme-1", "acme-2"}, names(t, tx, "SELECT name FROM employee"))
+			assert.Equal(t, []string{"acme-admin"}, names(t, tx, "SELECT name FROM role"))
+			assert.Equal(t, []string{"acme"}, names(t, tx, "SELECT DISTINCT tenant_id FROM employee_role"))
+		})
+	})
+	t.Run("rows of another tenant are not found by id", func(t *testing.T) {
+		asTenant(t, db, &acme, func(tx *sqlx.Tx) {
+			assert.Empty(t, names(t, tx, "SELECT name FROM employee WHERE name = 'globex-1'"))
+			result := tx.MustExec("DELETE FROM employee WHERE name = 'globex-1'")
+			rows, err := result.RowsAffected()
+			require.NoError(t, err)
+			assert.Zero(t, rows)
+		})
+	})
+	t.Run("without tenant setting nothing is visible", func(t *testing.T) {
+		asTenant(t, db, nil, func(tx *sqlx.Tx) {
+			assert.Empty(t, names(t, tx, "SELECT name FROM employee"))
+			assert.Empty(t, names(t, tx, "SELECT name FROM role"))
+		})
+	})
+	t.Run("super admin sees all tenants", func(t *testing.T) {
+		asTenant(t, db, &all, func(tx *sqlx.Tx) {
+			assert.Len(t, names(t, tx, "SELECT name FROM employee"), 3)
+		})
+	})
+	t.Run("insert into another tenant is rejected", func(t *testing.T) {
+		asTenant(t, db, &acme, func(tx *sqlx.Tx) {
+			_, err := tx.Exec("INSERT INTO employee (tenant_id, name) VALUES ('globex', 'intruder')")
+			assert.ErrorContains(t, err, "row-level security")
+		})
+	})
+	t.Run("api key is found across tenants only by key hash", func(t *testing.T) {
+		asTenant(t, db, nil, func(tx *sqlx.Tx) {
+			assert.Empty(t, names(t, tx, "SELECT name FROM service_account"))
+			assert.Equal(t, []string{"globex-ci"}, names(t, tx, "SELECT name FROM service_account_by_key_hash('globex-hash')"))
+			// после вызова функции арендатор транзакции прежний
+			assert.Empty(t, names(t, tx, "SELECT name FROM service_account"))
+		})
+		asTenant(t, db, &acme, func(tx *sqlx.Tx) {
+			assert.Equal(t, []string{"acme-ci"}, names(t, tx, "SELECT name FROM service_account"))
+			assert.Equal(t, []string{"globex-ci"}, names(t, tx, "SELECT name FROM service_account_by_key_hash('globex-hash')"))
+			assert.Empty(t, names(t, tx, "SELECT name FROM service_account_by_key_hash('unknown')"))
+		})
+	})
+	t.Run("setting does not leak to next transaction", func(t *testing.T) {
+		asTenant(t, db, &acme, func(tx *sqlx.Tx) {})
+		asTenant(t, db, nil, func(tx *sqlx.Tx) {
+			assert.Empty(t, names(t, tx, "SELECT name FROM employee"))
+		})
+	})
+}
@@ -0,0 +1,63 @@
+package tests
+
+import (
+	"context"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"idm/inner/common"
+	"idm/inner/database"
+	"idm/inner/employee"
+	Role "idm/inner/role"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestUniqueNames(t *testing.T) {
+	ctx := context.Background()
+	fx := NewFixture()
+	defer fx.Close()
+	roles := NewRoleFixture()
+	defer roles.Close()
+	fx.db.MustExec("DROP INDEX IF EXISTS employee_name_uidx; DROP INDEX IF EXISTS role_name_uidx;")
+	fx.ClearTable()
+	roles.ClearTable()
+
+	t.Run("migration stops on names differing only by case", func(t *testing.T) {
+		first := mustEmployee(t, fx, "Jane Roe")
+		second := mustEmployee(t, fx, "JANE ROE")
+		migration, err := os.ReadFile("../migrations/20261018170000_unique_names.sql")
+		require.NoError(t, err)
+		up, _, _ := strings.Cut(string(migration), "-- +goose Down")
+		_, err = fx.db.Exec(up)
+		assert.ErrorContains(t, err, fmt.Sprintf("employee %s: Jane Roe (id=%d), JANE ROE (id=%d)", common.DefaultTenant, first, second))
+		fx.ClearTable()
+	})
+	applyMigrationUp(t, fx.db, "20261018170000_unique_names.sql")
+
+	t.Run("employee name is unique ignoring case", func(t *testing.T) {
+		mustEmployee(t, fx, "John Doe")
+		err := fx.employees.WithTx(ctx, database.TxOptions{Tenant: testTenant}, func(ctx context.Context, tx *sqlx.Tx) error {
+			_, err := fx.employees.Add(ctx, tx, employee.Entity{TenantId: common.DefaultTenant, Name: "john doe"})
+			return err
+		})
+		var existsErr *common.AlreadyExistsError
+		assert.ErrorAs(t, err, &existsErr)
+	})
+	t.Run("same name is allowed in another tenant", func(t *testing.T) {
+		err := fx.employees.WithTx(ctx, database.TxOptions{Tenant: common.SingleTenant("globex")}, func(ctx context.Context, tx *sqlx.Tx) error {
+			_, err := fx.employees.Add(ctx, tx, employee.Entity{TenantId: "globex", Name: "John Doe"})
+			return err
+		})
+		assert.NoError(t, err)
+	})
+	t.Run("role name is unique ignoring case", func(t *testing.T) {
+		_, err := roles.Role("Admin")
+		require.NoError(t, err)
+		_, err = roles.repo.Add(ctx, Role.Entity{TenantId: common.DefaultTenant, Name: "ADMIN"})
+		var existsErr *common.AlreadyExistsError
+		assert.ErrorAs(t, err, &existsErr)
+	})
+}